@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/joho/godotenv"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+// report is the result printed by the CLI.
+type report struct {
+	Owner       string                  `json:"owner"`
+	Repo        string                  `json:"repo"`
+	Language    string                  `json:"language,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	FilesSent   int                     `json:"files_analyzed"`
+	TokensUsed  int                     `json:"tokens_used"`
+	Summary     *models.AnalysisSummary `json:"summary"`
+	Issues      []models.Issue          `json:"issues"`
+	RawAnalysis string                  `json:"raw_analysis"`
+}
+
+func main() {
+	// Load .env file if it exists, like the server does
+	_ = godotenv.Load()
+
+	repoFlag := flag.String("repo", "", "repository to analyze (https://github.com/owner/repo or owner/repo)")
+	token := flag.String("token", os.Getenv("GITHUB_TOKEN"), "GitHub token (defaults to $GITHUB_TOKEN)")
+	output := flag.String("output", "markdown", "output format: json or markdown")
+	maxFiles := flag.Int("max-files", models.DefaultMaxFiles, "number of source files to send for analysis")
+	flag.Parse()
+
+	if *repoFlag == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output != "json" && *output != "markdown" {
+		log.Fatalf("Unknown output format %q (want json or markdown)", *output)
+	}
+
+	apiKey := os.Getenv("PERPLEXITY_API_KEY")
+	if apiKey == "" {
+		log.Fatal("PERPLEXITY_API_KEY is required")
+	}
+
+	owner, repo, err := parseRepo(*repoFlag)
+	if err != nil {
+		log.Fatalf("Invalid repository %q: %v", *repoFlag, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	githubService := services.NewGitHubService(services.DefaultGitHubServiceConfig(getEnvOrDefault("GITHUB_API_BASE_URL", "https://api.github.com")))
+	perplexityService := services.NewPerplexityService(getEnvOrDefault("AI_BASE_URL", services.DefaultAIBaseURL), apiKey, getEnvOrDefault("PERPLEXITY_MODEL", "sonar"), nil, services.DefaultAIMaxRetries)
+
+	rep, err := run(ctx, githubService, perplexityService, owner, repo, *token, *maxFiles)
+	if err != nil {
+		log.Fatalf("Analysis failed: %v", err)
+	}
+
+	if *output == "json" {
+		err = writeJSON(os.Stdout, rep)
+	} else {
+		err = writeMarkdown(os.Stdout, rep)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+}
+
+// run performs the same fetch and analysis steps as the web pipeline,
+// without storing anything.
+func run(ctx context.Context, githubService *services.GitHubService, perplexityService *services.PerplexityService, owner, repo, token string, maxFiles int) (*report, error) {
+	repoInfo, err := githubService.GetRepository(ctx, owner, repo, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository: %w", err)
+	}
+
+	log.Printf("Fetching source code files for %s/%s", owner, repo)
+	codeFiles, skipped, codeStructure, err := githubService.GetRepositoryFiles(ctx, owner, repo, token, maxFiles, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch code files: %w", err)
+	}
+	for _, sf := range skipped {
+		log.Printf("Skipped %s (%s)", sf.Path, sf.Reason)
+	}
+
+	readme, readmeSize, _ := githubService.GetREADME(ctx, owner, repo, token)
+
+	log.Printf("Sending %d files to Perplexity AI (%s) for analysis", len(codeFiles), perplexityService.ModelFor(repoInfo.Language))
+	aiResult, err := perplexityService.Analyze(ctx, services.AnalysisInput{
+		RepoName:        repo,
+		RepoOwner:       owner,
+		Description:     repoInfo.Description,
+		PrimaryLanguage: repoInfo.Language,
+		README:          readme,
+		READMESize:      readmeSize,
+		CodeStructure:   codeStructure,
+		CodeFiles:       codeFiles,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("AI analysis failed: %w", err)
+	}
+
+	return &report{
+		Owner:       owner,
+		Repo:        repo,
+		Language:    repoInfo.Language,
+		Description: repoInfo.Description,
+		FilesSent:   len(codeFiles),
+		TokensUsed:  aiResult.TokensUsed,
+		Summary:     aiResult.Summary,
+		Issues:      aiResult.Issues,
+		RawAnalysis: aiResult.RawAnalysis,
+	}, nil
+}
+
+// parseRepo accepts either a GitHub URL or an owner/repo shorthand.
+func parseRepo(s string) (owner, repo string, err error) {
+	if owner, repo, err := models.ParseGitHubURL(s); err == nil {
+		return owner, repo, nil
+	}
+
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("expected a GitHub URL or owner/repo")
+	}
+	return parts[0], parts[1], nil
+}
+
+func writeJSON(w io.Writer, rep *report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func writeMarkdown(w io.Writer, rep *report) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Analysis of %s/%s\n\n", rep.Owner, rep.Repo)
+	if rep.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", rep.Description)
+	}
+	if rep.Language != "" {
+		fmt.Fprintf(&b, "- **Language:** %s\n", rep.Language)
+	}
+	fmt.Fprintf(&b, "- **Files analyzed:** %d\n", rep.FilesSent)
+	fmt.Fprintf(&b, "- **Tokens used:** %d\n", rep.TokensUsed)
+
+	if rep.Summary != nil {
+		fmt.Fprintf(&b, "- **Overall score:** %d/100\n", rep.Summary.OverallScore)
+		fmt.Fprintf(&b, "- **Total issues:** %d\n", rep.Summary.TotalIssues)
+
+		if len(rep.Summary.KeyFindings) > 0 {
+			b.WriteString("\n## Key Findings\n\n")
+			for _, finding := range rep.Summary.KeyFindings {
+				fmt.Fprintf(&b, "- %s\n", finding)
+			}
+		}
+	}
+
+	if len(rep.Issues) > 0 {
+		b.WriteString("\n## Issues\n")
+
+		issues := make([]models.Issue, len(rep.Issues))
+		copy(issues, rep.Issues)
+		models.SortIssuesBySeverity(issues)
+
+		for _, issue := range issues {
+			fmt.Fprintf(&b, "\n### [%s] %s\n\n", issue.Severity, issue.Title)
+			if issue.File != "" {
+				if issue.Line > 0 {
+					fmt.Fprintf(&b, "`%s:%d`\n\n", issue.File, issue.Line)
+				} else {
+					fmt.Fprintf(&b, "`%s`\n\n", issue.File)
+				}
+			}
+			if issue.Description != "" {
+				fmt.Fprintf(&b, "%s\n\n", issue.Description)
+			}
+			if issue.Suggestion != "" {
+				fmt.Fprintf(&b, "**Suggestion:** %s\n", issue.Suggestion)
+			}
+		}
+	} else if rep.RawAnalysis != "" {
+		// Fall back to the raw response when no structured issues were parsed
+		fmt.Fprintf(&b, "\n## Analysis\n\n%s\n", rep.RawAnalysis)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
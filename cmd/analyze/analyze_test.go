@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+const aiAnalysis = `## Issues
+
+[HIGH/security] SQL injection in the user lookup
+File: main.go:12
+Description: The query is built from user input.
+Suggestion: Use query placeholders.
+
+## Summary
+
+One serious issue.
+`
+
+func TestRunProducesReport(t *testing.T) {
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case path == "/repos/acme/app":
+			json.NewEncoder(w).Encode(services.GitHubRepository{Name: "app", FullName: "acme/app", DefaultBranch: "main", Language: "Go", Description: "An app"})
+		case path == "/repos/acme/app/commits/main":
+			fmt.Fprint(w, "abc123")
+		case path == "/repos/acme/app/git/trees/abc123":
+			fmt.Fprint(w, `{"sha": "abc123", "tree": [
+				{"path": "main.go", "type": "blob", "size": 40},
+				{"path": "db/query.go", "type": "blob", "size": 40}
+			]}`)
+		case strings.HasPrefix(path, "/repos/acme/app/contents/"):
+			fmt.Fprintf(w, "package main // %s", strings.TrimPrefix(path, "/repos/acme/app/contents/"))
+		case path == "/repos/acme/app/readme":
+			fmt.Fprint(w, "# app")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer github.Close()
+
+	var prompt string
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		prompt = string(body)
+		fmt.Fprintf(w, `{"usage": {"total_tokens": 42}, "choices": [{"message": {"content": %q}, "finish_reason": "stop"}]}`, aiAnalysis)
+	}))
+	defer ai.Close()
+
+	githubService := services.NewGitHubService(services.GitHubServiceConfig{BaseURL: github.URL})
+	perplexityService := services.NewPerplexityService(ai.URL, "key", "sonar", nil, 0)
+
+	rep, err := run(context.Background(), githubService, perplexityService, "acme", "app", "token", 10)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if rep.FilesSent != 2 || rep.TokensUsed != 42 || rep.Language != "Go" {
+		t.Errorf("report = %d files, %d tokens, language %q; want 2 files, 42 tokens, Go", rep.FilesSent, rep.TokensUsed, rep.Language)
+	}
+	if !strings.Contains(prompt, "package main // db/query.go") {
+		t.Error("the AI was not sent the fetched files")
+	}
+
+	var md bytes.Buffer
+	if err := writeMarkdown(&md, rep); err != nil {
+		t.Fatalf("writeMarkdown: %v", err)
+	}
+	for _, want := range []string{"# Analysis of acme/app", "- **Files analyzed:** 2", "### [HIGH] SQL injection in the user lookup", "`main.go:12`", "**Suggestion:** Use query placeholders."} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("markdown report lacks %q:\n%s", want, md.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeJSON(&out, rep); err != nil {
+		t.Fatalf("writeJSON: %v", err)
+	}
+	var decoded report
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode JSON report: %v", err)
+	}
+	found := false
+	for _, issue := range decoded.Issues {
+		if issue.Title == "SQL injection in the user lookup" && issue.File == "main.go" && issue.Line == 12 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("JSON report issues = %+v, want the SQL injection in main.go:12", decoded.Issues)
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -22,9 +24,13 @@ import (
 	"github.com/rahul4469/github-analyzer/internal/models"
 	"github.com/rahul4469/github-analyzer/internal/services"
 	"github.com/rahul4469/github-analyzer/internal/views"
+	"github.com/rahul4469/github-analyzer/migrations"
 )
 
 func main() {
+	migrationsStatus := flag.Bool("migrations-status", false, "print database migration status and exit")
+	flag.Parse()
+
 	// Load Configs
 	cfg, err := config.Load()
 	if err != nil {
@@ -40,13 +46,27 @@ func main() {
 
 	// DATABASE
 	ctx := context.Background()
-	db, err := models.NewDatabase(ctx, models.DefaultDatabaseConfig(cfg.Database.URL))
+	dbConfig := models.DefaultDatabaseConfig(cfg.Database.URL)
+	dbConfig.MaxConns = cfg.Database.MaxConns
+	dbConfig.MinConns = cfg.Database.MinConns
+	dbConfig.MaxConnLifetime = cfg.Database.MaxConnLifetime
+	dbConfig.MaxConnIdleTime = cfg.Database.MaxConnIdleTime
+	dbConfig.ConnectTimeout = cfg.Database.ConnectTimeout
+
+	db, err := models.NewDatabase(ctx, dbConfig)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 	log.Println("Connected to database")
 
+	if *migrationsStatus {
+		if err := printMigrationStatus(ctx, db); err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		return
+	}
+
 	// Run migrations automatically on startup
 	// log.Println("Running database migrations...")
 	// if err := models.Migrate(db.DB, "./migrations"); err != nil {
@@ -55,21 +75,67 @@ func main() {
 
 	// Initialize Template filesystem (OS filesystem for development)
 	views.TemplateFS = os.DirFS(".").(fs.ReadDirFS)
+	// Pick up template edits without a restart in development
+	views.AutoReload = cfg.IsDevelopment()
+	views.SignupsEnabled = cfg.Security.SignupsEnabled
+	if err := views.EnableUnsafeFuncs(cfg.Security.TemplateUnsafeFuncs...); err != nil {
+		log.Fatalf("Invalid TEMPLATE_UNSAFE_FUNCS: %v", err)
+	}
 
 	// Parse templates
 	templates := parseTemplates()
 
 	// SERVICES
 	userService := models.NewUserService(db.Pool, cfg.Security.BcryptCost)
-	sessionService := models.NewSessionService(db.Pool, cfg.Security.SessionDuration)
+	if cfg.Security.CheckEmailDomains {
+		userService.EnableEmailDomainCheck(net.DefaultResolver)
+	}
+	userService.SetPasswordPolicy(models.PasswordPolicy{
+		MinClasses:   cfg.Security.PasswordMinClasses,
+		RejectCommon: cfg.Security.PasswordRejectCommon,
+	})
+	sessionService := models.NewSessionService(db.Pool, cfg.Security.SessionDuration, cfg.Security.SessionIdle)
 	repositoryService := models.NewRepositoryService(db.Pool)
 	analysisService := models.NewAnalysisService(db.Pool)
+	inviteService := models.NewInviteService(db.Pool)
+	loginAttemptService := models.NewLoginAttemptService(db.Pool, models.LoginThrottle{
+		MaxFailures:      cfg.Security.LoginMaxFailures,
+		MaxFailuresPerIP: cfg.Security.LoginMaxFailuresPerIP,
+		Lockout:          cfg.Security.LoginLockout,
+	})
 
-	githubService := services.NewGitHubService(cfg.APIs.GitHubAPIBaseURL)
-	perplexityService := services.NewPerplexityService(cfg.APIs.PerplexityAPIKey, cfg.APIs.PerplexityModel)
+	githubService := services.NewGitHubService(services.GitHubServiceConfig{
+		BaseURL:             cfg.APIs.GitHubAPIBaseURL,
+		HTTPTimeout:         cfg.APIs.GitHubHTTPTimeout,
+		MaxIdleConnsPerHost: cfg.APIs.GitHubMaxIdleConnsPerHost,
+		Timeouts: services.GitHubTimeouts{
+			Metadata: cfg.APIs.GitHubMetadataTimeout,
+			Tree:     cfg.APIs.GitHubTreeTimeout,
+			File:     cfg.APIs.GitHubFileTimeout,
+			README:   cfg.APIs.GitHubREADMETimeout,
+		},
+		MaxREADMEBytes:      cfg.APIs.GitHubREADMEMaxBytes,
+		MaxFilesPerLanguage: cfg.APIs.GitHubMaxFilesPerLanguage,
+		ExcludedLanguages:   cfg.APIs.GitHubExcludedLanguages,
+	})
+	perplexityService := services.NewPerplexityService(cfg.APIs.AIBaseURL, cfg.APIs.PerplexityAPIKey, cfg.APIs.PerplexityModel, cfg.APIs.PerplexityLanguageModels, cfg.APIs.PerplexityMaxRetries)
+	perplexityService.SetPrompts(cfg.APIs.AISystemPrompt, cfg.APIs.AIPromptTemplate)
+	perplexityService.SetTokenBudget(cfg.APIs.AIMaxTokens, cfg.APIs.AIRetryMaxTokens)
+	if err := perplexityService.SetIssueCaps(cfg.APIs.AIMaxIssuesPerSeverity); err != nil {
+		log.Fatalf("Invalid AI_MAX_ISSUES_PER_SEVERITY: %v", err)
+	}
+	if err := perplexityService.SetMaxKeyFindings(cfg.APIs.AIMaxKeyFindings); err != nil {
+		log.Fatalf("Invalid AI_MAX_KEY_FINDINGS: %v", err)
+	}
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(sessionService, cfg.Security.SessionCookieName)
+	authMiddleware := middleware.NewAuthMiddleware(sessionService, cfg.Security.SessionCookieName, cfg.Security.CookieDomain)
+	sessionCookie := controllers.CookieOptions{
+		Name:     cfg.Security.SessionCookieName,
+		Domain:   cfg.Security.CookieDomain,
+		Secure:   cfg.Security.SecureCookies,
+		SameSite: cfg.Security.CookieSameSite,
+	}
 
 	// CONTROLLERS
 	staticController := controllers.NewStaticController(controllers.StaticTemplates{
@@ -83,11 +149,15 @@ func main() {
 			SignUp: templates.signUp,
 			SignIn: templates.signIn,
 		},
-		cfg.Security.SessionCookieName,
-		cfg.Security.SecureCookies,
+		sessionCookie,
 		cfg.Security.SessionDuration,
 		cfg.Limits.DefaultUserQuota,
+		cfg.Security.SignupsEnabled,
 	)
+	if cfg.Security.InviteRequired {
+		authController.RequireInviteCodes(inviteService)
+	}
+	authController.ThrottleLogins(loginAttemptService)
 
 	dashboardController := controllers.NewDashboardController(
 		analysisService,
@@ -95,6 +165,8 @@ func main() {
 		templates.dashboard,
 	)
 
+	issuesController := controllers.NewIssuesController(analysisService, templates.issues)
+
 	analyzeController := controllers.NewAnalyzeController(
 		analysisService,
 		repositoryService,
@@ -103,10 +175,44 @@ func main() {
 		perplexityService,
 		encryptor,
 		controllers.AnalyzeTemplates{
-			Form:   templates.analyze,
-			Result: templates.result,
+			Form:    templates.analyze,
+			Result:  templates.result,
+			Compare: templates.compare,
+		},
+		controllers.AnalyzeConfig{
+			MaxReposPerUser:     cfg.Limits.MaxReposPerUser,
+			QueueSize:           cfg.Analysis.QueueSize,
+			MaxQueueDepth:       cfg.Analysis.MaxQueueDepth,
+			DedupWindow:         cfg.Analysis.DedupWindow,
+			RedactSecrets:       cfg.Analysis.RedactSecrets,
+			StoreFileHashesOnly: cfg.Analysis.StoreFileHashesOnly,
+			CacheResults:        cfg.Analysis.CacheResults,
+			CountPullRequests:   cfg.Analysis.CountPullRequests,
+			MaxInFlightPerUser:  cfg.Analysis.MaxInFlightPerUser,
+			MaxRepoSizeKB:       cfg.Analysis.MaxRepoSizeKB,
+			RateLimitMaxWait:    cfg.Analysis.RateLimitMaxWait,
+			CaptureAIExchange:   cfg.Analysis.CaptureAIExchange,
+			AppGitHubToken:      cfg.APIs.GitHubAppToken,
+			BaseURL:             cfg.Server.BaseURL,
 		},
 	)
+	if cfg.APIs.GitHubAppID > 0 {
+		githubApp, err := services.NewGitHubAppAuth(githubService, services.GitHubAppConfig{
+			AppID:         cfg.APIs.GitHubAppID,
+			PrivateKeyPEM: []byte(cfg.APIs.GitHubAppPrivateKey),
+			Installations: cfg.APIs.GitHubAppInstallations,
+		})
+		if err != nil {
+			log.Fatalf("Invalid GitHub App configuration: %v", err)
+		}
+		analyzeController.UseGitHubApp(githubApp)
+	}
+
+	adminController := controllers.NewAdminController(db, migrations.FS, inviteService)
+
+	billingController := controllers.NewBillingController(userService)
+
+	settingsController := controllers.NewSettingsController(userService)
 
 	oauthController := controllers.NewOAuthController(
 		userService,
@@ -117,19 +223,25 @@ func main() {
 			ClientSecret: cfg.GitHubOAuth.ClientSecret,
 			RedirectURL:  cfg.GitHubOAuth.RedirectURL,
 			Scopes:       cfg.GitHubOAuth.Scopes,
+			APIBaseURL:   cfg.APIs.GitHubAPIBaseURL,
+			APITimeout:   cfg.GitHubOAuth.APITimeout,
 		},
-		cfg.Security.SessionCookieName,
-		cfg.Security.SecureCookies,
+		sessionCookie,
 		cfg.Security.SessionDuration,
 	)
 
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Security.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Setup Router
 	r := chi.NewRouter()
 
 	// Global middleware
+	r.Use(middleware.RealIP(trustedProxies))
 	r.Use(chimiddleware.Logger)
 	r.Use(chimiddleware.Recoverer)
-	r.Use(chimiddleware.RealIP)
 	r.Use(chimiddleware.Timeout(60 * time.Second))
 
 	// CSRF protection
@@ -137,9 +249,19 @@ func main() {
 		[]byte(cfg.Security.CSRFSecret),
 		csrf.Secure(cfg.Security.SecureCookies),
 		csrf.Path("/"),
-		csrf.SameSite(csrf.SameSiteLaxMode),
+		csrf.SameSite(csrfSameSite(cfg.Security.CookieSameSite)),
+		csrf.Domain(cfg.Security.CookieDomain),
 		csrf.TrustedOrigins([]string{"localhost:3000", "127.0.0.1:3000"}),
+		csrf.ErrorHandler(http.HandlerFunc(middleware.CSRFFailure)),
 	)
+	// GitHub webhooks are verified by their HMAC signature instead, and the
+	// billing service by its bearer token
+	r.Use(middleware.SkipCSRF("/api/v1/github/webhook", "/api/v1/billing/quota"))
+	// The CSRF check parses form bodies to find its token, so cap them first
+	r.Use(middleware.LimitBody(cfg.Limits.MaxRequestBodyBytes, map[string]int64{
+		"/analyze/upload":        controllers.MaxUploadBytes,
+		"/api/v1/github/webhook": controllers.MaxWebhookBodyBytes,
+	}))
 	r.Use(csrfMiddleware)
 
 	// Auth middleware (loads user from session)
@@ -158,6 +280,9 @@ func main() {
 	r.Get("/auth/github/login", oauthController.GitHubLogin)
 	r.Get("/auth/github/callback", oauthController.GitHubCallback)
 
+	// GitHub push webhooks (public - signed per repository)
+	r.Post("/api/v1/github/webhook", analyzeController.PostGitHubWebhook)
+
 	// Auth routes (accessible only when "not" logged in)
 	r.Group(func(r chi.Router) {
 		r.Use(authMiddleware.RequireNoUser)
@@ -175,6 +300,7 @@ func main() {
 		r.Use(authMiddleware.RequireUser)
 
 		r.Get("/dashboard", dashboardController.GetDashboard)
+		r.Get("/issues", issuesController.GetIssues)
 
 		// GitHub connection management
 		r.Get("/auth/github/connect", oauthController.GitHubConnect)
@@ -182,14 +308,76 @@ func main() {
 
 		r.Get("/analyze", analyzeController.GetAnalyze)
 		r.Post("/analyze", analyzeController.PostAnalyze)
+		r.Post("/analyze/upload", analyzeController.PostUpload)
+		r.Post("/analyze/compare", analyzeController.PostCompare)
 		r.Get("/analyze/{id}", analyzeController.GetResult)
+		r.Get("/analyze/{id}/compare", analyzeController.GetCompare)
+		r.Get("/analyze/{id}/tree", analyzeController.GetTree)
+		r.Get("/analyze/{id}/languages", analyzeController.GetLanguages)
+		r.Get("/analyze/{id}/files.zip", analyzeController.GetFilesArchive)
+		r.Get("/analyze/{id}/export.sarif", analyzeController.GetSARIFExport)
+		r.Get("/analyze/{id}/issues/{issueID}/as-github-issue", analyzeController.GetGitHubIssueDraft)
+		r.Post("/analyze/{id}/issues/{issueID}/file", analyzeController.PostFileGitHubIssue)
+		r.Post("/analyze/{id}/issues/{issueID}/resolve", analyzeController.PostResolveIssue)
+		r.Post("/analyze/{id}/note", analyzeController.PostNote)
+		r.Post("/analyze/{id}/cancel", analyzeController.PostCancel)
 		r.Post("/analyze/{id}/delete", analyzeController.DeleteAnalysis)
+
+		r.Get("/api/v1/analyses/preview", analyzeController.GetPreview)
+		r.Get("/api/v1/analyses/{id}", analyzeController.GetAnalysisJSON)
+		r.Get("/api/v1/analyses/{id}/drift", analyzeController.GetAnalysisDrift)
+		r.Post("/api/v1/analyses/batch", analyzeController.PostBatch)
+		r.Post("/api/v1/repositories/{id}/webhook", analyzeController.PostWebhookSecret)
+		r.Get("/api/v1/settings/preferences", settingsController.GetPreferences)
+		r.Put("/api/v1/settings/preferences", settingsController.PutPreferences)
+	})
+
+	// Admin API (operators listed in ADMIN_EMAILS)
+	r.Route("/api/v1/admin", func(r chi.Router) {
+		r.Use(authMiddleware.RequireUser)
+		r.Use(middleware.RequireAdmin(cfg.Security.AdminEmails))
+
+		r.Get("/migrations", adminController.GetMigrations)
+		r.Get("/metrics", adminController.GetMetrics)
+		r.Post("/invites", adminController.PostInvite)
+	})
+
+	// Billing API (billing service, authenticated by BILLING_API_TOKEN)
+	r.Route("/api/v1/billing", func(r chi.Router) {
+		r.Use(middleware.RequireBearerToken(cfg.Security.BillingAPIToken))
+
+		r.Post("/quota", billingController.PostQuota)
 	})
 
 	// Start session cleanup routine
 	stopCleanup := sessionService.StartCleanupRoutine(1 * time.Hour)
 	defer close(stopCleanup)
 
+	// Fail analyses left in processing by a crash or restart
+	stopReconciler := analysisService.StartStaleReconciler(cfg.Analysis.ReconcileInterval, cfg.Analysis.StaleAfter)
+	defer close(stopReconciler)
+
+	// Drop login attempts past the lockout window, and stored source files
+	// of old analyses, keeping their results
+	pruners := []models.Pruner{loginAttemptService.Pruner()}
+	if cfg.Analysis.FileRetention > 0 {
+		pruners = append(pruners, analysisService.FilePruner(cfg.Analysis.FileRetention))
+	}
+	stopPruner := models.StartPruners(24*time.Hour, pruners...)
+	defer close(stopPruner)
+
+	// Keep stars/forks of recently analyzed repositories current
+	if cfg.Analysis.RepoRefreshInterval > 0 {
+		refresher := services.NewRepositoryRefresher(repositoryService, githubService, encryptor,
+			cfg.Analysis.RepoRefreshInterval, cfg.Analysis.RepoRefreshLookback)
+		stopRefresher := refresher.Start()
+		defer close(stopRefresher)
+	}
+
+	// Run queued analyses in the background
+	stopWorkers := analyzeController.StartWorkers(cfg.Analysis.Workers)
+	defer close(stopWorkers)
+
 	// Create Server
 	server := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
@@ -234,6 +422,8 @@ type appTemplates struct {
 	dashboard *views.Template
 	analyze   *views.Template
 	result    *views.Template
+	compare   *views.Template
+	issues    *views.Template
 }
 
 func parseTemplates() *appTemplates {
@@ -251,5 +441,41 @@ func parseTemplates() *appTemplates {
 		dashboard: mustParse("pages/dashboard.gohtml"),
 		analyze:   mustParse("pages/analyze.gohtml"),
 		result:    mustParse("pages/result.gohtml"),
+		compare:   mustParse("pages/compare.gohtml"),
+		issues:    mustParse("pages/issues.gohtml"),
+	}
+}
+
+// printMigrationStatus writes applied/pending migrations to stdout.
+func printMigrationStatus(ctx context.Context, db *models.Database) error {
+	statuses, err := models.MigrationStatus(ctx, db.DB, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range statuses {
+		state := "pending"
+		appliedAt := ""
+		if m.Applied {
+			state = "applied"
+			if m.AppliedAt != nil {
+				appliedAt = m.AppliedAt.Format(time.RFC3339)
+			}
+		}
+		fmt.Printf("%-8s %-40s %-8s %s\n", fmt.Sprintf("%05d", m.Version), m.Source, state, appliedAt)
+	}
+	return nil
+}
+
+// csrfSameSite maps a cookie SameSite setting to gorilla/csrf's equivalent,
+// so the CSRF cookie follows COOKIE_SAMESITE like the session cookie.
+func csrfSameSite(mode http.SameSite) csrf.SameSiteMode {
+	switch mode {
+	case http.SameSiteStrictMode:
+		return csrf.SameSiteStrictMode
+	case http.SameSiteNoneMode:
+		return csrf.SameSiteNoneMode
+	default:
+		return csrf.SameSiteLaxMode
 	}
 }
@@ -3,11 +3,15 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/rahul4469/github-analyzer/internal/services"
 )
 
 type Config struct {
@@ -28,6 +32,9 @@ type Config struct {
 
 	// feature flags and limits
 	Limits LimitsConfig
+
+	// analysis pipeline settings
+	Analysis AnalysisConfig
 }
 
 // ServerConfig holds HTTP server configuration.
@@ -39,7 +46,12 @@ type ServerConfig struct {
 
 // DatabaseConfig holds PostgreSQL connection settings.
 type DatabaseConfig struct {
-	URL string
+	URL             string
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	ConnectTimeout  time.Duration // how long startup retries an unreachable database; 0 tries once
 }
 
 // SecurityConfig holds security-related settings.
@@ -47,9 +59,31 @@ type SecurityConfig struct {
 	CSRFSecret        string
 	SessionCookieName string
 	SessionDuration   time.Duration
+	SessionIdle       time.Duration // 0 disables idle expiry
 	BcryptCost        int
-	SecureCookies     bool   // true in production
-	EncryptionKey     string // 32-byte key for AES-256 encryption
+	SecureCookies     bool // defaults to true in production
+	CookieSameSite    http.SameSite
+	CookieDomain      string   // empty scopes cookies to the request host
+	EncryptionKey     string   // 32-byte key for AES-256 encryption
+	AdminEmails       []string // users allowed on /api/v1/admin routes
+	BillingAPIToken   string   // bearer token for /api/v1/billing routes; empty disables them
+	TrustedProxies    []string // IPs/CIDRs whose X-Forwarded-For and X-Real-IP headers are honored
+	CheckEmailDomains bool     // reject signups whose email domain has no DNS records
+	SignupsEnabled    bool     // false closes /signup to new users
+	InviteRequired    bool     // signups must present an unused invite code
+
+	// Password policy on top of the 8 character minimum
+	PasswordMinClasses   int  // of lowercase, uppercase, digits and symbols (0-4)
+	PasswordRejectCommon bool // reject well-known passwords like "password1"
+
+	// Sign-in lockout after repeated failures; 0 disables a limit
+	LoginMaxFailures      int           // failures in a row per account
+	LoginMaxFailuresPerIP int           // failures per client IP across accounts
+	LoginLockout          time.Duration // window failures are counted over
+
+	// Template functions that bypass HTML escaping (safeHTML, safeURL,
+	// safeCSS, safeJS); none are available unless listed
+	TemplateUnsafeFuncs []string
 }
 
 // APIConfig holds external API configuration.
@@ -57,6 +91,61 @@ type APIConfig struct {
 	PerplexityAPIKey string
 	PerplexityModel  string
 	GitHubAPIBaseURL string
+
+	// App-level token for analyzing public repositories without a
+	// connected account; empty requires users to connect GitHub
+	GitHubAppToken string
+
+	// GitHub App used for the repositories of owners it is installed on;
+	// GitHubAppID 0 disables it
+	GitHubAppID            int64
+	GitHubAppPrivateKey    string
+	GitHubAppInstallations map[string]int64 // owner -> installation id
+
+	// Base URL of the AI API, e.g. an OpenAI-compatible gateway
+	AIBaseURL string
+
+	// Preferred model per primary language, e.g. {"rust": "sonar-pro"}
+	PerplexityLanguageModels map[string]string
+
+	// Times a rate limited (429) Perplexity request is retried
+	PerplexityMaxRetries int
+
+	// Completion token limit per AI request, 0 for the API default, and the
+	// limit a response truncated by it is retried with, 0 for no retry
+	AIMaxTokens      int
+	AIRetryMaxTokens int
+
+	// Most issues of each severity stored per analysis (severity=count);
+	// the rest are only counted in the summary
+	AIMaxIssuesPerSeverity map[string]int
+
+	// Most key findings kept in an analysis summary
+	AIMaxKeyFindings int
+
+	// Prompt overrides read from AI_SYSTEM_PROMPT_FILE and
+	// AI_PROMPT_TEMPLATE_FILE; empty keeps the built-in prompt
+	AISystemPrompt   string
+	AIPromptTemplate string
+
+	// GitHub request deadlines
+	GitHubHTTPTimeout     time.Duration
+	GitHubMetadataTimeout time.Duration
+	GitHubTreeTimeout     time.Duration
+	GitHubFileTimeout     time.Duration
+	GitHubREADMETimeout   time.Duration
+
+	// Largest README (bytes) sent for analysis; longer ones are truncated
+	GitHubREADMEMaxBytes int
+
+	// Keep-alive connections pooled per GitHub host
+	GitHubMaxIdleConnsPerHost int
+
+	// Most files of one language selected for analysis (0 = no cap)
+	GitHubMaxFilesPerLanguage int
+
+	// Languages or extensions never analyzed, for every user
+	GitHubExcludedLanguages []string
 }
 
 // GitHubOAuthConfig holds GitHub OAuth2 settings.
@@ -65,12 +154,59 @@ type GitHubOAuthConfig struct {
 	ClientSecret string
 	RedirectURL  string
 	Scopes       []string
+
+	// Deadline for each GitHub user/email lookup during the callback
+	APITimeout time.Duration
 }
 
 // LimitsConfig holds rate limiting and quota settings.
 type LimitsConfig struct {
 	DefaultUserQuota int
 	MaxReposPerUser  int
+	// Largest request body accepted outside of uploads and webhooks, which
+	// have their own limits
+	MaxRequestBodyBytes int64
+}
+
+// AnalysisConfig holds settings for the analysis pipeline.
+type AnalysisConfig struct {
+	// Processing analyses older than this are considered abandoned
+	StaleAfter time.Duration
+	// How often to look for abandoned analyses
+	ReconcileInterval time.Duration
+	// Background workers running queued analyses
+	Workers int
+	// Queued analyses held before new ones are rejected
+	QueueSize int
+	// Pending analyses, across all users, before queued ones are rejected
+	// (0 = only QueueSize applies)
+	MaxQueueDepth int
+	// Reuse an in-flight analysis of the same repo created within this window
+	DedupWindow time.Duration
+	// Mask detected secrets in fetched files before storing them or sending them to the AI
+	RedactSecrets bool
+	// Most analyses one user may have pending or processing (0 = unlimited)
+	MaxInFlightPerUser int
+	// Largest repository size in KB that may be analyzed (0 = unlimited)
+	MaxRepoSizeKB int
+	// Longest wait for a GitHub rate limit reset when too few requests are
+	// left for an analysis; sooner resets are waited out, later ones fail
+	// fast (0 disables the check)
+	RateLimitMaxWait time.Duration
+	// How often stored repository metadata is refreshed (0 disables it)
+	RepoRefreshInterval time.Duration
+	// Only repositories analyzed within this window are refreshed
+	RepoRefreshLookback time.Duration
+	// Stored source files of analyses older than this are dropped (0 keeps them)
+	FileRetention time.Duration
+	// Store only hashes of analyzed files, not their contents
+	StoreFileHashesOnly bool
+	// Reuse the result of the user's earlier analysis of identical AI input
+	CacheResults bool
+	// Count open pull requests apart from issues with the search API
+	CountPullRequests bool
+	// Store the raw AI request and response on each analysis (debugging only)
+	CaptureAIExchange bool
 }
 
 // IsDevelopment returns true if running in development mode.
@@ -99,8 +235,38 @@ func Load() (*Config, error) {
 	}
 
 	// Load database configuration
+	maxConns, err := strconv.Atoi(getEnvOrDefault("DB_MAX_CONNS", "25"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_MAX_CONNS: %w", err)
+	}
+
+	minConns, err := strconv.Atoi(getEnvOrDefault("DB_MIN_CONNS", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_MIN_CONNS: %w", err)
+	}
+
+	connLifetimeMins, err := strconv.Atoi(getEnvOrDefault("DB_MAX_CONN_LIFETIME_MINUTES", "60"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_MAX_CONN_LIFETIME_MINUTES: %w", err)
+	}
+
+	connIdleMins, err := strconv.Atoi(getEnvOrDefault("DB_MAX_CONN_IDLE_MINUTES", "30"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_MAX_CONN_IDLE_MINUTES: %w", err)
+	}
+
+	connectSecs, err := strconv.Atoi(getEnvOrDefault("DB_CONNECT_TIMEOUT_SECONDS", "60"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_CONNECT_TIMEOUT_SECONDS: %w", err)
+	}
+
 	cfg.Database = DatabaseConfig{
-		URL: os.Getenv("DATABASE_URL"),
+		URL:             os.Getenv("DATABASE_URL"),
+		MaxConns:        int32(maxConns),
+		MinConns:        int32(minConns),
+		MaxConnLifetime: time.Duration(connLifetimeMins) * time.Minute,
+		MaxConnIdleTime: time.Duration(connIdleMins) * time.Minute,
+		ConnectTimeout:  time.Duration(connectSecs) * time.Second,
 	}
 
 	// Load security configuration
@@ -109,33 +275,233 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid SESSION_DURATION_HOURS: %w", err)
 	}
 
+	sessionIdleMins, err := strconv.Atoi(getEnvOrDefault("SESSION_IDLE_TIMEOUT_MINUTES", "120"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SESSION_IDLE_TIMEOUT_MINUTES: %w", err)
+	}
+
 	bcryptCost, err := strconv.Atoi(getEnvOrDefault("BCRYPT_COST", "12"))
 	if err != nil {
 		return nil, fmt.Errorf("invalid BCRYPT_COST: %w", err)
 	}
 
+	checkEmailDomains, err := strconv.ParseBool(getEnvOrDefault("SIGNUP_CHECK_EMAIL_DOMAIN", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNUP_CHECK_EMAIL_DOMAIN: %w", err)
+	}
+
+	signupsEnabled, err := strconv.ParseBool(getEnvOrDefault("SIGNUPS_ENABLED", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNUPS_ENABLED: %w", err)
+	}
+
+	inviteRequired, err := strconv.ParseBool(getEnvOrDefault("SIGNUP_INVITE_REQUIRED", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNUP_INVITE_REQUIRED: %w", err)
+	}
+
+	passwordMinClasses, err := strconv.Atoi(getEnvOrDefault("PASSWORD_MIN_CLASSES", "2"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PASSWORD_MIN_CLASSES: %w", err)
+	}
+
+	passwordRejectCommon, err := strconv.ParseBool(getEnvOrDefault("PASSWORD_REJECT_COMMON", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PASSWORD_REJECT_COMMON: %w", err)
+	}
+
+	loginMaxFailures, err := strconv.Atoi(getEnvOrDefault("LOGIN_MAX_FAILURES", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_MAX_FAILURES: %w", err)
+	}
+
+	loginMaxFailuresPerIP, err := strconv.Atoi(getEnvOrDefault("LOGIN_MAX_FAILURES_PER_IP", "20"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_MAX_FAILURES_PER_IP: %w", err)
+	}
+
+	loginLockoutMins, err := strconv.Atoi(getEnvOrDefault("LOGIN_LOCKOUT_MINUTES", "15"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_MINUTES: %w", err)
+	}
+
+	secureCookies, err := strconv.ParseBool(getEnvOrDefault("COOKIE_SECURE", strconv.FormatBool(cfg.Server.Environment == "production")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid COOKIE_SECURE: %w", err)
+	}
+
+	cookieSameSite, err := ParseSameSite(getEnvOrDefault("COOKIE_SAMESITE", "lax"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid COOKIE_SAMESITE: %w", err)
+	}
+
 	cfg.Security = SecurityConfig{
 		CSRFSecret:        os.Getenv("CSRF_SECRET"),
 		SessionCookieName: getEnvOrDefault("SESSION_COOKIE_NAME", "github_analyzer_session"),
 		SessionDuration:   time.Duration(sessionHours) * time.Hour,
+		SessionIdle:       time.Duration(sessionIdleMins) * time.Minute,
 		BcryptCost:        bcryptCost,
-		SecureCookies:     cfg.Server.Environment == "production",
+		SecureCookies:     secureCookies,
+		CookieSameSite:    cookieSameSite,
+		CookieDomain:      os.Getenv("COOKIE_DOMAIN"),
 		EncryptionKey:     os.Getenv("ENCRYPTION_KEY"),
+		AdminEmails:       getEnvList("ADMIN_EMAILS"),
+		BillingAPIToken:   os.Getenv("BILLING_API_TOKEN"),
+		TrustedProxies:    getEnvList("TRUSTED_PROXIES"),
+		CheckEmailDomains: checkEmailDomains,
+		SignupsEnabled:    signupsEnabled,
+		InviteRequired:    inviteRequired,
+
+		PasswordMinClasses:   passwordMinClasses,
+		PasswordRejectCommon: passwordRejectCommon,
+
+		LoginMaxFailures:      loginMaxFailures,
+		LoginMaxFailuresPerIP: loginMaxFailuresPerIP,
+		LoginLockout:          time.Duration(loginLockoutMins) * time.Minute,
+
+		TemplateUnsafeFuncs: getEnvList("TEMPLATE_UNSAFE_FUNCS"),
 	}
 
 	// Load API configuration
+	githubHTTPSecs, err := strconv.Atoi(getEnvOrDefault("GITHUB_HTTP_TIMEOUT_SECONDS", "60"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_HTTP_TIMEOUT_SECONDS: %w", err)
+	}
+
+	githubMetadataSecs, err := strconv.Atoi(getEnvOrDefault("GITHUB_METADATA_TIMEOUT_SECONDS", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_METADATA_TIMEOUT_SECONDS: %w", err)
+	}
+
+	githubTreeSecs, err := strconv.Atoi(getEnvOrDefault("GITHUB_TREE_TIMEOUT_SECONDS", "45"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_TREE_TIMEOUT_SECONDS: %w", err)
+	}
+
+	githubFileSecs, err := strconv.Atoi(getEnvOrDefault("GITHUB_FILE_TIMEOUT_SECONDS", "15"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_FILE_TIMEOUT_SECONDS: %w", err)
+	}
+
+	githubREADMESecs, err := strconv.Atoi(getEnvOrDefault("GITHUB_README_TIMEOUT_SECONDS", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_README_TIMEOUT_SECONDS: %w", err)
+	}
+
+	githubREADMEMaxBytes, err := strconv.Atoi(getEnvOrDefault("GITHUB_README_MAX_BYTES", "2000"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_README_MAX_BYTES: %w", err)
+	}
+
+	githubMaxIdleConns, err := strconv.Atoi(getEnvOrDefault("GITHUB_MAX_IDLE_CONNS_PER_HOST", "16"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_MAX_IDLE_CONNS_PER_HOST: %w", err)
+	}
+
+	githubMaxPerLanguage, err := strconv.Atoi(getEnvOrDefault("GITHUB_MAX_FILES_PER_LANGUAGE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_MAX_FILES_PER_LANGUAGE: %w", err)
+	}
+
+	languageModels, err := getEnvMap("PERPLEXITY_LANGUAGE_MODELS")
+	if err != nil {
+		return nil, fmt.Errorf("invalid PERPLEXITY_LANGUAGE_MODELS: %w", err)
+	}
+
+	perplexityMaxRetries, err := strconv.Atoi(getEnvOrDefault("PERPLEXITY_MAX_RETRIES", "2"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PERPLEXITY_MAX_RETRIES: %w", err)
+	}
+
+	aiMaxTokens, err := strconv.Atoi(getEnvOrDefault("AI_MAX_TOKENS", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI_MAX_TOKENS: %w", err)
+	}
+
+	aiRetryMaxTokens, err := strconv.Atoi(getEnvOrDefault("AI_RETRY_MAX_TOKENS", "8192"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI_RETRY_MAX_TOKENS: %w", err)
+	}
+
+	issueCaps, err := getEnvInt64Map("AI_MAX_ISSUES_PER_SEVERITY")
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI_MAX_ISSUES_PER_SEVERITY: %w", err)
+	}
+	aiMaxIssues := make(map[string]int, len(issueCaps))
+	for sev, n := range issueCaps {
+		aiMaxIssues[sev] = int(n)
+	}
+
+	aiMaxKeyFindings, err := strconv.Atoi(getEnvOrDefault("AI_MAX_KEY_FINDINGS", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI_MAX_KEY_FINDINGS: %w", err)
+	}
+
+	aiSystemPrompt, err := readOptionalFile(os.Getenv("AI_SYSTEM_PROMPT_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI_SYSTEM_PROMPT_FILE: %w", err)
+	}
+
+	aiPromptTemplate, err := readOptionalFile(os.Getenv("AI_PROMPT_TEMPLATE_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI_PROMPT_TEMPLATE_FILE: %w", err)
+	}
+
+	githubAppID, err := strconv.ParseInt(getEnvOrDefault("GITHUB_APP_ID", "0"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_ID: %w", err)
+	}
+
+	githubAppPrivateKey, err := readOptionalFile(os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_PRIVATE_KEY_FILE: %w", err)
+	}
+
+	githubAppInstallations, err := getEnvInt64Map("GITHUB_APP_INSTALLATIONS")
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_APP_INSTALLATIONS: %w", err)
+	}
+
 	cfg.APIs = APIConfig{
-		PerplexityAPIKey: os.Getenv("PERPLEXITY_API_KEY"),
-		PerplexityModel:  getEnvOrDefault("PERPLEXITY_MODEL", "sonar"),
-		GitHubAPIBaseURL: getEnvOrDefault("GITHUB_API_BASE_URL", "https://api.github.com"),
+		PerplexityAPIKey:          os.Getenv("PERPLEXITY_API_KEY"),
+		PerplexityModel:           getEnvOrDefault("PERPLEXITY_MODEL", "sonar"),
+		PerplexityLanguageModels:  languageModels,
+		PerplexityMaxRetries:      perplexityMaxRetries,
+		AIMaxTokens:               aiMaxTokens,
+		AIRetryMaxTokens:          aiRetryMaxTokens,
+		AIMaxIssuesPerSeverity:    aiMaxIssues,
+		AIMaxKeyFindings:          aiMaxKeyFindings,
+		AISystemPrompt:            aiSystemPrompt,
+		AIPromptTemplate:          aiPromptTemplate,
+		GitHubAPIBaseURL:          getEnvOrDefault("GITHUB_API_BASE_URL", "https://api.github.com"),
+		GitHubAppToken:            os.Getenv("GITHUB_APP_TOKEN"),
+		GitHubAppID:               githubAppID,
+		GitHubAppPrivateKey:       githubAppPrivateKey,
+		GitHubAppInstallations:    githubAppInstallations,
+		AIBaseURL:                 getEnvOrDefault("AI_BASE_URL", "https://api.perplexity.ai"),
+		GitHubHTTPTimeout:         time.Duration(githubHTTPSecs) * time.Second,
+		GitHubMetadataTimeout:     time.Duration(githubMetadataSecs) * time.Second,
+		GitHubTreeTimeout:         time.Duration(githubTreeSecs) * time.Second,
+		GitHubFileTimeout:         time.Duration(githubFileSecs) * time.Second,
+		GitHubREADMETimeout:       time.Duration(githubREADMESecs) * time.Second,
+		GitHubREADMEMaxBytes:      githubREADMEMaxBytes,
+		GitHubMaxIdleConnsPerHost: githubMaxIdleConns,
+		GitHubMaxFilesPerLanguage: githubMaxPerLanguage,
+		GitHubExcludedLanguages:   getEnvList("GITHUB_EXCLUDED_LANGUAGES"),
+	}
+
+	oauthAPISecs, err := strconv.Atoi(getEnvOrDefault("GITHUB_OAUTH_TIMEOUT_SECONDS", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_OAUTH_TIMEOUT_SECONDS: %w", err)
 	}
 
 	// Load GitHub OAuth configuration
 	cfg.GitHubOAuth = GitHubOAuthConfig{
 		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
 		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
-		RedirectURL:  getEnvOrDefault("GITHUB_REDIRECT_URL", cfg.Server.BaseURL+"/auth/github/callback"),
+		RedirectURL:  strings.TrimSpace(getEnvOrDefault("GITHUB_REDIRECT_URL", strings.TrimRight(cfg.Server.BaseURL, "/")+"/auth/github/callback")),
 		Scopes:       []string{"repo", "read:user", "user:email"},
+		APITimeout:   time.Duration(oauthAPISecs) * time.Second,
 	}
 
 	// Load limits configuration
@@ -149,9 +515,121 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid MAX_REPOS_PER_USER: %w", err)
 	}
 
+	maxBodyKB, err := strconv.Atoi(getEnvOrDefault("MAX_REQUEST_BODY_KB", "1024"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAX_REQUEST_BODY_KB: %w", err)
+	}
+
 	cfg.Limits = LimitsConfig{
-		DefaultUserQuota: defaultQuota,
-		MaxReposPerUser:  maxRepos,
+		DefaultUserQuota:    defaultQuota,
+		MaxReposPerUser:     maxRepos,
+		MaxRequestBodyBytes: int64(maxBodyKB) << 10,
+	}
+
+	// Load analysis pipeline configuration
+	staleMins, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_STALE_MINUTES", "30"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_STALE_MINUTES: %w", err)
+	}
+
+	reconcileMins, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_RECONCILE_INTERVAL_MINUTES", "5"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_RECONCILE_INTERVAL_MINUTES: %w", err)
+	}
+
+	workers, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_WORKERS", "2"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_WORKERS: %w", err)
+	}
+
+	queueSize, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_QUEUE_SIZE", "100"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_QUEUE_SIZE: %w", err)
+	}
+
+	maxQueueDepth, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_MAX_QUEUE_DEPTH", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_MAX_QUEUE_DEPTH: %w", err)
+	}
+
+	dedupMins, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_DEDUP_WINDOW_MINUTES", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_DEDUP_WINDOW_MINUTES: %w", err)
+	}
+
+	maxInFlight, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_MAX_IN_FLIGHT_PER_USER", "3"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_MAX_IN_FLIGHT_PER_USER: %w", err)
+	}
+
+	maxRepoSizeMB, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_MAX_REPO_SIZE_MB", "1024"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_MAX_REPO_SIZE_MB: %w", err)
+	}
+
+	rateLimitWaitSecs, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_RATE_LIMIT_MAX_WAIT_SECONDS", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_RATE_LIMIT_MAX_WAIT_SECONDS: %w", err)
+	}
+
+	repoRefreshMins, err := strconv.Atoi(getEnvOrDefault("REPO_REFRESH_INTERVAL_MINUTES", "360"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REPO_REFRESH_INTERVAL_MINUTES: %w", err)
+	}
+
+	repoRefreshDays, err := strconv.Atoi(getEnvOrDefault("REPO_REFRESH_LOOKBACK_DAYS", "30"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REPO_REFRESH_LOOKBACK_DAYS: %w", err)
+	}
+
+	retentionDays, err := strconv.Atoi(getEnvOrDefault("ANALYSIS_FILE_RETENTION_DAYS", "90"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_FILE_RETENTION_DAYS: %w", err)
+	}
+
+	redactSecrets, err := strconv.ParseBool(getEnvOrDefault("ANALYSIS_REDACT_SECRETS", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_REDACT_SECRETS: %w", err)
+	}
+
+	hashesOnly, err := strconv.ParseBool(getEnvOrDefault("ANALYSIS_STORE_FILE_HASHES_ONLY", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_STORE_FILE_HASHES_ONLY: %w", err)
+	}
+
+	cacheResults, err := strconv.ParseBool(getEnvOrDefault("ANALYSIS_CACHE_RESULTS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_CACHE_RESULTS: %w", err)
+	}
+
+	countPRs, err := strconv.ParseBool(getEnvOrDefault("ANALYSIS_COUNT_PULL_REQUESTS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_COUNT_PULL_REQUESTS: %w", err)
+	}
+
+	captureAI, err := strconv.ParseBool(getEnvOrDefault("ANALYSIS_CAPTURE_AI_EXCHANGE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ANALYSIS_CAPTURE_AI_EXCHANGE: %w", err)
+	}
+
+	cfg.Analysis = AnalysisConfig{
+		StaleAfter:          time.Duration(staleMins) * time.Minute,
+		ReconcileInterval:   time.Duration(reconcileMins) * time.Minute,
+		Workers:             workers,
+		QueueSize:           queueSize,
+		MaxQueueDepth:       maxQueueDepth,
+		DedupWindow:         time.Duration(dedupMins) * time.Minute,
+		RedactSecrets:       redactSecrets,
+		MaxInFlightPerUser:  maxInFlight,
+		MaxRepoSizeKB:       maxRepoSizeMB * 1024,
+		RateLimitMaxWait:    time.Duration(rateLimitWaitSecs) * time.Second,
+		RepoRefreshInterval: time.Duration(repoRefreshMins) * time.Minute,
+		RepoRefreshLookback: time.Duration(repoRefreshDays) * 24 * time.Hour,
+		FileRetention:       time.Duration(retentionDays) * 24 * time.Hour,
+		StoreFileHashesOnly: hashesOnly,
+		CacheResults:        cacheResults,
+		CountPullRequests:   countPRs,
+		CaptureAIExchange:   captureAI,
 	}
 
 	// Validate required configuration
@@ -173,6 +651,95 @@ func (c *Config) validate() error {
 		errs = append(errs, errors.New("DATABASE_URL is required"))
 	}
 
+	// Pool sizes must be usable by pgxpool
+	if c.Database.MaxConns < 1 {
+		errs = append(errs, errors.New("DB_MAX_CONNS must be at least 1"))
+	}
+	if c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		errs = append(errs, errors.New("DB_MIN_CONNS must be between 0 and DB_MAX_CONNS"))
+	}
+	if c.Database.ConnectTimeout < 0 {
+		errs = append(errs, errors.New("DB_CONNECT_TIMEOUT_SECONDS must not be negative"))
+	}
+
+	if c.APIs.GitHubREADMEMaxBytes < 0 {
+		errs = append(errs, errors.New("GITHUB_README_MAX_BYTES must not be negative"))
+	}
+
+	if c.APIs.GitHubMaxIdleConnsPerHost < 1 {
+		errs = append(errs, errors.New("GITHUB_MAX_IDLE_CONNS_PER_HOST must be at least 1"))
+	}
+	if c.APIs.GitHubMaxFilesPerLanguage < 0 {
+		errs = append(errs, errors.New("GITHUB_MAX_FILES_PER_LANGUAGE must not be negative"))
+	}
+
+	if c.Limits.MaxRequestBodyBytes < 1 {
+		errs = append(errs, errors.New("MAX_REQUEST_BODY_KB must be at least 1"))
+	}
+
+	if c.Analysis.FileRetention < 0 {
+		errs = append(errs, errors.New("ANALYSIS_FILE_RETENTION_DAYS must not be negative"))
+	}
+
+	if c.Analysis.RepoRefreshInterval < 0 {
+		errs = append(errs, errors.New("REPO_REFRESH_INTERVAL_MINUTES must not be negative"))
+	}
+	if c.Analysis.RepoRefreshInterval > 0 && c.Analysis.RepoRefreshLookback <= 0 {
+		errs = append(errs, errors.New("REPO_REFRESH_LOOKBACK_DAYS must be positive"))
+	}
+
+	if c.Analysis.MaxInFlightPerUser < 0 {
+		errs = append(errs, errors.New("ANALYSIS_MAX_IN_FLIGHT_PER_USER must not be negative"))
+	}
+
+	if c.Analysis.MaxRepoSizeKB < 0 {
+		errs = append(errs, errors.New("ANALYSIS_MAX_REPO_SIZE_MB must not be negative"))
+	}
+	if c.Analysis.RateLimitMaxWait < 0 {
+		errs = append(errs, errors.New("ANALYSIS_RATE_LIMIT_MAX_WAIT_SECONDS must not be negative"))
+	}
+
+	if c.Analysis.CaptureAIExchange && c.IsProduction() {
+		errs = append(errs, errors.New("ANALYSIS_CAPTURE_AI_EXCHANGE must not be enabled in production"))
+	}
+
+	if err := validateBaseURL(c.APIs.AIBaseURL, c.IsProduction()); err != nil {
+		errs = append(errs, fmt.Errorf("AI_BASE_URL %w", err))
+	}
+
+	if c.APIs.PerplexityMaxRetries < 0 {
+		errs = append(errs, errors.New("PERPLEXITY_MAX_RETRIES must not be negative"))
+	}
+
+	if c.APIs.AIMaxTokens < 0 || c.APIs.AIRetryMaxTokens < 0 {
+		errs = append(errs, errors.New("AI_MAX_TOKENS and AI_RETRY_MAX_TOKENS must not be negative"))
+	}
+	if c.APIs.AIMaxKeyFindings < 1 {
+		errs = append(errs, errors.New("AI_MAX_KEY_FINDINGS must be at least 1"))
+	}
+	if err := validatePromptTemplate(c.APIs.AIPromptTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("AI_PROMPT_TEMPLATE_FILE %w", err))
+	}
+
+	if c.Analysis.StaleAfter <= 0 {
+		errs = append(errs, errors.New("ANALYSIS_STALE_MINUTES must be positive"))
+	}
+	if c.Analysis.ReconcileInterval <= 0 {
+		errs = append(errs, errors.New("ANALYSIS_RECONCILE_INTERVAL_MINUTES must be positive"))
+	}
+	if c.Analysis.Workers < 1 {
+		errs = append(errs, errors.New("ANALYSIS_WORKERS must be at least 1"))
+	}
+	if c.Analysis.QueueSize < 1 {
+		errs = append(errs, errors.New("ANALYSIS_QUEUE_SIZE must be at least 1"))
+	}
+	if c.Analysis.MaxQueueDepth < 0 {
+		errs = append(errs, errors.New("ANALYSIS_MAX_QUEUE_DEPTH must not be negative"))
+	}
+	if c.Analysis.DedupWindow < 0 {
+		errs = append(errs, errors.New("ANALYSIS_DEDUP_WINDOW_MINUTES must not be negative"))
+	}
+
 	// CSRF secret must be set and sufficiently long
 	if c.Security.CSRFSecret == "" {
 		errs = append(errs, errors.New("CSRF_SECRET is required"))
@@ -200,6 +767,27 @@ func (c *Config) validate() error {
 		errs = append(errs, errors.New("GITHUB_CLIENT_SECRET is required"))
 	}
 
+	if c.GitHubOAuth.APITimeout <= 0 {
+		errs = append(errs, errors.New("GITHUB_OAUTH_TIMEOUT_SECONDS must be positive"))
+	}
+
+	if c.APIs.GitHubAppID > 0 {
+		if c.APIs.GitHubAppPrivateKey == "" {
+			errs = append(errs, errors.New("GITHUB_APP_PRIVATE_KEY_FILE is required when GITHUB_APP_ID is set"))
+		}
+		if len(c.APIs.GitHubAppInstallations) == 0 {
+			errs = append(errs, errors.New("GITHUB_APP_INSTALLATIONS is required when GITHUB_APP_ID is set"))
+		}
+	}
+
+	if err := validateRedirectURL(c.GitHubOAuth.RedirectURL, c.Server.BaseURL, c.IsProduction()); err != nil {
+		errs = append(errs, fmt.Errorf("GITHUB_REDIRECT_URL %w", err))
+	}
+
+	if c.Security.CookieSameSite == http.SameSiteNoneMode && !c.Security.SecureCookies {
+		errs = append(errs, errors.New("COOKIE_SAMESITE=none requires COOKIE_SECURE=true"))
+	}
+
 	// Validate bcrypt cost is in reasonable range
 	// Cost < 10 is too fast (vulnerable to brute force)
 	// Cost > 16 is too slow (poor user experience)
@@ -207,6 +795,18 @@ func (c *Config) validate() error {
 		errs = append(errs, errors.New("BCRYPT_COST must be between 10 and 16"))
 	}
 
+	if c.Security.PasswordMinClasses < 0 || c.Security.PasswordMinClasses > 4 {
+		errs = append(errs, errors.New("PASSWORD_MIN_CLASSES must be between 0 and 4"))
+	}
+
+	if c.Security.LoginMaxFailures < 0 || c.Security.LoginMaxFailuresPerIP < 0 {
+		errs = append(errs, errors.New("LOGIN_MAX_FAILURES and LOGIN_MAX_FAILURES_PER_IP must not be negative"))
+	}
+
+	if c.Security.LoginLockout <= 0 {
+		errs = append(errs, errors.New("LOGIN_LOCKOUT_MINUTES must be positive"))
+	}
+
 	// Validate environment is a known value
 	validEnvs := map[string]bool{
 		"development": true,
@@ -233,6 +833,81 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList splits a comma-separated env value, dropping empty entries.
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// getEnvMap parses a comma-separated list of key=value pairs.
+func getEnvMap(key string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range getEnvList(key) {
+		k, v, ok := strings.Cut(pair, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		values[k] = v
+	}
+	return values, nil
+}
+
+// getEnvInt64Map parses a comma-separated list of key=integer pairs.
+func getEnvInt64Map(key string) (map[string]int64, error) {
+	pairs, err := getEnvMap(key)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]int64, len(pairs))
+	for k, v := range pairs {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", k, err)
+		}
+		values[k] = n
+	}
+	return values, nil
+}
+
+// validatePromptTemplate checks that a user prompt template contains
+// services.PromptRepositoryPlaceholder, where the repository data goes,
+// exactly once. An empty template keeps the built-in one.
+func validatePromptTemplate(tmpl string) error {
+	if strings.TrimSpace(tmpl) == "" {
+		return nil
+	}
+	switch strings.Count(tmpl, services.PromptRepositoryPlaceholder) {
+	case 0:
+		return fmt.Errorf("must contain %s", services.PromptRepositoryPlaceholder)
+	case 1:
+		return nil
+	default:
+		return fmt.Errorf("must contain %s only once", services.PromptRepositoryPlaceholder)
+	}
+}
+
+// readOptionalFile returns the contents of the file at path, or "" when no
+// path is given. A file that is set but empty is an error.
+func readOptionalFile(path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return string(data), nil
+}
+
 // MustLoad is like Load but panics on error.
 // Used in main() where its required to fail fast
 func MustLoad() *Config {
@@ -242,3 +917,55 @@ func MustLoad() *Config {
 	}
 	return cfg
 }
+
+// ParseSameSite parses a cookie SameSite setting: "lax", "strict" or "none",
+// in any case.
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite mode %q (want lax, strict or none)", s)
+	}
+}
+
+// validateRedirectURL checks the OAuth callback URL like validateBaseURL,
+// and that it points at the same host as baseURL, since GitHub rejects a
+// redirect_uri that doesn't match the registered app.
+func validateRedirectURL(raw, baseURL string, production bool) error {
+	if err := validateBaseURL(raw, production); err != nil {
+		return err
+	}
+	redirect, _ := url.Parse(raw)
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Host == "" {
+		return errors.New("can't be checked: BASE_URL is not an absolute URL")
+	}
+	if !strings.EqualFold(redirect.Host, base.Host) {
+		return fmt.Errorf("host %q does not match BASE_URL host %q", redirect.Host, base.Host)
+	}
+	return nil
+}
+
+// validateBaseURL checks that raw is an absolute http(s) URL without a query
+// or fragment. Plain http is only allowed outside production.
+func validateBaseURL(raw string, production bool) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return errors.New("must be an absolute http(s) URL")
+	}
+	if u.Scheme == "http" && production {
+		return errors.New("must use https in production")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return errors.New("must not have a query or fragment")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidatePromptTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		wantErr string // substring of the error; empty when valid
+	}{
+		{name: "unset"},
+		{name: "blank", tmpl: " \n"},
+		{name: "placeholder once", tmpl: "Review for security only:\n{{repository}}"},
+		{name: "no placeholder", tmpl: "Review this repository.", wantErr: "must contain {{repository}}"},
+		{name: "misspelled placeholder", tmpl: "Review {{ repository }}", wantErr: "must contain {{repository}}"},
+		{name: "placeholder twice", tmpl: "{{repository}}\n{{repository}}", wantErr: "only once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePromptTemplate(tt.tmpl)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validatePromptTemplate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validatePromptTemplate = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSameSite(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    http.SameSite
+		wantErr bool
+	}{
+		{in: "lax", want: http.SameSiteLaxMode},
+		{in: "Strict", want: http.SameSiteStrictMode},
+		{in: " none ", want: http.SameSiteNoneMode},
+		{in: "sideways", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSameSite(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSameSite(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSameSite(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSameSiteNoneRequiresSecure(t *testing.T) {
+	const wantErr = "COOKIE_SAMESITE=none requires COOKIE_SECURE=true"
+	tests := []struct {
+		sameSite http.SameSite
+		secure   bool
+		wantErr  bool
+	}{
+		{http.SameSiteLaxMode, false, false},
+		{http.SameSiteStrictMode, false, false},
+		{http.SameSiteNoneMode, true, false},
+		{http.SameSiteNoneMode, false, true},
+	}
+
+	for _, tt := range tests {
+		// The rest of the config is empty, so validate always fails; only
+		// the cookie error matters here
+		var cfg Config
+		cfg.Security.CookieSameSite = tt.sameSite
+		cfg.Security.SecureCookies = tt.secure
+		err := cfg.validate()
+		if got := err != nil && strings.Contains(err.Error(), wantErr); got != tt.wantErr {
+			t.Errorf("SameSite %v, Secure %v: validate = %v, want cookie error %v", tt.sameSite, tt.secure, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateRedirectURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		redirect   string
+		baseURL    string
+		production bool
+		wantErr    string // substring of the error; empty when valid
+	}{
+		{name: "production https same host", redirect: "https://app.example.com/auth/github/callback", baseURL: "https://app.example.com", production: true},
+		{name: "host in another case", redirect: "https://APP.example.com/auth/github/callback", baseURL: "https://app.example.com", production: true},
+		{name: "production http", redirect: "http://app.example.com/auth/github/callback", baseURL: "https://app.example.com", production: true, wantErr: "must use https"},
+		{name: "development http", redirect: "http://localhost:3000/auth/github/callback", baseURL: "http://localhost:3000"},
+		{name: "development https", redirect: "https://localhost:3000/auth/github/callback", baseURL: "http://localhost:3000"},
+		{name: "production foreign host", redirect: "https://evil.example.net/auth/github/callback", baseURL: "https://app.example.com", production: true, wantErr: "does not match BASE_URL host"},
+		{name: "development foreign host", redirect: "http://127.0.0.1:3000/auth/github/callback", baseURL: "http://localhost:3000", wantErr: "does not match BASE_URL host"},
+		{name: "relative", redirect: "/auth/github/callback", baseURL: "https://app.example.com", production: true, wantErr: "must be an absolute"},
+		{name: "relative in development", redirect: "/auth/github/callback", baseURL: "http://localhost:3000", wantErr: "must be an absolute"},
+		{name: "with a query", redirect: "https://app.example.com/callback?x=1", baseURL: "https://app.example.com", production: true, wantErr: "query or fragment"},
+		{name: "relative base URL", redirect: "https://app.example.com/callback", baseURL: "app.example.com", production: true, wantErr: "BASE_URL is not an absolute URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRedirectURL(tt.redirect, tt.baseURL, tt.production)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateRedirectURL = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateRedirectURL = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Package context holds the request context helpers shared by middleware,
+// controllers and views.
+package context
+
+import (
+	"context"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+type contextkey string
+
+const (
+	userKey contextkey = "user"
+)
+
+// SetUser returns a copy of ctx carrying the authenticated user.
+func SetUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// GetUser retrieves the authenticated user from request context.
+// Returns nil if no user is set (unauthenticated request) or the stored
+// value is not a *models.User.
+func GetUser(ctx context.Context) *models.User {
+	val := ctx.Value(userKey)
+	user, ok := val.(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"io/fs"
+	"log"
+	"net/http"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// AdminController handles operator-only endpoints.
+type AdminController struct {
+	db            *models.Database
+	migrationFS   fs.FS
+	inviteService *models.InviteService
+}
+
+// NewAdminController creates a new AdminController.
+func NewAdminController(db *models.Database, migrationFS fs.FS, inviteService *models.InviteService) *AdminController {
+	return &AdminController{
+		db:            db,
+		migrationFS:   migrationFS,
+		inviteService: inviteService,
+	}
+}
+
+// PostInvite creates a single-use signup invite code.
+// POST /api/v1/admin/invites
+func (c *AdminController) PostInvite(w http.ResponseWriter, r *http.Request) {
+	invite, err := c.inviteService.Create(r.Context())
+	if err != nil {
+		log.Printf("Failed to create invite code: %v", err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to create invite code")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, invite)
+}
+
+// MigrationsResponse is the JSON body for the migrations endpoint.
+type MigrationsResponse struct {
+	Applied    int                    `json:"applied"`
+	Pending    int                    `json:"pending"`
+	Migrations []models.MigrationInfo `json:"migrations"`
+}
+
+// GetMigrations returns applied and pending database migrations.
+// GET /api/v1/admin/migrations
+func (c *AdminController) GetMigrations(w http.ResponseWriter, r *http.Request) {
+	migrations, err := models.MigrationStatus(r.Context(), c.db.DB, c.migrationFS)
+	if err != nil {
+		log.Printf("Failed to load migration status: %v", err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to load migration status")
+		return
+	}
+
+	resp := MigrationsResponse{Migrations: migrations}
+	for _, m := range migrations {
+		if m.Applied {
+			resp.Applied++
+		} else {
+			resp.Pending++
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// PoolMetrics is the JSON body for the metrics endpoint.
+type PoolMetrics struct {
+	AcquiredConns        int32  `json:"acquired_conns"`
+	IdleConns            int32  `json:"idle_conns"`
+	TotalConns           int32  `json:"total_conns"`
+	MaxConns             int32  `json:"max_conns"`
+	ConstructingConns    int32  `json:"constructing_conns"`
+	AcquireCount         int64  `json:"acquire_count"`
+	EmptyAcquireCount    int64  `json:"empty_acquire_count"`
+	CanceledAcquireCount int64  `json:"canceled_acquire_count"`
+	AcquireDurationMs    int64  `json:"acquire_duration_ms"`
+	Status               string `json:"status"`
+}
+
+// GetMetrics returns database connection pool statistics.
+// Useful for spotting connection exhaustion (acquired == max, empty acquires climbing).
+// GET /api/v1/admin/metrics
+func (c *AdminController) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := c.db.Stats()
+
+	metrics := PoolMetrics{
+		AcquiredConns:        stats.AcquiredConns(),
+		IdleConns:            stats.IdleConns(),
+		TotalConns:           stats.TotalConns(),
+		MaxConns:             stats.MaxConns(),
+		ConstructingConns:    stats.ConstructingConns(),
+		AcquireCount:         stats.AcquireCount(),
+		EmptyAcquireCount:    stats.EmptyAcquireCount(),
+		CanceledAcquireCount: stats.CanceledAcquireCount(),
+		AcquireDurationMs:    stats.AcquireDuration().Milliseconds(),
+		Status:               "ok",
+	}
+	if err := c.db.Health(r.Context()); err != nil {
+		metrics.Status = "unhealthy"
+	}
+
+	respondJSON(w, http.StatusOK, metrics)
+}
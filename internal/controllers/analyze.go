@@ -1,10 +1,22 @@
 package controllers
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/csrf"
@@ -15,6 +27,19 @@ import (
 	"github.com/rahul4469/github-analyzer/internal/views"
 )
 
+const (
+	// maxAnalyzeFormBytes caps the request body read by PostAnalyze.
+	maxAnalyzeFormBytes = 16 << 10
+	// maxRepoURLLength is the longest repo_url accepted before parsing.
+	maxRepoURLLength = 256
+	// maxArchiveBytes caps the uncompressed size of a files.zip export.
+	maxArchiveBytes = 10 << 20
+	// githubRequestsPerAnalysis is how many GitHub requests an analysis
+	// makes besides one per file and the optional pull request count:
+	// metadata, the commit, the tree, README and license.
+	githubRequestsPerAnalysis = 5
+)
+
 // AnalyzeController handles repository analysis.
 type AnalyzeController struct {
 	analysisService   *models.AnalysisService
@@ -24,13 +49,71 @@ type AnalyzeController struct {
 	perplexityService *services.PerplexityService
 	encryptor         *crypto.Encryptor
 	templates         AnalyzeTemplates
+	config            AnalyzeConfig
 	maxFilesToFetch   int
+	jobs              chan *analysisJob
+	githubApp         *services.GitHubAppAuth // non-nil when a GitHub App is configured
+
+	runningMu sync.Mutex
+	running   map[int64]context.CancelFunc // analysis id -> cancels its run
 }
 
 // AnalyzeTemplates holds the templates for analysis pages.
 type AnalyzeTemplates struct {
-	Form   *views.Template
-	Result *views.Template
+	Form    *views.Template
+	Result  *views.Template
+	Compare *views.Template
+}
+
+// AnalyzeConfig holds analysis limits and queue settings.
+type AnalyzeConfig struct {
+	MaxReposPerUser int // 0 disables the limit
+	QueueSize       int // pending jobs held for the workers
+	MaxQueueDepth   int // pending analyses across all users; 0 only applies QueueSize
+
+	// An in-flight analysis of the same repository created within this
+	// window is reused instead of starting another. 0 disables it.
+	DedupWindow time.Duration
+
+	// Mask detected secrets in fetched files before they are stored or
+	// sent to the AI.
+	RedactSecrets bool
+
+	// Store only hashes of the files sent to the AI, not their contents
+	StoreFileHashesOnly bool
+
+	// Complete an analysis whose AI input is identical to one of the
+	// user's completed analyses with a copy of its result, without
+	// calling the AI.
+	CacheResults bool
+
+	// Count open pull requests apart from issues for the prompt. It costs a
+	// search API request per analysis, and search has a much lower rate
+	// limit than the rest of the API.
+	CountPullRequests bool
+
+	// Most analyses one user may have pending or processing. 0 disables it.
+	MaxInFlightPerUser int
+
+	// Largest repository, as reported by GitHub, that may be analyzed.
+	// 0 disables the limit.
+	MaxRepoSizeKB int
+
+	// Longest wait for a GitHub rate limit reset when too few requests are
+	// left for an analysis. Later resets fail the analysis up front with
+	// the reset time. 0 disables the check.
+	RateLimitMaxWait time.Duration
+
+	// Store the raw AI request and response on each analysis for
+	// debugging. Never meant for production.
+	CaptureAIExchange bool
+
+	// App-level GitHub token used for public repositories when the user
+	// hasn't connected GitHub. Empty requires a connection.
+	AppGitHubToken string
+
+	// Public URL of the app, used in generated API commands
+	BaseURL string
 }
 
 // NewAnalyzeController creates a new AnalyzeController.
@@ -42,6 +125,7 @@ func NewAnalyzeController(
 	perplexityService *services.PerplexityService,
 	encryptor *crypto.Encryptor,
 	templates AnalyzeTemplates,
+	config AnalyzeConfig,
 ) *AnalyzeController {
 	return &AnalyzeController{
 		analysisService:   analysisService,
@@ -51,15 +135,30 @@ func NewAnalyzeController(
 		perplexityService: perplexityService,
 		encryptor:         encryptor,
 		templates:         templates,
-		maxFilesToFetch:   15,
+		config:            config,
+		maxFilesToFetch:   models.DefaultMaxFiles,
+		jobs:              make(chan *analysisJob, config.QueueSize),
+		running:           make(map[int64]context.CancelFunc),
 	}
 }
 
+// UseGitHubApp fetches the repositories of owners app is installed on with
+// its installation tokens instead of the user's own token.
+func (c *AnalyzeController) UseGitHubApp(app *services.GitHubAppAuth) {
+	c.githubApp = app
+}
+
 // AnalyzeFormData holds data for the analyze form template.
 type AnalyzeFormData struct {
 	RepoURL         string
 	GitHubConnected bool
 	GitHubUsername  string
+	MaxFiles        int // files fetched per analysis, from the user's preferences
+	Mode            models.AnalysisMode
+	MaxUploadMB     int  // largest archive accepted by the upload form
+	PublicOnly      bool // not connected, but public repositories can be analyzed
+	BaseRef         string
+	HeadRef         string // refs submitted to the compare form
 }
 
 // GetAnalyze renders the analysis form.
@@ -86,11 +185,15 @@ func (c *AnalyzeController) GetAnalyze(w http.ResponseWriter, r *http.Request) {
 		Data: AnalyzeFormData{
 			GitHubConnected: githubConnected,
 			GitHubUsername:  githubUsername,
+			MaxFiles:        c.maxFilesFor(r.Context(), user.ID),
+			Mode:            models.ModeDeep,
+			MaxUploadMB:     MaxUploadBytes >> 20,
+			PublicOnly:      !githubConnected && c.config.AppGitHubToken != "",
 		},
 	}
 
 	// If GitHub not connected, show warning
-	if !githubConnected {
+	if !githubConnected && c.config.AppGitHubToken == "" {
 		data.Warning = "Please connect your GitHub account first to analyze repositories."
 	}
 
@@ -101,42 +204,41 @@ func (c *AnalyzeController) GetAnalyze(w http.ResponseWriter, r *http.Request) {
 func (c *AnalyzeController) PostAnalyze(w http.ResponseWriter, r *http.Request) {
 	user := middleware.MustCurrentUser(r)
 
+	r.Body = http.MaxBytesReader(w, r.Body, maxAnalyzeFormBytes)
 	if err := r.ParseForm(); err != nil {
 		c.renderFormError(w, r, user, "", "Invalid form data")
 		return
 	}
 
-	repoURL := r.FormValue("repo_url")
-
-	// Validate inputs
-	if repoURL == "" {
-		c.renderFormError(w, r, user, repoURL, "Repository URL is required")
+	rawURL := r.FormValue("repo_url")
+	if len(rawURL) > maxRepoURLLength {
+		c.renderFormError(w, r, user, "", "Repository URL is too long")
 		return
 	}
 
-	// Check if GitHub is connected
-	if !user.HasGitHubConnected() {
-		c.renderFormError(w, r, user, repoURL, "Please connect your GitHub account first")
+	repoURL := sanitizeRepoURL(rawURL)
+
+	mode, err := models.ParseAnalysisMode(r.FormValue("mode"))
+	if err != nil {
+		c.renderFormError(w, r, user, repoURL, "Invalid analysis mode")
 		return
 	}
 
-	// Get and decrypt the GitHub token
-	encryptedToken, err := c.userService.GetGitHubToken(r.Context(), user.ID)
-	if err != nil || encryptedToken == "" {
-		c.renderFormError(w, r, user, repoURL, "GitHub token not found. Please reconnect your GitHub account.")
+	// Validate inputs
+	if repoURL == "" {
+		c.renderFormError(w, r, user, repoURL, "Repository URL is required")
 		return
 	}
 
-	githubToken, err := c.encryptor.Decrypt(encryptedToken)
-	if err != nil {
-		log.Printf("Failed to decrypt GitHub token: %v", err)
-		c.renderFormError(w, r, user, repoURL, "Failed to access GitHub token. Please reconnect your GitHub account.")
+	if strings.ContainsAny(repoURL, " <>\"'`") {
+		c.renderFormError(w, r, user, repoURL, "Invalid GitHub repository URL. Use format: https://github.com/owner/repo")
 		return
 	}
 
-	// Parse and validate GitHub URL
+	// Parse and validate GitHub URL; gist URLs are analyzed as repositories
+	_, gistID, gistErr := models.ParseGistURL(repoURL)
 	owner, repo, err := models.ParseGitHubURL(repoURL)
-	if err != nil {
+	if err != nil && gistErr != nil {
 		c.renderFormError(w, r, user, repoURL, "Invalid GitHub repository URL. Use format: https://github.com/owner/repo")
 		return
 	}
@@ -148,10 +250,20 @@ func (c *AnalyzeController) PostAnalyze(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Perform the analysis
-	analysisID, err := c.performAnalysis(r, user, owner, repo, repoURL, githubToken)
+	var analysisID int64
+	if gistErr == nil {
+		owner, repo = "gist", gistID
+		analysisID, err = c.performGistAnalysis(r, user, gistID, mode)
+	} else {
+		analysisID, err = c.performAnalysis(r, user, owner, repo, repoURL, mode)
+	}
 	if err != nil {
+		if errors.Is(err, services.ErrEmptyRepository) {
+			c.renderFormError(w, r, user, repoURL, "This repository is empty. Push at least one commit before analyzing it.")
+			return
+		}
 		log.Printf("Analysis failed for %s/%s: %v", owner, repo, err)
-		c.renderFormError(w, r, user, repoURL, fmt.Sprintf("Analysis failed: %v", err))
+		c.renderFormError(w, r, user, repoURL, analysisErrorMessage(err))
 		return
 	}
 
@@ -159,17 +271,180 @@ func (c *AnalyzeController) PostAnalyze(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, fmt.Sprintf("/analyze/%d", analysisID), http.StatusSeeOther)
 }
 
-// performAnalysis executes the full analysis pipeline.
-func (c *AnalyzeController) performAnalysis(r *http.Request, user *models.User, owner, repo, repoURL, githubToken string) (int64, error) {
+// analysisJob carries everything a worker needs to run a created analysis.
+type analysisJob struct {
+	analysisID   int64
+	userID       int64
+	repositoryID int64
+	owner        string
+	repo         string
+	repoURL      string
+	ref          string // branch, tag or commit to read; empty reads branch
+	branch       string // default branch, from the repository metadata
+	description  string
+	language     string
+	openIssues   int // open issues and pull requests, from the repository metadata
+	githubToken  string
+	mode         models.AnalysisMode
+	maxFiles     int
+	scoring      *models.ScoringConfig
+	reused       bool                 // an in-flight analysis was returned; don't run it again
+	timings      []models.StepTiming  // per-step durations, in pipeline order
+	skipped      []models.SkippedFile // selected files left out of the analysis
+}
+
+// trackStep records how long a pipeline step took since start.
+func (j *analysisJob) trackStep(step string, start time.Time) {
+	j.timings = append(j.timings, models.StepTiming{
+		Step:       step,
+		DurationMS: time.Since(start).Milliseconds(),
+	})
+}
+
+// performAnalysis executes the full analysis pipeline, fetching from GitHub
+// with the user's token, or the app token for public repositories when the
+// user hasn't connected GitHub.
+func (c *AnalyzeController) performAnalysis(r *http.Request, user *models.User, owner, repo, repoURL string, mode models.AnalysisMode) (int64, error) {
 	ctx := r.Context()
 
+	githubToken, appToken, err := c.githubTokenFor(ctx, user, owner, repo)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.config.RateLimitMaxWait > 0 {
+		if err := c.githubService.WaitForRateLimit(ctx, githubToken, c.githubRequestsFor(ctx, user.ID, mode), c.config.RateLimitMaxWait); err != nil {
+			return 0, err
+		}
+	}
+
+	repoInfo, metadataTime, err := c.fetchRepository(ctx, owner, repo, githubToken)
+	if err != nil {
+		return 0, err
+	}
+	// The app token may see private repositories the user can't
+	if appToken && repoInfo.Private {
+		return 0, ErrPrivateRepoNeedsConnection
+	}
+
+	job, err := c.createAnalysis(ctx, user, repoInfo, metadataTime, owner, repo, repoURL, githubToken, mode)
+	if err != nil {
+		return 0, err
+	}
+	if job.reused {
+		return job.analysisID, nil
+	}
+
+	if err := c.runAnalysis(ctx, job); err != nil {
+		return 0, err
+	}
+
+	return job.analysisID, nil
+}
+
+// githubRequestsFor returns how many GitHub requests an analysis in mode
+// for the user makes: githubRequestsPerAnalysis, the pull request count
+// when enabled and one per file the user's analyses fetch.
+func (c *AnalyzeController) githubRequestsFor(ctx context.Context, userID int64, mode models.AnalysisMode) int {
+	n := githubRequestsPerAnalysis
+	if c.config.CountPullRequests {
+		n++
+	}
+	if mode != models.ModeMetadata {
+		n += c.maxFilesFor(ctx, userID)
+	}
+	return n
+}
+
+// githubTokenFor returns the GitHub token to fetch owner/repo with for user:
+// the user's own when connected, else the app token, reported by appToken,
+// if configured. When the GitHub App is installed for owner its installation
+// token is used instead, but it is reported as an app token unless GitHub
+// shows the user the repository with their own token, as the installation
+// sees private repositories the user may not. owner and repo may be empty
+// when unknown, which skips the App.
+func (c *AnalyzeController) githubTokenFor(ctx context.Context, user *models.User, owner, repo string) (token string, appToken bool, err error) {
+	userToken, userErr := c.userGitHubToken(ctx, user)
+
+	if c.githubApp != nil && owner != "" && repo != "" && c.githubApp.Installed(owner) {
+		installationToken, err := c.githubApp.Token(ctx, owner)
+		if err == nil {
+			return installationToken, !c.userCanSeeRepository(ctx, owner, repo, userToken), nil
+		}
+		log.Printf("Failed to get GitHub App token for %s, falling back: %v", owner, err)
+	}
+
+	if errors.Is(userErr, ErrGitHubNotConnected) {
+		if c.config.AppGitHubToken == "" {
+			return "", false, ErrGitHubNotConnected
+		}
+		return c.config.AppGitHubToken, true, nil
+	}
+	if userErr != nil {
+		return "", false, userErr
+	}
+	return userToken, false, nil
+}
+
+// userGitHubToken returns the user's own decrypted GitHub token, or
+// ErrGitHubNotConnected when they haven't connected GitHub.
+func (c *AnalyzeController) userGitHubToken(ctx context.Context, user *models.User) (string, error) {
+	if !user.HasGitHubConnected() {
+		return "", ErrGitHubNotConnected
+	}
+
+	encryptedToken, err := c.userService.GetGitHubToken(ctx, user.ID)
+	if err != nil || encryptedToken == "" {
+		return "", ErrGitHubTokenUnavailable
+	}
+
+	token, err := c.encryptor.Decrypt(encryptedToken)
+	if err != nil {
+		log.Printf("Failed to decrypt GitHub token: %v", err)
+		return "", ErrGitHubTokenUnavailable
+	}
+	return token, nil
+}
+
+// userCanSeeRepository reports whether GitHub shows owner/repo to the
+// holder of userToken. Any failure, including a missing token, counts as
+// not visible.
+func (c *AnalyzeController) userCanSeeRepository(ctx context.Context, owner, repo, userToken string) bool {
+	if userToken == "" {
+		return false
+	}
+	_, err := c.githubService.GetRepository(ctx, owner, repo, userToken)
+	return err == nil
+}
+
+// fetchRepository loads repository metadata from GitHub and reports how long
+// the request took. Repositories over the size limit are rejected here,
+// before any of their contents are fetched.
+func (c *AnalyzeController) fetchRepository(ctx context.Context, owner, repo, githubToken string) (*services.GitHubRepository, time.Duration, error) {
 	// Step 1: Fetch repository metadata from GitHub
 	log.Printf("Fetching repository metadata for %s/%s", owner, repo)
+	start := time.Now()
 	repoInfo, err := c.githubService.GetRepository(ctx, owner, repo, githubToken)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch repository: %w", err)
+		return nil, 0, fmt.Errorf("failed to fetch repository: %w", err)
+	}
+	if c.config.MaxRepoSizeKB > 0 && repoInfo.Size > c.config.MaxRepoSizeKB {
+		return nil, 0, &RepositoryTooLargeError{SizeKB: repoInfo.Size, LimitKB: c.config.MaxRepoSizeKB}
 	}
+	return repoInfo, time.Since(start), nil
+}
 
+// createAnalysis stores the repository and a pending analysis for it.
+// metadataTime is how long fetching repoInfo took, recorded as the job's
+// first step.
+func (c *AnalyzeController) createAnalysis(ctx context.Context, user *models.User, repoInfo *services.GitHubRepository, metadataTime time.Duration, owner, repo, repoURL, githubToken string, mode models.AnalysisMode) (*analysisJob, error) {
+	return c.createAnalysisWithin(ctx, user, repoInfo, metadataTime, owner, repo, repoURL, githubToken, mode, c.config.DedupWindow, minQuotaReserve)
+}
+
+// createAnalysisWithin is createAnalysis reusing only analyses started
+// within dedupWindow; 0 always creates a new one. A new analysis sets aside
+// reserveTokens of the user's quota until it finishes.
+func (c *AnalyzeController) createAnalysisWithin(ctx context.Context, user *models.User, repoInfo *services.GitHubRepository, metadataTime time.Duration, owner, repo, repoURL, githubToken string, mode models.AnalysisMode, dedupWindow time.Duration, reserveTokens int) (*analysisJob, error) {
 	// Step 2: Create or update repository record
 	repoModel := &models.Repository{
 		UserID:          user.ID,
@@ -180,71 +455,377 @@ func (c *AnalyzeController) performAnalysis(r *http.Request, user *models.User,
 		PrimaryLanguage: &repoInfo.Language,
 		StarsCount:      repoInfo.StargazersCount,
 		ForksCount:      repoInfo.ForksCount,
+		Private:         repoInfo.Private,
 	}
 
-	savedRepo, err := c.repositoryService.Create(ctx, repoModel)
+	// Step 3: Create analysis record, or reuse one already running. Both
+	// records are written in one transaction, so a failure can't leave the
+	// repository without its analysis.
+	savedRepo, analysis, reused, err := c.analysisService.CreateWithRepository(ctx, repoModel, mode, dedupWindow, c.analysisLimits(reserveTokens))
 	if err != nil {
-		return 0, fmt.Errorf("failed to save repository: %w", err)
+		return nil, fmt.Errorf("failed to create analysis: %w", err)
+	}
+	if reused {
+		log.Printf("Reusing in-flight analysis %d for %s/%s", analysis.ID, owner, repo)
+		return &analysisJob{analysisID: analysis.ID, userID: user.ID, owner: owner, repo: repo, reused: true}, nil
+	}
+
+	job := &analysisJob{
+		analysisID:   analysis.ID,
+		userID:       user.ID,
+		repositoryID: savedRepo.ID,
+		owner:        owner,
+		repo:         repo,
+		repoURL:      repoURL,
+		branch:       repoInfo.DefaultBranch,
+		description:  repoInfo.Description,
+		language:     repoInfo.Language,
+		openIssues:   repoInfo.OpenIssuesCount,
+		githubToken:  githubToken,
+		mode:         mode,
+		maxFiles:     c.maxFilesToFetch,
+		timings:      []models.StepTiming{{Step: "metadata", DurationMS: metadataTime.Milliseconds()}},
 	}
 
-	// Step 3: Create analysis record
-	analysis, err := c.analysisService.Create(ctx, user.ID, savedRepo.ID)
+	c.applyPreferences(ctx, job)
+	return job, nil
+}
+
+// applyPreferences applies the user's saved scoring profile to job, if any.
+func (c *AnalyzeController) applyPreferences(ctx context.Context, job *analysisJob) {
+	prefs, err := c.userService.GetPreferences(ctx, job.userID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create analysis: %w", err)
+		log.Printf("Failed to load preferences for user %d, using defaults: %v", job.userID, err)
+		return
+	}
+	job.maxFiles = prefs.MaxFiles
+	job.scoring = prefs.Scoring
+}
+
+// recordParameters stores the inputs job runs with: the repository and
+// commit, empty for uploads and gists, and the scoring profile and limits it
+// selects its files with, so the result shows how they were chosen.
+func (c *AnalyzeController) recordParameters(ctx context.Context, job *analysisJob, repoURL, ref string) {
+	params := c.githubService.SelectionParameters(job.maxFiles, job.scoring)
+	params.RepoURL = repoURL
+	params.Ref = ref
+	params.Mode = job.mode
+	if err := c.analysisService.SetParameters(ctx, job.analysisID, params); err != nil {
+		log.Printf("Failed to store analysis parameters: %v", err)
 	}
+}
+
+// runAnalysis fetches the code for a created analysis, sends it to the AI
+// and stores the result. The analysis is marked failed on error.
+func (c *AnalyzeController) runAnalysis(ctx context.Context, job *analysisJob) error {
+	owner, repo, githubToken := job.owner, job.repo, job.githubToken
+	defer c.recordStepTimings(job)
 
 	// Step 4: Mark as processing
-	if err := c.analysisService.MarkProcessing(ctx, analysis.ID); err != nil {
-		log.Printf("Failed to mark analysis as processing: %v", err)
+	ctx, done, err := c.startProcessing(ctx, job)
+	if err != nil {
+		return err
 	}
+	defer done()
 
-	// Step 5: Fetch actual code files (THE ENHANCED FEATURE!)
-	log.Printf("Fetching source code files for %s/%s", owner, repo)
-	codeFiles, codeStructure, err := c.githubService.GetRepositoryFiles(ctx, owner, repo, githubToken, c.maxFilesToFetch)
+	// Step 5: Fetch the repository tree
+	log.Printf("Fetching file structure for %s/%s", owner, repo)
+	start := time.Now()
+	ref := job.ref
+	if ref == "" {
+		ref = job.branch
+	}
+	tree, err := c.githubService.GetRepositoryTreeAt(ctx, owner, repo, ref, githubToken)
+	job.trackStep("tree", start)
 	if err != nil {
-		_ = c.analysisService.Fail(ctx, analysis.ID, fmt.Sprintf("Failed to fetch code: %v", err))
-		return 0, fmt.Errorf("failed to fetch code files: %w", err)
+		// Nothing to analyze in an empty repo - stop before spending AI quota
+		if errors.Is(err, services.ErrEmptyRepository) {
+			_ = c.analysisService.Fail(ctx, job.analysisID, "Repository is empty: there are no commits to analyze")
+			return services.ErrEmptyRepository
+		}
+		_ = c.analysisService.Fail(ctx, job.analysisID, fmt.Sprintf("Failed to fetch code: %v", err))
+		return fmt.Errorf("failed to fetch code files: %w", err)
+	}
+	if tree.CommitSHA != "" {
+		if err := c.analysisService.SetCommitSHA(ctx, job.analysisID, tree.CommitSHA); err != nil {
+			log.Printf("Failed to store commit SHA: %v", err)
+		}
 	}
-	log.Printf("Fetched %d code files for analysis", len(codeFiles))
+	// Pinned to the commit, so a re-run reads the same files
+	c.recordParameters(ctx, job, job.repoURL, tree.CommitSHA)
+	codeStructure := c.githubService.BuildCodeStructure(tree, job.scoring)
 
-	// Step 6: Fetch README
-	readme, _ := c.githubService.GetREADME(ctx, owner, repo, githubToken)
+	// Step 6: Fetch actual code files (THE ENHANCED FEATURE!)
+	// Metadata mode only needs the tree for the structure summary
+	var codeFiles []models.FileContent
+	if job.mode != models.ModeMetadata {
+		log.Printf("Fetching source code files for %s/%s", owner, repo)
+		start = time.Now()
+		codeFiles, job.skipped = c.githubService.FetchTopFiles(ctx, owner, repo, githubToken, tree, job.maxFiles, job.scoring)
+		if c.config.RedactSecrets {
+			var redacted int
+			codeFiles, redacted = services.RedactSecrets(codeFiles)
+			if redacted > 0 {
+				log.Printf("Redacted %d secrets from %s/%s", redacted, owner, repo)
+			}
+		}
+		job.trackStep("files", start)
+		log.Printf("Fetched %d code files for analysis", len(codeFiles))
+	}
 
-	// Step 7: Store GitHub data
-	if err := c.analysisService.UpdateGitHubData(ctx, analysis.ID, codeStructure, codeFiles, readme); err != nil {
-		log.Printf("Failed to store GitHub data: %v", err)
+	// Step 7: Fetch README
+	start = time.Now()
+	readme, readmeSize, _ := c.githubService.GetREADME(ctx, owner, repo, githubToken)
+	job.trackStep("readme", start)
+
+	// Step 8: Detect the license; a failed lookup is not reported as "no license"
+	start = time.Now()
+	license, licenseErr := c.githubService.GetLicense(ctx, owner, repo, githubToken)
+	job.trackStep("license", start)
+	var spdxID string
+	if licenseErr != nil {
+		log.Printf("Failed to fetch license for %s/%s: %v", owner, repo, licenseErr)
+	} else {
+		var stored *string
+		if license != nil {
+			spdxID = license.SPDXID
+			stored = &spdxID
+		}
+		if err := c.repositoryService.SetLicense(ctx, job.repositoryID, stored); err != nil {
+			log.Printf("Failed to store license: %v", err)
+		}
+	}
+
+	// Step 9: Tell open pull requests from issues if enabled; GitHub's open
+	// issue count includes both
+	activity := &services.RepositoryActivity{OpenIssues: job.openIssues, OpenPullRequests: -1}
+	if c.config.CountPullRequests {
+		start = time.Now()
+		if prs, err := c.githubService.GetOpenPullRequestCount(ctx, owner, repo, githubToken); err != nil {
+			log.Printf("Failed to count open pull requests for %s/%s: %v", owner, repo, err)
+		} else {
+			activity.OpenPullRequests = prs
+		}
+		job.trackStep("activity", start)
 	}
 
-	// Step 8: Send to Perplexity AI for analysis
-	log.Printf("Sending %d files to Perplexity AI for analysis", len(codeFiles))
-	aiInput := services.AnalysisInput{
+	return c.analyzeAndStore(ctx, job, services.AnalysisInput{
 		RepoName:        repo,
 		RepoOwner:       owner,
-		Description:     repoInfo.Description,
-		PrimaryLanguage: repoInfo.Language,
+		Description:     job.description,
+		PrimaryLanguage: job.language,
 		README:          readme,
+		READMESize:      readmeSize,
 		CodeStructure:   codeStructure,
 		CodeFiles:       codeFiles, // THE ACTUAL CODE!
+		MetadataOnly:    job.mode == models.ModeMetadata,
+		License:         spdxID,
+		NoLicense:       licenseErr == nil && license == nil,
+		Activity:        activity,
+	})
+}
+
+// analyzeAndStore stores the fetched code, sends it to the AI and stores the
+// result, charging the user's quota once it is saved. The analysis is marked
+// failed on error.
+func (c *AnalyzeController) analyzeAndStore(ctx context.Context, job *analysisJob, aiInput services.AnalysisInput) error {
+	// Code files were redacted as they were fetched; the README is redacted
+	// here for every source alike
+	if c.config.RedactSecrets {
+		var redacted int
+		aiInput.README, redacted = services.RedactText(aiInput.README)
+		if redacted > 0 {
+			log.Printf("Redacted %d secrets from the README of analysis %d", redacted, job.analysisID)
+		}
 	}
 
+	// Step 10: Store GitHub data
+	if err := c.analysisService.UpdateGitHubData(ctx, job.analysisID, aiInput.CodeStructure, aiInput.CodeFiles, aiInput.README, c.config.StoreFileHashesOnly); err != nil {
+		log.Printf("Failed to store GitHub data: %v", err)
+	}
+	if len(job.skipped) > 0 {
+		if err := c.analysisService.UpdateSkippedFiles(ctx, job.analysisID, job.skipped); err != nil {
+			log.Printf("Failed to store skipped files: %v", err)
+		}
+	}
+
+	// Step 11: Send to Perplexity AI for analysis
+	log.Printf("Sending %d files to Perplexity AI (%s) for analysis", len(aiInput.CodeFiles), c.perplexityService.ModelFor(job.language))
+
+	// Don't spend tokens on an input with nothing in it
+	if err := aiInput.Validate(); err != nil {
+		msg := fmt.Sprintf("Invalid analysis input: %v", err)
+		if errors.Is(err, services.ErrNothingToAnalyze) {
+			msg = "Nothing to analyze: the repository has no readable files or README"
+		}
+		_ = c.analysisService.Fail(ctx, job.analysisID, msg)
+		return err
+	}
+
+	if c.config.CacheResults {
+		reused, err := c.reuseCachedResult(ctx, job, aiInput)
+		if err != nil || reused {
+			return err
+		}
+	}
+
+	if c.config.CaptureAIExchange {
+		aiInput.Capture = &services.AIExchange{}
+	}
+
+	start := time.Now()
 	aiResult, err := c.perplexityService.Analyze(ctx, aiInput)
+	job.trackStep("ai", start)
+	if aiInput.Capture != nil && aiInput.Capture.Request != "" {
+		if err := c.analysisService.UpdateAIExchange(ctx, job.analysisID, aiInput.Capture.Request, aiInput.Capture.Response); err != nil {
+			log.Printf("Failed to store AI exchange: %v", err)
+		}
+	}
 	if err != nil {
-		_ = c.analysisService.Fail(ctx, analysis.ID, fmt.Sprintf("AI analysis failed: %v", err))
-		return 0, fmt.Errorf("AI analysis failed: %w", err)
+		_ = c.analysisService.Fail(ctx, job.analysisID, fmt.Sprintf("AI analysis failed: %v", err))
+		return fmt.Errorf("AI analysis failed: %w", err)
 	}
 	log.Printf("AI analysis completed, found %d issues, used %d tokens", len(aiResult.Issues), aiResult.TokensUsed)
 
-	// Step 9: Store results
-	if err := c.analysisService.Complete(ctx, analysis.ID, aiResult.RawAnalysis, aiResult.Summary, aiResult.Issues, aiResult.TokensUsed); err != nil {
-		return 0, fmt.Errorf("failed to store results: %w", err)
+	// Step 12: Store results, reporting skipped files as an INFO issue
+	issues := aiResult.Issues
+	if len(job.skipped) > 0 {
+		issues = append(issues[:len(issues):len(issues)], models.SkippedFilesIssue(job.skipped))
+		aiResult.Summary.Recompute(issues)
+	}
+	if err := c.analysisService.Complete(ctx, job.analysisID, aiResult.RawAnalysis, aiResult.Summary, issues, aiResult.TokensUsed); err != nil {
+		_ = c.analysisService.Fail(ctx, job.analysisID, "Failed to store analysis results")
+		return fmt.Errorf("failed to store results: %w", err)
+	}
+	if aiResult.Truncated() {
+		log.Printf("AI response for analysis %d was truncated, issues may be incomplete", job.analysisID)
+	}
+	if err := c.analysisService.SetFinishReason(ctx, job.analysisID, aiResult.FinishReason); err != nil {
+		log.Printf("Failed to store finish reason: %v", err)
 	}
 
-	// Step 10: Update user quota
-	if err := c.userService.UpdateAPIQuota(ctx, user.ID, aiResult.TokensUsed); err != nil {
+	// Step 13: Update user quota - only once the result is safely stored,
+	// so a failed AI call or store never costs the user tokens
+	if err := c.userService.UpdateAPIQuota(ctx, job.userID, aiResult.TokensUsed); err != nil {
 		log.Printf("Failed to update user quota: %v", err)
 	}
 
-	return analysis.ID, nil
+	return nil
+}
+
+// reuseCachedResult completes the analysis with the result of the user's
+// latest completed analysis of identical AI input, if there is one. Nothing
+// is charged to the user's quota. Failures other than a cancelled analysis
+// are logged and leave the analysis to the AI.
+func (c *AnalyzeController) reuseCachedResult(ctx context.Context, job *analysisJob, aiInput services.AnalysisInput) (bool, error) {
+	key := c.perplexityService.CacheKey(aiInput)
+	if err := c.analysisService.SetCacheKey(ctx, job.analysisID, key); err != nil {
+		log.Printf("Failed to store cache key: %v", err)
+	}
+
+	sourceID, err := c.analysisService.CachedResultID(ctx, job.userID, key)
+	if err != nil {
+		log.Printf("Failed to look up cached result: %v", err)
+		return false, nil
+	}
+	if sourceID == 0 {
+		return false, nil
+	}
+
+	start := time.Now()
+	err = c.analysisService.CompleteFromCache(ctx, job.analysisID, sourceID)
+	job.trackStep("cache", start)
+	if errors.Is(err, models.ErrAnalysisNotRunning) {
+		return false, err
+	}
+	if err != nil {
+		log.Printf("Failed to reuse result of analysis %d: %v", sourceID, err)
+		return false, nil
+	}
+
+	log.Printf("Analysis %d reused the result of analysis %d, no tokens used", job.analysisID, sourceID)
+	return true, nil
+}
+
+// recordStepTimings logs the job's step timings as a single JSON line and
+// stores them on the analysis.
+func (c *AnalyzeController) recordStepTimings(job *analysisJob) {
+	var total int64
+	for _, t := range job.timings {
+		total += t.DurationMS
+	}
+
+	line, err := json.Marshal(struct {
+		AnalysisID int64               `json:"analysis_id"`
+		Repo       string              `json:"repo"`
+		Mode       models.AnalysisMode `json:"mode"`
+		TotalMS    int64               `json:"total_ms"`
+		Steps      []models.StepTiming `json:"steps"`
+	}{job.analysisID, job.owner + "/" + job.repo, job.mode, total, job.timings})
+	if err == nil {
+		log.Printf("analysis_timings %s", line)
+	}
+
+	// The request context may already be cancelled; timings are still worth keeping
+	if err := c.analysisService.UpdateStepTimings(context.Background(), job.analysisID, job.timings); err != nil {
+		log.Printf("Failed to store step timings for analysis %d: %v", job.analysisID, err)
+	}
+}
+
+// sanitizeRepoURL strips control characters and surrounding whitespace from
+// a submitted repository URL.
+func sanitizeRepoURL(raw string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, raw)
+	return strings.TrimSpace(cleaned)
+}
+
+// analysisErrorMessage maps pipeline errors to a message suitable for the user.
+func analysisErrorMessage(err error) string {
+	var apiErr *services.GitHubAPIError
+	var sizeErr *RepositoryTooLargeError
+	switch {
+	case errors.As(err, &sizeErr):
+		return fmt.Sprintf("This repository is too large to analyze (%d MB, limit %d MB). Try a fork that keeps only the directories you want analyzed.",
+			sizeErr.SizeKB/1024, sizeErr.LimitKB/1024)
+	case errors.Is(err, services.ErrGitHubRateLimited):
+		if errors.As(err, &apiErr) && !apiErr.ResetAt.IsZero() {
+			return fmt.Sprintf("GitHub rate limit reached. Please try again after %s.", apiErr.ResetAt.Format("15:04 MST"))
+		}
+		return "GitHub rate limit reached. Please try again later."
+	case errors.Is(err, services.ErrGitHubUnauthorized):
+		return "Your GitHub authorization has expired. Please reconnect your GitHub account."
+	case errors.Is(err, services.ErrGitHubNotFound):
+		return "Repository not found. Check the URL and that your GitHub account can access it."
+	case errors.Is(err, services.ErrGitHubForbidden):
+		return "GitHub denied access to this repository."
+	case errors.Is(err, ErrGitHubNotConnected):
+		return "Please connect your GitHub account first."
+	case errors.Is(err, ErrGitHubTokenUnavailable):
+		return "Failed to access your GitHub token. Please reconnect your GitHub account."
+	case errors.Is(err, ErrPrivateRepoNeedsConnection):
+		return "This repository is private. Connect your GitHub account to analyze it."
+	case errors.Is(err, models.ErrQuotaExceeded):
+		return "You have exceeded your API quota. Please contact support."
+	case errors.Is(err, ErrTooManyInFlight):
+		return "You have too many analyses in progress. Please wait for one to finish."
+	case errors.Is(err, ErrQueueFull):
+		return "The analysis queue is full. Please try again in a few minutes."
+	case errors.Is(err, services.ErrNothingToAnalyze):
+		return "Nothing to analyze: the repository has no readable files or README."
+	case errors.Is(err, services.ErrAIRateLimited):
+		return "The AI service is busy right now. Please try again in a few minutes."
+	case errors.Is(err, services.ErrAIAuth):
+		return "The AI service rejected our credentials. Please contact the administrator."
+	case errors.Is(err, services.ErrAIServer):
+		return "The AI service is temporarily unavailable. Please try again later."
+	default:
+		return fmt.Sprintf("Analysis failed: %v", err)
+	}
 }
 
 // renderFormError renders the form with an error message.
@@ -256,6 +837,12 @@ func (c *AnalyzeController) renderFormError(w http.ResponseWriter, r *http.Reque
 		githubUsername = *user.GitHubUsername
 	}
 
+	// Keep the submitted mode selected
+	mode, err := models.ParseAnalysisMode(r.FormValue("mode"))
+	if err != nil {
+		mode = models.ModeDeep
+	}
+
 	data := &views.TemplateData{
 		Title:       "Analyze Repository",
 		CSRFToken:   csrf.Token(r),
@@ -265,55 +852,258 @@ func (c *AnalyzeController) renderFormError(w http.ResponseWriter, r *http.Reque
 			RepoURL:         repoURL,
 			GitHubConnected: githubConnected,
 			GitHubUsername:  githubUsername,
+			MaxFiles:        c.maxFilesFor(r.Context(), user.ID),
+			Mode:            mode,
+			MaxUploadMB:     MaxUploadBytes >> 20,
+			PublicOnly:      !githubConnected && c.config.AppGitHubToken != "",
+			BaseRef:         r.FormValue("base_ref"),
+			HeadRef:         r.FormValue("head_ref"),
 		},
 	}
 	c.templates.Form.ExecuteHTTPWithStatus(w, r, http.StatusUnprocessableEntity, data)
 }
 
+// maxFilesFor returns how many files the user's analyses fetch.
+func (c *AnalyzeController) maxFilesFor(ctx context.Context, userID int64) int {
+	prefs, err := c.userService.GetPreferences(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load preferences for user %d: %v", userID, err)
+		return c.maxFilesToFetch
+	}
+	return prefs.MaxFiles
+}
+
+// ResultIssue is an issue listed on the result page with its number,
+// counting from 1 in the order the analysis stores them.
+type ResultIssue struct {
+	Number int
+	models.Issue
+}
+
 // AnalysisResultData holds data for the result template.
 type AnalysisResultData struct {
-	Analysis *models.Analysis
+	Analysis   *models.Analysis
+	Issues     []ResultIssue // issues to list, after the category filter
+	Category   string        // selected category; empty shows all
+	Categories []string      // categories present in the analysis, sorted
+
+	MaxNoteLength int
+
+	// curl command re-running the analysis; empty without stored parameters
+	ReproduceCommand string
 }
 
-// GetResult renders the analysis results page.
+// GetResult renders the analysis results page. The optional ?category=
+// query parameter limits the listed issues to one category.
+// GET /analyze/{id}
 func (c *AnalyzeController) GetResult(w http.ResponseWriter, r *http.Request) {
 	user := middleware.MustCurrentUser(r)
 
+	analysis := c.analysisForUser(w, r, user)
+	if analysis == nil {
+		return
+	}
+
+	groups := analysis.IssuesByCategory()
+	categories := make([]string, 0, len(groups))
+	for category := range groups {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	category, issues := resultIssues(analysis.Issues, r.URL.Query().Get("category"))
+
+	data := &views.TemplateData{
+		Title:       fmt.Sprintf("Analysis: %s", analysis.Repository.FullName()),
+		CSRFToken:   csrf.Token(r),
+		CurrentUser: user,
+		Data: AnalysisResultData{
+			Analysis:   analysis,
+			Issues:     issues,
+			Category:   category,
+			Categories: categories,
+
+			MaxNoteLength: models.MaxNoteLength,
+
+			ReproduceCommand: reproduceCommand(c.config.BaseURL, analysis.Parameters),
+		},
+	}
+
+	c.templates.Result.ExecuteHTTP(w, r, data)
+}
+
+// resultIssues numbers issues and keeps those in category, returning it
+// normalized. An unknown category is returned as given and matches no
+// issues; an empty one keeps them all.
+func resultIssues(issues []models.Issue, category string) (string, []ResultIssue) {
+	category = strings.TrimSpace(category)
+	if canonical, ok := models.LookupCategory(category); ok {
+		category = canonical
+	}
+
+	var listed []ResultIssue
+	for i, issue := range issues {
+		if category == "" || models.NormalizeCategory(issue.Category) == category {
+			listed = append(listed, ResultIssue{Number: i + 1, Issue: issue})
+		}
+	}
+	return category, listed
+}
+
+// GetTree returns the analyzed repository's file tree as nested JSON.
+// GET /analyze/{id}/tree
+func (c *AnalyzeController) GetTree(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	analysis := c.ownedAnalysis(w, r, user, respondError)
+	if analysis == nil {
+		return
+	}
+
+	if analysis.CodeStructure == nil {
+		respondError(w, http.StatusNotFound, codeNotFound, "No file structure stored for this analysis")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, analysis.CodeStructure.ToTree())
+}
+
+// GetLanguages returns the language breakdown as chart-ready JSON.
+// GET /analyze/{id}/languages
+func (c *AnalyzeController) GetLanguages(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	analysis := c.ownedAnalysis(w, r, user, respondError)
+	if analysis == nil {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, analysis.CodeStructure.LanguagePercentages())
+}
+
+// GetFilesArchive streams the source files sent to the AI as a zip archive.
+// GET /analyze/{id}/files.zip
+func (c *AnalyzeController) GetFilesArchive(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	analysis := c.analysisForUser(w, r, user)
+	if analysis == nil {
+		return
+	}
+
+	if len(analysis.CodeFiles) == 0 {
+		http.Error(w, "No source files stored for this analysis", http.StatusNotFound)
+		return
+	}
+
+	// Check the size up front: once streaming starts the status is sent
+	total := 0
+	for _, file := range analysis.CodeFiles {
+		total += len(file.Content)
+	}
+	if total > maxArchiveBytes {
+		http.Error(w, "Stored files are too large to export", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	name := fmt.Sprintf("analysis-%d-files.zip", analysis.ID)
+	if analysis.Repository != nil {
+		name = fmt.Sprintf("%s-%s-files.zip", analysis.Repository.Owner, analysis.Repository.Name)
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	for _, file := range analysis.CodeFiles {
+		// Stored paths come from the GitHub tree; keep them relative anyway
+		entry := strings.TrimPrefix(path.Clean("/"+file.Path), "/")
+		if entry == "" {
+			continue
+		}
+		fw, err := zw.Create(entry)
+		if err != nil {
+			log.Printf("Failed to add %s to archive for analysis %d: %v", entry, analysis.ID, err)
+			return
+		}
+		if _, err := io.WriteString(fw, file.Content); err != nil {
+			log.Printf("Failed to write archive for analysis %d: %v", analysis.ID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Failed to finish archive for analysis %d: %v", analysis.ID, err)
+	}
+}
+
+// analysisForUser loads the analysis named by the {id} URL param and checks
+// that it belongs to user. On failure it writes the error response and returns nil.
+func (c *AnalyzeController) analysisForUser(w http.ResponseWriter, r *http.Request, user *models.User) *models.Analysis {
+	return c.ownedAnalysis(w, r, user, func(w http.ResponseWriter, status int, _, msg string) {
+		http.Error(w, msg, status)
+	})
+}
+
+// ownedAnalysis is analysisForUser with the error response written by
+// respond, so JSON endpoints can use respondError.
+func (c *AnalyzeController) ownedAnalysis(w http.ResponseWriter, r *http.Request, user *models.User, respond func(w http.ResponseWriter, status int, code, msg string)) *models.Analysis {
 	// Get analysis ID from URL
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid analysis ID", http.StatusBadRequest)
-		return
+		respond(w, http.StatusBadRequest, codeInvalidRequest, "Invalid analysis ID")
+		return nil
 	}
 
 	// Fetch analysis
 	analysis, err := c.analysisService.ByID(r.Context(), id)
 	if err != nil {
 		if err == models.ErrAnalysisNotFound {
-			http.Error(w, "Analysis not found", http.StatusNotFound)
-			return
+			respond(w, http.StatusNotFound, codeNotFound, "Analysis not found")
+			return nil
 		}
-		http.Error(w, "Failed to load analysis", http.StatusInternalServerError)
-		return
+		respond(w, http.StatusInternalServerError, codeInternal, "Failed to load analysis")
+		return nil
 	}
 
 	// Verify ownership
 	if analysis.UserID != user.ID {
-		http.Error(w, "Access denied", http.StatusForbidden)
+		respond(w, http.StatusForbidden, codeForbidden, "Access denied")
+		return nil
+	}
+
+	return analysis
+}
+
+// PostNote sets or clears the user's note on an analysis.
+// POST /analyze/{id}/note
+func (c *AnalyzeController) PostNote(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid analysis ID", http.StatusBadRequest)
 		return
 	}
 
-	data := &views.TemplateData{
-		Title:       fmt.Sprintf("Analysis: %s", analysis.Repository.FullName()),
-		CSRFToken:   csrf.Token(r),
-		CurrentUser: user,
-		Data: AnalysisResultData{
-			Analysis: analysis,
-		},
+	r.Body = http.MaxBytesReader(w, r.Body, maxAnalyzeFormBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
 	}
 
-	c.templates.Result.ExecuteHTTP(w, r, data)
+	if err := c.analysisService.SetNote(r.Context(), id, user.ID, r.FormValue("note")); err != nil {
+		if errors.Is(err, models.ErrAnalysisNotFound) {
+			http.Redirect(w, r, "/dashboard?error=Analysis+not+found", http.StatusSeeOther)
+			return
+		}
+		log.Printf("Failed to set note on analysis %d: %v", id, err)
+		http.Redirect(w, r, "/dashboard?error=Failed+to+save+note", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/analyze/%d", id), http.StatusSeeOther)
 }
 
 // DeleteAnalysis handles analysis deletion.
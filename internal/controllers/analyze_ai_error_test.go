@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+func TestAnalyzeAndStoreAIFailure(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusUnauthorized, services.ErrAIAuth},
+		{http.StatusTooManyRequests, services.ErrAIRateLimited},
+		{http.StatusInternalServerError, services.ErrAIServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			env := newTestEnv(t, AnalyzeConfig{QueueSize: 1}, mockGitHubRepos())
+			env.useAI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprintf(w, `{"error": {"message": %q}}`, http.StatusText(tt.status))
+			}))
+			ctx := context.Background()
+			user := env.newGitHubUser(t, "ai@example.com", 100000)
+
+			repo := &models.Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+			_, analysis, _, err := env.analyses.CreateWithRepository(ctx, repo, models.ModeDeep, 0, models.AnalysisLimits{ReserveTokens: minQuotaReserve})
+			if err != nil {
+				t.Fatalf("CreateWithRepository: %v", err)
+			}
+			if err := env.analyses.MarkProcessing(ctx, analysis.ID); err != nil {
+				t.Fatalf("MarkProcessing: %v", err)
+			}
+
+			job := &analysisJob{analysisID: analysis.ID, userID: user.ID, owner: "acme", repo: "app"}
+			input := services.AnalysisInput{RepoOwner: "acme", RepoName: "app", README: "# app"}
+			if err := env.c.analyzeAndStore(ctx, job, input); !errors.Is(err, tt.want) {
+				t.Errorf("analyzeAndStore = %v, want %v", err, tt.want)
+			}
+
+			if status := env.status(t, analysis.ID); status != models.StatusFailed {
+				t.Errorf("analysis status = %s, want %s", status, models.StatusFailed)
+			}
+			reloaded, err := env.users.ByID(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("reload user: %v", err)
+			}
+			if reloaded.APIQuotaUsed != user.APIQuotaUsed {
+				t.Errorf("api_quota_used = %d, want %d", reloaded.APIQuotaUsed, user.APIQuotaUsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+const (
+	// maxBatchSize is the most repositories accepted in one batch request.
+	maxBatchSize = 10
+	// maxBatchBodyBytes caps the batch request body.
+	maxBatchBodyBytes = 64 << 10
+	// estimatedTokensPerAnalysis is the quota reserved per repository in a
+	// batch or comparison until its analysis finishes.
+	estimatedTokensPerAnalysis = 5000
+	// minQuotaReserve is the quota reserved for any other analysis: just
+	// enough that it can't start with none left.
+	minQuotaReserve = 1
+)
+
+// BatchAnalyzeRequest is the body of POST /api/v1/analyses/batch. The
+// optional fields override the user's defaults, e.g. to reproduce an
+// earlier analysis from its parameters.
+type BatchAnalyzeRequest struct {
+	RepoURLs []string              `json:"repo_urls"`
+	Ref      string                `json:"ref,omitempty"` // only with a single repository
+	Mode     models.AnalysisMode   `json:"mode,omitempty"`
+	MaxFiles int                   `json:"max_files,omitempty"`
+	Scoring  *models.ScoringConfig `json:"scoring,omitempty"`
+}
+
+// gitRefPattern matches branch, tag and commit names that are safe to put in
+// GitHub API URLs.
+var gitRefPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]{1,255}$`)
+
+// BatchAnalyzeResponse lists the analyses created for a batch.
+type BatchAnalyzeResponse struct {
+	AnalysisIDs []int64 `json:"analysis_ids"`
+}
+
+// batchItem is a validated repository from a batch request.
+type batchItem struct {
+	owner        string
+	repo         string
+	repoURL      string
+	repoInfo     *services.GitHubRepository
+	metadataTime time.Duration
+}
+
+// PostBatch creates and enqueues one analysis per repository. The batch is
+// all-or-nothing: if any repository is invalid or the batch would exceed the
+// user's quota or repository limit, nothing is created.
+// POST /api/v1/analyses/batch
+func (c *AnalyzeController) PostBatch(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+	var req BatchAnalyzeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	if len(req.RepoURLs) == 0 {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "repo_urls must not be empty")
+		return
+	}
+	if len(req.RepoURLs) > maxBatchSize {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("At most %d repositories per batch", maxBatchSize))
+		return
+	}
+
+	mode, err := models.ParseAnalysisMode(string(req.Mode))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "mode must be deep or metadata")
+		return
+	}
+	if req.MaxFiles < 0 || req.MaxFiles > models.MaxFilesLimit {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("max_files must be between 1 and %d", models.MaxFilesLimit))
+		return
+	}
+	if req.Ref != "" {
+		if len(req.RepoURLs) != 1 {
+			respondError(w, http.StatusBadRequest, codeInvalidRequest, "ref can only be given for a single repository")
+			return
+		}
+		if !validRef(req.Ref) {
+			respondError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid ref")
+			return
+		}
+	}
+	if req.Scoring != nil {
+		if err := req.Scoring.Validate(); err != nil {
+			respondError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		req.Scoring.FillDefaults()
+	}
+
+	// Validate and de-duplicate URLs
+	var items []*batchItem
+	seen := make(map[string]bool)
+	for _, raw := range req.RepoURLs {
+		if len(raw) > maxRepoURLLength {
+			respondError(w, http.StatusBadRequest, codeInvalidRequest, "Repository URL is too long")
+			return
+		}
+		repoURL := sanitizeRepoURL(raw)
+		owner, repo, err := models.ParseGitHubURL(repoURL)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Invalid GitHub repository URL: %q", repoURL))
+			return
+		}
+		key := owner + "/" + repo
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		items = append(items, &batchItem{owner: owner, repo: repo, repoURL: repoURL})
+	}
+
+	if !user.HasGitHubConnected() {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "Please connect your GitHub account first")
+		return
+	}
+
+	encryptedToken, err := c.userService.GetGitHubToken(ctx, user.ID)
+	if err != nil || encryptedToken == "" {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "GitHub token not found. Please reconnect your GitHub account.")
+		return
+	}
+
+	githubToken, err := c.encryptor.Decrypt(encryptedToken)
+	if err != nil {
+		log.Printf("Failed to decrypt GitHub token: %v", err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to access GitHub token. Please reconnect your GitHub account.")
+		return
+	}
+
+	// Quota is enforced for the batch as a whole
+	if user.RemainingQuota() < len(items)*estimatedTokensPerAnalysis {
+		respondError(w, http.StatusForbidden, codeForbidden, "This batch would exceed your API quota")
+		return
+	}
+
+	// So is the per-user repository limit, counting only repositories the user doesn't have yet
+	if c.config.MaxReposPerUser > 0 {
+		existing, err := c.repositoryService.CountByUser(ctx, user.ID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, codeInternal, "Failed to check repository limit")
+			return
+		}
+
+		added := 0
+		for _, item := range items {
+			_, err := c.repositoryService.ByUserAndURL(ctx, user.ID, item.repoURL)
+			if errors.Is(err, models.ErrRepositoryNotFound) {
+				added++
+			} else if err != nil {
+				respondError(w, http.StatusInternalServerError, codeInternal, "Failed to check repository limit")
+				return
+			}
+		}
+
+		if existing+added > c.config.MaxReposPerUser {
+			respondError(w, http.StatusForbidden, codeForbidden, fmt.Sprintf("This batch would exceed your limit of %d repositories", c.config.MaxReposPerUser))
+			return
+		}
+	}
+
+	if err := c.checkQueueCapacity(ctx, len(items)); err != nil {
+		if errors.Is(err, ErrQueueFull) {
+			respondQueueFull(w)
+			return
+		}
+		log.Printf("Failed to check analysis queue: %v", err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to check the analysis queue")
+		return
+	}
+
+	// Fetch all metadata before writing anything so a bad repo rejects the batch
+	for _, item := range items {
+		item.repoInfo, item.metadataTime, err = c.fetchRepository(ctx, item.owner, item.repo, githubToken)
+		if err != nil {
+			log.Printf("Batch analysis rejected at %s/%s: %v", item.owner, item.repo, err)
+			respondError(w, http.StatusBadGateway, codeUpstream, fmt.Sprintf("%s/%s: %s", item.owner, item.repo, analysisErrorMessage(err)))
+			return
+		}
+	}
+
+	var jobs []*analysisJob
+	for _, item := range items {
+		job, err := c.createAnalysisWithin(ctx, user, item.repoInfo, item.metadataTime, item.owner, item.repo, item.repoURL, githubToken, mode, c.config.DedupWindow, estimatedTokensPerAnalysis)
+		if err != nil {
+			log.Printf("Failed to create batch analysis for %s/%s: %v", item.owner, item.repo, err)
+			c.rejectBatch(ctx, jobs)
+			if errors.Is(err, ErrTooManyInFlight) {
+				respondError(w, http.StatusTooManyRequests, codeRateLimited, "This batch would exceed your limit of analyses in progress")
+				return
+			}
+			if errors.Is(err, models.ErrQuotaExceeded) {
+				respondError(w, http.StatusForbidden, codeForbidden, "This batch would exceed your API quota")
+				return
+			}
+			respondError(w, http.StatusInternalServerError, codeInternal, "Failed to create analyses")
+			return
+		}
+		job.ref = req.Ref
+		if req.MaxFiles > 0 {
+			job.maxFiles = req.MaxFiles
+		}
+		if req.Scoring != nil {
+			job.scoring = req.Scoring
+		}
+		jobs = append(jobs, job)
+	}
+
+	// Capacity was checked up front, but other requests share the queue: if
+	// it fills up anyway, the jobs already queued are failed with the rest
+	// and skipped by the workers
+	resp := BatchAnalyzeResponse{AnalysisIDs: make([]int64, 0, len(jobs))}
+	for _, job := range jobs {
+		if !job.reused {
+			if err := c.enqueue(job); err != nil {
+				log.Printf("Batch rejected: queue filled up at %s/%s", job.owner, job.repo)
+				c.rejectBatch(ctx, jobs)
+				respondQueueFull(w)
+				return
+			}
+		}
+		resp.AnalysisIDs = append(resp.AnalysisIDs, job.analysisID)
+	}
+
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+// rejectBatch fails the analyses created for a rejected batch, releasing
+// their quota reservations. Queued ones are skipped by the workers and
+// running ones are stopped; reused analyses belong to earlier requests and
+// are left alone.
+func (c *AnalyzeController) rejectBatch(ctx context.Context, jobs []*analysisJob) {
+	for _, job := range jobs {
+		if job.reused {
+			continue
+		}
+		if err := c.analysisService.Fail(ctx, job.analysisID, "Batch was rejected before this analysis started"); err != nil {
+			log.Printf("Failed to fail rejected batch analysis %d: %v", job.analysisID, err)
+		}
+		c.stopRunning(job.analysisID)
+	}
+}
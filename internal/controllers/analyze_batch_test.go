@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appctx "github.com/rahul4469/github-analyzer/internal/context"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestPostBatch(t *testing.T) {
+	three := `{"repo_urls": ["https://github.com/acme/one", "https://github.com/acme/two", "https://github.com/acme/three"]}`
+
+	tests := []struct {
+		name      string
+		queueSize int
+		quota     int
+		reserved  bool // another analysis already holds estimatedTokensPerAnalysis
+		body      string
+		wantCode  int
+		wantQueue int
+	}{
+		{
+			name:      "enqueued",
+			queueSize: 5, quota: 3 * estimatedTokensPerAnalysis, body: three,
+			wantCode: http.StatusAccepted, wantQueue: 3,
+		},
+		{
+			name:      "over quota up front",
+			queueSize: 5, quota: 2 * estimatedTokensPerAnalysis, body: three,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:      "over quota once in-flight reservations count",
+			queueSize: 5, quota: 3 * estimatedTokensPerAnalysis, reserved: true, body: three,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:      "larger than the queue",
+			queueSize: 2, quota: 3 * estimatedTokensPerAnalysis, body: three,
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, AnalyzeConfig{QueueSize: tt.queueSize}, mockGitHubRepos())
+			ctx := context.Background()
+			user := env.newGitHubUser(t, "batch@example.com", tt.quota)
+
+			var existing int64
+			if tt.reserved {
+				repo := &models.Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/other", Owner: "acme", Name: "other"}
+				_, analysis, _, err := env.analyses.CreateWithRepository(ctx, repo, models.ModeDeep, 0, models.AnalysisLimits{ReserveTokens: estimatedTokensPerAnalysis})
+				if err != nil {
+					t.Fatalf("CreateWithRepository: %v", err)
+				}
+				existing = analysis.ID
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/analyses/batch", strings.NewReader(tt.body))
+			r = r.WithContext(appctx.SetUser(r.Context(), user))
+			w := httptest.NewRecorder()
+			env.c.PostBatch(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if len(env.c.jobs) != tt.wantQueue {
+				t.Errorf("%d jobs queued, want %d", len(env.c.jobs), tt.wantQueue)
+			}
+
+			// All or nothing: a rejected batch leaves no analysis to run
+			rows, err := env.pool.Query(ctx, `SELECT id, status FROM analyses WHERE id <> $1`, existing)
+			if err != nil {
+				t.Fatalf("list analyses: %v", err)
+			}
+			defer rows.Close()
+			pending := 0
+			for rows.Next() {
+				var id int64
+				var status models.AnalysisStatus
+				if err := rows.Scan(&id, &status); err != nil {
+					t.Fatalf("scan: %v", err)
+				}
+				if status == models.StatusPending {
+					pending++
+				}
+			}
+			if pending != tt.wantQueue {
+				t.Errorf("%d batch analyses pending, want %d", pending, tt.wantQueue)
+			}
+
+			if tt.wantCode == http.StatusAccepted {
+				var resp BatchAnalyzeResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decode %q: %v", w.Body, err)
+				}
+				if len(resp.AnalysisIDs) != tt.wantQueue {
+					t.Errorf("analysis_ids = %v, want %d", resp.AnalysisIDs, tt.wantQueue)
+				}
+			}
+			if tt.wantCode == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "30" {
+				t.Errorf("Retry-After = %q, want 30", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
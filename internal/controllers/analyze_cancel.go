@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// startProcessing marks job's analysis as processing and registers its run
+// so PostCancel can stop it. It returns ctx wrapped with that cancellation,
+// and done to call when the run ends. An analysis cancelled while queued
+// returns models.ErrAnalysisNotRunning and must not be run.
+func (c *AnalyzeController) startProcessing(ctx context.Context, job *analysisJob) (context.Context, func(), error) {
+	if err := c.analysisService.MarkProcessing(ctx, job.analysisID); err != nil {
+		if errors.Is(err, models.ErrAnalysisNotRunning) {
+			return ctx, nil, err
+		}
+		log.Printf("Failed to mark analysis as processing: %v", err)
+	}
+
+	ctx, done := c.trackRunning(ctx, job.analysisID)
+	return ctx, done, nil
+}
+
+// trackRunning registers a run of an analysis so stopRunning can cancel it.
+// It returns ctx wrapped with that cancellation, and done to call when the
+// run ends.
+func (c *AnalyzeController) trackRunning(ctx context.Context, analysisID int64) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.runningMu.Lock()
+	c.running[analysisID] = cancel
+	c.runningMu.Unlock()
+
+	done := func() {
+		c.runningMu.Lock()
+		delete(c.running, analysisID)
+		c.runningMu.Unlock()
+		cancel()
+	}
+	return ctx, done
+}
+
+// stopRunning cancels the context of an analysis running in this process.
+// It reports whether one was found.
+func (c *AnalyzeController) stopRunning(analysisID int64) bool {
+	c.runningMu.Lock()
+	cancel, ok := c.running[analysisID]
+	c.runningMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// PostCancel cancels one of the user's pending or processing analyses. A
+// queued one is skipped when a worker picks it up; a running one has its
+// GitHub and AI requests aborted. Either way no quota is used.
+// POST /analyze/{id}/cancel
+func (c *AnalyzeController) PostCancel(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid analysis ID", http.StatusBadRequest)
+		return
+	}
+
+	previous, err := c.analysisService.Cancel(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrAnalysisNotFound):
+			http.Redirect(w, r, "/dashboard?error=Analysis+not+found", http.StatusSeeOther)
+		case errors.Is(err, models.ErrAnalysisNotRunning):
+			http.Redirect(w, r, fmt.Sprintf("/analyze/%d", id), http.StatusSeeOther)
+		default:
+			log.Printf("Failed to cancel analysis %d: %v", id, err)
+			http.Redirect(w, r, "/dashboard?error=Failed+to+cancel+analysis", http.StatusSeeOther)
+		}
+		return
+	}
+
+	// A run on another instance isn't stopped, but Complete refuses the
+	// cancelled analysis, so its result is dropped
+	if previous == models.StatusProcessing && !c.stopRunning(id) {
+		log.Printf("Cancelled analysis %d is not running in this process", id)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/analyze/%d", id), http.StatusSeeOther)
+}
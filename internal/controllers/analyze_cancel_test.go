@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStopRunning(t *testing.T) {
+	tests := []struct {
+		name      string
+		running   bool // whether a fake worker is running the analysis
+		finished  bool // whether it finished before the cancel
+		wantFound bool
+	}{
+		{name: "processing in this process", running: true, wantFound: true},
+		{name: "not running here", running: false},
+		{name: "already finished", running: true, finished: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &AnalyzeController{running: make(map[int64]context.CancelFunc)}
+			const id = 42
+
+			stopped := make(chan error, 1)
+			if tt.running {
+				ctx, done := c.trackRunning(context.Background(), id)
+				if tt.finished {
+					done()
+				} else {
+					// A fake worker blocked on its GitHub or AI request
+					go func() {
+						defer done()
+						<-ctx.Done()
+						stopped <- ctx.Err()
+					}()
+				}
+			}
+
+			if found := c.stopRunning(id); found != tt.wantFound {
+				t.Fatalf("stopRunning = %v, want %v", found, tt.wantFound)
+			}
+			if !tt.wantFound {
+				return
+			}
+
+			select {
+			case err := <-stopped:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("worker stopped with %v, want context.Canceled", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("worker wasn't cancelled")
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/csrf"
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/views"
+)
+
+// validRef reports whether ref is a branch, tag or commit name that is safe
+// to put in GitHub API URLs. Git forbids ".." in refs; rejecting it also
+// keeps the ref out of path traversal.
+func validRef(ref string) bool {
+	return gitRefPattern.MatchString(ref) && !strings.Contains(ref, "..")
+}
+
+// PostCompare analyzes a repository at two refs for a before/after
+// comparison. Both analyses are created and enqueued together, the head one
+// linked to the base one, and the user is sent to the comparison page.
+// POST /analyze/compare
+func (c *AnalyzeController) PostCompare(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAnalyzeFormBytes)
+	if err := r.ParseForm(); err != nil {
+		c.renderFormError(w, r, user, "", "Invalid form data")
+		return
+	}
+
+	rawURL := r.FormValue("repo_url")
+	if len(rawURL) > maxRepoURLLength {
+		c.renderFormError(w, r, user, "", "Repository URL is too long")
+		return
+	}
+	repoURL := sanitizeRepoURL(rawURL)
+
+	mode, err := models.ParseAnalysisMode(r.FormValue("mode"))
+	if err != nil {
+		c.renderFormError(w, r, user, repoURL, "Invalid analysis mode")
+		return
+	}
+
+	owner, repo, err := models.ParseGitHubURL(repoURL)
+	if err != nil {
+		c.renderFormError(w, r, user, repoURL, "Invalid GitHub repository URL. Use format: https://github.com/owner/repo")
+		return
+	}
+
+	baseRef := strings.TrimSpace(r.FormValue("base_ref"))
+	headRef := strings.TrimSpace(r.FormValue("head_ref"))
+	if !validRef(baseRef) || !validRef(headRef) {
+		c.renderFormError(w, r, user, repoURL, "Enter a valid branch, tag or commit for both refs")
+		return
+	}
+	if baseRef == headRef {
+		c.renderFormError(w, r, user, repoURL, "The base and head refs must differ")
+		return
+	}
+
+	// Quota is reserved for both analyses
+	if user.RemainingQuota() < 2*estimatedTokensPerAnalysis {
+		c.renderFormError(w, r, user, repoURL, "This comparison would exceed your API quota")
+		return
+	}
+
+	githubToken, appToken, err := c.githubTokenFor(ctx, user, owner, repo)
+	if err == nil {
+		err = c.checkInFlight(ctx, user.ID, 2)
+	}
+	if err == nil {
+		err = c.checkQueueCapacity(ctx, 2)
+	}
+	if err != nil {
+		c.renderFormError(w, r, user, repoURL, analysisErrorMessage(err))
+		return
+	}
+
+	repoInfo, metadataTime, err := c.fetchRepository(ctx, owner, repo, githubToken)
+	if err == nil && appToken && repoInfo.Private {
+		err = ErrPrivateRepoNeedsConnection
+	}
+	if err != nil {
+		log.Printf("Comparison rejected for %s/%s: %v", owner, repo, err)
+		c.renderFormError(w, r, user, repoURL, analysisErrorMessage(err))
+		return
+	}
+
+	// Never reuse an in-flight analysis: it would be at the other ref
+	var jobs []*analysisJob
+	for _, ref := range []string{baseRef, headRef} {
+		job, err := c.createAnalysisWithin(ctx, user, repoInfo, metadataTime, owner, repo, repoURL, githubToken, mode, 0, estimatedTokensPerAnalysis)
+		if err != nil {
+			log.Printf("Failed to create comparison analysis for %s/%s@%s: %v", owner, repo, ref, err)
+			for _, created := range jobs {
+				_ = c.analysisService.Fail(ctx, created.analysisID, "Comparison was rejected before this analysis started")
+			}
+			message := "Failed to create analyses"
+			if errors.Is(err, models.ErrQuotaExceeded) {
+				message = "This comparison would exceed your API quota"
+			} else if errors.Is(err, ErrTooManyInFlight) {
+				message = analysisErrorMessage(err)
+			}
+			c.renderFormError(w, r, user, repoURL, message)
+			return
+		}
+		job.ref = ref
+		jobs = append(jobs, job)
+	}
+	base, head := jobs[0], jobs[1]
+
+	if err := c.analysisService.LinkComparison(ctx, base.analysisID, head.analysisID, baseRef, headRef); err != nil {
+		log.Printf("Failed to link analyses %d and %d: %v", base.analysisID, head.analysisID, err)
+		for _, job := range jobs {
+			_ = c.analysisService.Fail(ctx, job.analysisID, "Comparison was rejected before this analysis started")
+		}
+		c.renderFormError(w, r, user, repoURL, "Failed to create analyses")
+		return
+	}
+
+	for _, job := range jobs {
+		if err := c.enqueue(job); err != nil {
+			_ = c.analysisService.Fail(ctx, job.analysisID, "Analysis queue is full, please try again later")
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/analyze/%d/compare", head.analysisID), http.StatusSeeOther)
+}
+
+// CompareData holds data for the comparison template.
+type CompareData struct {
+	Base *models.Analysis
+	Head *models.Analysis
+
+	// Set once both analyses completed; Drift also needs both to have
+	// fetched their files
+	Issues *models.IssueDiff
+	Drift  *models.FileDrift
+}
+
+// InProgress reports whether either analysis is still pending or
+// processing.
+func (d CompareData) InProgress() bool {
+	return d.Base.Status == models.StatusPending || d.Base.Status == models.StatusProcessing ||
+		d.Head.Status == models.StatusPending || d.Head.Status == models.StatusProcessing
+}
+
+// GetCompare renders a before/after comparison started with PostCompare:
+// progress while its analyses run, then the issues new in the head ref,
+// those resolved since the base ref, and the files that changed.
+// GET /analyze/{id}/compare
+func (c *AnalyzeController) GetCompare(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	head := c.analysisForUser(w, r, user)
+	if head == nil {
+		return
+	}
+	if head.CompareBaseID == nil {
+		http.Error(w, "This analysis is not part of a comparison", http.StatusNotFound)
+		return
+	}
+
+	base, err := c.analysisService.ByID(r.Context(), *head.CompareBaseID)
+	if err != nil && !errors.Is(err, models.ErrAnalysisNotFound) {
+		log.Printf("Failed to load base analysis %d: %v", *head.CompareBaseID, err)
+		http.Error(w, "Failed to load analysis", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || base.UserID != user.ID {
+		http.Error(w, "Base analysis not found", http.StatusNotFound)
+		return
+	}
+
+	data := CompareData{Base: base, Head: head}
+	if base.Status == models.StatusCompleted && head.Status == models.StatusCompleted {
+		diff := models.DiffIssues(base.Issues, head.Issues)
+		data.Issues = &diff
+		if base.ContentHash != nil && head.ContentHash != nil {
+			drift := models.CompareFileHashes(base.FileHashes, head.FileHashes)
+			data.Drift = &drift
+		}
+	}
+
+	c.templates.Compare.ExecuteHTTP(w, r, &views.TemplateData{
+		Title:       fmt.Sprintf("Compare: %s", head.Repository.FullName()),
+		CSRFToken:   csrf.Token(r),
+		CurrentUser: user,
+		Data:        data,
+	})
+}
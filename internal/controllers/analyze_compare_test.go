@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestCompareDataInProgress(t *testing.T) {
+	tests := []struct {
+		base, head models.AnalysisStatus
+		want       bool
+	}{
+		{models.StatusPending, models.StatusPending, true},
+		{models.StatusCompleted, models.StatusProcessing, true},
+		{models.StatusProcessing, models.StatusCompleted, true},
+		{models.StatusCompleted, models.StatusCompleted, false},
+		{models.StatusFailed, models.StatusCompleted, false},
+	}
+
+	for _, tt := range tests {
+		data := CompareData{Base: &models.Analysis{Status: tt.base}, Head: &models.Analysis{Status: tt.head}}
+		if got := data.InProgress(); got != tt.want {
+			t.Errorf("InProgress() with %s base and %s head = %v, want %v", tt.base, tt.head, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// AnalysisDetailResponse is the public view of an analysis. Internal fields
+// like the owner id, raw AI output, token usage and step timings are left out.
+type AnalysisDetailResponse struct {
+	ID            int64                   `json:"id"`
+	Status        models.AnalysisStatus   `json:"status"`
+	Mode          models.AnalysisMode     `json:"mode"`
+	CommitSHA     *string                 `json:"commit_sha,omitempty"`
+	ContentHash   *string                 `json:"content_hash,omitempty"` // TreeHash of the files sent to the AI
+	Note          *string                 `json:"note,omitempty"`
+	ErrorMessage  *string                 `json:"error_message,omitempty"`
+	Summary       *models.AnalysisSummary `json:"summary,omitempty"`
+	Issues        []models.Issue          `json:"issues"`
+	CodeStructure *models.CodeStructure   `json:"code_structure,omitempty"`
+	SkippedFiles  []models.SkippedFile    `json:"skipped_files,omitempty"`
+	Truncated     bool                    `json:"truncated"`             // the AI response hit its token limit
+	CachedFrom    *int64                  `json:"cached_from,omitempty"` // analysis whose result was reused
+	RequestedRef  *string                 `json:"requested_ref,omitempty"`
+	CompareBaseID *int64                  `json:"compare_base_id,omitempty"` // base analysis of a before/after comparison
+	Repository    AnalysisRepository      `json:"repository"`
+
+	// Inputs the analysis ran with, including the scoring profile and limits
+	// the analyzed files were chosen with, and a curl command re-running it
+	Parameters       *models.AnalysisParameters `json:"parameters,omitempty"`
+	ReproduceCommand string                     `json:"reproduce_command,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	// Only with ?include=files
+	Files []models.FileContent `json:"files,omitempty"`
+
+	// Only with policy thresholds, once the analysis has completed
+	Policy *PolicyResult    `json:"policy,omitempty"`
+	Error  *models.APIError `json:"error,omitempty"` // set when the policy failed
+}
+
+// AnalysisRepository is the analyzed repository in an AnalysisDetailResponse.
+type AnalysisRepository struct {
+	ID              int64   `json:"id"`
+	GitHubURL       string  `json:"github_url"`
+	Owner           string  `json:"owner"`
+	Name            string  `json:"name"`
+	Description     *string `json:"description,omitempty"`
+	PrimaryLanguage *string `json:"primary_language,omitempty"`
+	StarsCount      int     `json:"stars_count"`
+	ForksCount      int     `json:"forks_count"`
+	License         *string `json:"license,omitempty"`
+	Private         bool    `json:"private"`
+}
+
+// GetAnalysisJSON returns one of the user's analyses with its summary,
+// issues, structure and repository. ?include=files adds the source files
+// that were sent to the AI.
+//
+// CI pipelines can pass ?min_overall= and ?max_high_issues= to gate on the
+// result: a completed analysis violating them is returned with 422 and the
+// violations under "policy". Thresholds aren't checked before completion,
+// so poll until status is completed or failed.
+// GET /api/v1/analyses/{id}
+func (c *AnalyzeController) GetAnalysisJSON(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	includeFiles := false
+	for _, include := range strings.Split(r.URL.Query().Get("include"), ",") {
+		switch strings.TrimSpace(include) {
+		case "":
+		case "files":
+			includeFiles = true
+		default:
+			respondError(w, http.StatusBadRequest, codeInvalidRequest, "Unknown include "+include+"; supported: files")
+			return
+		}
+	}
+
+	thresholds, err := parsePolicyThresholds(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	analysis := c.ownedAnalysis(w, r, user, respondError)
+	if analysis == nil {
+		return
+	}
+
+	resp := AnalysisDetailResponse{
+		ID:            analysis.ID,
+		Status:        analysis.Status,
+		Mode:          analysis.Mode,
+		CommitSHA:     analysis.CommitSHA,
+		ContentHash:   analysis.ContentHash,
+		Note:          analysis.Note,
+		ErrorMessage:  analysis.ErrorMessage,
+		Summary:       analysis.Summary,
+		Issues:        analysis.Issues,
+		CodeStructure: analysis.CodeStructure,
+		SkippedFiles:  analysis.SkippedFiles,
+		Truncated:     analysis.Truncated(),
+		CachedFrom:    analysis.CachedFrom,
+		RequestedRef:  analysis.RequestedRef,
+		CompareBaseID: analysis.CompareBaseID,
+		CreatedAt:     analysis.CreatedAt,
+		StartedAt:     analysis.StartedAt,
+		CompletedAt:   analysis.CompletedAt,
+
+		Parameters:       analysis.Parameters,
+		ReproduceCommand: reproduceCommand(c.config.BaseURL, analysis.Parameters),
+	}
+	if resp.Issues == nil {
+		resp.Issues = []models.Issue{}
+	}
+	if repo := analysis.Repository; repo != nil {
+		resp.Repository = AnalysisRepository{
+			ID:              repo.ID,
+			GitHubURL:       repo.GitHubURL,
+			Owner:           repo.Owner,
+			Name:            repo.Name,
+			Description:     repo.Description,
+			PrimaryLanguage: repo.PrimaryLanguage,
+			StarsCount:      repo.StarsCount,
+			ForksCount:      repo.ForksCount,
+			License:         repo.License,
+			Private:         repo.Private,
+		}
+	}
+	if includeFiles {
+		resp.Files = analysis.CodeFiles
+	}
+
+	status := http.StatusOK
+	if thresholds.IsSet() && analysis.Status == models.StatusCompleted {
+		resp.Policy = evaluatePolicy(analysis, thresholds)
+		if !resp.Policy.Passed {
+			status = http.StatusUnprocessableEntity
+			resp.Error = &models.APIError{
+				Code:      codePolicyFailed,
+				Message:   fmt.Sprintf("Analysis violates %d policy threshold(s)", len(resp.Policy.Violations)),
+				Timestamp: time.Now().UTC(),
+			}
+		}
+	}
+
+	respondJSON(w, status, resp)
+}
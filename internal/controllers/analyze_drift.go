@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// AnalysisDriftResponse compares the files two analyses sent to the AI.
+type AnalysisDriftResponse struct {
+	AnalysisID int64  `json:"analysis_id"`
+	AgainstID  int64  `json:"against_id"`
+	Hash       string `json:"content_hash"`
+	Against    string `json:"against_content_hash"`
+	models.FileDrift
+}
+
+// GetAnalysisDrift reports which analyzed files changed between an earlier
+// analysis, ?against={id}, and this one. It works from stored hashes, so
+// analyses that kept only hashes of their files can be compared too.
+// GET /api/v1/analyses/{id}/drift
+func (c *AnalyzeController) GetAnalysisDrift(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	againstID, err := strconv.ParseInt(r.URL.Query().Get("against"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "against must be an analysis ID")
+		return
+	}
+
+	analysis := c.ownedAnalysis(w, r, user, respondError)
+	if analysis == nil {
+		return
+	}
+
+	against, err := c.analysisService.ByID(r.Context(), againstID)
+	if err != nil && !errors.Is(err, models.ErrAnalysisNotFound) {
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to load analysis")
+		return
+	}
+	// Another user's analysis is reported as missing
+	if err != nil || against.UserID != user.ID {
+		respondError(w, http.StatusNotFound, codeNotFound, "Analysis to compare against not found")
+		return
+	}
+
+	if analysis.ContentHash == nil || against.ContentHash == nil {
+		respondError(w, http.StatusConflict, codeInvalidRequest, "Both analyses must have fetched their files")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, AnalysisDriftResponse{
+		AnalysisID: analysis.ID,
+		AgainstID:  against.ID,
+		Hash:       *analysis.ContentHash,
+		Against:    *against.ContentHash,
+		FileDrift:  models.CompareFileHashes(against.FileHashes, analysis.FileHashes),
+	})
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+// performGistAnalysis runs the analysis pipeline on a gist. Its files are
+// analyzed directly, with no tree to fetch, and it is stored as a
+// pseudo-repository named after the gist id. Gists are readable without a
+// token, so users who haven't connected GitHub fetch anonymously.
+func (c *AnalyzeController) performGistAnalysis(r *http.Request, user *models.User, gistID string, mode models.AnalysisMode) (int64, error) {
+	ctx := r.Context()
+
+	githubToken, _, err := c.githubTokenFor(ctx, user, "", "")
+	if err != nil && !errors.Is(err, ErrGitHubNotConnected) {
+		return 0, err
+	}
+
+	log.Printf("Fetching gist %s", gistID)
+	start := time.Now()
+	gist, err := c.githubService.GetGist(ctx, gistID, githubToken)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch gist: %w", err)
+	}
+	metadataTime := time.Since(start)
+
+	owner := gist.OwnerLogin()
+	repoInfo := &services.GitHubRepository{
+		Description: gist.Description,
+		Language:    gistLanguage(gist),
+	}
+	repoURL := models.GistURLPrefix + owner + "/" + gist.ID
+
+	job, err := c.createAnalysis(ctx, user, repoInfo, metadataTime, owner, gist.ID, repoURL, githubToken, mode)
+	if err != nil {
+		return 0, err
+	}
+	if job.reused {
+		return job.analysisID, nil
+	}
+
+	if err := c.runGistAnalysis(ctx, job, gist); err != nil {
+		return 0, err
+	}
+
+	return job.analysisID, nil
+}
+
+// runGistAnalysis runs the analysis pipeline on a fetched gist. File
+// selection uses the same scoring as repositories.
+func (c *AnalyzeController) runGistAnalysis(ctx context.Context, job *analysisJob, gist *services.GitHubGist) error {
+	defer c.recordStepTimings(job)
+
+	ctx, done, err := c.startProcessing(ctx, job)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	c.recordParameters(ctx, job, "", "")
+	codeStructure := c.githubService.BuildCodeStructure(gist.Tree(), job.scoring)
+
+	var codeFiles []models.FileContent
+	if job.mode != models.ModeMetadata {
+		start := time.Now()
+		codeFiles, job.skipped = c.githubService.GistTopFiles(gist, job.maxFiles, job.scoring)
+		if c.config.RedactSecrets {
+			var redacted int
+			codeFiles, redacted = services.RedactSecrets(codeFiles)
+			if redacted > 0 {
+				log.Printf("Redacted %d secrets from gist %s", redacted, gist.ID)
+			}
+		}
+		job.trackStep("files", start)
+	}
+
+	readme, readmeSize := c.githubService.GistREADME(gist)
+
+	return c.analyzeAndStore(ctx, job, services.AnalysisInput{
+		RepoName:        job.repo,
+		RepoOwner:       job.owner,
+		Description:     job.description,
+		PrimaryLanguage: job.language,
+		README:          readme,
+		READMESize:      readmeSize,
+		CodeStructure:   codeStructure,
+		CodeFiles:       codeFiles,
+		MetadataOnly:    job.mode == models.ModeMetadata,
+	})
+}
+
+// gistLanguage returns the language of the gist's largest file, standing in
+// for a repository's primary language.
+func gistLanguage(gist *services.GitHubGist) string {
+	var language string
+	largest := -1
+	for _, f := range gist.Files {
+		if f.Language != "" && f.Size > largest {
+			language, largest = f.Language, f.Size
+		}
+	}
+	return language
+}
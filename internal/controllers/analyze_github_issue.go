@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+// maxGitHubIssueTitle is the longest title GitHub accepts for an issue.
+const maxGitHubIssueTitle = 256
+
+// GitHubIssueDraft is an analysis issue laid out as a GitHub issue, ready
+// to paste or send to the GitHub issues API.
+type GitHubIssueDraft struct {
+	Title string `json:"title"`
+	Body  string `json:"body"` // Markdown
+}
+
+// FiledGitHubIssue is the response of PostFileGitHubIssue.
+type FiledGitHubIssue struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
+// GetGitHubIssueDraft returns one of the analysis's issues, numbered from 1
+// in the order they are stored, as a GitHub issue title and Markdown body.
+// GET /analyze/{id}/issues/{issueID}/as-github-issue
+func (c *AnalyzeController) GetGitHubIssueDraft(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	analysis := c.ownedAnalysis(w, r, user, respondError)
+	if analysis == nil {
+		return
+	}
+
+	_, issue, ok := issueForRequest(w, r, analysis)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, buildGitHubIssueDraft(analysis, issue, c.config.BaseURL))
+}
+
+// PostFileGitHubIssue opens the issue returned by GetGitHubIssueDraft in
+// the analyzed repository, as the user. It needs the user's own GitHub
+// token with write access to the repository's issues; the app token is
+// never used to write. Each issue is filed at most once; filing it again
+// responds 409.
+// POST /analyze/{id}/issues/{issueID}/file
+func (c *AnalyzeController) PostFileGitHubIssue(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+	ctx := r.Context()
+
+	analysis := c.ownedAnalysis(w, r, user, respondError)
+	if analysis == nil {
+		return
+	}
+
+	n, issue, ok := issueForRequest(w, r, analysis)
+	if !ok {
+		return
+	}
+
+	repo := analysis.Repository
+	if repo.IsUpload() || repo.IsGist() {
+		respondError(w, http.StatusConflict, codeInvalidRequest, "Issues can only be filed in GitHub repositories")
+		return
+	}
+
+	token, err := c.userGitHubToken(ctx, user)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, analysisErrorMessage(err))
+		return
+	}
+
+	filed, err := c.analysisService.ClaimIssueFiling(ctx, analysis.ID, n)
+	if errors.Is(err, models.ErrIssueAlreadyFiled) {
+		msg := "This issue is already being filed on GitHub"
+		if filed != nil && filed.GitHubURL != nil {
+			msg = fmt.Sprintf("This issue was already filed on GitHub: %s", *filed.GitHubURL)
+		}
+		respondError(w, http.StatusConflict, codeInvalidRequest, msg)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to claim issue %d of analysis %d for filing: %v", n, analysis.ID, err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to file the issue")
+		return
+	}
+
+	draft := buildGitHubIssueDraft(analysis, issue, c.config.BaseURL)
+	created, err := c.githubService.CreateIssue(ctx, repo.Owner, repo.Name, token, services.NewGitHubIssue{
+		Title: draft.Title,
+		Body:  draft.Body,
+	})
+	if err != nil {
+		if err := c.analysisService.ReleaseIssueFiling(ctx, analysis.ID, n); err != nil {
+			log.Printf("Failed to release issue %d of analysis %d: %v", n, analysis.ID, err)
+		}
+		log.Printf("Failed to file issue for analysis %d in %s: %v", analysis.ID, repo.FullName(), err)
+		var apiErr *services.GitHubAPIError
+		switch {
+		case errors.Is(err, services.ErrGitHubForbidden), errors.Is(err, services.ErrGitHubNotFound):
+			respondError(w, http.StatusForbidden, codeForbidden, "GitHub denied creating the issue. Reconnect your GitHub account with the repo scope, and check you can open issues in this repository.")
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusGone:
+			respondError(w, http.StatusConflict, codeInvalidRequest, "Issues are disabled for this repository")
+		default:
+			respondError(w, http.StatusBadGateway, codeUpstream, analysisErrorMessage(err))
+		}
+		return
+	}
+
+	if err := c.analysisService.RecordIssueFiled(ctx, analysis.ID, n, created.Number, created.HTMLURL); err != nil {
+		log.Printf("Failed to record issue %d of analysis %d as filed: %v", n, analysis.ID, err)
+	}
+
+	respondJSON(w, http.StatusCreated, FiledGitHubIssue{Number: created.Number, URL: created.HTMLURL})
+}
+
+// issueForRequest returns the issue numbered {issueID}, counting from 1,
+// and its number, or responds with 404 and returns false.
+func issueForRequest(w http.ResponseWriter, r *http.Request, analysis *models.Analysis) (int, models.Issue, bool) {
+	n, err := strconv.Atoi(chi.URLParam(r, "issueID"))
+	if err != nil || n < 1 || n > len(analysis.Issues) {
+		respondError(w, http.StatusNotFound, codeNotFound, "Issue not found")
+		return 0, models.Issue{}, false
+	}
+	return n, analysis.Issues[n-1], true
+}
+
+// githubReference matches what GitHub turns into a notification or a link
+// in Markdown: @user and @org/team mentions, and #123, GH-123 and
+// owner/repo#123 references. The first group is the character before it.
+var githubReference = regexp.MustCompile(`(^|[^\w@/.-])(@[A-Za-z0-9][A-Za-z0-9-]*(?:/[A-Za-z0-9_-]+)?|(?:[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+)?#\d+|GH-\d+)`)
+
+// quoteGitHubReferences wraps the mentions and references in text written
+// by the AI in code spans, so filing the issue doesn't notify strangers or
+// link unrelated issues. Text already in code spans is left alone.
+func quoteGitHubReferences(text string) string {
+	parts := strings.Split(text, "`")
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = githubReference.ReplaceAllString(parts[i], "$1`$2`")
+	}
+	return strings.Join(parts, "`")
+}
+
+// buildGitHubIssueDraft lays out issue as a GitHub issue: its severity and
+// category, location (linked at the analyzed commit when possible),
+// description and suggestion, and where it was found. Mentions and
+// references in the AI's text are quoted, see quoteGitHubReferences.
+func buildGitHubIssueDraft(analysis *models.Analysis, issue models.Issue, baseURL string) GitHubIssueDraft {
+	var body strings.Builder
+
+	fmt.Fprintf(&body, "**Severity:** `%s` · **Category:** `%s`\n\n", issue.Severity, models.NormalizeCategory(issue.Category))
+
+	if issue.File != "" {
+		location := issue.File
+		if issue.Line > 0 {
+			location = fmt.Sprintf("%s:%d", issue.File, issue.Line)
+		}
+		if link := analysis.FileURL(issue.File, issue.Line); link != "" {
+			fmt.Fprintf(&body, "**Location:** [`%s`](%s)\n\n", location, link)
+		} else {
+			fmt.Fprintf(&body, "**Location:** `%s`\n\n", location)
+		}
+	}
+
+	if issue.Description != "" {
+		fmt.Fprintf(&body, "### Description\n\n%s\n\n", quoteGitHubReferences(issue.Description))
+	}
+	if issue.Suggestion != "" {
+		fmt.Fprintf(&body, "### Suggested fix\n\n%s\n\n", quoteGitHubReferences(issue.Suggestion))
+	}
+
+	body.WriteString("---\n")
+	source := fmt.Sprintf("[analysis #%d](%s/analyze/%d)", analysis.ID, strings.TrimRight(baseURL, "/"), analysis.ID)
+	if sha := analysis.ShortCommitSHA(); sha != "" {
+		fmt.Fprintf(&body, "_Found by GitHub Analyzer in %s at commit %s._\n", source, sha)
+	} else {
+		fmt.Fprintf(&body, "_Found by GitHub Analyzer in %s._\n", source)
+	}
+
+	title := strings.Join(strings.Fields(issue.Title), " ")
+	if title == "" {
+		title = fmt.Sprintf("%s %s issue", issue.Severity, models.NormalizeCategory(issue.Category))
+	}
+	if runes := []rune(title); len(runes) > maxGitHubIssueTitle {
+		title = string(runes[:maxGitHubIssueTitle-3]) + "..."
+	}
+
+	return GitHubIssueDraft{Title: title, Body: body.String()}
+}
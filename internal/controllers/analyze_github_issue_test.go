@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestQuoteGitHubReferences(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"No references here.", "No references here."},
+		{"Ask @octocat to review.", "Ask `@octocat` to review."},
+		{"@octocat first", "`@octocat` first"},
+		{"Ping @acme/security-team now", "Ping `@acme/security-team` now"},
+		{"Same as #12 and GH-7.", "Same as `#12` and `GH-7`."},
+		{"See acme/app#3 for context", "See `acme/app#3` for context"},
+		{"Mail admin@example.com", "Mail admin@example.com"},
+		{"Already `@quoted` and `#4`", "Already `@quoted` and `#4`"},
+		{"In code:\n```\nfoo(@bar) # 1\nx #2\n```\nthen @baz", "In code:\n```\nfoo(@bar) # 1\nx #2\n```\nthen `@baz`"},
+		{"A heading # Title and color #fff", "A heading # Title and color #fff"},
+	}
+
+	for _, tt := range tests {
+		if got := quoteGitHubReferences(tt.text); got != tt.want {
+			t.Errorf("quoteGitHubReferences(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBuildGitHubIssueDraft(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	repo := &models.Repository{GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+
+	tests := []struct {
+		name      string
+		analysis  *models.Analysis
+		issue     models.Issue
+		wantTitle string
+		want      []string
+		wantNot   []string
+	}{
+		{
+			name:     "full issue at a commit",
+			analysis: &models.Analysis{ID: 7, CommitSHA: &sha, Repository: repo},
+			issue: models.Issue{
+				Severity: models.SeverityHigh, Category: "Security", Title: "SQL  injection",
+				Description: "Query built from input.", File: "db/query.go", Line: 12, Suggestion: "Use parameters.",
+			},
+			wantTitle: "SQL injection",
+			want: []string{
+				"**Severity:** `HIGH` · **Category:** `security`",
+				"**Location:** [`db/query.go:12`](https://github.com/acme/app/blob/" + sha + "/db/query.go#L12)",
+				"### Description\n\nQuery built from input.",
+				"### Suggested fix\n\nUse parameters.",
+				"[analysis #7](https://analyzer.example.com/analyze/7) at commit 0123456",
+			},
+		},
+		{
+			name:      "no commit, file or text",
+			analysis:  &models.Analysis{ID: 8, Repository: repo},
+			issue:     models.Issue{Severity: models.SeverityLow, Category: "performance", File: "main.go"},
+			wantTitle: "LOW performance issue",
+			want:      []string{"**Location:** `main.go`", "_Found by GitHub Analyzer in [analysis #8](https://analyzer.example.com/analyze/8)._"},
+			wantNot:   []string{"### Description", "### Suggested fix", "at commit"},
+		},
+		{
+			name:     "mentions in AI text are quoted",
+			analysis: &models.Analysis{ID: 9, Repository: repo},
+			issue: models.Issue{
+				Severity: models.SeverityMedium, Category: "quality", Title: "Dead code",
+				Description: "Reported by @someone in #42.", Suggestion: "Ask @acme/owners.",
+			},
+			wantTitle: "Dead code",
+			want:      []string{"Reported by `@someone` in `#42`.", "Ask `@acme/owners`."},
+			wantNot:   []string{" @someone", " #42"},
+		},
+		{
+			name:      "long title is cut",
+			analysis:  &models.Analysis{ID: 10, Repository: repo},
+			issue:     models.Issue{Severity: models.SeverityInfo, Title: strings.Repeat("x", 300)},
+			wantTitle: strings.Repeat("x", maxGitHubIssueTitle-3) + "...",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draft := buildGitHubIssueDraft(tt.analysis, tt.issue, "https://analyzer.example.com/")
+			if draft.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", draft.Title, tt.wantTitle)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(draft.Body, want) {
+					t.Errorf("body doesn't contain %q:\n%s", want, draft.Body)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(draft.Body, unwanted) {
+					t.Errorf("body contains %q:\n%s", unwanted, draft.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// PolicyThresholds let a CI pipeline gate on an analysis. Nil thresholds
+// aren't checked.
+type PolicyThresholds struct {
+	MinOverall    *int `json:"min_overall,omitempty"`     // lowest acceptable overall score
+	MaxHighIssues *int `json:"max_high_issues,omitempty"` // most issues of HIGH severity or worse
+}
+
+// PolicyResult is the outcome of checking a completed analysis against
+// PolicyThresholds.
+type PolicyResult struct {
+	Thresholds PolicyThresholds  `json:"thresholds"`
+	Passed     bool              `json:"passed"`
+	Violations []PolicyViolation `json:"violations"`
+}
+
+// PolicyViolation is a threshold the analysis didn't meet.
+type PolicyViolation struct {
+	Threshold string `json:"threshold"` // query parameter name, e.g. "min_overall"
+	Limit     int    `json:"limit"`
+	Actual    int    `json:"actual"`
+	Message   string `json:"message"`
+}
+
+// parsePolicyThresholds reads ?min_overall= and ?max_high_issues=.
+func parsePolicyThresholds(query url.Values) (PolicyThresholds, error) {
+	var t PolicyThresholds
+
+	if raw := query.Get("min_overall"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > 100 {
+			return t, errors.New("min_overall must be a score from 0 to 100")
+		}
+		t.MinOverall = &n
+	}
+
+	if raw := query.Get("max_high_issues"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return t, errors.New("max_high_issues must be a non-negative number")
+		}
+		t.MaxHighIssues = &n
+	}
+
+	return t, nil
+}
+
+// IsSet reports whether any threshold is given.
+func (t PolicyThresholds) IsSet() bool {
+	return t.MinOverall != nil || t.MaxHighIssues != nil
+}
+
+// evaluatePolicy checks a completed analysis against t. An analysis without
+// a summary scores 0.
+func evaluatePolicy(analysis *models.Analysis, t PolicyThresholds) *PolicyResult {
+	result := &PolicyResult{Thresholds: t, Violations: []PolicyViolation{}}
+
+	if t.MinOverall != nil {
+		score := 0
+		if analysis.Summary != nil {
+			score = analysis.Summary.OverallScore
+		}
+		if score < *t.MinOverall {
+			result.Violations = append(result.Violations, PolicyViolation{
+				Threshold: "min_overall",
+				Limit:     *t.MinOverall,
+				Actual:    score,
+				Message:   fmt.Sprintf("overall score %d is below the minimum of %d", score, *t.MinOverall),
+			})
+		}
+	}
+
+	if t.MaxHighIssues != nil {
+		high := 0
+		for _, issue := range analysis.Issues {
+			sev, err := models.ParseSeverity(string(issue.Severity))
+			if err == nil && sev.Rank() <= models.SeverityHigh.Rank() {
+				high++
+			}
+		}
+		if high > *t.MaxHighIssues {
+			result.Violations = append(result.Violations, PolicyViolation{
+				Threshold: "max_high_issues",
+				Limit:     *t.MaxHighIssues,
+				Actual:    high,
+				Message:   fmt.Sprintf("%d high or critical issues exceed the maximum of %d", high, *t.MaxHighIssues),
+			})
+		}
+	}
+
+	result.Passed = len(result.Violations) == 0
+	return result
+}
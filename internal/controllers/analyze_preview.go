@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+// SelectionPreviewResponse lists every scored file of a repository with
+// whether an analysis would select it.
+type SelectionPreviewResponse struct {
+	Owner    string                  `json:"owner"`
+	Repo     string                  `json:"repo"`
+	MaxFiles int                     `json:"max_files"`
+	Files    []services.FileDecision `json:"files"`
+}
+
+// GetPreview is a dry run of file selection: it scores the repository's
+// files with the user's preferences and reports which would be analyzed and
+// why the others wouldn't, without fetching any content or using quota.
+// GET /api/v1/analyses/preview?repo_url=...
+func (c *AnalyzeController) GetPreview(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+	ctx := r.Context()
+
+	rawURL := r.URL.Query().Get("repo_url")
+	if len(rawURL) > maxRepoURLLength {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "Repository URL is too long")
+		return
+	}
+	owner, repo, err := models.ParseGitHubURL(sanitizeRepoURL(rawURL))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid GitHub repository URL. Use format: https://github.com/owner/repo")
+		return
+	}
+
+	githubToken, appToken, err := c.githubTokenFor(ctx, user, owner, repo)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, analysisErrorMessage(err))
+		return
+	}
+
+	repoInfo, _, err := c.fetchRepository(ctx, owner, repo, githubToken)
+	if err != nil {
+		c.respondPreviewError(w, owner, repo, err)
+		return
+	}
+	// The app token may see private repositories the user can't
+	if appToken && repoInfo.Private {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, analysisErrorMessage(ErrPrivateRepoNeedsConnection))
+		return
+	}
+
+	tree, err := c.githubService.GetRepositoryTreeAt(ctx, owner, repo, repoInfo.DefaultBranch, githubToken)
+	if err != nil {
+		c.respondPreviewError(w, owner, repo, err)
+		return
+	}
+
+	// Select with the same settings an analysis would use
+	job := &analysisJob{userID: user.ID, maxFiles: c.maxFilesToFetch}
+	c.applyPreferences(ctx, job)
+
+	respondJSON(w, http.StatusOK, SelectionPreviewResponse{
+		Owner:    owner,
+		Repo:     repo,
+		MaxFiles: job.maxFiles,
+		Files:    c.githubService.PreviewFileSelection(tree, job.maxFiles, job.scoring),
+	})
+}
+
+// respondPreviewError reports a failed GitHub lookup for a preview.
+func (c *AnalyzeController) respondPreviewError(w http.ResponseWriter, owner, repo string, err error) {
+	var sizeErr *RepositoryTooLargeError
+	switch {
+	case errors.As(err, &sizeErr):
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, analysisErrorMessage(err))
+	case errors.Is(err, services.ErrEmptyRepository):
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "This repository is empty. Push at least one commit before analyzing it.")
+	case errors.Is(err, services.ErrGitHubNotFound):
+		respondError(w, http.StatusNotFound, codeNotFound, analysisErrorMessage(err))
+	default:
+		log.Printf("Preview failed for %s/%s: %v", owner, repo, err)
+		respondError(w, http.StatusBadGateway, codeUpstream, analysisErrorMessage(err))
+	}
+}
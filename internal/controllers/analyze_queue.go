@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+const (
+	// analysisJobTimeout bounds a single queued analysis run.
+	analysisJobTimeout = 10 * time.Minute
+	// queueRetryAfter is the Retry-After sent when the queue is full.
+	queueRetryAfter = 30 * time.Second
+)
+
+var (
+	// ErrQueueFull is returned when the analysis queue cannot take more jobs.
+	ErrQueueFull = errors.New("analysis queue is full")
+	// ErrTooManyInFlight is returned when a user already has the maximum
+	// number of analyses pending or processing.
+	ErrTooManyInFlight = models.ErrTooManyInFlight
+	// ErrGitHubNotConnected is returned when the user has no GitHub account
+	// connected and no app token can stand in for it.
+	ErrGitHubNotConnected = errors.New("GitHub account not connected")
+	// ErrGitHubTokenUnavailable is returned when the user's stored GitHub
+	// token is missing or can't be decrypted.
+	ErrGitHubTokenUnavailable = errors.New("GitHub token unavailable")
+	// ErrPrivateRepoNeedsConnection is returned when the app token was used
+	// and the repository turned out to be private.
+	ErrPrivateRepoNeedsConnection = errors.New("private repository requires a connected GitHub account")
+)
+
+// RepositoryTooLargeError is returned when a repository exceeds the
+// configured size limit.
+type RepositoryTooLargeError struct {
+	SizeKB  int
+	LimitKB int
+}
+
+func (e *RepositoryTooLargeError) Error() string {
+	return fmt.Sprintf("repository is %d KB, limit is %d KB", e.SizeKB, e.LimitKB)
+}
+
+// StartWorkers starts n goroutines that run queued analyses.
+// Returns a channel that can be closed to stop the workers.
+func (c *AnalyzeController) StartWorkers(n int) chan struct{} {
+	stop := make(chan struct{})
+
+	for i := 0; i < n; i++ {
+		go func() {
+			for {
+				select {
+				case job := <-c.jobs:
+					c.runQueued(job)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	return stop
+}
+
+// runQueued runs one job with its own deadline, detached from any request.
+func (c *AnalyzeController) runQueued(job *analysisJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), analysisJobTimeout)
+	defer cancel()
+
+	if err := c.runAnalysis(ctx, job); err != nil {
+		if errors.Is(err, models.ErrAnalysisNotRunning) {
+			log.Printf("Queued analysis %d for %s/%s was cancelled", job.analysisID, job.owner, job.repo)
+			return
+		}
+		log.Printf("Queued analysis %d for %s/%s failed: %v", job.analysisID, job.owner, job.repo, err)
+	}
+}
+
+// enqueue adds a job to the queue without blocking.
+func (c *AnalyzeController) enqueue(job *analysisJob) error {
+	select {
+	case c.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// checkInFlight returns ErrTooManyInFlight if starting n more analyses would
+// put the user over the per-user in-flight limit. It is only a fast path for
+// requests that never reuse an analysis: the limit is enforced when the
+// analysis is created, see analysisLimits.
+func (c *AnalyzeController) checkInFlight(ctx context.Context, userID int64, n int) error {
+	if c.config.MaxInFlightPerUser <= 0 {
+		return nil
+	}
+
+	inFlight, err := c.analysisService.CountInFlight(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if inFlight+n > c.config.MaxInFlightPerUser {
+		return ErrTooManyInFlight
+	}
+	return nil
+}
+
+// analysisLimits returns the limits a new analysis must fit, setting aside
+// reserveTokens of the user's quota until it finishes.
+func (c *AnalyzeController) analysisLimits(reserveTokens int) models.AnalysisLimits {
+	return models.AnalysisLimits{MaxInFlight: c.config.MaxInFlightPerUser, ReserveTokens: reserveTokens}
+}
+
+// checkQueueCapacity returns ErrQueueFull if n more jobs don't fit in the
+// queue or would put the pending analyses over MaxQueueDepth.
+func (c *AnalyzeController) checkQueueCapacity(ctx context.Context, n int) error {
+	if len(c.jobs)+n > cap(c.jobs) {
+		return ErrQueueFull
+	}
+	if c.config.MaxQueueDepth <= 0 {
+		return nil
+	}
+
+	pending, err := c.analysisService.CountPending(ctx)
+	if err != nil {
+		return err
+	}
+	if pending+n > c.config.MaxQueueDepth {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// respondQueueFull tells the client to come back once the workers have
+// drained the queue.
+func respondQueueFull(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(queueRetryAfter.Seconds())))
+	respondError(w, http.StatusServiceUnavailable, codeUnavailable, "Analysis queue is full, please try again later")
+}
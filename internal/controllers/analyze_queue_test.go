@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appctx "github.com/rahul4469/github-analyzer/internal/context"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestEnqueueBoundedQueue(t *testing.T) {
+	const size = 2
+	c := &AnalyzeController{jobs: make(chan *analysisJob, size)}
+	ctx := context.Background()
+
+	for i := 0; i < size; i++ {
+		if err := c.checkQueueCapacity(ctx, 1); err != nil {
+			t.Fatalf("checkQueueCapacity with %d queued: %v", i, err)
+		}
+		if err := c.enqueue(&analysisJob{analysisID: int64(i + 1)}); err != nil {
+			t.Fatalf("enqueue %d: %v", i+1, err)
+		}
+	}
+
+	if err := c.checkQueueCapacity(ctx, 1); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("checkQueueCapacity on a full queue = %v, want ErrQueueFull", err)
+	}
+	if err := c.enqueue(&analysisJob{analysisID: size + 1}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("enqueue on a full queue = %v, want ErrQueueFull", err)
+	}
+
+	w := httptest.NewRecorder()
+	respondQueueFull(w)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	assertEnvelope(t, w, codeUnavailable)
+
+	// A worker taking one job makes room for the next
+	<-c.jobs
+	if err := c.checkQueueCapacity(ctx, 1); err != nil {
+		t.Errorf("checkQueueCapacity after draining one: %v", err)
+	}
+	if err := c.enqueue(&analysisJob{analysisID: size + 1}); err != nil {
+		t.Errorf("enqueue after draining one: %v", err)
+	}
+}
+
+func TestBatchQueueBackpressure(t *testing.T) {
+	env := newTestEnv(t, AnalyzeConfig{QueueSize: 1, MaxQueueDepth: 1}, mockGitHubRepos())
+	user := env.newGitHubUser(t, "queue@example.com", 100000)
+
+	post := func(repoURL string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/analyses/batch", strings.NewReader(`{"repo_urls": ["`+repoURL+`"]}`))
+		r = r.WithContext(appctx.SetUser(r.Context(), user))
+		w := httptest.NewRecorder()
+		env.c.PostBatch(w, r)
+		return w
+	}
+
+	first := post("https://github.com/acme/one")
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("first batch: status = %d, want %d: %s", first.Code, http.StatusAccepted, first.Body)
+	}
+	job := <-env.c.jobs
+	env.c.jobs <- job
+
+	full := post("https://github.com/acme/two")
+	if full.Code != http.StatusServiceUnavailable {
+		t.Fatalf("batch on a full queue: status = %d, want %d", full.Code, http.StatusServiceUnavailable)
+	}
+	if got := full.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+
+	// The mock has no tree, so the worker fails the analysis, which is
+	// enough to take it off the queue
+	stop := env.c.StartWorkers(1)
+	defer close(stop)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := env.status(t, job.analysisID)
+		if status != models.StatusPending && status != models.StatusProcessing {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("analysis %d still %s after the worker started", job.analysisID, status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if again := post("https://github.com/acme/two"); again.Code != http.StatusAccepted {
+		t.Errorf("batch after draining: status = %d, want %d: %s", again.Code, http.StatusAccepted, again.Body)
+	}
+}
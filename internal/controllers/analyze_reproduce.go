@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// reproduceCommand returns a curl command that re-runs an analysis with the
+// same parameters through POST /api/v1/analyses/batch, or "" when the
+// analysis can't be reproduced. The session cookies and CSRF token are left
+// as shell variables for the user to fill in.
+func reproduceCommand(baseURL string, params *models.AnalysisParameters) string {
+	if !params.Reproducible() {
+		return ""
+	}
+
+	body, err := json.Marshal(BatchAnalyzeRequest{
+		RepoURLs: []string{params.RepoURL},
+		Ref:      params.Ref,
+		Mode:     params.Mode,
+		MaxFiles: params.MaxFiles,
+		Scoring:  params.Scoring,
+	})
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf(`curl -X POST %s \
+  -H 'Content-Type: application/json' \
+  -H "Cookie: $COOKIES" \
+  -H "X-CSRF-Token: $CSRF_TOKEN" \
+  --data %s`,
+		shellQuote(strings.TrimRight(baseURL, "/")+"/api/v1/analyses/batch"),
+		shellQuote(string(body)),
+	)
+}
+
+// shellQuote wraps s in single quotes for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
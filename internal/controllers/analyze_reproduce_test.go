@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestReproduceCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		params *models.AnalysisParameters
+		want   []string // substrings expected in the command; none when it's empty
+	}{
+		{name: "no parameters"},
+		{
+			name: "upload without a repository",
+			params: &models.AnalysisParameters{
+				Mode: models.ModeDeep, MaxFiles: 20, MaxFileBytes: 100000,
+			},
+		},
+		{
+			name: "repository without a commit",
+			params: &models.AnalysisParameters{
+				RepoURL: "https://github.com/acme/app", Mode: models.ModeDeep, MaxFiles: 20,
+			},
+		},
+		{
+			name: "GitHub repository at a commit",
+			params: &models.AnalysisParameters{
+				RepoURL: "https://github.com/acme/app", Ref: "0123abc", Mode: models.ModeDeep,
+				MaxFiles: 20, MaxFileBytes: 100000,
+			},
+			want: []string{
+				"'https://analyzer.example.com/api/v1/analyses/batch'",
+				`"repo_urls":["https://github.com/acme/app"]`,
+				`"ref":"0123abc"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reproduceCommand("https://analyzer.example.com/", tt.params)
+			if len(tt.want) == 0 {
+				if got != "" {
+					t.Errorf("reproduceCommand = %q, want none", got)
+				}
+				return
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("reproduceCommand = %q, doesn't contain %q", got, want)
+				}
+			}
+			if strings.Contains(got, "max_file_bytes") {
+				t.Errorf("reproduceCommand = %q, sends the server's own limits", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// PostResolveIssue removes an issue from a completed analysis, once it's
+// fixed or because it duplicates another one, and recomputes the summary.
+// POST /analyze/{id}/issues/{issueID}/resolve
+func (c *AnalyzeController) PostResolveIssue(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	analysis := c.analysisForUser(w, r, user)
+	if analysis == nil {
+		return
+	}
+
+	if analysis.Status != models.StatusCompleted {
+		http.Error(w, "Analysis has not completed", http.StatusConflict)
+		return
+	}
+
+	n, err := strconv.Atoi(chi.URLParam(r, "issueID"))
+	if err != nil {
+		http.Error(w, "Issue not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := c.analysisService.ResolveIssues(r.Context(), analysis.ID, []int{n}); err != nil {
+		if errors.Is(err, models.ErrIssueNotFound) {
+			http.Error(w, "Issue not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to resolve issue %d of analysis %d: %v", n, analysis.ID, err)
+		http.Redirect(w, r, "/dashboard?error=Failed+to+resolve+issue", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/analyze/%d", analysis.ID), http.StatusSeeOther)
+}
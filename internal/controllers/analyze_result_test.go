@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestResultIssues(t *testing.T) {
+	issues := []models.Issue{
+		{Title: "SQL injection", Category: "Security"},
+		{Title: "N+1 query", Category: "performance"},
+		{Title: "Leaked key", Category: "sec"},
+		{Title: "Odd one", Category: "testing"},
+	}
+
+	tests := []struct {
+		name         string
+		category     string
+		wantCategory string
+		wantNumbers  []int
+	}{
+		{"no filter", "", "", []int{1, 2, 3, 4}},
+		{"canonical", "security", models.CategorySecurity, []int{1, 3}},
+		{"alias", " Perf ", models.CategoryPerformance, []int{2}},
+		{"other", "other", models.CategoryOther, []int{4}},
+		{"unknown matches nothing", "testing", "testing", nil},
+		{"known category without issues", "style", models.CategoryStyle, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category, listed := resultIssues(issues, tt.category)
+			if category != tt.wantCategory {
+				t.Errorf("category = %q, want %q", category, tt.wantCategory)
+			}
+			var numbers []int
+			for _, issue := range listed {
+				numbers = append(numbers, issue.Number)
+				if issues[issue.Number-1].Title != issue.Title {
+					t.Errorf("issue %d is %q, want %q", issue.Number, issue.Title, issues[issue.Number-1].Title)
+				}
+			}
+			if !reflect.DeepEqual(numbers, tt.wantNumbers) {
+				t.Errorf("numbers = %v, want %v", numbers, tt.wantNumbers)
+			}
+		})
+	}
+}
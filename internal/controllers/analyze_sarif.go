@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+const (
+	sarifVersion  = "2.1.0"
+	sarifSchema   = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName = "github-analyzer"
+)
+
+// SARIF 2.1.0 document, limited to the properties the export fills in.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool                     sarifTool                 `json:"tool"`
+	Results                  []sarifResult             `json:"results"`
+	VersionControlProvenance []sarifVersionControlInfo `json:"versionControlProvenance,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	RuleIndex  int             `json:"ruleIndex"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations,omitempty"`
+	Properties map[string]any  `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifVersionControlInfo struct {
+	RepositoryURI string `json:"repositoryUri"`
+	RevisionID    string `json:"revisionId,omitempty"`
+}
+
+// GetSARIFExport returns the analysis's issues as a SARIF 2.1.0 log, which
+// GitHub code scanning and other CI tools can ingest.
+// GET /analyze/{id}/export.sarif
+func (c *AnalyzeController) GetSARIFExport(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	analysis := c.analysisForUser(w, r, user)
+	if analysis == nil {
+		return
+	}
+
+	if analysis.Status != models.StatusCompleted {
+		http.Error(w, "Analysis has not completed", http.StatusConflict)
+		return
+	}
+
+	body, err := json.MarshalIndent(buildSARIF(analysis, c.config.BaseURL), "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode SARIF for analysis %d: %v", analysis.ID, err)
+		http.Error(w, "Failed to export analysis", http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("analysis-%d.sarif", analysis.ID)
+	if analysis.Repository != nil {
+		name = fmt.Sprintf("%s-%s.sarif", analysis.Repository.Owner, analysis.Repository.Name)
+	}
+
+	w.Header().Set("Content-Type", "application/sarif+json")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// buildSARIF converts an analysis to a SARIF log with one rule per issue
+// category. Issues without a file have no location.
+func buildSARIF(analysis *models.Analysis, baseURL string) sarifLog {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           sarifToolName,
+			InformationURI: baseURL,
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	if repo := analysis.Repository; repo != nil && !repo.IsUpload() && analysis.CommitSHA != nil {
+		run.VersionControlProvenance = []sarifVersionControlInfo{{
+			RepositoryURI: repo.GitHubURL,
+			RevisionID:    *analysis.CommitSHA,
+		}}
+	}
+
+	ruleIndex := make(map[string]int)
+	for _, issue := range analysis.Issues {
+		ruleID := sarifRuleID(issue.Category)
+		index, ok := ruleIndex[ruleID]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			ruleIndex[ruleID] = index
+			name := strings.TrimSpace(issue.Category)
+			if name == "" {
+				name = "General"
+			}
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               ruleID,
+				Name:             name,
+				ShortDescription: sarifMessage{Text: name + " issues"},
+			})
+		}
+
+		result := sarifResult{
+			RuleID:     ruleID,
+			RuleIndex:  index,
+			Level:      sarifLevel(issue.Severity),
+			Message:    sarifMessage{Text: sarifMessageText(issue)},
+			Properties: map[string]any{"severity": string(issue.Severity)},
+		}
+		if uri := sarifURI(issue.File); uri != "" {
+			location := sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: uri, URIBaseID: "%SRCROOT%"},
+			}
+			if issue.Line > 0 {
+				location.Region = &sarifRegion{StartLine: issue.Line}
+			}
+			result.Locations = []sarifLocation{{PhysicalLocation: location}}
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}
+}
+
+// sarifLevel maps a severity to a SARIF result level: critical and high
+// issues are errors, medium ones warnings and the rest notes.
+func sarifLevel(severity models.Severity) string {
+	sev, _ := models.ParseSeverity(string(severity))
+	switch sev {
+	case models.SeverityCritical, models.SeverityHigh:
+		return "error"
+	case models.SeverityLow, models.SeverityInfo:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// sarifRuleID turns a category into a rule id, e.g. "Error Handling" into
+// "error-handling".
+func sarifRuleID(category string) string {
+	id := strings.Join(strings.FieldsFunc(strings.ToLower(category), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}), "-")
+	if id == "" {
+		return "general"
+	}
+	return id
+}
+
+// sarifMessageText combines an issue's title, description and suggestion.
+// SARIF requires message text, so an issue with none of them gets a generic
+// one.
+func sarifMessageText(issue models.Issue) string {
+	var parts []string
+	if t := strings.TrimSpace(issue.Title); t != "" {
+		parts = append(parts, t)
+	}
+	if d := strings.TrimSpace(issue.Description); d != "" {
+		parts = append(parts, d)
+	}
+	if s := strings.TrimSpace(issue.Suggestion); s != "" {
+		parts = append(parts, "Suggestion: "+s)
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("%s issue", issue.Severity)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// sarifURI returns file as an escaped repository-relative URI, or "" if
+// there is none.
+func sarifURI(file string) string {
+	file = strings.TrimSpace(file)
+	if file == "" {
+		return ""
+	}
+	relative := strings.TrimPrefix(path.Clean("/"+file), "/")
+	return (&url.URL{Path: relative}).EscapedPath()
+}
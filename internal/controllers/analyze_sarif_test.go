@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestSARIFLevel(t *testing.T) {
+	tests := []struct {
+		severity models.Severity
+		want     string
+	}{
+		{models.SeverityCritical, "error"},
+		{models.SeverityHigh, "error"},
+		{models.SeverityMedium, "warning"},
+		{models.SeverityLow, "note"},
+		{models.SeverityInfo, "note"},
+		{"major", "error"},     // alias of HIGH
+		{"warning", "warning"}, // alias of MEDIUM
+		{"", "warning"},
+		{"unheard-of", "warning"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.severity), func(t *testing.T) {
+			if got := sarifLevel(tt.severity); got != tt.want {
+				t.Errorf("sarifLevel(%q) = %q, want %q", tt.severity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSARIFURI(t *testing.T) {
+	tests := []struct{ file, want string }{
+		{"", ""},
+		{"main.go", "main.go"},
+		{"/src/app.js", "src/app.js"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"docs/read me.md", "docs/read%20me.md"},
+	}
+
+	for _, tt := range tests {
+		if got := sarifURI(tt.file); got != tt.want {
+			t.Errorf("sarifURI(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestBuildSARIFMatchesSchema(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name     string
+		analysis *models.Analysis
+	}{
+		{"no issues", &models.Analysis{ID: 1}},
+		{
+			name: "issues with and without locations",
+			analysis: &models.Analysis{
+				ID:         2,
+				CommitSHA:  &sha,
+				Repository: &models.Repository{GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"},
+				Issues: []models.Issue{
+					{Severity: models.SeverityHigh, Category: "Security", Title: "SQL injection", File: "db/query.go", Line: 12, Suggestion: "Use parameters"},
+					{Severity: models.SeverityLow, Category: "Error Handling", Title: "Ignored error", File: "main.go"},
+					{Severity: models.SeverityMedium, Category: "security", Title: "Weak hash"},
+					{Severity: models.SeverityInfo},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(buildSARIF(tt.analysis, "https://analyzer.example.com"))
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var doc map[string]any
+			if err := json.Unmarshal(body, &doc); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if err := validateSARIF(doc, len(tt.analysis.Issues)); err != nil {
+				t.Errorf("invalid SARIF: %v\n%s", err, body)
+			}
+		})
+	}
+}
+
+// validateSARIF checks doc against the parts of the SARIF 2.1.0 schema the
+// export uses: required properties, enums, and minimums.
+func validateSARIF(doc map[string]any, wantResults int) error {
+	if doc["version"] != "2.1.0" {
+		return fmt.Errorf("version = %v", doc["version"])
+	}
+	if _, ok := doc["$schema"].(string); !ok {
+		return fmt.Errorf("missing $schema")
+	}
+	runs, ok := doc["runs"].([]any)
+	if !ok || len(runs) != 1 {
+		return fmt.Errorf("runs = %v, want one run", doc["runs"])
+	}
+	run := runs[0].(map[string]any)
+
+	driver, ok := dig(run, "tool", "driver").(map[string]any)
+	if !ok {
+		return fmt.Errorf("missing tool.driver")
+	}
+	if name, _ := driver["name"].(string); name == "" {
+		return fmt.Errorf("tool.driver.name is required")
+	}
+	rules, _ := driver["rules"].([]any)
+	ruleIDs := make(map[string]bool)
+	for i, r := range rules {
+		rule := r.(map[string]any)
+		id, _ := rule["id"].(string)
+		if id == "" {
+			return fmt.Errorf("rule %d has no id", i)
+		}
+		if ruleIDs[id] {
+			return fmt.Errorf("duplicate rule id %q", id)
+		}
+		ruleIDs[id] = true
+		if text, _ := dig(rule, "shortDescription", "text").(string); text == "" {
+			return fmt.Errorf("rule %q has no shortDescription.text", id)
+		}
+	}
+
+	results, ok := run["results"].([]any)
+	if !ok {
+		return fmt.Errorf("results must be an array, even when empty")
+	}
+	if len(results) != wantResults {
+		return fmt.Errorf("%d results, want %d", len(results), wantResults)
+	}
+	for i, r := range results {
+		result := r.(map[string]any)
+		if text, _ := dig(result, "message", "text").(string); text == "" {
+			return fmt.Errorf("result %d has no message.text", i)
+		}
+		switch result["level"] {
+		case "none", "note", "warning", "error":
+		default:
+			return fmt.Errorf("result %d level %v not in the schema's enum", i, result["level"])
+		}
+		index := int(result["ruleIndex"].(float64))
+		if index < 0 || index >= len(rules) || rules[index].(map[string]any)["id"] != result["ruleId"] {
+			return fmt.Errorf("result %d ruleIndex %d doesn't point at rule %v", i, index, result["ruleId"])
+		}
+
+		locations, _ := result["locations"].([]any)
+		for _, l := range locations {
+			physical, _ := dig(l.(map[string]any), "physicalLocation").(map[string]any)
+			if uri, _ := dig(physical, "artifactLocation", "uri").(string); uri == "" {
+				return fmt.Errorf("result %d location has no artifactLocation.uri", i)
+			}
+			if region, ok := physical["region"].(map[string]any); ok {
+				if line, _ := region["startLine"].(float64); line < 1 {
+					return fmt.Errorf("result %d startLine %v below the schema's minimum of 1", i, region["startLine"])
+				}
+			}
+		}
+	}
+
+	if vcs, ok := run["versionControlProvenance"].([]any); ok {
+		for _, v := range vcs {
+			if uri, _ := v.(map[string]any)["repositoryUri"].(string); uri == "" {
+				return fmt.Errorf("versionControlProvenance entry has no repositoryUri")
+			}
+		}
+	}
+	return nil
+}
+
+// dig follows keys through nested JSON objects, returning nil when one is
+// missing.
+func dig(v any, keys ...string) any {
+	for _, key := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
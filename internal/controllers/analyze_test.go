@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+func TestGitHubRequestsForCountsAnalysisRequests(t *testing.T) {
+	// More files than the default cap, so the cap decides how many are fetched
+	var tree services.GitHubTree
+	for i := 0; i < 2*models.DefaultMaxFiles; i++ {
+		tree.Tree = append(tree.Tree, services.GitHubTreeEntry{Path: fmt.Sprintf("pkg/file%d.go", i), Type: "blob", Size: 100})
+	}
+
+	var requests atomic.Int32
+	github := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rate_limit" {
+			fmt.Fprintf(w, `{"resources": {"core": {"limit": 5000, "remaining": 5000, "reset": %d}}}`, time.Now().Add(time.Hour).Unix())
+			return
+		}
+		requests.Add(1)
+		switch {
+		case r.URL.Path == "/repos/acme/app":
+			json.NewEncoder(w).Encode(services.GitHubRepository{Name: "app", FullName: "acme/app", DefaultBranch: "main", Language: "Go"})
+		case strings.HasPrefix(r.URL.Path, "/repos/acme/app/commits/"):
+			fmt.Fprint(w, "abc123")
+		case strings.HasPrefix(r.URL.Path, "/repos/acme/app/git/trees/"):
+			json.NewEncoder(w).Encode(tree)
+		case strings.HasPrefix(r.URL.Path, "/repos/acme/app/contents/"):
+			fmt.Fprint(w, "package pkg")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	env := newTestEnv(t, AnalyzeConfig{QueueSize: 1, CountPullRequests: true, RateLimitMaxWait: time.Minute}, github)
+	env.useAI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"usage": {"total_tokens": 10}, "choices": [{"message": {"content": "No issues."}, "finish_reason": "stop"}]}`)
+	}))
+	user := env.newGitHubUser(t, "count@example.com", 100000)
+
+	r := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+	analysisID, err := env.c.performAnalysis(r, user, "acme", "app", "https://github.com/acme/app", models.ModeDeep)
+	if err != nil {
+		t.Fatalf("performAnalysis: %v", err)
+	}
+
+	if want := env.c.githubRequestsFor(r.Context(), user.ID, models.ModeDeep); int(requests.Load()) != want {
+		t.Errorf("analysis made %d GitHub requests, githubRequestsFor = %d", requests.Load(), want)
+	}
+
+	// The tree is read at the default branch's commit, which is stored
+	analysis, err := env.analyses.ByID(r.Context(), analysisID)
+	if err != nil {
+		t.Fatalf("load analysis: %v", err)
+	}
+	if analysis.CommitSHA == nil || *analysis.CommitSHA != "abc123" {
+		t.Errorf("CommitSHA = %v, want abc123", analysis.CommitSHA)
+	}
+}
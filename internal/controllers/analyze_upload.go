@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+)
+
+const (
+	// MaxUploadBytes caps the upload request, and so the archive itself.
+	MaxUploadBytes = 20 << 20
+	// maxUploadFiles and maxUploadExtractedBytes cap what is unpacked from it.
+	maxUploadFiles          = 5000
+	maxUploadExtractedBytes = 100 << 20
+)
+
+// PostUpload analyzes source code uploaded as a zip or tar.gz archive,
+// without any GitHub calls. Each upload creates its own repository record.
+// POST /analyze/upload
+func (c *AnalyzeController) PostUpload(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadBytes)
+	if err := r.ParseMultipartForm(MaxUploadBytes); err != nil {
+		c.renderFormError(w, r, user, "", fmt.Sprintf("Upload a zip or tar.gz archive of at most %d MB", MaxUploadBytes>>20))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	mode, err := models.ParseAnalysisMode(r.FormValue("mode"))
+	if err != nil {
+		c.renderFormError(w, r, user, "", "Invalid analysis mode")
+		return
+	}
+
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		c.renderFormError(w, r, user, "", "Please choose an archive to upload")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.renderFormError(w, r, user, "", "Failed to read the uploaded archive")
+		return
+	}
+
+	// Check user quota
+	if user.RemainingQuota() <= 0 {
+		c.renderFormError(w, r, user, "", "You have exceeded your API quota. Please contact support.")
+		return
+	}
+
+	archive, err := services.ExtractArchive(data, services.ArchiveLimits{
+		MaxFiles:      maxUploadFiles,
+		MaxTotalBytes: maxUploadExtractedBytes,
+	})
+	if err != nil {
+		log.Printf("Rejected upload %q from user %d: %v", header.Filename, user.ID, err)
+		c.renderFormError(w, r, user, "", uploadErrorMessage(err))
+		return
+	}
+
+	if err := c.checkInFlight(ctx, user.ID, 1); err != nil {
+		c.renderFormError(w, r, user, "", analysisErrorMessage(err))
+		return
+	}
+
+	// Every upload is a new repository, so it counts toward the limit
+	if c.config.MaxReposPerUser > 0 {
+		existing, err := c.repositoryService.CountByUser(ctx, user.ID)
+		if err != nil {
+			c.renderFormError(w, r, user, "", "Failed to check repository limit")
+			return
+		}
+		if existing >= c.config.MaxReposPerUser {
+			c.renderFormError(w, r, user, "", fmt.Sprintf("You have reached your limit of %d repositories", c.config.MaxReposPerUser))
+			return
+		}
+	}
+
+	repository, err := c.repositoryService.CreateUpload(ctx, user.ID, uploadName(header.Filename))
+	if err != nil {
+		log.Printf("Failed to save uploaded repository: %v", err)
+		c.renderFormError(w, r, user, "", "Failed to start analysis. Please try again.")
+		return
+	}
+
+	analysis, err := c.analysisService.Create(ctx, user.ID, repository.ID, mode, c.analysisLimits(minQuotaReserve))
+	if err != nil {
+		log.Printf("Failed to create analysis for upload: %v", err)
+		message := "Failed to start analysis. Please try again."
+		if errors.Is(err, ErrTooManyInFlight) || errors.Is(err, models.ErrQuotaExceeded) {
+			message = analysisErrorMessage(err)
+		}
+		c.renderFormError(w, r, user, "", message)
+		return
+	}
+
+	job := &analysisJob{
+		analysisID:   analysis.ID,
+		userID:       user.ID,
+		repositoryID: repository.ID,
+		owner:        repository.Owner,
+		repo:         repository.Name,
+		mode:         mode,
+		maxFiles:     c.maxFilesToFetch,
+	}
+	c.applyPreferences(ctx, job)
+
+	if err := c.runUploadAnalysis(ctx, job, archive); err != nil {
+		log.Printf("Analysis failed for upload %q: %v", header.Filename, err)
+		c.renderFormError(w, r, user, "", analysisErrorMessage(err))
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/analyze/%d", analysis.ID), http.StatusSeeOther)
+}
+
+// runUploadAnalysis runs the analysis pipeline on an extracted archive. File
+// selection uses the same scoring as repositories fetched from GitHub.
+func (c *AnalyzeController) runUploadAnalysis(ctx context.Context, job *analysisJob, archive *services.Archive) error {
+	defer c.recordStepTimings(job)
+
+	ctx, done, err := c.startProcessing(ctx, job)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	c.recordParameters(ctx, job, "", "")
+	codeStructure := c.githubService.BuildCodeStructure(archive.Tree, job.scoring)
+
+	var codeFiles []models.FileContent
+	if job.mode != models.ModeMetadata {
+		start := time.Now()
+		codeFiles, job.skipped = c.githubService.ArchiveTopFiles(archive, job.maxFiles, job.scoring)
+		if c.config.RedactSecrets {
+			var redacted int
+			codeFiles, redacted = services.RedactSecrets(codeFiles)
+			if redacted > 0 {
+				log.Printf("Redacted %d secrets from upload %s", redacted, job.repo)
+			}
+		}
+		job.trackStep("files", start)
+	}
+
+	readme, readmeSize := c.githubService.ArchiveREADME(archive)
+
+	return c.analyzeAndStore(ctx, job, services.AnalysisInput{
+		RepoName:      job.repo,
+		RepoOwner:     job.owner,
+		README:        readme,
+		READMESize:    readmeSize,
+		CodeStructure: codeStructure,
+		CodeFiles:     codeFiles,
+		MetadataOnly:  job.mode == models.ModeMetadata,
+	})
+}
+
+// uploadName derives a repository name from the archive's file name,
+// e.g. "my-project-main.tar.gz" becomes "my-project-main".
+func uploadName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "upload"
+	}
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	return name
+}
+
+// uploadErrorMessage maps archive extraction errors to a message suitable
+// for the user.
+func uploadErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrUnsupportedArchive):
+		return "The upload is not a valid zip or tar.gz archive."
+	case errors.Is(err, services.ErrArchiveTooLarge):
+		return fmt.Sprintf("The archive is too large: at most %d files and %d MB uncompressed are allowed.", maxUploadFiles, maxUploadExtractedBytes>>20)
+	case errors.Is(err, services.ErrUnsafeArchivePath):
+		return "The archive contains unsafe file paths and was rejected."
+	default:
+		return "Failed to read the uploaded archive."
+	}
+}
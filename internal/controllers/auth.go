@@ -2,8 +2,13 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/gorilla/csrf"
 	"github.com/rahul4469/github-analyzer/internal/models"
@@ -15,10 +20,12 @@ type AuthController struct {
 	userService     *models.UserService
 	sessionService  *models.SessionService
 	templates       AuthTemplates
-	cookieName      string
-	cookieSecure    bool
+	cookies         CookieOptions
 	sessionDuration time.Duration
 	defaultQuota    int
+	signupsEnabled  bool
+	inviteService   *models.InviteService       // non-nil when signups need an invite code
+	loginAttempts   *models.LoginAttemptService // non-nil when sign-ins are throttled
 }
 
 // AuthTemplates holds the templates for auth pages.
@@ -32,69 +39,133 @@ func NewAuthController(
 	userService *models.UserService,
 	sessionService *models.SessionService,
 	templates AuthTemplates,
-	cookieName string,
-	cookieSecure bool,
+	cookies CookieOptions,
 	sessionDuration time.Duration,
 	defaultQuota int,
+	signupsEnabled bool,
 ) *AuthController {
 	return &AuthController{
 		userService:     userService,
 		sessionService:  sessionService,
 		templates:       templates,
-		cookieName:      cookieName,
-		cookieSecure:    cookieSecure,
+		cookies:         cookies,
 		sessionDuration: sessionDuration,
 		defaultQuota:    defaultQuota,
+		signupsEnabled:  signupsEnabled,
 	}
 }
 
+// RequireInviteCodes makes signups consume an invite code from invites.
+func (c *AuthController) RequireInviteCodes(invites *models.InviteService) {
+	c.inviteService = invites
+}
+
+// ThrottleLogins records every sign-in attempt in attempts and refuses
+// sign-ins for accounts and IPs it has locked out.
+func (c *AuthController) ThrottleLogins(attempts *models.LoginAttemptService) {
+	c.loginAttempts = attempts
+}
+
 // SignUpData holds data for the signup template.
 type SignUpData struct {
-	Email string
+	Email          string
+	Disabled       bool // signups are closed; show a notice instead of the form
+	InviteRequired bool
+	InviteCode     string
 }
 
 // GetSignUp renders the signup form.
 func (c *AuthController) GetSignUp(w http.ResponseWriter, r *http.Request) {
+	if !c.signupsEnabled {
+		c.renderSignUpDisabled(w, r)
+		return
+	}
+
+	// Prefilled once after a GitHub login
+	email := signupEmailFrom(r)
+	if email != "" {
+		http.SetCookie(w, c.cookies.signupEmail(""))
+	}
+
 	data := &views.TemplateData{
 		Title:     "Sign Up",
 		CSRFToken: csrf.Token(r),
-		Data:      SignUpData{},
+		Data: SignUpData{
+			Email:          email,
+			InviteRequired: c.inviteService != nil,
+			InviteCode:     r.URL.Query().Get("invite"),
+		},
 	}
 	c.templates.SignUp.ExecuteHTTP(w, r, data)
 }
 
 // PostSignUp handles the signup form submission.
 func (c *AuthController) PostSignUp(w http.ResponseWriter, r *http.Request) {
+	if !c.signupsEnabled {
+		c.renderSignUpDisabled(w, r)
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
-		c.renderSignUpError(w, r, "", "Invalid form data")
+		c.renderSignUpError(w, r, "", "", "Invalid form data")
 		return
 	}
 
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 	confirmPassword := r.FormValue("confirm_password")
+	inviteCode := r.FormValue("invite_code")
 
 	// Validate password confirmation
 	if password != confirmPassword {
-		c.renderSignUpError(w, r, email, "Passwords do not match")
+		c.renderSignUpError(w, r, email, inviteCode, "Passwords do not match")
 		return
 	}
 
+	// Consume the invite code first so two signups can't share it
+	if c.inviteService != nil {
+		if err := c.inviteService.Consume(r.Context(), inviteCode); err != nil {
+			var errMsg string
+			switch {
+			case errors.Is(err, models.ErrInviteCodeInvalid):
+				errMsg = "That invite code is not valid"
+			case errors.Is(err, models.ErrInviteCodeUsed):
+				errMsg = "That invite code has already been used"
+			default:
+				log.Printf("Failed to consume invite code: %v", err)
+				errMsg = "Failed to check invite code. Please try again."
+			}
+			c.renderSignUpError(w, r, email, inviteCode, errMsg)
+			return
+		}
+	}
+
 	// Create user
 	user, err := c.userService.Create(r.Context(), email, password, c.defaultQuota)
 	if err != nil {
+		if c.inviteService != nil {
+			if relErr := c.inviteService.Release(r.Context(), inviteCode); relErr != nil {
+				log.Printf("Failed to release invite code: %v", relErr)
+			}
+		}
+
 		var errMsg string
+		var weakErr *models.PasswordTooWeakError
 		switch {
 		case errors.Is(err, models.ErrEmailAlreadyExists):
 			errMsg = "An account with this email already exists"
 		case errors.Is(err, models.ErrInvalidEmail):
 			errMsg = "Please enter a valid email address"
+		case errors.Is(err, models.ErrEmailDomainInvalid):
+			errMsg = "That email domain doesn't seem to exist. Please check it for typos"
 		case errors.Is(err, models.ErrPasswordTooShort):
 			errMsg = "Password must be at least 8 characters"
+		case errors.As(err, &weakErr):
+			errMsg = "Password is too weak: " + weakErr.Guidance
 		default:
 			errMsg = "Failed to create account. Please try again."
 		}
-		c.renderSignUpError(w, r, email, errMsg)
+		c.renderSignUpError(w, r, email, inviteCode, errMsg)
 		return
 	}
 
@@ -114,16 +185,32 @@ func (c *AuthController) PostSignUp(w http.ResponseWriter, r *http.Request) {
 }
 
 // renderSignUpError renders the signup page with an error message.
-func (c *AuthController) renderSignUpError(w http.ResponseWriter, r *http.Request, email, errMsg string) {
+func (c *AuthController) renderSignUpError(w http.ResponseWriter, r *http.Request, email, inviteCode, errMsg string) {
 	data := &views.TemplateData{
 		Title:     "Sign Up",
 		CSRFToken: csrf.Token(r),
 		Error:     errMsg,
-		Data:      SignUpData{Email: email},
+		Data: SignUpData{
+			Email:          email,
+			InviteRequired: c.inviteService != nil,
+			InviteCode:     inviteCode,
+		},
 	}
 	c.templates.SignUp.ExecuteHTTPWithStatus(w, r, http.StatusUnprocessableEntity, data)
 }
 
+// renderSignUpDisabled renders the signup page's notice that signups are
+// closed.
+func (c *AuthController) renderSignUpDisabled(w http.ResponseWriter, r *http.Request) {
+	data := &views.TemplateData{
+		Title:     "Sign Up",
+		CSRFToken: csrf.Token(r),
+		Warning:   "Signups are currently disabled. If you already have an account, please sign in.",
+		Data:      SignUpData{Disabled: true},
+	}
+	c.templates.SignUp.ExecuteHTTPWithStatus(w, r, http.StatusForbidden, data)
+}
+
 // SignInData holds data for the signin template.
 type SignInData struct {
 	Email    string
@@ -160,8 +247,26 @@ func (c *AuthController) PostSignIn(w http.ResponseWriter, r *http.Request) {
 	password := r.FormValue("password")
 	redirect := r.FormValue("redirect")
 
+	if c.loginAttempts != nil {
+		err := c.loginAttempts.Check(r.Context(), email, r.RemoteAddr)
+		var lockedErr *models.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			log.Printf("Sign-in for %q from %s refused: %v", email, r.RemoteAddr, err)
+			minutes := int(lockedErr.RetryAfter.Minutes()) + 1
+			c.renderSignInError(w, r, email, redirect, fmt.Sprintf("Too many failed sign-in attempts. Try again in %d minute(s).", minutes))
+			return
+		}
+		if err != nil {
+			// Don't lock everyone out because the check failed
+			log.Printf("Failed to check login attempts: %v", err)
+		}
+	}
+
 	// Authenticate user
 	user, err := c.userService.Authenticate(r.Context(), email, password)
+	if err == nil || errors.Is(err, models.ErrInvalidCredentials) {
+		c.recordLoginAttempt(r, email, err == nil)
+	}
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
 			c.renderSignInError(w, r, email, redirect, "Invalid email or password")
@@ -189,6 +294,17 @@ func (c *AuthController) PostSignIn(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 }
 
+// recordLoginAttempt adds a sign-in attempt to the audit log when logins
+// are throttled. A failure to record is logged but doesn't block sign-in.
+func (c *AuthController) recordLoginAttempt(r *http.Request, email string, succeeded bool) {
+	if c.loginAttempts == nil {
+		return
+	}
+	if err := c.loginAttempts.Record(r.Context(), email, r.RemoteAddr, succeeded); err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+}
+
 // renderSignInError renders the signin page with an error message.
 func (c *AuthController) renderSignInError(w http.ResponseWriter, r *http.Request, email, redirect, errMsg string) {
 	data := &views.TemplateData{
@@ -206,22 +322,14 @@ func (c *AuthController) renderSignInError(w http.ResponseWriter, r *http.Reques
 // PostLogout handles user logout.
 func (c *AuthController) PostLogout(w http.ResponseWriter, r *http.Request) {
 	// Get session cookie
-	cookie, err := r.Cookie(c.cookieName)
+	cookie, err := r.Cookie(c.cookies.Name)
 	if err == nil && cookie.Value != "" {
 		// Delete session from database
 		_ = c.sessionService.Delete(r.Context(), cookie.Value)
 	}
 
 	// Clear the cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     c.cookieName,
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   c.cookieSecure,
-		SameSite: http.SameSiteLaxMode,
-	})
+	http.SetCookie(w, c.cookies.session("", -1))
 
 	// Redirect to home
 	http.Redirect(w, r, "/?msg=logged_out", http.StatusSeeOther)
@@ -229,15 +337,7 @@ func (c *AuthController) PostLogout(w http.ResponseWriter, r *http.Request) {
 
 // setSessionCookie sets the session cookie with secure settings.
 func (c *AuthController) setSessionCookie(w http.ResponseWriter, token string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     c.cookieName,
-		Value:    token,
-		Path:     "/",
-		MaxAge:   int(c.sessionDuration.Seconds()),
-		HttpOnly: true,                 // Not accessible via JavaScript
-		Secure:   c.cookieSecure,       // HTTPS only in production
-		SameSite: http.SameSiteLaxMode, // CSRF protection
-	})
+	http.SetCookie(w, c.cookies.session(token, int(c.sessionDuration.Seconds())))
 }
 
 // isValidRedirect checks if a redirect URL is safe (internal only).
@@ -250,9 +350,16 @@ func isValidRedirect(redirect string) bool {
 	if redirect[0] != '/' {
 		return false
 	}
-	// Don't allow protocol-relative URLs
-	if len(redirect) > 1 && redirect[1] == '/' {
+	// Don't allow protocol-relative URLs; browsers read a backslash as a
+	// slash, so "/\evil.com" is one too
+	if len(redirect) > 1 && (redirect[1] == '/' || redirect[1] == '\\') {
+		return false
+	}
+	// Control characters are stripped by browsers, so "/\t/evil.com" could
+	// become protocol-relative
+	if strings.ContainsFunc(redirect, unicode.IsControl) {
 		return false
 	}
-	return true
+	u, err := url.Parse(redirect)
+	return err == nil && u.Scheme == "" && u.Host == ""
 }
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsValidRedirect(t *testing.T) {
+	tests := []struct {
+		redirect string
+		want     bool
+	}{
+		{"/dashboard", true},
+		{"/analyze/12?tab=issues", true},
+		{"/", true},
+		{"", false},
+		{"dashboard", false},
+		{"https://evil.com", false},
+		{"//evil.com", false},
+		{`/\evil.com`, false},
+		{`/\/evil.com`, false},
+		{"/\t/evil.com", false},
+		{"/\n/evil.com", false},
+		{"javascript:alert(1)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.redirect, func(t *testing.T) {
+			if got := isValidRedirect(tt.redirect); got != tt.want {
+				t.Errorf("isValidRedirect(%q) = %v, want %v", tt.redirect, got, tt.want)
+			}
+		})
+	}
+}
+
+// startOAuthFlow runs GitHubLogin and returns the state it sent to GitHub
+// and the state cookie it set.
+func startOAuthFlow(t *testing.T, c *OAuthController, redirect string) (string, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c.GitHubLogin(rec, httptest.NewRequest(http.MethodGet, "/auth/github/login?redirect="+url.QueryEscape(redirect), nil))
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("bad Location: %v", err)
+	}
+	state := location.Query().Get("state")
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oauthStateCookiePrefix+state {
+		t.Fatalf("login set cookies %v, want one named after state %q", cookies, state)
+	}
+	return state, cookies[0]
+}
+
+func TestOAuthConcurrentFlows(t *testing.T) {
+	c := NewOAuthController(nil, nil, nil, OAuthConfig{ClientID: "id"}, CookieOptions{}, time.Hour)
+
+	// Two tabs start a sign in before either finishes; the browser holds
+	// both cookies
+	stateA, cookieA := startOAuthFlow(t, c, "/analyze/1")
+	stateB, cookieB := startOAuthFlow(t, c, `/\evil.com`)
+	if stateA == stateB {
+		t.Fatal("two flows got the same state")
+	}
+
+	tests := []struct {
+		name        string
+		state       string
+		cookies     []*http.Cookie
+		wantError   string
+		wantCleared string
+	}{
+		// GitHub's error parameter ends the callback right after the state
+		// check, so github_denied means the state was accepted
+		{"first flow", stateA, []*http.Cookie{cookieA, cookieB}, "github_denied", cookieA.Name},
+		{"second flow", stateB, []*http.Cookie{cookieA, cookieB}, "github_denied", cookieB.Name},
+		{"flow started in another browser", stateA, []*http.Cookie{cookieB}, "oauth_failed", ""},
+		{"malformed state", "nope", []*http.Cookie{cookieA, cookieB}, "oauth_failed", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/auth/github/callback?error=access_denied&state="+url.QueryEscape(tt.state), nil)
+			for _, cookie := range tt.cookies {
+				r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+			}
+			rec := httptest.NewRecorder()
+			c.GitHubCallback(rec, r)
+
+			if location := rec.Header().Get("Location"); !strings.HasSuffix(location, "error="+tt.wantError) {
+				t.Errorf("redirected to %q, want error=%s", location, tt.wantError)
+			}
+
+			var cleared []string
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.MaxAge < 0 {
+					cleared = append(cleared, cookie.Name)
+				}
+			}
+			switch {
+			case tt.wantCleared == "" && len(cleared) > 0:
+				t.Errorf("cleared %v, want none", cleared)
+			case tt.wantCleared != "" && (len(cleared) != 1 || cleared[0] != tt.wantCleared):
+				t.Errorf("cleared %v, want only %s", cleared, tt.wantCleared)
+			}
+		})
+	}
+}
+
+func TestOAuthLoginDropsUnsafeRedirect(t *testing.T) {
+	c := NewOAuthController(nil, nil, nil, OAuthConfig{ClientID: "id"}, CookieOptions{}, time.Hour)
+
+	for _, redirect := range []string{"//evil.com", `/\evil.com`, "https://evil.com"} {
+		_, cookie := startOAuthFlow(t, c, redirect)
+		if cookie.Value != "" {
+			t.Errorf("redirect %q was kept in the state cookie as %q", redirect, cookie.Value)
+		}
+	}
+}
+
+func TestSessionCookieFollowsConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CookieOptions
+	}{
+		{"defaults", CookieOptions{Name: "session", SameSite: http.SameSiteLaxMode}},
+		{"strict on a parent domain", CookieOptions{Name: "session", Domain: "example.com", Secure: true, SameSite: http.SameSiteStrictMode}},
+		{"none over https", CookieOptions{Name: "app_session", Secure: true, SameSite: http.SameSiteNoneMode}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setters := map[string]func(http.ResponseWriter, string){
+				"auth":  (&AuthController{cookies: tt.opts, sessionDuration: time.Hour}).setSessionCookie,
+				"oauth": (&OAuthController{cookies: tt.opts, sessionDuration: time.Hour}).setSessionCookie,
+			}
+			for controller, set := range setters {
+				rec := httptest.NewRecorder()
+				set(rec, "token")
+
+				cookies := rec.Result().Cookies()
+				if len(cookies) != 1 {
+					t.Fatalf("%s set %d cookies, want 1", controller, len(cookies))
+				}
+				c := cookies[0]
+				if c.Name != tt.opts.Name || c.Value != "token" || c.Domain != tt.opts.Domain ||
+					c.Secure != tt.opts.Secure || c.SameSite != tt.opts.SameSite || !c.HttpOnly || c.MaxAge != 3600 {
+					t.Errorf("%s set %+v, want options %+v", controller, c, tt.opts)
+				}
+			}
+		})
+	}
+}
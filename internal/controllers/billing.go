@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// maxBillingBodyBytes caps billing request bodies.
+const maxBillingBodyBytes = 4 << 10
+
+// BillingController handles endpoints called by the billing service.
+type BillingController struct {
+	userService *models.UserService
+}
+
+// NewBillingController creates a new BillingController.
+func NewBillingController(userService *models.UserService) *BillingController {
+	return &BillingController{userService: userService}
+}
+
+// SetQuotaRequest is the body of POST /api/v1/billing/quota.
+type SetQuotaRequest struct {
+	UserID int64 `json:"user_id"`
+	Limit  *int  `json:"limit"`
+	// ResetUsage clears the tokens used so far, but only when the new limit
+	// is higher than the old one (a plan upgrade)
+	ResetUsage bool `json:"reset_usage"`
+}
+
+// QuotaResponse reports a user's quota after a change.
+type QuotaResponse struct {
+	UserID     int64 `json:"user_id"`
+	QuotaLimit int   `json:"quota_limit"`
+	QuotaUsed  int   `json:"quota_used"`
+	UsageReset bool  `json:"usage_reset"`
+}
+
+// PostQuota sets a user's API quota limit after a plan change.
+// POST /api/v1/billing/quota
+func (c *BillingController) PostQuota(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBillingBodyBytes)
+	var req SetQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	if req.UserID <= 0 || req.Limit == nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "user_id and limit are required")
+		return
+	}
+	if *req.Limit < 0 {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, models.ErrInvalidQuotaLimit.Error())
+		return
+	}
+
+	user, err := c.userService.ByID(ctx, req.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			respondError(w, http.StatusNotFound, codeNotFound, "User not found")
+			return
+		}
+		log.Printf("Failed to load user %d for quota change: %v", req.UserID, err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to load user")
+		return
+	}
+
+	if err := c.userService.SetQuotaLimit(ctx, user.ID, *req.Limit); err != nil {
+		log.Printf("Failed to set quota limit for user %d: %v", user.ID, err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to set quota limit")
+		return
+	}
+
+	resp := QuotaResponse{
+		UserID:     user.ID,
+		QuotaLimit: *req.Limit,
+		QuotaUsed:  user.APIQuotaUsed,
+	}
+
+	if req.ResetUsage && *req.Limit > user.APIQuotaLimit {
+		if err := c.userService.ResetAPIQuota(ctx, user.ID); err != nil {
+			log.Printf("Failed to reset quota usage for user %d: %v", user.ID, err)
+			respondError(w, http.StatusInternalServerError, codeInternal, "Quota limit set but usage could not be reset")
+			return
+		}
+		resp.QuotaUsed = 0
+		resp.UsageReset = true
+	}
+
+	log.Printf("Quota limit for user %d changed from %d to %d (usage reset: %t)", user.ID, user.APIQuotaLimit, *req.Limit, resp.UsageReset)
+
+	respondJSON(w, http.StatusOK, resp)
+}
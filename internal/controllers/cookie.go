@@ -1,43 +1,72 @@
 package controllers
 
-import "net/http"
+import (
+	"encoding/base64"
+	"net/http"
+)
 
 const (
 	CookieSession = "session"
+
+	// cookieSignupEmail carries the email of a new GitHub user to the signup
+	// form, so it stays out of URLs, logs and Referer headers.
+	cookieSignupEmail = "signup_email"
+	// signupEmailMaxAge is how long, in seconds, the email is kept.
+	signupEmailMaxAge = 600
 )
 
-// func newCookie(name, value string) *http.Cookie {
-// 	cookie := http.Cookie{
-// 		Name:     name,
-// 		Value:    value,
-// 		Path:     "/",
-// 		HttpOnly: true,
-// 	}
-// 	return &cookie
-// }
+// CookieOptions are the attributes of the session cookie, shared by every
+// controller that sets or clears it.
+type CookieOptions struct {
+	Name     string
+	Domain   string // empty scopes the cookie to the request host
+	Secure   bool   // HTTPS only; required when SameSite is None
+	SameSite http.SameSite
+}
 
-// setCookie sets a session cookie
-func (ac *AuthController) setCookie(w http.ResponseWriter, name, value string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     name,
+// session returns the session cookie holding value. A negative maxAge
+// deletes it.
+func (o CookieOptions) session(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     o.Name,
 		Value:    value,
 		Path:     "/",
-		MaxAge:   24 * 60 * 60, // 24 hours
-		HttpOnly: true,
-		Secure:   true, // HTTPS only in production
-		SameSite: http.SameSiteLaxMode,
-	})
+		Domain:   o.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: true, // Not accessible via JavaScript
+		Secure:   o.Secure,
+		SameSite: o.SameSite,
+	}
 }
 
-// deleteCookie removes a session cookie
-func (ac *AuthController) deleteCookie(w http.ResponseWriter, name string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     name,
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
+// signupEmail returns the cookie carrying email to the signup form. An empty
+// email deletes it.
+func (o CookieOptions) signupEmail(email string) *http.Cookie {
+	maxAge := signupEmailMaxAge
+	if email == "" {
+		maxAge = -1
+	}
+	return &http.Cookie{
+		Name:     cookieSignupEmail,
+		Value:    base64.RawURLEncoding.EncodeToString([]byte(email)),
+		Path:     "/signup",
+		Domain:   o.Domain,
+		MaxAge:   maxAge,
 		HttpOnly: true,
-		Secure:   true,
+		Secure:   o.Secure,
 		SameSite: http.SameSiteLaxMode,
-	})
+	}
+}
+
+// signupEmailFrom returns the email set with signupEmail, if any.
+func signupEmailFrom(r *http.Request) string {
+	cookie, err := r.Cookie(cookieSignupEmail)
+	if err != nil {
+		return ""
+	}
+	email, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return ""
+	}
+	return string(email)
 }
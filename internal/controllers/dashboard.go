@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"cmp"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/gorilla/csrf"
 	"github.com/rahul4469/github-analyzer/internal/middleware"
@@ -29,9 +32,20 @@ func NewDashboardController(
 	}
 }
 
+// Orders of the dashboard's repository health view.
+const (
+	healthSortRecent = "recent" // most recently updated repository first
+	healthSortScore  = "score"  // lowest score first, unscored repositories last
+	healthSortName   = "name"
+)
+
 // DashboardData holds data for the dashboard template.
 type DashboardData struct {
 	Analyses      []*models.Analysis
+	LatestOnly    bool // show only the newest analysis of each repository
+	Health        bool // show each repository with its latest score instead
+	HealthSort    string
+	Repositories  []*models.RepositoryHealth
 	StatusCounts  map[string]int
 	TotalAnalyses int
 	QuotaUsed     int
@@ -43,8 +57,29 @@ type DashboardData struct {
 func (c *DashboardController) GetDashboard(w http.ResponseWriter, r *http.Request) {
 	user := middleware.MustCurrentUser(r)
 
-	// Get recent analyses
-	analyses, err := c.analysisService.ByUserID(r.Context(), user.ID, 20)
+	// Get recent analyses, the latest one per repository, or each
+	// repository's health
+	view := r.URL.Query().Get("view")
+	latestOnly := view == "latest"
+	health := view == "health"
+
+	var analyses []*models.Analysis
+	var repositories []*models.RepositoryHealth
+	healthSort := healthSortRecent
+	var err error
+	switch {
+	case health:
+		repositories, err = c.repositoryService.ByUserIDWithLatestScore(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, "Failed to load repositories", http.StatusInternalServerError)
+			return
+		}
+		healthSort = sortRepositoryHealth(repositories, r.URL.Query().Get("sort"))
+	case latestOnly:
+		analyses, err = c.analysisService.LatestPerRepository(r.Context(), user.ID)
+	default:
+		analyses, err = c.analysisService.ByUserID(r.Context(), user.ID, models.Page{Limit: 20})
+	}
 	if err != nil {
 		http.Error(w, "Failed to load analyses", http.StatusInternalServerError)
 		return
@@ -74,6 +109,10 @@ func (c *DashboardController) GetDashboard(w http.ResponseWriter, r *http.Reques
 		CurrentUser: user,
 		Data: DashboardData{
 			Analyses:      analyses,
+			LatestOnly:    latestOnly,
+			Health:        health,
+			HealthSort:    healthSort,
+			Repositories:  repositories,
 			StatusCounts:  stringStatusCounts,
 			TotalAnalyses: totalAnalyses,
 			QuotaUsed:     user.APIQuotaUsed,
@@ -92,3 +131,30 @@ func (c *DashboardController) GetDashboard(w http.ResponseWriter, r *http.Reques
 
 	c.template.ExecuteHTTP(w, r, data)
 }
+
+// sortRepositoryHealth orders repos in place by the given sort, returning
+// the one applied. Unknown sorts keep the most recently updated first, the
+// order ByUserIDWithLatestScore returns.
+func sortRepositoryHealth(repos []*models.RepositoryHealth, sort string) string {
+	switch sort {
+	case healthSortScore:
+		slices.SortStableFunc(repos, func(a, b *models.RepositoryHealth) int {
+			switch {
+			case a.LatestScore == nil && b.LatestScore == nil:
+				return 0
+			case a.LatestScore == nil:
+				return 1
+			case b.LatestScore == nil:
+				return -1
+			}
+			return cmp.Compare(*a.LatestScore, *b.LatestScore)
+		})
+	case healthSortName:
+		slices.SortStableFunc(repos, func(a, b *models.RepositoryHealth) int {
+			return cmp.Compare(strings.ToLower(a.Repository.FullName()), strings.ToLower(b.Repository.FullName()))
+		})
+	default:
+		sort = healthSortRecent
+	}
+	return sort
+}
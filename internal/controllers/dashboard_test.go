@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestSortRepositoryHealth(t *testing.T) {
+	score := func(n int) *int { return &n }
+	repo := func(name string, s *int) *models.RepositoryHealth {
+		return &models.RepositoryHealth{Repository: &models.Repository{Owner: "acme", Name: name}, LatestScore: s}
+	}
+
+	tests := []struct {
+		sort     string
+		wantSort string
+		want     []string
+	}{
+		{"", healthSortRecent, []string{"web", "api", "Cli", "docs"}},
+		{"recent", healthSortRecent, []string{"web", "api", "Cli", "docs"}},
+		{"bogus", healthSortRecent, []string{"web", "api", "Cli", "docs"}},
+		{"score", healthSortScore, []string{"Cli", "web", "api", "docs"}},
+		{"name", healthSortName, []string{"api", "Cli", "docs", "web"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			// In the order ByUserIDWithLatestScore returns them; docs was
+			// never analyzed
+			repos := []*models.RepositoryHealth{
+				repo("web", score(70)), repo("api", score(90)), repo("Cli", score(0)), repo("docs", nil),
+			}
+			if got := sortRepositoryHealth(repos, tt.sort); got != tt.wantSort {
+				t.Errorf("applied sort %q, want %q", got, tt.wantSort)
+			}
+			var names []string
+			for _, r := range repos {
+				names = append(names, r.Repository.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("order = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/rand"
+)
+
+const (
+	// MaxWebhookBodyBytes caps the webhook payload read before verification.
+	MaxWebhookBodyBytes = 5 << 20
+	// webhookSecretBytes is the entropy of generated webhook secrets.
+	webhookSecretBytes = 32
+)
+
+// pushEvent is the subset of a GitHub push payload the webhook needs.
+type pushEvent struct {
+	Ref     string `json:"ref"`
+	Deleted bool   `json:"deleted"`
+	Repo    struct {
+		FullName      string `json:"full_name"`
+		HTMLURL       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// WebhookSecretResponse is returned when a webhook secret is generated.
+type WebhookSecretResponse struct {
+	RepositoryID int64  `json:"repository_id"`
+	Secret       string `json:"secret"`
+}
+
+// WebhookResponse lists the analyses queued by a push.
+type WebhookResponse struct {
+	AnalysisIDs []int64 `json:"analysis_ids"`
+}
+
+// PostWebhookSecret generates a new push webhook secret for one of the user's
+// repositories, replacing any previous one. The secret is only shown once.
+// POST /api/v1/repositories/{id}/webhook
+func (c *AnalyzeController) PostWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	repositoryID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid repository ID")
+		return
+	}
+
+	secret, err := rand.String(webhookSecretBytes)
+	if err != nil {
+		log.Printf("Failed to generate webhook secret: %v", err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to generate webhook secret")
+		return
+	}
+
+	encryptedSecret, err := c.encryptor.Encrypt(secret)
+	if err != nil {
+		log.Printf("Failed to encrypt webhook secret: %v", err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to generate webhook secret")
+		return
+	}
+
+	if err := c.repositoryService.SetWebhookSecret(r.Context(), user.ID, repositoryID, encryptedSecret); err != nil {
+		if errors.Is(err, models.ErrRepositoryNotFound) {
+			respondError(w, http.StatusNotFound, codeNotFound, "Repository not found")
+			return
+		}
+		log.Printf("Failed to store webhook secret: %v", err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to store webhook secret")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, WebhookSecretResponse{RepositoryID: repositoryID, Secret: secret})
+}
+
+// PostGitHubWebhook re-analyzes a repository when GitHub reports a push to
+// its default branch. The payload must be signed with the secret of at least
+// one user linked to the repository; an analysis is queued for each of them
+// that still has quota.
+// POST /api/v1/github/webhook
+func (c *AnalyzeController) PostGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Nothing but pushes triggers work, so other events need no verification
+	if r.Header.Get("X-GitHub-Event") != "push" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxWebhookBodyBytes))
+	if err != nil {
+		respondError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "Payload too large")
+		return
+	}
+
+	var event pushEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	subscribers, err := c.repositoryService.WebhookSubscribers(ctx, event.Repo.HTMLURL)
+	if err != nil && !errors.Is(err, models.ErrInvalidRepositoryURL) {
+		log.Printf("Failed to load webhook subscribers for %s: %v", event.Repo.FullName, err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to process webhook")
+		return
+	}
+
+	signature := r.Header.Get("X-Hub-Signature-256")
+	var verified []models.WebhookSubscriber
+	for _, sub := range subscribers {
+		secret, err := c.encryptor.Decrypt(sub.EncryptedSecret)
+		if err != nil {
+			log.Printf("Failed to decrypt webhook secret for user %d: %v", sub.UserID, err)
+			continue
+		}
+		if validWebhookSignature(body, signature, secret) {
+			verified = append(verified, sub)
+		}
+	}
+
+	// Unknown repositories and bad signatures look the same to the caller
+	if len(verified) == 0 {
+		respondError(w, http.StatusUnauthorized, codeUnauthorized, "Invalid signature")
+		return
+	}
+
+	resp := WebhookResponse{AnalysisIDs: []int64{}}
+
+	// Only the default branch is analyzed, so other pushes change nothing
+	if event.Deleted || event.Ref != "refs/heads/"+event.Repo.DefaultBranch {
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	queueFull := false
+	for _, sub := range verified {
+		analysisID, err := c.enqueueWebhookAnalysis(ctx, sub.UserID, event.Repo.HTMLURL)
+		if err != nil {
+			log.Printf("Webhook analysis of %s for user %d skipped: %v", event.Repo.FullName, sub.UserID, err)
+			queueFull = queueFull || errors.Is(err, ErrQueueFull)
+			continue
+		}
+		resp.AnalysisIDs = append(resp.AnalysisIDs, analysisID)
+	}
+
+	// Let the sender redeliver once the queue drains if nothing got in
+	if queueFull && len(resp.AnalysisIDs) == 0 {
+		respondQueueFull(w)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, resp)
+}
+
+// enqueueWebhookAnalysis creates and queues an analysis of repoURL on behalf
+// of a webhook subscriber.
+func (c *AnalyzeController) enqueueWebhookAnalysis(ctx context.Context, userID int64, repoURL string) (int64, error) {
+	user, err := c.userService.ByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if user.RemainingQuota() <= 0 {
+		return 0, errors.New("API quota exceeded")
+	}
+	if !user.HasGitHubConnected() {
+		return 0, errors.New("GitHub account not connected")
+	}
+
+	encryptedToken, err := c.userService.GetGitHubToken(ctx, user.ID)
+	if err != nil || encryptedToken == "" {
+		return 0, errors.New("GitHub token not found")
+	}
+	githubToken, err := c.encryptor.Decrypt(encryptedToken)
+	if err != nil {
+		return 0, err
+	}
+
+	owner, repo, err := models.ParseGitHubURL(repoURL)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.checkQueueCapacity(ctx, 1); err != nil {
+		return 0, err
+	}
+
+	repoInfo, metadataTime, err := c.fetchRepository(ctx, owner, repo, githubToken)
+	if err != nil {
+		return 0, err
+	}
+
+	job, err := c.createAnalysis(ctx, user, repoInfo, metadataTime, owner, repo, repoURL, githubToken, models.ModeDeep)
+	if err != nil {
+		return 0, err
+	}
+
+	if job.reused {
+		return job.analysisID, nil
+	}
+
+	if err := c.enqueue(job); err != nil {
+		_ = c.analysisService.Fail(ctx, job.analysisID, "Analysis queue is full, please try again later")
+		return 0, err
+	}
+
+	return job.analysisID, nil
+}
+
+// validWebhookSignature checks a GitHub X-Hub-Signature-256 header
+// ("sha256=<hex HMAC of the body>") in constant time. An empty secret
+// never verifies.
+func validWebhookSignature(body []byte, header, secret string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok || secret == "" {
+		return false
+	}
+
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
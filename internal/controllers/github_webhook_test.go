@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// signWebhook returns the X-Hub-Signature-256 header GitHub sends for body.
+func signWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidWebhookSignature(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	secret := "s3cret"
+
+	sign := signWebhook
+	sha1Mac := hmac.New(sha1.New, []byte(secret))
+	sha1Mac.Write(body)
+
+	valid := sign(body, secret)
+
+	tests := []struct {
+		name   string
+		body   []byte
+		header string
+		secret string
+		want   bool
+	}{
+		{"valid", body, valid, secret, true},
+		{"wrong secret", body, sign(body, "other"), secret, false},
+		{"tampered body", []byte(`{"ref":"refs/heads/evil"}`), valid, secret, false},
+		{"missing header", body, "", secret, false},
+		{"missing prefix", body, strings.TrimPrefix(valid, "sha256="), secret, false},
+		{"SHA-1 signature", body, "sha1=" + hex.EncodeToString(sha1Mac.Sum(nil)), secret, false},
+		{"not hex", body, "sha256=zz", secret, false},
+		{"truncated", body, valid[:len(valid)-2], secret, false},
+		{"uppercase hex", body, "sha256=" + strings.ToUpper(strings.TrimPrefix(valid, "sha256=")), secret, true},
+		{"empty secret", body, sign(body, ""), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validWebhookSignature(tt.body, tt.header, tt.secret); got != tt.want {
+				t.Errorf("validWebhookSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostGitHubWebhookIgnoresOtherEvents(t *testing.T) {
+	// No services: other events must be answered before any is needed
+	c := &AnalyzeController{jobs: make(chan *analysisJob, 1)}
+
+	for _, event := range []string{"ping", "pull_request", "issues", ""} {
+		t.Run(event, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/github/webhook", strings.NewReader(`{"zen": "Keep it logically awesome."}`))
+			r.Header.Set("X-GitHub-Event", event)
+			w := httptest.NewRecorder()
+
+			c.PostGitHubWebhook(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if len(c.jobs) != 0 {
+				t.Errorf("%d jobs queued, want none", len(c.jobs))
+			}
+		})
+	}
+}
+
+func TestPostGitHubWebhook(t *testing.T) {
+	const secret = "s3cret"
+	push := []byte(`{
+		"ref": "refs/heads/main",
+		"repository": {"full_name": "acme/app", "html_url": "https://github.com/acme/app", "default_branch": "main"}
+	}`)
+
+	tests := []struct {
+		name      string
+		event     string
+		signature string
+		wantCode  int
+		wantQueue int
+	}{
+		{"signed push", "push", signWebhook(push, secret), http.StatusAccepted, 1},
+		{"wrong secret", "push", signWebhook(push, "guess"), http.StatusUnauthorized, 0},
+		{"unsigned push", "push", "", http.StatusUnauthorized, 0},
+		{"other event", "ping", signWebhook(push, secret), http.StatusNoContent, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, AnalyzeConfig{QueueSize: 5}, mockGitHubRepos())
+			ctx := context.Background()
+			user := env.newGitHubUser(t, "hook@example.com", 100000)
+
+			repo, err := env.c.repositoryService.Create(ctx, &models.Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"})
+			if err != nil {
+				t.Fatalf("create repository: %v", err)
+			}
+			encrypted, err := env.encryptor.Encrypt(secret)
+			if err != nil {
+				t.Fatalf("encrypt secret: %v", err)
+			}
+			if err := env.c.repositoryService.SetWebhookSecret(ctx, user.ID, repo.ID, encrypted); err != nil {
+				t.Fatalf("SetWebhookSecret: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/github/webhook", strings.NewReader(string(push)))
+			r.Header.Set("X-GitHub-Event", tt.event)
+			if tt.signature != "" {
+				r.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+			w := httptest.NewRecorder()
+
+			env.c.PostGitHubWebhook(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if len(env.c.jobs) != tt.wantQueue {
+				t.Fatalf("%d jobs queued, want %d", len(env.c.jobs), tt.wantQueue)
+			}
+			if tt.wantQueue == 0 {
+				return
+			}
+
+			var resp WebhookResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %q: %v", w.Body, err)
+			}
+			job := <-env.c.jobs
+			if len(resp.AnalysisIDs) != 1 || resp.AnalysisIDs[0] != job.analysisID {
+				t.Errorf("analysis_ids = %v, want [%d]", resp.AnalysisIDs, job.analysisID)
+			}
+			if job.userID != user.ID || job.owner != "acme" || job.repo != "app" {
+				t.Errorf("queued job for user %d, %s/%s; want user %d, acme/app", job.userID, job.owner, job.repo, user.ID)
+			}
+			if status := env.status(t, job.analysisID); status != models.StatusPending {
+				t.Errorf("analysis status = %s, want %s", status, models.StatusPending)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/csrf"
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/views"
+)
+
+// issuesPageLimit is the most issues listed on the issues page.
+const issuesPageLimit = 200
+
+// IssuesController lists issues across all of a user's analyses.
+type IssuesController struct {
+	analysisService *models.AnalysisService
+	template        *views.Template
+}
+
+// NewIssuesController creates a new IssuesController.
+func NewIssuesController(analysisService *models.AnalysisService, template *views.Template) *IssuesController {
+	return &IssuesController{
+		analysisService: analysisService,
+		template:        template,
+	}
+}
+
+// IssuesData holds data for the issues template.
+type IssuesData struct {
+	Severity   models.Severity
+	Severities []models.Severity
+	Issues     []models.UserIssue
+}
+
+// GetIssues renders the user's recent issues of one severity, e.g. a
+// security backlog of HIGH issues.
+// GET /issues?severity=HIGH
+func (c *IssuesController) GetIssues(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	severity := models.SeverityHigh
+	if raw := r.URL.Query().Get("severity"); raw != "" {
+		parsed, err := models.ParseSeverity(raw)
+		if err != nil {
+			http.Error(w, "Invalid severity", http.StatusBadRequest)
+			return
+		}
+		severity = parsed
+	}
+
+	issues, err := c.analysisService.IssuesBySeverity(r.Context(), user.ID, severity, models.Page{Limit: issuesPageLimit})
+	if err != nil {
+		log.Printf("Failed to load issues for user %d: %v", user.ID, err)
+		http.Error(w, "Failed to load issues", http.StatusInternalServerError)
+		return
+	}
+
+	data := &views.TemplateData{
+		Title:       "Issues",
+		CSRFToken:   csrf.Token(r),
+		CurrentUser: user,
+		Data: IssuesData{
+			Severity:   severity,
+			Severities: models.Severities,
+			Issues:     issues,
+		},
+	}
+
+	c.template.ExecuteHTTP(w, r, data)
+}
@@ -5,11 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/rahul4469/github-analyzer/internal/crypto"
@@ -25,9 +27,10 @@ type OAuthController struct {
 	sessionService  *models.SessionService
 	encryptor       *crypto.Encryptor
 	oauthConfig     *oauth2.Config
-	cookieName      string
-	cookieSecure    bool
+	cookies         CookieOptions
 	sessionDuration time.Duration
+	apiBaseURL      string
+	httpClient      *http.Client // shared by the GitHub user and email lookups
 }
 
 // OAuthConfig holds OAuth2 configuration.
@@ -36,16 +39,29 @@ type OAuthConfig struct {
 	ClientSecret string
 	RedirectURL  string
 	Scopes       []string
+
+	// APIBaseURL is the GitHub API the user and email lookups call;
+	// empty uses https://api.github.com.
+	APIBaseURL string
+	// APITimeout caps each lookup; zero uses defaultOAuthAPITimeout.
+	APITimeout time.Duration
 }
 
+// defaultOAuthAPITimeout caps a GitHub user or email lookup when
+// OAuthConfig.APITimeout is unset.
+const defaultOAuthAPITimeout = 10 * time.Second
+
+// errEmailScopeDenied is returned by getGitHubPrimaryEmail when the user
+// didn't grant the user:email scope.
+var errEmailScopeDenied = errors.New("user:email scope not granted")
+
 // NewOAuthController creates a new OAuthController.
 func NewOAuthController(
 	userService *models.UserService,
 	sessionService *models.SessionService,
 	encryptor *crypto.Encryptor,
 	config OAuthConfig,
-	cookieName string,
-	cookieSecure bool,
+	cookies CookieOptions,
 	sessionDuration time.Duration,
 ) *OAuthController {
 	// Create oauth2.Config using the library
@@ -57,19 +73,31 @@ func NewOAuthController(
 		Endpoint:     github.Endpoint, // Pre-configured GitHub OAuth endpoints
 	}
 
+	apiBaseURL := strings.TrimRight(config.APIBaseURL, "/")
+	if apiBaseURL == "" {
+		apiBaseURL = "https://api.github.com"
+	}
+	apiTimeout := config.APITimeout
+	if apiTimeout <= 0 {
+		apiTimeout = defaultOAuthAPITimeout
+	}
+
 	return &OAuthController{
 		userService:     userService,
 		sessionService:  sessionService,
 		encryptor:       encryptor,
 		oauthConfig:     oauthConfig,
-		cookieName:      cookieName,
-		cookieSecure:    cookieSecure,
+		cookies:         cookies,
 		sessionDuration: sessionDuration,
+		apiBaseURL:      apiBaseURL,
+		httpClient:      &http.Client{Timeout: apiTimeout},
 	}
 }
 
 // GitHubLogin initiates the GitHub OAuth2 flow.
 // GET /auth/github/login
+// The optional ?redirect= query parameter is where the callback sends the
+// user once done.
 func (c *OAuthController) GitHubLogin(w http.ResponseWriter, r *http.Request) {
 	// Generate state token to prevent CSRF
 	state, err := generateState()
@@ -79,14 +107,21 @@ func (c *OAuthController) GitHubLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store state in cookie for validation on callback
+	returnTo := r.URL.Query().Get("redirect")
+	if !isValidRedirect(returnTo) {
+		returnTo = ""
+	}
+
+	// Store state in a cookie named after it, so flows started in several
+	// tabs don't overwrite each other. It stays Lax whatever the session
+	// cookie uses: Strict would drop it on GitHub's redirect back.
 	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    state,
+		Name:     oauthStateCookiePrefix + state,
+		Value:    base64.RawURLEncoding.EncodeToString([]byte(returnTo)),
 		Path:     "/",
-		MaxAge:   600, // 10 minutes
+		MaxAge:   oauthStateMaxAge,
 		HttpOnly: true,
-		Secure:   c.cookieSecure,
+		Secure:   c.cookies.Secure,
 		SameSite: http.SameSiteLaxMode,
 	})
 
@@ -99,30 +134,35 @@ func (c *OAuthController) GitHubLogin(w http.ResponseWriter, r *http.Request) {
 // GitHubCallback handles the OAuth2 callback from GitHub.
 // GET /auth/github/callback
 func (c *OAuthController) GitHubCallback(w http.ResponseWriter, r *http.Request) {
-	// Verify state to prevent CSRF
-	stateCookie, err := r.Cookie("oauth_state")
-	if err != nil {
-		log.Printf("Missing state cookie: %v", err)
+	// Verify state to prevent CSRF: only a flow started in this browser has
+	// a cookie named after the returned state
+	state := r.URL.Query().Get("state")
+	if !validState(state) {
+		log.Printf("Invalid OAuth state %q", state)
 		http.Redirect(w, r, "/signin?error=oauth_failed", http.StatusSeeOther)
 		return
 	}
-
-	state := r.URL.Query().Get("state")
-	if state == "" || state != stateCookie.Value {
-		log.Printf("State mismatch: expected %s, got %s", stateCookie.Value, state)
+	stateCookie, err := r.Cookie(oauthStateCookiePrefix + state)
+	if err != nil {
+		log.Printf("Missing state cookie: %v", err)
 		http.Redirect(w, r, "/signin?error=oauth_failed", http.StatusSeeOther)
 		return
 	}
 
-	// Clear state cookie
+	// Consume the state so it can't be replayed
 	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
+		Name:     stateCookie.Name,
 		Value:    "",
 		Path:     "/",
 		MaxAge:   -1,
 		HttpOnly: true,
 	})
 
+	var returnTo string
+	if b, err := base64.RawURLEncoding.DecodeString(stateCookie.Value); err == nil && isValidRedirect(string(b)) {
+		returnTo = string(b)
+	}
+
 	// Check for error from GitHub
 	if errParam := r.URL.Query().Get("error"); errParam != "" {
 		errDesc := r.URL.Query().Get("error_description")
@@ -165,7 +205,7 @@ func (c *OAuthController) GitHubCallback(w http.ResponseWriter, r *http.Request)
 			http.Redirect(w, r, "/dashboard?error=github_connect_failed", http.StatusSeeOther)
 			return
 		}
-		http.Redirect(w, r, "/dashboard?success=github_connected", http.StatusSeeOther)
+		http.Redirect(w, r, redirectOr(returnTo, "/dashboard?success=github_connected"), http.StatusSeeOther)
 		return
 	}
 
@@ -180,13 +220,27 @@ func (c *OAuthController) GitHubCallback(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		c.setSessionCookie(w, sessionToken)
-		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		http.Redirect(w, r, redirectOr(returnTo, "/dashboard"), http.StatusSeeOther)
 		return
 	}
 
 	// New user - redirect to complete registration
 	// Store GitHub data temporarily in session for registration completion
 	// For now, we'll require email/password signup first, then GitHub connection
+	// Only new users need the email, to prefill the signup form
+	email := githubUser.Email
+	if email == "" {
+		email, err = c.getGitHubPrimaryEmail(r.Context(), token.AccessToken)
+		if errors.Is(err, errEmailScopeDenied) {
+			log.Printf("GitHub user %s did not grant the user:email scope", githubUser.Login)
+		} else if err != nil {
+			log.Printf("Failed to get GitHub email: %v", err)
+		}
+	}
+
+	if email != "" {
+		http.SetCookie(w, c.cookies.signupEmail(email))
+	}
 	http.Redirect(w, r, "/signup?github=pending&username="+url.QueryEscape(githubUser.Login), http.StatusSeeOther)
 }
 
@@ -222,18 +276,14 @@ type GitHubUser struct {
 }
 
 // getGitHubUser fetches the authenticated user's information from GitHub.
+// Email is only set when the user made it public; see getGitHubPrimaryEmail.
 func (c *OAuthController) getGitHubUser(ctx context.Context, accessToken string) (*GitHubUser, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user", nil)
+	req, err := c.newGitHubRequest(ctx, "/user", accessToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "GitHub-Analyzer/1.0")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user: %w", err)
 	}
@@ -249,32 +299,33 @@ func (c *OAuthController) getGitHubUser(ctx context.Context, accessToken string)
 		return nil, fmt.Errorf("failed to parse user response: %w", err)
 	}
 
-	// If email is empty, try to get primary email
-	if user.Email == "" {
-		user.Email, _ = c.getGitHubPrimaryEmail(ctx, accessToken)
-	}
-
 	return &user, nil
 }
 
 // getGitHubPrimaryEmail fetches the user's primary email from GitHub.
+// Returns errEmailScopeDenied if the user didn't grant the user:email scope.
 func (c *OAuthController) getGitHubPrimaryEmail(ctx context.Context, accessToken string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user/emails", nil)
+	req, err := c.newGitHubRequest(ctx, "/user/emails", accessToken)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "GitHub-Analyzer/1.0")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to fetch emails: %w", err)
 	}
 	defer resp.Body.Close()
 
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusNotFound:
+		// GitHub answers 404 to tokens without the scope, 403 for some apps
+		return "", errEmailScopeDenied
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("GitHub API error (%d): %s", resp.StatusCode, string(body))
+	}
+
 	var emails []struct {
 		Email    string `json:"email"`
 		Primary  bool   `json:"primary"`
@@ -282,7 +333,7 @@ func (c *OAuthController) getGitHubPrimaryEmail(ctx context.Context, accessToken
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to parse emails response: %w", err)
 	}
 
 	// Return primary verified email
@@ -302,6 +353,19 @@ func (c *OAuthController) getGitHubPrimaryEmail(ctx context.Context, accessToken
 	return "", nil
 }
 
+// newGitHubRequest builds an authenticated GitHub API GET request for path.
+func (c *OAuthController) newGitHubRequest(ctx context.Context, path, accessToken string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.apiBaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "GitHub-Analyzer/1.0")
+	return req, nil
+}
+
 // connectGitHubToUser links a GitHub account to an existing user.
 func (c *OAuthController) connectGitHubToUser(ctx context.Context, userID int64, githubUser *GitHubUser, token *oauth2.Token) error {
 	// Encrypt the access token
@@ -328,22 +392,38 @@ func (c *OAuthController) connectGitHubToUser(ctx context.Context, userID int64,
 
 // setSessionCookie sets the session cookie.
 func (c *OAuthController) setSessionCookie(w http.ResponseWriter, token string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     c.cookieName,
-		Value:    token,
-		Path:     "/",
-		MaxAge:   int(c.sessionDuration.Seconds()),
-		HttpOnly: true,
-		Secure:   c.cookieSecure,
-		SameSite: http.SameSiteLaxMode,
-	})
+	http.SetCookie(w, c.cookies.session(token, int(c.sessionDuration.Seconds())))
 }
 
-// generateState creates a random state string for CSRF protection.
+const (
+	// oauthStateCookiePrefix plus the state names the cookie of one flow.
+	oauthStateCookiePrefix = "oauth_state_"
+	// oauthStateMaxAge is how long, in seconds, a started flow stays valid.
+	oauthStateMaxAge = 600
+	// oauthStateBytes is the entropy of a state; it encodes to 43 characters.
+	oauthStateBytes = 32
+)
+
+// generateState creates a random state string for CSRF protection. It is
+// unpadded URL-safe base64, so it can be used in a cookie name.
 func generateState() (string, error) {
-	b := make([]byte, 32)
+	b := make([]byte, oauthStateBytes)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return base64.URLEncoding.EncodeToString(b), nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validState reports whether state looks like one from generateState.
+func validState(state string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(state)
+	return err == nil && len(b) == oauthStateBytes
+}
+
+// redirectOr returns returnTo, or fallback when it is empty.
+func redirectOr(returnTo, fallback string) string {
+	if returnTo == "" {
+		return fallback
+	}
+	return returnTo
 }
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// Error codes used in JSON error responses.
+const (
+	codeInvalidRequest  = "invalid_request"
+	codeUnauthorized    = "unauthorized"
+	codeForbidden       = "forbidden"
+	codeNotFound        = "not_found"
+	codePayloadTooLarge = "payload_too_large"
+	codeRateLimited     = "rate_limited"
+	codeInternal        = "internal_error"
+	codeUpstream        = "upstream_error"
+	codeUnavailable     = "unavailable"
+	codePolicyFailed    = "policy_failed"
+)
+
+// errorEnvelope is the body of every JSON error response.
+type errorEnvelope struct {
+	Error models.APIError `json:"error"`
+}
+
+// respondJSON writes payload as a JSON response with the given status.
+func respondJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		log.Printf("Failed to encode JSON response: %v", err)
+	}
+}
+
+// respondError writes a JSON error response of the form
+// {"error": {"code": ..., "message": ..., "timestamp": ...}}.
+func respondError(w http.ResponseWriter, status int, code, msg string) {
+	respondJSON(w, status, errorEnvelope{Error: models.APIError{
+		Code:      code,
+		Message:   msg,
+		Timestamp: time.Now().UTC(),
+	}})
+}
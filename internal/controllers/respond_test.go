@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	appctx "github.com/rahul4469/github-analyzer/internal/context"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestRespond(t *testing.T) {
+	tests := []struct {
+		name      string
+		respond   func(w http.ResponseWriter)
+		status    int
+		wantError string // error code expected in the envelope; empty for success
+	}{
+		{
+			name:    "success",
+			respond: func(w http.ResponseWriter) { respondJSON(w, http.StatusCreated, map[string]int{"count": 2}) },
+			status:  http.StatusCreated,
+		},
+		{
+			name:      "error",
+			respond:   func(w http.ResponseWriter) { respondError(w, http.StatusNotFound, codeNotFound, "Analysis not found") },
+			status:    http.StatusNotFound,
+			wantError: codeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.respond(w)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			assertEnvelope(t, w, tt.wantError)
+		})
+	}
+}
+
+func TestJSONRoutesRespondWithEnvelope(t *testing.T) {
+	c := &AnalyzeController{}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"tree", c.GetTree},
+		{"languages", c.GetLanguages},
+	}
+
+	// An invalid ID is rejected before the analysis service is needed.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "not-a-number")
+			r := httptest.NewRequest(http.MethodGet, "/analyze/not-a-number/"+tt.name, nil)
+			ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+			r = r.WithContext(appctx.SetUser(ctx, &models.User{ID: 1}))
+			w := httptest.NewRecorder()
+
+			tt.handler(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			assertEnvelope(t, w, codeInvalidRequest)
+		})
+	}
+}
+
+// assertEnvelope checks that w's body is a JSON error envelope with the
+// given code, or a plain JSON payload without one when code is empty.
+func assertEnvelope(t *testing.T, w *httptest.ResponseRecorder, code string) {
+	t.Helper()
+	var body struct {
+		Error *models.APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	switch {
+	case code == "" && body.Error != nil:
+		t.Errorf("unexpected error envelope %+v", body.Error)
+	case code == "":
+	case body.Error == nil:
+		t.Errorf("body %q has no error envelope", w.Body.String())
+	case body.Error.Code != code || body.Error.Message == "" || body.Error.Timestamp.IsZero():
+		t.Errorf("error = %+v, want code %s with a message and timestamp", body.Error, code)
+	}
+}
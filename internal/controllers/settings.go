@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/rahul4469/github-analyzer/internal/middleware"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// maxPreferencesBodyBytes caps preference request bodies.
+const maxPreferencesBodyBytes = 64 << 10
+
+// SettingsController handles the user's analysis defaults.
+type SettingsController struct {
+	userService *models.UserService
+}
+
+// NewSettingsController creates a new SettingsController.
+func NewSettingsController(userService *models.UserService) *SettingsController {
+	return &SettingsController{userService: userService}
+}
+
+// PreferencesRequest is the body of PUT /api/v1/settings/preferences. A
+// section of the scoring profile left out uses the built-in one; leaving
+// out the whole profile resets it.
+type PreferencesRequest struct {
+	Scoring  *models.ScoringConfig `json:"scoring"`
+	MaxFiles int                   `json:"max_files"`
+}
+
+// GetPreferences returns the user's analysis defaults.
+// GET /api/v1/settings/preferences
+func (c *SettingsController) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	prefs, err := c.userService.GetPreferences(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Failed to load preferences for user %d: %v", user.ID, err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to load preferences")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, prefs)
+}
+
+// PutPreferences replaces the user's analysis defaults: the scoring profile
+// files are chosen with and how many are fetched.
+// PUT /api/v1/settings/preferences
+func (c *SettingsController) PutPreferences(w http.ResponseWriter, r *http.Request) {
+	user := middleware.MustCurrentUser(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPreferencesBodyBytes)
+	var req PreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	if req.MaxFiles < 1 || req.MaxFiles > models.MaxFilesLimit {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("max_files must be between 1 and %d", models.MaxFilesLimit))
+		return
+	}
+	if req.Scoring == nil {
+		req.Scoring = &models.ScoringConfig{}
+	}
+	if err := req.Scoring.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	req.Scoring.FillDefaults()
+
+	prefs := &models.UserPreferences{UserID: user.ID, Scoring: req.Scoring, MaxFiles: req.MaxFiles}
+	if err := c.userService.SavePreferences(r.Context(), prefs); err != nil {
+		if errors.Is(err, models.ErrInvalidScoringConfig) || errors.Is(err, models.ErrInvalidMaxFiles) {
+			respondError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		log.Printf("Failed to save preferences for user %d: %v", user.ID, err)
+		respondError(w, http.StatusInternalServerError, codeInternal, "Failed to save preferences")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, prefs)
+}
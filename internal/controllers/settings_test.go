@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appctx "github.com/rahul4469/github-analyzer/internal/context"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestPutPreferencesRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string // substring of the error message
+	}{
+		{"not JSON", `{`, "Invalid JSON"},
+		{"missing max_files", `{"scoring": {}}`, "max_files"},
+		{"too many files", `{"max_files": 100000}`, "max_files"},
+		{"uppercase entry point", `{"max_files": 10, "scoring": {"entry_points": ["Main.go"]}}`, "entry_points"},
+		{"directory score out of range", `{"max_files": 10, "scoring": {"important_dirs": {"src": 500}}}`, "important_dirs"},
+		{"extension without dot", `{"max_files": 10, "scoring": {"extension_boost": {"go": 5}}}`, "extension_boost"},
+	}
+
+	// No user service: every case must be rejected before it's needed.
+	c := NewSettingsController(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/api/v1/settings/preferences", strings.NewReader(tt.body))
+			r = r.WithContext(appctx.SetUser(r.Context(), &models.User{ID: 1}))
+			w := httptest.NewRecorder()
+
+			c.PutPreferences(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			var body struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode %q: %v", w.Body.String(), err)
+			}
+			if body.Error.Code != codeInvalidRequest || !strings.Contains(body.Error.Message, tt.want) {
+				t.Errorf("error = %+v, want %s mentioning %q", body.Error, codeInvalidRequest, tt.want)
+			}
+		})
+	}
+}
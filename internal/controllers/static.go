@@ -3,7 +3,7 @@ package controllers
 import (
 	"net/http"
 
-	"github.com/rahul4469/github-analyzer/context"
+	"github.com/rahul4469/github-analyzer/internal/context"
 	"github.com/rahul4469/github-analyzer/internal/views"
 )
 
@@ -39,7 +39,7 @@ type Feature struct {
 // GetHome renders the home page.
 func (c *StaticController) GetHome(w http.ResponseWriter, r *http.Request) {
 	// Get current user from context (may be nil)
-	user := context.ContextGetUser(r.Context())
+	user := context.GetUser(r.Context())
 
 	// Check for logout message
 	var success string
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rahul4469/github-analyzer/internal/crypto"
+	"github.com/rahul4469/github-analyzer/internal/models"
+	"github.com/rahul4469/github-analyzer/internal/services"
+	"github.com/rahul4469/github-analyzer/migrations"
+)
+
+// testEnv is an AnalyzeController backed by the test database and a mock
+// GitHub API.
+type testEnv struct {
+	pool      *pgxpool.Pool
+	users     *models.UserService
+	analyses  *models.AnalysisService
+	encryptor *crypto.Encryptor
+	c         *AnalyzeController
+}
+
+// newTestEnv migrates and empties the database named by TEST_DATABASE_URL,
+// skipping the test when it isn't set, and returns a controller whose GitHub
+// API is github.
+func newTestEnv(t *testing.T, cfg AnalyzeConfig, github http.Handler) *testEnv {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := models.NewDatabase(context.Background(), models.DefaultDatabaseConfig(url))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(db.Close)
+	if err := models.MigrateFS(db.DB, migrations.FS, "."); err != nil {
+		t.Fatalf("MigrateFS: %v", err)
+	}
+	for _, table := range []string{"users", "repositories", "analyses"} {
+		if _, err := db.Pool.Exec(context.Background(), "TRUNCATE "+table+" RESTART IDENTITY CASCADE"); err != nil {
+			t.Fatalf("truncate %s: %v", table, err)
+		}
+	}
+
+	server := httptest.NewServer(github)
+	t.Cleanup(server.Close)
+
+	encryptor, err := crypto.NewEncryptor([]byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+
+	env := &testEnv{
+		pool:      db.Pool,
+		users:     models.NewUserService(db.Pool, bcrypt.MinCost),
+		analyses:  models.NewAnalysisService(db.Pool),
+		encryptor: encryptor,
+	}
+	env.c = NewAnalyzeController(
+		env.analyses,
+		models.NewRepositoryService(db.Pool),
+		env.users,
+		services.NewGitHubService(services.DefaultGitHubServiceConfig(server.URL)),
+		services.NewPerplexityService("", "test-key", "", nil, 0),
+		encryptor,
+		AnalyzeTemplates{},
+		cfg,
+	)
+	return env
+}
+
+// useAI points the controller's AI service at ai.
+func (e *testEnv) useAI(t *testing.T, ai http.Handler) {
+	t.Helper()
+	server := httptest.NewServer(ai)
+	t.Cleanup(server.Close)
+	e.c.perplexityService = services.NewPerplexityService(server.URL, "test-key", "sonar", nil, 0)
+}
+
+// newGitHubUser creates a user with the given API quota and a connected
+// GitHub account.
+func (e *testEnv) newGitHubUser(t *testing.T, email string, quota int) *models.User {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := e.users.Create(ctx, email, "correct-horse-battery", quota)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	token, err := e.encryptor.Encrypt("gho_test")
+	if err != nil {
+		t.Fatalf("encrypt token: %v", err)
+	}
+	data := models.GitHubOAuthData{GitHubID: user.ID, GitHubUsername: fmt.Sprintf("user%d", user.ID)}
+	if err := e.users.ConnectGitHub(ctx, user.ID, data, token); err != nil {
+		t.Fatalf("ConnectGitHub: %v", err)
+	}
+
+	user, err = e.users.ByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("reload user: %v", err)
+	}
+	return user
+}
+
+// status returns an analysis's status.
+func (e *testEnv) status(t *testing.T, analysisID int64) models.AnalysisStatus {
+	t.Helper()
+	analysis, err := e.analyses.ByID(context.Background(), analysisID)
+	if err != nil {
+		t.Fatalf("load analysis %d: %v", analysisID, err)
+	}
+	return analysis.Status
+}
+
+// mockGitHubRepos serves repository metadata for any /repos/{owner}/{name}
+// and 404 for everything else.
+func mockGitHubRepos() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/"), "/")
+		if !strings.HasPrefix(r.URL.Path, "/repos/") || len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(services.GitHubRepository{
+			Name:          parts[1],
+			FullName:      parts[0] + "/" + parts[1],
+			DefaultBranch: "main",
+			Language:      "Go",
+			Size:          100,
+		})
+	})
+}
@@ -1,21 +1,29 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"log"
 	"net/http"
+	"strings"
 
-	"github.com/rahul4469/github-analyzer/context"
+	"github.com/rahul4469/github-analyzer/internal/context"
 	"github.com/rahul4469/github-analyzer/internal/models"
 )
 
 type AuthMiddleware struct {
 	sessionService *models.SessionService
 	cookieName     string
+	cookieDomain   string
 }
 
-func NewAuthMiddleware(sessionService *models.SessionService, cookieName string) *AuthMiddleware {
+// NewAuthMiddleware creates an AuthMiddleware reading the session from the
+// named cookie. cookieDomain must match the domain the cookie is set with, so
+// stale cookies can be cleared.
+func NewAuthMiddleware(sessionService *models.SessionService, cookieName, cookieDomain string) *AuthMiddleware {
 	return &AuthMiddleware{
 		sessionService: sessionService,
 		cookieName:     cookieName,
+		cookieDomain:   cookieDomain,
 	}
 }
 
@@ -41,6 +49,7 @@ func (m *AuthMiddleware) SetUser(next http.Handler) http.Handler {
 				Name:     m.cookieName,
 				Value:    "",
 				Path:     "/",
+				Domain:   m.cookieDomain,
 				MaxAge:   -1, // Delete cookie
 				HttpOnly: true,
 			})
@@ -48,8 +57,13 @@ func (m *AuthMiddleware) SetUser(next http.Handler) http.Handler {
 			return
 		}
 
+		// Record activity for "last active" display and idle expiry
+		if err := m.sessionService.Touch(r.Context(), cookie.Value); err != nil {
+			log.Printf("Failed to touch session: %v", err)
+		}
+
 		// Store user in request context
-		ctx := context.ContextSetUser(r.Context(), user)
+		ctx := context.SetUser(r.Context(), user)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
@@ -60,7 +74,7 @@ func (m *AuthMiddleware) SetUser(next http.Handler) http.Handler {
 // If no user is in context, redirects to the signin page.
 func (m *AuthMiddleware) RequireUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := context.ContextGetUser(r.Context())
+		user := context.GetUser(r.Context())
 		if user == nil {
 			// Store the original URL to redirect back after login
 			// We'll use a query parameter for simplicity
@@ -80,7 +94,7 @@ func (m *AuthMiddleware) RequireUser(next http.Handler) http.Handler {
 // Useful for login/signup pages that shouldn't be accessible when logged in.
 func (m *AuthMiddleware) RequireNoUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := context.ContextGetUser(r.Context())
+		user := context.GetUser(r.Context())
 		if user != nil {
 			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 			return
@@ -94,7 +108,7 @@ func (m *AuthMiddleware) RequireNoUser(next http.Handler) http.Handler {
 // If quota is exceeded, shows an error page.
 func (m *AuthMiddleware) RequireQuota(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := context.ContextGetUser(r.Context())
+		user := context.GetUser(r.Context())
 		if user == nil {
 			http.Redirect(w, r, "/signin", http.StatusSeeOther)
 			return
@@ -109,18 +123,61 @@ func (m *AuthMiddleware) RequireQuota(next http.Handler) http.Handler {
 	})
 }
 
+// RequireAdmin returns middleware that only lets through users whose email
+// is in adminEmails. Everyone else gets a 404 so the routes aren't advertised.
+func RequireAdmin(adminEmails []string) func(http.Handler) http.Handler {
+	admins := make(map[string]bool, len(adminEmails))
+	for _, email := range adminEmails {
+		admins[strings.ToLower(strings.TrimSpace(email))] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := context.GetUser(r.Context())
+			if user == nil || !admins[strings.ToLower(user.Email)] {
+				http.NotFound(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireBearerToken returns middleware for service-to-service routes that
+// only lets through requests with "Authorization: Bearer <token>". An empty
+// token disables the routes (404) rather than leaving them open.
+func RequireBearerToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				http.NotFound(w, r)
+				return
+			}
+
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // HELPER FUNCS --------------------------------------------
 
 // CurrentUser is a helper function to get the current user from any handler.
 // Returns nil if not authenticated.
 func CurrentUser(r *http.Request) *models.User {
-	return context.ContextGetUser(r.Context())
+	return context.GetUser(r.Context())
 }
 
 // MustCurrentUser is like CurrentUser but panics if no user is found.
 // Only use this in handlers protected by RequireUser middleware.
 func MustCurrentUser(r *http.Request) *models.User {
-	user := context.ContextGetUser(r.Context())
+	user := context.GetUser(r.Context())
 	if user == nil {
 		panic("MustCurrentUser called without RequireUser middleware")
 	}
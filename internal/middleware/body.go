@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/csrf"
+)
+
+// LimitBody returns middleware that caps request bodies at n bytes, or at the
+// limit given in paths for requests to those paths, e.g. uploads. Bodies
+// declaring a larger Content-Length are refused with 413 before anything is
+// read; others fail with an *http.MaxBytesError once they pass the limit.
+// It must run before the CSRF middleware, which parses form bodies
+// (including multipart uploads) to find the token.
+func LimitBody(n int64, paths map[string]int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := n
+			if l, ok := paths[r.URL.Path]; ok {
+				limit = l
+			}
+
+			if r.ContentLength > limit {
+				bodyTooLarge(w, limit)
+				return
+			}
+
+			r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), limit: limit}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSRFFailure handles requests failing the CSRF check. A body cut off by
+// LimitBody loses its token, so it is reported as 413 instead of 403.
+func CSRFFailure(w http.ResponseWriter, r *http.Request) {
+	if body, ok := r.Body.(*limitedBody); ok && body.exceeded {
+		bodyTooLarge(w, body.limit)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s - %s", http.StatusText(http.StatusForbidden), csrf.FailureReason(r)), http.StatusForbidden)
+}
+
+// limitedBody records whether its http.MaxBytesReader hit the limit, which
+// handlers swallowing read errors (like the CSRF check) otherwise hide.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+	limit    int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+func bodyTooLarge(w http.ResponseWriter, limit int64) {
+	w.Header().Set("Connection", "close")
+	http.Error(w, fmt.Sprintf("Request body too large: at most %d bytes are allowed", limit), http.StatusRequestEntityTooLarge)
+}
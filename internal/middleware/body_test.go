@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/csrf"
+)
+
+// endlessBody is a request body that never ends and records how much of it
+// was read.
+type endlessBody struct {
+	prefix string
+	read   int64
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	n := 0
+	if int(b.read) < len(b.prefix) {
+		n = copy(p, b.prefix[b.read:])
+	}
+	for i := n; i < len(p); i++ {
+		p[i] = 'a'
+	}
+	b.read += int64(len(p))
+	return len(p), nil
+}
+
+func (b *endlessBody) Close() error { return nil }
+
+func TestLimitBody(t *testing.T) {
+	const limit = 1024
+
+	tests := []struct {
+		name          string
+		contentType   string
+		prefix        string
+		contentLength int64 // -1 when the client doesn't declare one
+	}{
+		{name: "declared too large", contentType: "application/x-www-form-urlencoded", prefix: "field=", contentLength: 10 << 20},
+		{name: "form without a length", contentType: "application/x-www-form-urlencoded", prefix: "field=", contentLength: -1},
+		{
+			name:          "multipart without a length",
+			contentType:   "multipart/form-data; boundary=xyz",
+			prefix:        "--xyz\r\nContent-Disposition: form-data; name=\"archive\"; filename=\"repo.zip\"\r\n\r\n",
+			contentLength: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			handler := LimitBody(limit, nil)(csrf.Protect(
+				[]byte(strings.Repeat("k", 32)),
+				csrf.ErrorHandler(http.HandlerFunc(CSRFFailure)),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+			})))
+
+			body := &endlessBody{prefix: tt.prefix}
+			r := httptest.NewRequest(http.MethodPost, "/analyze/upload", nil)
+			r.Body = body
+			r.ContentLength = tt.contentLength
+			r.Header.Set("Content-Type", tt.contentType)
+			r = csrf.PlaintextHTTPRequest(r)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+			}
+			if reached {
+				t.Error("handler reached with an oversized body")
+			}
+			// A declared length is refused unread; otherwise reading stops
+			// one byte past the limit
+			max := int64(0)
+			if tt.contentLength < 0 {
+				max = limit + 1
+			}
+			if body.read > max {
+				t.Errorf("read %d bytes of the body, want at most %d", body.read, max)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses proxy addresses given as single IPs or CIDR
+// ranges, e.g. "10.0.0.1" or "10.0.0.0/8".
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		if strings.Contains(p, "/") {
+			prefix, err := netip.ParsePrefix(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// RealIP returns middleware that sets r.RemoteAddr to the client IP. The
+// X-Forwarded-For and X-Real-IP headers are only honored when the request
+// comes from one of the trusted proxies, so clients can't spoof their IP.
+// It replaces chi's RealIP, which trusts the headers from anyone.
+func RealIP(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.RemoteAddr = clientIP(r, trustedProxies)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the IP of the client that made r. Forwarding headers are
+// used only when the immediate peer is a trusted proxy; X-Forwarded-For,
+// across all its header lines, is walked from the right, skipping trusted
+// proxies, so entries the client prepended itself are ignored. X-Real-IP is
+// only read when there is no X-Forwarded-For.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+
+	peerAddr, err := netip.ParseAddr(peer)
+	if err != nil || !isTrusted(peerAddr, trustedProxies) {
+		return peer
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		// The nearest address vouched for by a trusted proxy
+		last := peerAddr.Unmap()
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// A malformed hop can't be trusted; stop at the last good one
+				return last.String()
+			}
+			last = addr.Unmap()
+			if !isTrusted(addr, trustedProxies) {
+				break
+			}
+		}
+		return last.String()
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if addr, err := netip.ParseAddr(realIP); err == nil {
+			return addr.Unmap().String()
+		}
+	}
+
+	return peer
+}
+
+// isTrusted reports whether addr belongs to one of the trusted proxies.
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
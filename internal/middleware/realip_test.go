@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		realIP     string
+		want       string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:4321",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer spoofing forwarding headers",
+			remoteAddr: "203.0.113.7:4321",
+			xff:        []string{"1.2.3.4"},
+			realIP:     "5.6.7.8",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"198.51.100.2"},
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "forwarded chain through trusted proxies",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"198.51.100.2, 192.168.1.1, 10.0.0.2"},
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "client prepends a spoofed hop",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"1.2.3.4, 198.51.100.2"},
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "spoofed first header line, proxy appends a second",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"1.2.3.4", "198.51.100.2"},
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "malformed hop stops at the last trusted address",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"garbage, 10.0.0.2"},
+			realIP:     "5.6.7.8",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "malformed nearest hop falls back to the peer",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"198.51.100.2, garbage"},
+			realIP:     "5.6.7.8",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "only trusted proxies",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "IPv4-mapped IPv6 hop",
+			remoteAddr: "10.0.0.1:80",
+			xff:        []string{"::ffff:198.51.100.2"},
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "X-Real-IP without X-Forwarded-For",
+			remoteAddr: "10.0.0.1:80",
+			realIP:     "198.51.100.9",
+			want:       "198.51.100.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := clientIP(r, trusted); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
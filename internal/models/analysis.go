@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -20,11 +22,95 @@ const (
 	StatusFailed     AnalysisStatus = "failed"
 )
 
+// AnalysisMode selects how much of a repository is sent for analysis.
+type AnalysisMode string
+
+const (
+	// ModeDeep fetches and analyzes the most important source files.
+	ModeDeep AnalysisMode = "deep"
+	// ModeMetadata only sends metadata, README and file structure - quicker
+	// and cheaper for very large repositories or low quota.
+	ModeMetadata AnalysisMode = "metadata"
+)
+
+// ParseAnalysisMode validates a mode, defaulting to ModeDeep when empty.
+func ParseAnalysisMode(s string) (AnalysisMode, error) {
+	switch AnalysisMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ModeDeep:
+		return ModeDeep, nil
+	case ModeMetadata:
+		return ModeMetadata, nil
+	default:
+		return "", fmt.Errorf("unknown analysis mode %q", s)
+	}
+}
+
 type FileContent struct {
 	Path     string `json:"path"`
 	Content  string `json:"content"`
 	Language string `json:"language"`
 	Size     int    `json:"size"`
+	// Generated marks code generator output, which the AI is told not to
+	// review for style
+	Generated bool `json:"generated,omitempty"`
+}
+
+// Reasons a file selected for analysis was left out.
+const (
+	SkipTooLarge   = "too_large"
+	SkipBinary     = "binary"
+	SkipFetchError = "fetch_error"
+
+	// Reasons a scored file was never selected, only reported by selection
+	// previews
+	SkipMaxFiles      = "max_files"
+	SkipSizeBudget    = "size_budget"
+	SkipLanguageQuota = "language_quota"
+)
+
+// SkippedFile is a file selected for analysis whose content couldn't be
+// included.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// SkippedFilesIssue returns an INFO issue listing the skipped files and why
+// each was left out, so a shallower analysis is reported with its issues.
+func SkippedFilesIssue(skipped []SkippedFile) Issue {
+	title := "1 selected file was left out of the analysis"
+	if len(skipped) != 1 {
+		title = fmt.Sprintf("%d selected files were left out of the analysis", len(skipped))
+	}
+
+	lines := make([]string, len(skipped))
+	for i, sf := range skipped {
+		lines[i] = fmt.Sprintf("%s: %s", sf.Path, skipReasonText(sf.Reason))
+	}
+
+	issue := Issue{
+		Severity:    SeverityInfo,
+		Category:    CategoryOther,
+		Title:       title,
+		Description: strings.Join(lines, "\n"),
+		Suggestion:  "Issues in these files may have been missed. Lower the file count or review them separately.",
+	}
+	if len(skipped) == 1 {
+		issue.File = skipped[0].Path
+	}
+	return issue
+}
+
+// skipReasonText describes a skip reason for people.
+func skipReasonText(reason string) string {
+	switch reason {
+	case SkipTooLarge:
+		return "too large"
+	case SkipBinary:
+		return "binary content"
+	default:
+		return "could not be fetched"
+	}
 }
 
 type CodeStructure struct {
@@ -33,24 +119,92 @@ type CodeStructure struct {
 	Directories       []string       `json:"directories"`
 	Files             []string       `json:"files"`
 	LanguageBreakdown map[string]int `json:"language_breakdown"`
+
+	// Code files split by IsTestPath; both zero in analyses stored before
+	// they were counted
+	TestFiles   int `json:"test_files"`
+	SourceFiles int `json:"source_files"`
 }
 
 type Issue struct {
-	Severity    string `json:"severity"` // HIGH, MEDIUM, LOW
-	Category    string `json:"category"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	File        string `json:"file,omitempty"`
-	Line        int    `json:"line,omitempty"`
-	Suggestion  string `json:"suggestion,omitempty"`
+	Severity    Severity `json:"severity"`
+	Category    string   `json:"category"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	File        string   `json:"file,omitempty"`
+	Line        int      `json:"line,omitempty"`
+	Suggestion  string   `json:"suggestion,omitempty"`
 }
 
 type AnalysisSummary struct {
+	// TotalIssues and IssuesBySeverity count every issue found, including
+	// omitted ones; IssuesByCategory only counts stored issues
 	TotalIssues      int            `json:"total_issues"`
 	IssuesBySeverity map[string]int `json:"issues_by_severity"`
 	IssuesByCategory map[string]int `json:"issues_by_category"`
 	OverallScore     int            `json:"overall_score"`
 	KeyFindings      []string       `json:"key_findings"`
+
+	// Where KeyFindings came from, KeyFindingsSourceAI or
+	// KeyFindingsSourceIssues, and the most kept; 0 is DefaultMaxKeyFindings
+	KeyFindingsSource string `json:"key_findings_source,omitempty"`
+	MaxKeyFindings    int    `json:"max_key_findings,omitempty"`
+
+	// Issues found but not stored because their severity was over its cap
+	OmittedIssues     int            `json:"omitted_issues,omitempty"`
+	OmittedBySeverity map[string]int `json:"omitted_by_severity,omitempty"`
+}
+
+// Recompute rebuilds the counts, overall score and key findings from the
+// given issues, e.g. after some were resolved or merged as duplicates.
+// Omitted issues set in OmittedBySeverity are kept and still counted, and
+// so are key findings taken from the AI response.
+func (s *AnalysisSummary) Recompute(issues []Issue) {
+	s.TotalIssues = len(issues)
+	s.IssuesBySeverity = make(map[string]int)
+	s.IssuesByCategory = make(map[string]int)
+
+	// Count by severity and category
+	for _, issue := range issues {
+		s.IssuesBySeverity[string(issue.Severity)]++
+		s.IssuesByCategory[NormalizeCategory(issue.Category)]++
+	}
+
+	// Omitted issues still count towards the totals and the score, so a cap
+	// never makes a result look better
+	s.OmittedIssues = 0
+	for sev, n := range s.OmittedBySeverity {
+		s.IssuesBySeverity[sev] += n
+		s.OmittedIssues += n
+	}
+	s.TotalIssues += s.OmittedIssues
+
+	// Calculate overall score (0-100)
+	// Start at 100, deduct points for issues
+	score := 100
+	score -= s.IssuesBySeverity[string(SeverityCritical)] * 20
+	score -= s.IssuesBySeverity[string(SeverityHigh)] * 10
+	score -= s.IssuesBySeverity[string(SeverityMedium)] * 5
+	score -= s.IssuesBySeverity[string(SeverityLow)] * 3
+	score -= s.IssuesBySeverity[string(SeverityInfo)] * 1
+	if score < 0 {
+		score = 0
+	}
+	s.OverallScore = score
+
+	// Without findings from the AI, the most severe issues are the key findings
+	if s.KeyFindingsSource == KeyFindingsSourceAI && len(s.KeyFindings) > 0 {
+		s.KeyFindings = CapKeyFindings(s.KeyFindings, s.keyFindingsLimit())
+		return
+	}
+	s.KeyFindings = KeyFindingsFromIssues(issues, s.keyFindingsLimit())
+	s.KeyFindingsSource = KeyFindingsSourceIssues
+}
+
+// StepTiming records how long one analysis pipeline step took.
+type StepTiming struct {
+	Step       string `json:"step"`
+	DurationMS int64  `json:"duration_ms"`
 }
 
 type Analysis struct {
@@ -58,20 +212,50 @@ type Analysis struct {
 	UserID       int64          `json:"user_id"`
 	RepositoryID int64          `json:"repository_id"`
 	Status       AnalysisStatus `json:"status"`
+	Mode         AnalysisMode   `json:"mode"`
 
 	// Data fetched from GitHub, jsonb
 	CodeStructure *CodeStructure `json:"code_structure,omitempty"`
 	CodeFiles     []FileContent  `json:"code_files,omitempty"`
 	READMEContent *string        `json:"readme_content,omitempty"`
+	CommitSHA     *string        `json:"commit_sha,omitempty"` // commit the files were read at
+
+	// Hashes of the files sent to the AI, kept even when their contents
+	// aren't stored. ContentHash is the TreeHash of FileHashes.
+	ContentHash *string    `json:"content_hash,omitempty"`
+	FileHashes  []FileHash `json:"file_hashes,omitempty"`
+
+	// Inputs the analysis ran with, including how the files sent to the AI
+	// were chosen; nil for analyses stored before they were recorded
+	Parameters *AnalysisParameters `json:"parameters,omitempty"`
 
 	// AI analysis results
 	AIAnalysis *string          `json:"ai_analysis,omitempty"`
 	Summary    *AnalysisSummary `json:"summary,omitempty"`
 	Issues     []Issue          `json:"issues,omitempty"`
 
+	// Why the AI stopped generating; FinishReasonLength means the response
+	// was truncated. Nil for analyses stored before it was recorded
+	FinishReason *string `json:"finish_reason,omitempty"`
+
+	// The analysis whose result was reused because the AI input was
+	// identical; no tokens were used. Nil when the AI was called
+	CachedFrom *int64 `json:"cached_from,omitempty"`
+
+	// Branch, tag or commit the analysis was requested at, and for the head
+	// of a before/after comparison, the analysis of the base ref. Nil when
+	// the default branch was analyzed on its own
+	RequestedRef  *string `json:"requested_ref,omitempty"`
+	CompareBaseID *int64  `json:"compare_base_id,omitempty"`
+
 	// Usage tracking
-	TokensUsed   int     `json:"tokens_used"`
-	ErrorMessage *string `json:"error_message,omitempty"`
+	TokensUsed   int           `json:"tokens_used"`
+	ErrorMessage *string       `json:"error_message,omitempty"`
+	StepTimings  []StepTiming  `json:"step_timings,omitempty"`
+	SkippedFiles []SkippedFile `json:"skipped_files,omitempty"`
+
+	// User-provided label, at most MaxNoteLength characters
+	Note *string `json:"note,omitempty"`
 
 	CreatedAt   time.Time  `json:"created_at"`
 	StartedAt   *time.Time `json:"started_at,omitempty"`
@@ -81,6 +265,44 @@ type Analysis struct {
 	Repository *Repository `json:"repository,omitempty"`
 }
 
+// FinishReasonLength is the finish reason of an AI response cut off by the
+// token limit.
+const FinishReasonLength = "length"
+
+// Truncated reports whether the AI response was cut off by the token limit,
+// so the issues found may be incomplete.
+func (a *Analysis) Truncated() bool {
+	return a.FinishReason != nil && *a.FinishReason == FinishReasonLength
+}
+
+// AnalysisParameters are the inputs an analysis ran with. Running an
+// analysis of a GitHub repository again with the same parameters reads the
+// same files; uploads and gists have no RepoURL or Ref and can't be re-run.
+type AnalysisParameters struct {
+	RepoURL  string         `json:"repo_url"`
+	Ref      string         `json:"ref"` // commit SHA the files were read at
+	Mode     AnalysisMode   `json:"mode"`
+	MaxFiles int            `json:"max_files"`
+	Scoring  *ScoringConfig `json:"scoring"`
+
+	// Server-wide limits the files were selected with, as in effect when the
+	// analysis ran; zero in analyses stored before they were recorded
+	MaxFilesPerLanguage int `json:"max_files_per_language,omitempty"` // 0 is no cap
+	MaxFileBytes        int `json:"max_file_bytes,omitempty"`         // larger files are skipped
+	MaxREADMEBytes      int `json:"max_readme_bytes,omitempty"`       // 0 is no cap
+	// Languages or extensions excluded on top of Scoring's ExcludedLanguages
+	ExcludedLanguages []string `json:"excluded_languages,omitempty"`
+}
+
+// Reproducible reports whether the analysis can be re-run with the same
+// parameters, i.e. it read a GitHub repository at a known commit.
+func (p *AnalysisParameters) Reproducible() bool {
+	return p != nil && p.RepoURL != "" && p.Ref != ""
+}
+
+// MaxNoteLength is the longest note, in characters, stored on an analysis.
+const MaxNoteLength = 200
+
 type AnalysisService struct {
 	pool *pgxpool.Pool
 }
@@ -89,25 +311,155 @@ func NewAnalysisService(pool *pgxpool.Pool) *AnalysisService {
 	return &AnalysisService{pool: pool}
 }
 
-func (s *AnalysisService) Create(ctx context.Context, userID, repositoryID int64) (*Analysis, error) {
-	query := `
-		INSERT INTO analyses (user_id, repository_id, status)
-		VALUES ($1, $2, $3)
-		RETURNING id, user_id, repository_id, status, code_structure, readme_content, 
-		          ai_analysis, tokens_used, error_message, created_at, started_at, completed_at
-	`
+// AnalysisLimits cap the analyses a user can start. They are checked in the
+// transaction that creates an analysis, after any reuse, so concurrent
+// requests can't slip past them.
+type AnalysisLimits struct {
+	// MaxInFlight is the most analyses a user can have pending or
+	// processing; 0 means no limit.
+	MaxInFlight int
+	// ReserveTokens is the API quota set aside for the analysis while it is
+	// pending or processing. It must fit in the quota left after what the
+	// user's other analyses in flight have reserved.
+	ReserveTokens int
+}
+
+// Create creates a pending analysis, subject to limits.
+func (s *AnalysisService) Create(ctx context.Context, userID, repositoryID int64, mode AnalysisMode, limits AnalysisLimits) (*Analysis, error) {
+	analysis, _, err := s.CreateOrReuse(ctx, userID, repositoryID, mode, 0, limits)
+	return analysis, err
+}
+
+// CreateOrReuse creates a pending analysis unless the user already has one
+// in the same mode pending or processing for the same repository that was
+// created within window, in which case that analysis is returned and reused
+// is true.
+// A window of zero or less always creates a new analysis. A new analysis
+// must fit within limits; a reused one needn't.
+func (s *AnalysisService) CreateOrReuse(ctx context.Context, userID, repositoryID int64, mode AnalysisMode, window time.Duration, limits AnalysisLimits) (analysis *Analysis, reused bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	analysis, reused, err = createOrReuseAnalysis(ctx, tx, userID, repositoryID, mode, window, limits)
+	if err != nil || reused {
+		return analysis, reused, err
+	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, fmt.Errorf("failed to commit analysis: %w", err)
+	}
+
+	return analysis, false, nil
+}
+
+// CreateWithRepository saves repo and associates it with repo.UserID, then
+// creates or reuses an analysis for it like CreateOrReuse, all in one
+// transaction: if any step fails, none of the rows are written. It is
+// committed before returning, so the records are consistent before the
+// slow fetching starts.
+func (s *AnalysisService) CreateWithRepository(ctx context.Context, repo *Repository, mode AnalysisMode, window time.Duration, limits AnalysisLimits) (saved *Repository, analysis *Analysis, reused bool, err error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	analysis := &Analysis{}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	saved, err = upsertRepository(ctx, tx, repo)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	saved.UserID = repo.UserID
+
+	if err := associateRepository(ctx, tx, repo.UserID, saved.ID); err != nil {
+		return nil, nil, false, err
+	}
+
+	analysis, reused, err = createOrReuseAnalysis(ctx, tx, repo.UserID, saved.ID, mode, window, limits)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to commit analysis: %w", err)
+	}
+
+	return saved, analysis, reused, nil
+}
+
+// createOrReuseAnalysis runs CreateOrReuse in tx, leaving the commit to the
+// caller. A window of zero or less always creates a new analysis.
+func createOrReuseAnalysis(ctx context.Context, tx pgx.Tx, userID, repositoryID int64, mode AnalysisMode, window time.Duration, limits AnalysisLimits) (analysis *Analysis, reused bool, err error) {
 	var codeStructureJSON []byte
 
-	err := s.pool.QueryRow(ctx, query, userID, repositoryID, StatusPending).Scan(
+	if window > 0 {
+		// Serialize creates for the same user and repository so two requests
+		// arriving together can't both miss each other
+		_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1::text || '/' || $2::text, 0))`, userID, repositoryID)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to lock analysis creation: %w", err)
+		}
+
+		query := `
+			SELECT id, user_id, repository_id, status, mode, code_structure, readme_content,
+			       ai_analysis, tokens_used, error_message, created_at, started_at, completed_at
+			FROM analyses
+			WHERE user_id = $1 AND repository_id = $2 AND mode = $6
+			  AND status IN ($3, $4) AND created_at > $5
+			ORDER BY created_at DESC
+			LIMIT 1
+		`
+
+		analysis = &Analysis{}
+		err = tx.QueryRow(ctx, query, userID, repositoryID, StatusPending, StatusProcessing, time.Now().Add(-window), mode).Scan(
+			&analysis.ID,
+			&analysis.UserID,
+			&analysis.RepositoryID,
+			&analysis.Status,
+			&analysis.Mode,
+			&codeStructureJSON,
+			&analysis.READMEContent,
+			&analysis.AIAnalysis,
+			&analysis.TokensUsed,
+			&analysis.ErrorMessage,
+			&analysis.CreatedAt,
+			&analysis.StartedAt,
+			&analysis.CompletedAt,
+		)
+		if err == nil {
+			return analysis, true, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, fmt.Errorf("failed to find in-flight analysis: %w", err)
+		}
+	}
+
+	if err := checkAnalysisLimits(ctx, tx, userID, limits); err != nil {
+		return nil, false, err
+	}
+
+	query := `
+		INSERT INTO analyses (user_id, repository_id, status, mode, quota_reserved)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, repository_id, status, mode, code_structure, readme_content,
+		          ai_analysis, tokens_used, error_message, created_at, started_at, completed_at
+	`
+
+	analysis = &Analysis{}
+	err = tx.QueryRow(ctx, query, userID, repositoryID, StatusPending, mode, max(limits.ReserveTokens, 0)).Scan(
 		&analysis.ID,
 		&analysis.UserID,
 		&analysis.RepositoryID,
 		&analysis.Status,
+		&analysis.Mode,
 		&codeStructureJSON,
 		&analysis.READMEContent,
 		&analysis.AIAnalysis,
@@ -117,33 +469,80 @@ func (s *AnalysisService) Create(ctx context.Context, userID, repositoryID int64
 		&analysis.StartedAt,
 		&analysis.CompletedAt,
 	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create analysis: %w", err)
+	}
+
+	return analysis, false, nil
+}
 
+// checkAnalysisLimits returns ErrTooManyInFlight or ErrQuotaExceeded if one
+// more analysis would put the user over limits. It locks the user's row
+// until tx ends, so concurrent creates for the same user are checked one at
+// a time.
+func checkAnalysisLimits(ctx context.Context, tx pgx.Tx, userID int64, limits AnalysisLimits) error {
+	if limits.MaxInFlight <= 0 && limits.ReserveTokens <= 0 {
+		return nil
+	}
+
+	var quotaLimit, quotaUsed int
+	err := tx.QueryRow(ctx, `SELECT api_quota_limit, api_quota_used FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&quotaLimit, &quotaUsed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create analysis: %w", err)
+		return fmt.Errorf("failed to lock user: %w", err)
 	}
 
-	return analysis, nil
+	var inFlight, reserved int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(quota_reserved), 0)
+		FROM analyses
+		WHERE user_id = $1 AND status IN ($2, $3)
+	`, userID, StatusPending, StatusProcessing).Scan(&inFlight, &reserved)
+	if err != nil {
+		return fmt.Errorf("failed to count in-flight analyses: %w", err)
+	}
+
+	if limits.MaxInFlight > 0 && inFlight+1 > limits.MaxInFlight {
+		return ErrTooManyInFlight
+	}
+	if limits.ReserveTokens > 0 && quotaLimit-quotaUsed-reserved < limits.ReserveTokens {
+		return ErrQuotaExceeded
+	}
+	return nil
 }
 
 func (s *AnalysisService) MarkProcessing(ctx context.Context, analysisID int64) error {
 	query := `
 		UPDATE analyses 
 		SET status = $1, started_at = NOW()
-		WHERE id = $2
+		WHERE id = $2 AND status = $3
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	_, err := s.pool.Exec(ctx, query, StatusProcessing, analysisID)
+	tag, err := s.pool.Exec(ctx, query, StatusProcessing, analysisID, StatusPending)
 	if err != nil {
 		return fmt.Errorf("failed to mark analysis as processing: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrAnalysisNotRunning
+	}
 
 	return nil
 }
 
-func (s *AnalysisService) UpdateGitHubData(ctx context.Context, analysisID int64, codeStructure *CodeStructure, codeFiles []FileContent, readme string) error {
+// UpdateGitHubData stores the code structure, README and analyzed files.
+// The files' hashes are always stored; with hashOnly their contents aren't,
+// which still allows drift to be detected without retaining source code.
+func (s *AnalysisService) UpdateGitHubData(ctx context.Context, analysisID int64, codeStructure *CodeStructure, codeFiles []FileContent, readme string, hashOnly bool) error {
+	fileHashes := HashFiles(codeFiles)
+	if hashOnly {
+		codeFiles = nil
+	}
+
 	// Combine code structure and files into a single JSONB structure
 	combinedData := struct {
 		Structure *CodeStructure `json:"structure"`
@@ -158,88 +557,550 @@ func (s *AnalysisService) UpdateGitHubData(ctx context.Context, analysisID int64
 		return fmt.Errorf("failed to marshal combined data: %w", err)
 	}
 
-	query := `
-        UPDATE analyses 
-        SET code_structure = $1, readme_content = $2
-        WHERE id = $3
-    `
+	// Metadata-only analyses have no files, so nothing to compare
+	var contentHash *string
+	var hashesJSON []byte
+	if len(fileHashes) > 0 {
+		hash := TreeHash(fileHashes)
+		contentHash = &hash
+		if hashesJSON, err = json.Marshal(fileHashes); err != nil {
+			return fmt.Errorf("failed to marshal file hashes: %w", err)
+		}
+	}
+
+	query := `
+        UPDATE analyses 
+        SET code_structure = $1, readme_content = $2, content_hash = $3, file_hashes = $4
+        WHERE id = $5
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err = s.pool.Exec(ctx, query, combinedJSON, readme, contentHash, hashesJSON, analysisID)
+	if err != nil {
+		return fmt.Errorf("failed to update GitHub data: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSkippedFiles stores the files that were selected for an analysis but
+// couldn't be included.
+func (s *AnalysisService) UpdateSkippedFiles(ctx context.Context, analysisID int64, skipped []SkippedFile) error {
+	skippedJSON, err := json.Marshal(skipped)
+	if err != nil {
+		return fmt.Errorf("failed to marshal skipped files: %w", err)
+	}
+
+	query := `UPDATE analyses SET skipped_files = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err = s.pool.Exec(ctx, query, skippedJSON, analysisID)
+	if err != nil {
+		return fmt.Errorf("failed to update skipped files: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateAIExchange stores the raw AI request and response for debugging.
+// Callers redact and size-cap both before storing them.
+func (s *AnalysisService) UpdateAIExchange(ctx context.Context, analysisID int64, request, response string) error {
+	query := `UPDATE analyses SET ai_debug_request = $1, ai_debug_response = $2 WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, request, response, analysisID)
+	if err != nil {
+		return fmt.Errorf("failed to update AI exchange: %w", err)
+	}
+
+	return nil
+}
+
+// SetCommitSHA records the commit an analysis read its files at.
+func (s *AnalysisService) SetCommitSHA(ctx context.Context, analysisID int64, sha string) error {
+	query := `UPDATE analyses SET commit_sha = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, sha, analysisID)
+	if err != nil {
+		return fmt.Errorf("failed to set commit SHA: %w", err)
+	}
+
+	return nil
+}
+
+// SetParameters records the inputs an analysis ran with.
+func (s *AnalysisService) SetParameters(ctx context.Context, analysisID int64, params *AnalysisParameters) error {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal analysis parameters: %w", err)
+	}
+
+	query := `UPDATE analyses SET parameters = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err = s.pool.Exec(ctx, query, paramsJSON, analysisID)
+	if err != nil {
+		return fmt.Errorf("failed to set analysis parameters: %w", err)
+	}
+
+	return nil
+}
+
+// LinkComparison records the refs of a before/after comparison and links
+// the head analysis to the base one, in one transaction.
+func (s *AnalysisService) LinkComparison(ctx context.Context, baseID, headID int64, baseRef, headRef string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE analyses SET requested_ref = $1 WHERE id = $2`, baseRef, baseID); err != nil {
+		return fmt.Errorf("failed to link comparison: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE analyses SET requested_ref = $1, compare_base_id = $2 WHERE id = $3`, headRef, baseID, headID); err != nil {
+		return fmt.Errorf("failed to link comparison: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit comparison: %w", err)
+	}
+
+	return nil
+}
+
+// SetFinishReason records why the AI stopped generating its response.
+func (s *AnalysisService) SetFinishReason(ctx context.Context, analysisID int64, reason string) error {
+	query := `UPDATE analyses SET finish_reason = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, reason, analysisID)
+	if err != nil {
+		return fmt.Errorf("failed to set finish reason: %w", err)
+	}
+
+	return nil
+}
+
+// SetCacheKey stores the key identifying the analysis's AI input, so later
+// analyses of the same input can reuse its result.
+func (s *AnalysisService) SetCacheKey(ctx context.Context, analysisID int64, key string) error {
+	query := `UPDATE analyses SET cache_key = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, key, analysisID)
+	if err != nil {
+		return fmt.Errorf("failed to set cache key: %w", err)
+	}
+
+	return nil
+}
+
+// CachedResultID returns the user's latest completed analysis with the given
+// cache key, or 0 if there is none. Results cut off by the token limit
+// aren't reused.
+func (s *AnalysisService) CachedResultID(ctx context.Context, userID int64, key string) (int64, error) {
+	query := `
+		SELECT id FROM analyses
+		WHERE user_id = $1 AND cache_key = $2 AND status = $3
+		  AND finish_reason IS DISTINCT FROM $4
+		ORDER BY completed_at DESC
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var id int64
+	err := s.pool.QueryRow(ctx, query, userID, key, StatusCompleted, FinishReasonLength).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find cached result: %w", err)
+	}
+
+	return id, nil
+}
+
+// CompleteFromCache completes a processing analysis with a copy of the
+// result and issues of sourceID, using no tokens. Returns
+// ErrAnalysisNotRunning if the analysis was cancelled meanwhile, and an
+// error if sourceID is no longer a completed analysis.
+func (s *AnalysisService) CompleteFromCache(ctx context.Context, analysisID, sourceID int64) error {
+	query := `
+		UPDATE analyses a
+		SET status = $1, ai_analysis = src.ai_analysis, finish_reason = src.finish_reason,
+		    tokens_used = 0, cached_from = src.id, completed_at = NOW()
+		FROM analyses src
+		WHERE a.id = $2 AND src.id = $3 AND src.status = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the analysis so a cancel can't slip in between check and update
+	var status AnalysisStatus
+	err = tx.QueryRow(ctx, `SELECT status FROM analyses WHERE id = $1 FOR UPDATE`, analysisID).Scan(&status)
+	if err != nil {
+		return fmt.Errorf("failed to complete analysis from cache: %w", err)
+	}
+	if status != StatusProcessing {
+		return ErrAnalysisNotRunning
+	}
+
+	tag, err := tx.Exec(ctx, query, StatusCompleted, analysisID, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to complete analysis from cache: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("cached result of analysis %d is no longer available", sourceID)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO code_issues (analysis_id, title, description, issue_type, severity, affected_file, line_number, suggested_fix)
+		SELECT $1, title, description, issue_type, severity, affected_file, line_number, suggested_fix
+		FROM code_issues WHERE analysis_id = $2
+		ORDER BY id
+	`, analysisID, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to copy cached issues: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit cached results: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStepTimings stores the pipeline step durations for an analysis.
+func (s *AnalysisService) UpdateStepTimings(ctx context.Context, analysisID int64, timings []StepTiming) error {
+	timingsJSON, err := json.Marshal(timings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal step timings: %w", err)
+	}
+
+	query := `UPDATE analyses SET step_timings = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err = s.pool.Exec(ctx, query, timingsJSON, analysisID)
+	if err != nil {
+		return fmt.Errorf("failed to update step timings: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AnalysisService) Complete(ctx context.Context, analysisID int64, aiAnalysis string, summary *AnalysisSummary, issues []Issue, tokensUsed int) error {
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary: %w", err)
+	}
+
+	// Store issues within the AI analysis or as a separate field
+	fullResult := struct {
+		RawAnalysis string           `json:"raw_analysis"`
+		Summary     *AnalysisSummary `json:"summary"`
+		Issues      []Issue          `json:"issues"`
+	}{
+		RawAnalysis: aiAnalysis,
+		Summary:     summary,
+		Issues:      issues,
+	}
+
+	fullResultJSON, err := json.Marshal(fullResult)
+	if err != nil {
+		return fmt.Errorf("failed to marshal full result: %w", err)
+	}
+
+	query := `
+		UPDATE analyses 
+		SET status = $1, ai_analysis = $2, tokens_used = $3, completed_at = NOW()
+		WHERE id = $4 AND status = $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, query, StatusCompleted, string(fullResultJSON), tokensUsed, analysisID, StatusProcessing)
+	if err != nil {
+		return fmt.Errorf("failed to complete analysis: %w", err)
+	}
+	// Cancelled while the AI was working
+	if tag.RowsAffected() == 0 {
+		return ErrAnalysisNotRunning
+	}
+
+	// Issues are also stored one per row so they can be queried across analyses
+	rows := make([][]any, 0, len(issues))
+	for _, issue := range issues {
+		rows = append(rows, []any{
+			analysisID,
+			truncateRunes(issue.Title, 255),
+			issue.Description,
+			issue.Category,
+			string(issue.Severity),
+			truncateRunes(issue.File, 500),
+			issue.Line,
+			issue.Suggestion,
+		})
+	}
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"code_issues"},
+		[]string{"analysis_id", "title", "description", "issue_type", "severity", "affected_file", "line_number", "suggested_fix"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store issues: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit analysis results: %w", err)
+	}
+
+	_ = summaryJSON // We stored it in fullResultJSON instead
+
+	return nil
+}
+
+// RecomputeSummary rebuilds a completed analysis's stored summary from its
+// current issues and saves it.
+func (s *AnalysisService) RecomputeSummary(ctx context.Context, analysisID int64) (*AnalysisSummary, error) {
+	return s.ResolveIssues(ctx, analysisID, nil)
+}
+
+// ResolveIssues removes the issues numbered in numbers, counting from 1 in
+// the order they are stored, from a completed analysis, e.g. once fixed or
+// merged into a duplicate, and saves the recomputed summary. Key findings
+// from the AI that mention a removed issue are derived from the remaining
+// issues instead, and filed GitHub issues are renumbered to match.
+func (s *AnalysisService) ResolveIssues(ctx context.Context, analysisID int64, numbers []int) (*AnalysisSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var aiAnalysisJSON *string
+	err = tx.QueryRow(ctx, `SELECT ai_analysis FROM analyses WHERE id = $1 FOR UPDATE`, analysisID).Scan(&aiAnalysisJSON)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAnalysisNotFound
+		}
+		return nil, fmt.Errorf("failed to load analysis result: %w", err)
+	}
+	if aiAnalysisJSON == nil {
+		return nil, ErrAnalysisNotFound
+	}
+
+	// Decode into a map so fields this method doesn't know about survive
+	var fullResult map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(*aiAnalysisJSON), &fullResult); err != nil {
+		return nil, fmt.Errorf("failed to decode analysis result: %w", err)
+	}
+
+	var issues []Issue
+	if raw, ok := fullResult["issues"]; ok {
+		if err := json.Unmarshal(raw, &issues); err != nil {
+			return nil, fmt.Errorf("failed to decode issues: %w", err)
+		}
+	}
+
+	resolve := make(map[int]bool, len(numbers))
+	for _, n := range numbers {
+		if n < 1 || n > len(issues) {
+			return nil, fmt.Errorf("%w: %d", ErrIssueNotFound, n)
+		}
+		resolve[n] = true
+	}
+	remaining := make([]Issue, 0, len(issues))
+	var resolved []Issue
+	var resolvedNumbers []int
+	for i, issue := range issues {
+		if resolve[i+1] {
+			resolved = append(resolved, issue)
+			resolvedNumbers = append(resolvedNumbers, i+1)
+			continue
+		}
+		remaining = append(remaining, issue)
+	}
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
-	defer cancel()
+	// Keep the counts of issues omitted by the severity caps, and the key
+	// findings taken from the AI response
+	summary := &AnalysisSummary{}
+	if raw, ok := fullResult["summary"]; ok {
+		var previous AnalysisSummary
+		if err := json.Unmarshal(raw, &previous); err == nil {
+			summary.OmittedBySeverity = previous.OmittedBySeverity
+			summary.KeyFindings = previous.KeyFindings
+			summary.KeyFindingsSource = previous.KeyFindingsSource
+			summary.MaxKeyFindings = previous.MaxKeyFindings
+		}
+	}
+	summary.DropKeyFindingsAbout(resolved, remaining)
+	summary.Recompute(remaining)
 
-	_, err = s.pool.Exec(ctx, query, combinedJSON, readme, analysisID)
+	if fullResult["issues"], err = json.Marshal(remaining); err != nil {
+		return nil, fmt.Errorf("failed to marshal issues: %w", err)
+	}
+	if fullResult["summary"], err = json.Marshal(summary); err != nil {
+		return nil, fmt.Errorf("failed to marshal summary: %w", err)
+	}
+	updated, err := json.Marshal(fullResult)
 	if err != nil {
-		return fmt.Errorf("failed to update GitHub data: %w", err)
+		return nil, fmt.Errorf("failed to marshal analysis result: %w", err)
 	}
 
-	return nil
-}
-
-func (s *AnalysisService) Complete(ctx context.Context, analysisID int64, aiAnalysis string, summary *AnalysisSummary, issues []Issue, tokensUsed int) error {
-	summaryJSON, err := json.Marshal(summary)
-	if err != nil {
-		return fmt.Errorf("failed to marshal summary: %w", err)
+	if _, err := tx.Exec(ctx, `UPDATE analyses SET ai_analysis = $1 WHERE id = $2`, string(updated), analysisID); err != nil {
+		return nil, fmt.Errorf("failed to update summary: %w", err)
 	}
 
-	// Store issues within the AI analysis or as a separate field
-	fullResult := struct {
-		RawAnalysis string           `json:"raw_analysis"`
-		Summary     *AnalysisSummary `json:"summary"`
-		Issues      []Issue          `json:"issues"`
-	}{
-		RawAnalysis: aiAnalysis,
-		Summary:     summary,
-		Issues:      issues,
+	if len(resolvedNumbers) > 0 {
+		// code_issues holds the same issues, one row each in the same order
+		_, err = tx.Exec(ctx, `
+			DELETE FROM code_issues WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS n
+					FROM code_issues WHERE analysis_id = $1
+				) numbered
+				WHERE n = ANY($2)
+			)
+		`, analysisID, resolvedNumbers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete resolved issues: %w", err)
+		}
+
+		// Renumber filed issues through negative numbers, so no two rows
+		// share a number halfway through
+		_, err = tx.Exec(ctx, `DELETE FROM filed_github_issues WHERE analysis_id = $1 AND issue_number = ANY($2)`, analysisID, resolvedNumbers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete filed issues: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE filed_github_issues f
+			SET issue_number = -(f.issue_number - (SELECT COUNT(*) FROM unnest($2::int[]) AS r(n) WHERE r.n < f.issue_number))
+			WHERE f.analysis_id = $1
+		`, analysisID, resolvedNumbers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to renumber filed issues: %w", err)
+		}
+		_, err = tx.Exec(ctx, `UPDATE filed_github_issues SET issue_number = -issue_number WHERE analysis_id = $1 AND issue_number < 0`, analysisID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to renumber filed issues: %w", err)
+		}
 	}
 
-	fullResultJSON, err := json.Marshal(fullResult)
-	if err != nil {
-		return fmt.Errorf("failed to marshal full result: %w", err)
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit summary: %w", err)
 	}
 
+	return summary, nil
+}
+
+// Fail marks the analysis as failed with an error message.
+func (s *AnalysisService) Fail(ctx context.Context, analysisID int64, errorMsg string) error {
+	// Finished analyses keep their outcome, e.g. the message of a cancelled one
 	query := `
 		UPDATE analyses 
-		SET status = $1, ai_analysis = $2, tokens_used = $3, completed_at = NOW()
-		WHERE id = $4
+		SET status = $1, error_message = $2, completed_at = NOW()
+		WHERE id = $3 AND status IN ($4, $5)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	_, err = s.pool.Exec(ctx, query, StatusCompleted, string(fullResultJSON), tokensUsed, analysisID)
+	_, err := s.pool.Exec(ctx, query, StatusFailed, errorMsg, analysisID, StatusPending, StatusProcessing)
 	if err != nil {
-		return fmt.Errorf("failed to complete analysis: %w", err)
+		return fmt.Errorf("failed to mark analysis as failed: %w", err)
 	}
 
-	_ = summaryJSON // We stored it in fullResultJSON instead
-
 	return nil
 }
 
-// Fail marks the analysis as failed with an error message.
-func (s *AnalysisService) Fail(ctx context.Context, analysisID int64, errorMsg string) error {
+// CancelledMessage is the error message of an analysis cancelled by its user.
+const CancelledMessage = "Cancelled by user"
+
+// Cancel marks one of the user's pending or processing analyses as failed
+// with CancelledMessage and returns the status it had. The caller stops any
+// work in progress; once cancelled, MarkProcessing and Complete refuse the
+// analysis, so a queued job is skipped and a running one can't store its
+// result or use quota. Returns ErrAnalysisNotFound if the user has no such
+// analysis and ErrAnalysisNotRunning if it already finished.
+func (s *AnalysisService) Cancel(ctx context.Context, id, userID int64) (AnalysisStatus, error) {
 	query := `
-		UPDATE analyses 
-		SET status = $1, error_message = $2, completed_at = NOW()
-		WHERE id = $3
+		UPDATE analyses a
+		SET status = $3, error_message = $4, completed_at = NOW()
+		FROM (SELECT id, status FROM analyses WHERE id = $1 FOR UPDATE) prev
+		WHERE a.id = prev.id AND a.user_id = $2 AND a.status IN ($5, $6)
+		RETURNING prev.status
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	_, err := s.pool.Exec(ctx, query, StatusFailed, errorMsg, analysisID)
-	if err != nil {
-		return fmt.Errorf("failed to mark analysis as failed: %w", err)
+	var previous AnalysisStatus
+	err := s.pool.QueryRow(ctx, query, id, userID, StatusFailed, CancelledMessage, StatusPending, StatusProcessing).Scan(&previous)
+	if err == nil {
+		return previous, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("failed to cancel analysis: %w", err)
 	}
 
-	return nil
+	// Tell a missing analysis from a finished one
+	var exists bool
+	err = s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM analyses WHERE id = $1 AND user_id = $2)`, id, userID).Scan(&exists)
+	if err != nil {
+		return "", fmt.Errorf("failed to cancel analysis: %w", err)
+	}
+	if !exists {
+		return "", ErrAnalysisNotFound
+	}
+	return "", ErrAnalysisNotRunning
 }
 
 func (s *AnalysisService) ByID(ctx context.Context, id int64) (*Analysis, error) {
 	query := `
-		SELECT a.id, a.user_id, a.repository_id, a.status, a.code_structure, a.readme_content,
-		       a.ai_analysis, a.tokens_used, a.error_message, a.created_at, a.started_at, a.completed_at,
-		       r.id, r.github_url, r.owner, r.name, r.description, r.primary_language, r.stars_count, r.forks_count
+		SELECT a.id, a.user_id, a.repository_id, a.status, a.mode, a.code_structure, a.readme_content,
+		       a.ai_analysis, a.tokens_used, a.error_message, a.step_timings, a.skipped_files, a.note, a.commit_sha,
+		       a.parameters, a.finish_reason, a.cached_from, a.content_hash, a.file_hashes, a.requested_ref, a.compare_base_id, a.created_at, a.started_at, a.completed_at,
+		       r.id, r.github_url, r.owner, r.name, r.description, r.primary_language, r.stars_count, r.forks_count, r.license, r.private
 		FROM analyses a
 		JOIN repositories r ON a.repository_id = r.id
 		WHERE a.id = $1
@@ -249,7 +1110,7 @@ func (s *AnalysisService) ByID(ctx context.Context, id int64) (*Analysis, error)
 	defer cancel()
 
 	analysis := &Analysis{Repository: &Repository{}}
-	var codeStructureJSON []byte
+	var codeStructureJSON, stepTimingsJSON, skippedJSON, paramsJSON, fileHashesJSON []byte
 	var aiAnalysisJSON *string
 
 	err := s.pool.QueryRow(ctx, query, id).Scan(
@@ -257,11 +1118,23 @@ func (s *AnalysisService) ByID(ctx context.Context, id int64) (*Analysis, error)
 		&analysis.UserID,
 		&analysis.RepositoryID,
 		&analysis.Status,
+		&analysis.Mode,
 		&codeStructureJSON,
 		&analysis.READMEContent,
 		&aiAnalysisJSON,
 		&analysis.TokensUsed,
 		&analysis.ErrorMessage,
+		&stepTimingsJSON,
+		&skippedJSON,
+		&analysis.Note,
+		&analysis.CommitSHA,
+		&paramsJSON,
+		&analysis.FinishReason,
+		&analysis.CachedFrom,
+		&analysis.ContentHash,
+		&fileHashesJSON,
+		&analysis.RequestedRef,
+		&analysis.CompareBaseID,
 		&analysis.CreatedAt,
 		&analysis.StartedAt,
 		&analysis.CompletedAt,
@@ -273,6 +1146,8 @@ func (s *AnalysisService) ByID(ctx context.Context, id int64) (*Analysis, error)
 		&analysis.Repository.PrimaryLanguage,
 		&analysis.Repository.StarsCount,
 		&analysis.Repository.ForksCount,
+		&analysis.Repository.License,
+		&analysis.Repository.Private,
 	)
 
 	if err != nil {
@@ -294,6 +1169,27 @@ func (s *AnalysisService) ByID(ctx context.Context, id int64) (*Analysis, error)
 		}
 	}
 
+	if len(stepTimingsJSON) > 0 {
+		_ = json.Unmarshal(stepTimingsJSON, &analysis.StepTimings)
+	}
+	if len(skippedJSON) > 0 {
+		_ = json.Unmarshal(skippedJSON, &analysis.SkippedFiles)
+	}
+	if len(fileHashesJSON) > 0 {
+		_ = json.Unmarshal(fileHashesJSON, &analysis.FileHashes)
+	} else if len(analysis.CodeFiles) > 0 {
+		// Stored before hashes were recorded
+		analysis.FileHashes = HashFiles(analysis.CodeFiles)
+		hash := TreeHash(analysis.FileHashes)
+		analysis.ContentHash = &hash
+	}
+	if len(paramsJSON) > 0 {
+		var params AnalysisParameters
+		if err := json.Unmarshal(paramsJSON, &params); err == nil {
+			analysis.Parameters = &params
+		}
+	}
+
 	if aiAnalysisJSON != nil && *aiAnalysisJSON != "" {
 		var fullResult struct {
 			RawAnalysis string           `json:"raw_analysis"`
@@ -313,34 +1209,74 @@ func (s *AnalysisService) ByID(ctx context.Context, id int64) (*Analysis, error)
 	return analysis, nil
 }
 
-func (s *AnalysisService) ByUserID(ctx context.Context, userID int64, limit int) ([]*Analysis, error) {
-	if limit <= 0 {
-		limit = 50
+// ByUserID lists a page of the user's analyses, newest first unless
+// page.Sort says otherwise.
+func (s *AnalysisService) ByUserID(ctx context.Context, userID int64, page Page) ([]*Analysis, error) {
+	order, orderArgs, err := analysisListOrder.clause(page, 2)
+	if err != nil {
+		return nil, err
 	}
 
 	query := `
-		SELECT a.id, a.user_id, a.repository_id, a.status, a.tokens_used, a.error_message,
+		SELECT a.id, a.user_id, a.repository_id, a.status, a.tokens_used, a.error_message, a.note,
 		       a.created_at, a.started_at, a.completed_at,
-		       r.id, r.github_url, r.owner, r.name, r.description, r.primary_language, r.stars_count, r.forks_count
+		       (a.code_structure->'structure'->>'test_files')::int, (a.code_structure->'structure'->>'source_files')::int,
+		       r.id, r.github_url, r.owner, r.name, r.description, r.primary_language, r.stars_count, r.forks_count, r.private
 		FROM analyses a
 		JOIN repositories r ON a.repository_id = r.id
 		WHERE a.user_id = $1
-		ORDER BY a.created_at DESC
-		LIMIT $2
-	`
+	` + order
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	rows, err := s.pool.Query(ctx, query, userID, limit)
+	rows, err := s.pool.Query(ctx, query, append([]any{userID}, orderArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list analyses: %w", err)
 	}
+
+	return scanAnalysisList(rows)
+}
+
+// LatestPerRepository returns the user's most recent analysis of each
+// repository, newest first.
+func (s *AnalysisService) LatestPerRepository(ctx context.Context, userID int64) ([]*Analysis, error) {
+	query := `
+		SELECT * FROM (
+			SELECT DISTINCT ON (a.repository_id)
+			       a.id, a.user_id, a.repository_id, a.status, a.tokens_used, a.error_message, a.note,
+			       a.created_at, a.started_at, a.completed_at,
+			       (a.code_structure->'structure'->>'test_files')::int AS test_files,
+			       (a.code_structure->'structure'->>'source_files')::int AS source_files,
+			       r.id, r.github_url, r.owner, r.name, r.description, r.primary_language, r.stars_count, r.forks_count, r.private
+			FROM analyses a
+			JOIN repositories r ON a.repository_id = r.id
+			WHERE a.user_id = $1
+			ORDER BY a.repository_id, a.created_at DESC
+		) latest
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list latest analyses: %w", err)
+	}
+
+	return scanAnalysisList(rows)
+}
+
+// scanAnalysisList scans analysis list rows (as selected by ByUserID) and
+// closes them.
+func scanAnalysisList(rows pgx.Rows) ([]*Analysis, error) {
 	defer rows.Close()
 
 	var analyses []*Analysis
 	for rows.Next() {
 		analysis := &Analysis{Repository: &Repository{}}
+		var testFiles, sourceFiles *int
 		err := rows.Scan(
 			&analysis.ID,
 			&analysis.UserID,
@@ -348,9 +1284,12 @@ func (s *AnalysisService) ByUserID(ctx context.Context, userID int64, limit int)
 			&analysis.Status,
 			&analysis.TokensUsed,
 			&analysis.ErrorMessage,
+			&analysis.Note,
 			&analysis.CreatedAt,
 			&analysis.StartedAt,
 			&analysis.CompletedAt,
+			&testFiles,
+			&sourceFiles,
 			&analysis.Repository.ID,
 			&analysis.Repository.GitHubURL,
 			&analysis.Repository.Owner,
@@ -359,10 +1298,15 @@ func (s *AnalysisService) ByUserID(ctx context.Context, userID int64, limit int)
 			&analysis.Repository.PrimaryLanguage,
 			&analysis.Repository.StarsCount,
 			&analysis.Repository.ForksCount,
+			&analysis.Repository.Private,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan analysis: %w", err)
 		}
+		// Lists only load the test counts, for the testing signal
+		if testFiles != nil && sourceFiles != nil {
+			analysis.CodeStructure = &CodeStructure{TestFiles: *testFiles, SourceFiles: *sourceFiles}
+		}
 		analyses = append(analyses, analysis)
 	}
 
@@ -373,6 +1317,99 @@ func (s *AnalysisService) ByUserID(ctx context.Context, userID int64, limit int)
 	return analyses, nil
 }
 
+// SetNote sets the user's note on an analysis, truncated to MaxNoteLength
+// characters. An empty note clears it. Returns ErrAnalysisNotFound if the
+// analysis doesn't exist or belongs to another user.
+func (s *AnalysisService) SetNote(ctx context.Context, id, userID int64, note string) error {
+	note = truncateRunes(strings.TrimSpace(note), MaxNoteLength)
+
+	query := `UPDATE analyses SET note = NULLIF($3, '') WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, query, id, userID, note)
+	if err != nil {
+		return fmt.Errorf("failed to set analysis note: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAnalysisNotFound
+	}
+
+	return nil
+}
+
+// UserIssue is an issue found in one of a user's analyses, with the
+// repository it was found in.
+type UserIssue struct {
+	Issue
+	AnalysisID int64
+	RepoOwner  string
+	RepoName   string
+	CreatedAt  time.Time
+}
+
+// IssuesBySeverity returns the user's most recent issues of the given
+// severity across all their analyses, newest first unless page.Sort says
+// otherwise.
+func (s *AnalysisService) IssuesBySeverity(ctx context.Context, userID int64, sev Severity, page Page) ([]UserIssue, error) {
+	order, orderArgs, err := issueListOrder.clause(page, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ci.analysis_id, ci.title, COALESCE(ci.description, ''), COALESCE(ci.issue_type, ''),
+		       ci.severity, COALESCE(ci.affected_file, ''), COALESCE(ci.line_number, 0),
+		       COALESCE(ci.suggested_fix, ''), ci.created_at, r.owner, r.name
+		FROM code_issues ci
+		JOIN analyses a ON a.id = ci.analysis_id
+		JOIN repositories r ON r.id = a.repository_id
+		WHERE a.user_id = $1 AND ci.severity = $2
+	` + order
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, query, append([]any{userID, string(sev)}, orderArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list issues: %w", err)
+	}
+	defer rows.Close()
+
+	var issues []UserIssue
+	for rows.Next() {
+		var issue UserIssue
+		var createdAt *time.Time
+		err := rows.Scan(
+			&issue.AnalysisID,
+			&issue.Title,
+			&issue.Description,
+			&issue.Category,
+			&issue.Severity,
+			&issue.File,
+			&issue.Line,
+			&issue.Suggestion,
+			&createdAt,
+			&issue.RepoOwner,
+			&issue.RepoName,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan issue: %w", err)
+		}
+		if createdAt != nil {
+			issue.CreatedAt = *createdAt
+		}
+		issues = append(issues, issue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating issues: %w", err)
+	}
+
+	return issues, nil
+}
+
 // CountByUser returns the number of analyses for a user.
 func (s *AnalysisService) CountByUser(ctx context.Context, userID int64) (int, error) {
 	query := `SELECT COUNT(*) FROM analyses WHERE user_id = $1`
@@ -389,6 +1426,39 @@ func (s *AnalysisService) CountByUser(ctx context.Context, userID int64) (int, e
 	return count, nil
 }
 
+// CountInFlight returns the number of the user's analyses that are pending
+// or processing.
+func (s *AnalysisService) CountInFlight(ctx context.Context, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM analyses WHERE user_id = $1 AND status IN ($2, $3)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var count int
+	err := s.pool.QueryRow(ctx, query, userID, StatusPending, StatusProcessing).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count in-flight analyses: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountPending returns the number of pending analyses across all users.
+func (s *AnalysisService) CountPending(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM analyses WHERE status = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var count int
+	err := s.pool.QueryRow(ctx, query, StatusPending).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pending analyses: %w", err)
+	}
+
+	return count, nil
+}
+
 // CountByStatus returns counts of analyses grouped by status for a user.
 func (s *AnalysisService) CountByStatus(ctx context.Context, userID int64) (map[AnalysisStatus]int, error) {
 	query := `
@@ -477,6 +1547,184 @@ func (s *AnalysisService) GetPendingAnalyses(ctx context.Context, limit int) ([]
 	return analyses, nil
 }
 
+// GetStaleProcessing returns analyses stuck in processing whose started_at
+// is older than olderThan, e.g. because the server died mid-analysis.
+func (s *AnalysisService) GetStaleProcessing(ctx context.Context, olderThan time.Duration) ([]*Analysis, error) {
+	query := `
+		SELECT id, user_id, repository_id, status, created_at, started_at
+		FROM analyses
+		WHERE status = $1 AND started_at < $2
+		ORDER BY started_at ASC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, query, StatusProcessing, time.Now().Add(-olderThan))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stale analyses: %w", err)
+	}
+	defer rows.Close()
+
+	var analyses []*Analysis
+	for rows.Next() {
+		analysis := &Analysis{}
+		err := rows.Scan(
+			&analysis.ID,
+			&analysis.UserID,
+			&analysis.RepositoryID,
+			&analysis.Status,
+			&analysis.CreatedAt,
+			&analysis.StartedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan analysis: %w", err)
+		}
+		analyses = append(analyses, analysis)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating analyses: %w", err)
+	}
+
+	return analyses, nil
+}
+
+// FailStale marks every analysis stuck in processing for longer than
+// olderThan as failed. Returns the number of analyses failed.
+func (s *AnalysisService) FailStale(ctx context.Context, olderThan time.Duration) (int, error) {
+	stale, err := s.GetStaleProcessing(ctx, olderThan)
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, analysis := range stale {
+		if err := s.Fail(ctx, analysis.ID, "Analysis was interrupted before it finished. Please run it again."); err != nil {
+			return failed, err
+		}
+		failed++
+	}
+
+	return failed, nil
+}
+
+// PruneOldFiles drops the stored source files of finished analyses created
+// more than olderThan ago. The file structure, README and results (summary,
+// issues, score) are kept. Returns the number of analyses pruned.
+func (s *AnalysisService) PruneOldFiles(ctx context.Context, olderThan time.Duration) (int, error) {
+	query := `
+		UPDATE analyses
+		SET code_structure = code_structure - 'files', code_files = NULL
+		WHERE status IN ($1, $2) AND created_at < $3
+		  AND (code_structure ? 'files' OR code_files IS NOT NULL)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, query, StatusCompleted, StatusFailed, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune analysis files: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// FilePruner returns a Pruner running PruneOldFiles, for StartPruners.
+func (s *AnalysisService) FilePruner(olderThan time.Duration) Pruner {
+	return Pruner{
+		Name: "stored files from old analyses",
+		Prune: func(ctx context.Context) (int, error) {
+			return s.PruneOldFiles(ctx, olderThan)
+		},
+	}
+}
+
+// Pruner deletes or trims rows that are past their retention. Prune returns
+// how many it pruned.
+type Pruner struct {
+	Name  string
+	Prune func(ctx context.Context) (int, error)
+}
+
+// StartPruners starts a background goroutine that runs every pruner once
+// immediately and then every interval. Returns a channel that can be closed
+// to stop it.
+func StartPruners(interval time.Duration, pruners ...Pruner) chan struct{} {
+	stop := make(chan struct{})
+
+	prune := func() {
+		for _, p := range pruners {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			count, err := p.Prune(ctx)
+			cancel()
+
+			if err != nil {
+				fmt.Printf("Prune error (%s): %v\n", p.Name, err)
+			} else if count > 0 {
+				fmt.Printf("Pruned %d %s\n", count, p.Name)
+			}
+		}
+	}
+
+	go func() {
+		prune()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				prune()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// StartStaleReconciler starts a background goroutine that fails analyses
+// stuck in processing. It runs once immediately (to clean up after a crash)
+// and then every interval. Returns a channel that can be closed to stop it.
+func (s *AnalysisService) StartStaleReconciler(interval, olderThan time.Duration) chan struct{} {
+	stop := make(chan struct{})
+
+	reconcile := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		count, err := s.FailStale(ctx, olderThan)
+		cancel()
+
+		if err != nil {
+			// Log error but continue
+			fmt.Printf("Stale analysis reconcile error: %v\n", err)
+		} else if count > 0 {
+			fmt.Printf("Marked %d stale analyses as failed\n", count)
+		}
+	}
+
+	go func() {
+		reconcile()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				reconcile()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
 // HELPER FUNCS --------------------------------
 
 // Duration returns how long the analysis took.
@@ -488,6 +1736,42 @@ func (a *Analysis) Duration() time.Duration {
 	return a.CompletedAt.Sub(*a.StartedAt)
 }
 
+// ShortCommitSHA returns the first 7 characters of the analyzed commit, or
+// "" when it wasn't recorded.
+func (a *Analysis) ShortCommitSHA() string {
+	if a.CommitSHA == nil {
+		return ""
+	}
+	sha := *a.CommitSHA
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	return sha
+}
+
+// CommitURL links to the analyzed commit on GitHub, or returns "" when the
+// commit wasn't recorded or the repository isn't on GitHub.
+func (a *Analysis) CommitURL() string {
+	if a.CommitSHA == nil || a.Repository == nil || a.Repository.IsUpload() || a.Repository.IsGist() {
+		return ""
+	}
+	return a.Repository.CanonicalURL() + "/commit/" + *a.CommitSHA
+}
+
+// FileURL links to path, and line when positive, on GitHub at the analyzed
+// commit, or returns "" when CommitURL would.
+func (a *Analysis) FileURL(path string, line int) string {
+	if a.CommitURL() == "" || path == "" {
+		return ""
+	}
+	escaped := (&url.URL{Path: strings.TrimPrefix(path, "/")}).EscapedPath()
+	u := a.Repository.CanonicalURL() + "/blob/" + *a.CommitSHA + "/" + escaped
+	if line > 0 {
+		u += fmt.Sprintf("#L%d", line)
+	}
+	return u
+}
+
 func (a *Analysis) IsPending() bool {
 	return a.Status == StatusPending
 }
@@ -504,10 +1788,38 @@ func (a *Analysis) IsFailed() bool {
 	return a.Status == StatusFailed
 }
 
+// CriticalCount returns the number of critical issues.
+func (a *Analysis) CriticalCount() int {
+	if a.Summary == nil {
+		return 0
+	}
+	return a.Summary.IssuesBySeverity[string(SeverityCritical)]
+}
+
 // HighSeverityCount returns the number of high severity issues.
 func (a *Analysis) HighSeverityCount() int {
 	if a.Summary == nil {
 		return 0
 	}
-	return a.Summary.IssuesBySeverity["HIGH"]
+	return a.Summary.IssuesBySeverity[string(SeverityHigh)]
+}
+
+// IssuesByCategory groups the issues by normalized category, keeping their
+// order within each group.
+func (a *Analysis) IssuesByCategory() map[string][]Issue {
+	groups := make(map[string][]Issue)
+	for _, issue := range a.Issues {
+		category := NormalizeCategory(issue.Category)
+		groups[category] = append(groups[category], issue)
+	}
+	return groups
+}
+
+// truncateRunes cuts s to at most n characters, for VARCHAR(n) columns.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
 }
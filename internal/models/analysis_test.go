@@ -0,0 +1,597 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestUser creates a user with the given API quota.
+func newTestUser(t *testing.T, pool *pgxpool.Pool, email string, quota int) *User {
+	t.Helper()
+	user, err := NewUserService(pool, bcrypt.MinCost).Create(context.Background(), email, "correct-horse-battery", quota)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func TestCreateWithRepositoryMaxInFlight(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+
+	tests := []struct {
+		name        string
+		maxInFlight int
+		requests    int
+		sameRepo    bool
+		wantCreated int
+	}{
+		{name: "no limit", maxInFlight: 0, requests: 5, wantCreated: 5},
+		{name: "concurrent requests can't exceed the limit", maxInFlight: 2, requests: 6, wantCreated: 2},
+		{name: "reuse at the limit is allowed", maxInFlight: 1, requests: 4, sameRepo: true, wantCreated: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncate(t, pool, "users", "repositories", "analyses")
+			user := newTestUser(t, pool, "inflight@example.com", 100000)
+			limits := AnalysisLimits{MaxInFlight: tt.maxInFlight}
+
+			var (
+				wg                    sync.WaitGroup
+				mu                    sync.Mutex
+				created, reused, over int
+			)
+			for i := 0; i < tt.requests; i++ {
+				name := fmt.Sprintf("repo%d", i)
+				if tt.sameRepo {
+					name = "repo"
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/" + name, Owner: "acme", Name: name}
+					_, _, wasReused, err := s.CreateWithRepository(ctx, repo, ModeDeep, time.Hour, limits)
+
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case errors.Is(err, ErrTooManyInFlight):
+						over++
+					case err != nil:
+						t.Errorf("CreateWithRepository: %v", err)
+					case wasReused:
+						reused++
+					default:
+						created++
+					}
+				}()
+			}
+			wg.Wait()
+
+			if created != tt.wantCreated {
+				t.Errorf("created %d analyses, want %d", created, tt.wantCreated)
+			}
+			if tt.sameRepo && over != 0 {
+				t.Errorf("%d requests rejected, want reuse instead", over)
+			}
+			inFlight, err := s.CountInFlight(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("CountInFlight: %v", err)
+			}
+			if inFlight != tt.wantCreated {
+				t.Errorf("%d analyses in flight, want %d", inFlight, tt.wantCreated)
+			}
+		})
+	}
+}
+
+func TestCreateWithRepositoryReservesQuota(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+	user := newTestUser(t, pool, "reserve@example.com", 12000)
+	limits := AnalysisLimits{ReserveTokens: 5000}
+
+	create := func(name string) (*Analysis, error) {
+		repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/" + name, Owner: "acme", Name: name}
+		_, analysis, _, err := s.CreateWithRepository(ctx, repo, ModeDeep, 0, limits)
+		return analysis, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		analyses []*Analysis
+		over     int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			analysis, err := create(fmt.Sprintf("repo%d", i))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrQuotaExceeded):
+				over++
+			case err != nil:
+				t.Errorf("CreateWithRepository: %v", err)
+			default:
+				analyses = append(analyses, analysis)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(analyses) != 2 || over != 3 {
+		t.Fatalf("created %d and rejected %d analyses, want 2 and 3", len(analyses), over)
+	}
+
+	// A finished analysis releases its reservation
+	if err := s.Fail(ctx, analyses[0].ID, "test"); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+	if _, err := create("after-fail"); err != nil {
+		t.Errorf("create after a reservation was released: %v", err)
+	}
+}
+
+func TestUpdateAPIQuotaConcurrent(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	truncate(t, pool, "users")
+	user := newTestUser(t, pool, "charge@example.com", 1000)
+	users := NewUserService(pool, bcrypt.MinCost)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		charged int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := users.UpdateAPIQuota(ctx, user.ID, 300)
+			if err != nil && !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("UpdateAPIQuota: %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				charged++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := users.ByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ByID: %v", err)
+	}
+	if charged != 3 || got.APIQuotaUsed != 900 {
+		t.Errorf("charged %d times to %d used, want 3 times to 900", charged, got.APIQuotaUsed)
+	}
+}
+
+func TestCreateWithRepositoryIsAtomic(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+
+	tests := []struct {
+		name    string
+		quota   int
+		mode    AnalysisMode
+		limits  AnalysisLimits
+		wantErr bool
+	}{
+		{name: "success writes every row", quota: 1000, mode: ModeDeep},
+		{name: "analysis insert fails", quota: 1000, mode: AnalysisMode(strings.Repeat("x", 21)), wantErr: true},
+		{name: "limit check fails", quota: 0, mode: ModeDeep, limits: AnalysisLimits{ReserveTokens: 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncate(t, pool, "users", "repositories", "analyses")
+			user := newTestUser(t, pool, "atomic@example.com", tt.quota)
+
+			repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+			_, _, _, err := s.CreateWithRepository(ctx, repo, tt.mode, 0, tt.limits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateWithRepository error = %v, want error %v", err, tt.wantErr)
+			}
+
+			want := 1
+			if tt.wantErr {
+				want = 0
+			}
+			for _, table := range []string{"repositories", "user_repositories", "analyses"} {
+				var count int
+				if err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+					t.Fatalf("count %s: %v", table, err)
+				}
+				if count != want {
+					t.Errorf("%d rows in %s, want %d", count, table, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+
+	tests := []struct {
+		name         string
+		status       AnalysisStatus
+		otherUser    bool
+		wantPrevious AnalysisStatus
+		wantErr      error
+	}{
+		{name: "pending", status: StatusPending, wantPrevious: StatusPending},
+		{name: "processing", status: StatusProcessing, wantPrevious: StatusProcessing},
+		{name: "completed", status: StatusCompleted, wantErr: ErrAnalysisNotRunning},
+		{name: "someone else's", status: StatusPending, otherUser: true, wantErr: ErrAnalysisNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncate(t, pool, "users", "repositories", "analyses")
+			owner := newTestUser(t, pool, "owner@example.com", 1000)
+			other := newTestUser(t, pool, "other@example.com", 1000)
+
+			repo := &Repository{UserID: owner.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+			_, analysis, _, err := s.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+			if err != nil {
+				t.Fatalf("CreateWithRepository: %v", err)
+			}
+			if _, err := pool.Exec(ctx, `UPDATE analyses SET status = $1 WHERE id = $2`, tt.status, analysis.ID); err != nil {
+				t.Fatalf("set status: %v", err)
+			}
+
+			userID := owner.ID
+			if tt.otherUser {
+				userID = other.ID
+			}
+			previous, err := s.Cancel(ctx, analysis.ID, userID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Cancel error = %v, want %v", err, tt.wantErr)
+			}
+			if previous != tt.wantPrevious {
+				t.Errorf("previous status = %q, want %q", previous, tt.wantPrevious)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			got, err := s.ByID(ctx, analysis.ID)
+			if err != nil {
+				t.Fatalf("ByID: %v", err)
+			}
+			if got.Status != StatusFailed || got.ErrorMessage == nil || *got.ErrorMessage != CancelledMessage {
+				t.Errorf("cancelled analysis has status %q and message %v", got.Status, got.ErrorMessage)
+			}
+
+			// A worker picking it up, or finishing it, is refused
+			if err := s.MarkProcessing(ctx, analysis.ID); !errors.Is(err, ErrAnalysisNotRunning) {
+				t.Errorf("MarkProcessing after cancel = %v, want ErrAnalysisNotRunning", err)
+			}
+			if err := s.Complete(ctx, analysis.ID, "{}", &AnalysisSummary{}, nil, 100); !errors.Is(err, ErrAnalysisNotRunning) {
+				t.Errorf("Complete after cancel = %v, want ErrAnalysisNotRunning", err)
+			}
+		})
+	}
+}
+
+func TestCompleteFromCacheUsesNoTokens(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+	user := newTestUser(t, pool, "cache@example.com", 100000)
+	const key = "same-input"
+
+	start := func() *Analysis {
+		t.Helper()
+		repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+		_, analysis, _, err := s.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+		if err != nil {
+			t.Fatalf("CreateWithRepository: %v", err)
+		}
+		if err := s.MarkProcessing(ctx, analysis.ID); err != nil {
+			t.Fatalf("MarkProcessing: %v", err)
+		}
+		if err := s.SetCacheKey(ctx, analysis.ID, key); err != nil {
+			t.Fatalf("SetCacheKey: %v", err)
+		}
+		return analysis
+	}
+
+	first := start()
+	issues := []Issue{{Severity: SeverityHigh, Category: CategorySecurity, Title: "SQL injection", File: "db.go"}}
+	if err := s.Complete(ctx, first.ID, "{}", &AnalysisSummary{TotalIssues: 1}, issues, 1200); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	second := start()
+	sourceID, err := s.CachedResultID(ctx, user.ID, key)
+	if err != nil {
+		t.Fatalf("CachedResultID: %v", err)
+	}
+	if sourceID != first.ID {
+		t.Fatalf("cached result is analysis %d, want %d", sourceID, first.ID)
+	}
+	if err := s.CompleteFromCache(ctx, second.ID, sourceID); err != nil {
+		t.Fatalf("CompleteFromCache: %v", err)
+	}
+
+	got, err := s.ByID(ctx, second.ID)
+	if err != nil {
+		t.Fatalf("ByID: %v", err)
+	}
+	if got.Status != StatusCompleted || got.TokensUsed != 0 {
+		t.Errorf("second analysis is %s with %d tokens, want completed with 0", got.Status, got.TokensUsed)
+	}
+	if len(got.Issues) != 1 || got.Issues[0].Title != "SQL injection" {
+		t.Errorf("second analysis has issues %+v, want the first's", got.Issues)
+	}
+}
+
+func TestResolveIssues(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+	user := newTestUser(t, pool, "resolve@example.com", 100000)
+
+	repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+	_, analysis, _, err := s.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+	if err != nil {
+		t.Fatalf("CreateWithRepository: %v", err)
+	}
+	if err := s.MarkProcessing(ctx, analysis.ID); err != nil {
+		t.Fatalf("MarkProcessing: %v", err)
+	}
+	summary := &AnalysisSummary{}
+	summary.Recompute(recomputeIssues)
+	summary.SetAIKeyFindings([]string{"SQL injection in search exposes the users table"})
+	if err := s.Complete(ctx, analysis.ID, "{}", summary, recomputeIssues, 100); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	// Issue 4 was filed on GitHub, and becomes issue 3 once 1 is resolved
+	if _, err := s.ClaimIssueFiling(ctx, analysis.ID, 4); err != nil {
+		t.Fatalf("ClaimIssueFiling: %v", err)
+	}
+	if err := s.RecordIssueFiled(ctx, analysis.ID, 4, 42, "https://github.com/acme/app/issues/42"); err != nil {
+		t.Fatalf("RecordIssueFiled: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		numbers     []int
+		wantErr     error
+		wantTitles  []string
+		wantScore   int
+		wantFinding string
+	}{
+		{name: "out of range", numbers: []int{6}, wantErr: ErrIssueNotFound},
+		{name: "zero", numbers: []int{0}, wantErr: ErrIssueNotFound},
+		{
+			name:        "merge a duplicate",
+			numbers:     []int{3},
+			wantTitles:  []string{"SQL injection in search", "Hardcoded secret", "N+1 query", "Long function"},
+			wantScore:   100 - 20 - 10 - 5 - 3,
+			wantFinding: "SQL injection in search exposes the users table",
+		},
+		{
+			name:        "resolve the issue a key finding mentions",
+			numbers:     []int{1},
+			wantTitles:  []string{"Hardcoded secret", "N+1 query", "Long function"},
+			wantScore:   100 - 10 - 5 - 3,
+			wantFinding: "Hardcoded secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := s.ResolveIssues(ctx, analysis.ID, tt.numbers)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveIssues = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveIssues: %v", err)
+			}
+
+			got, err := s.ByID(ctx, analysis.ID)
+			if err != nil {
+				t.Fatalf("ByID: %v", err)
+			}
+			var titles []string
+			for _, issue := range got.Issues {
+				titles = append(titles, issue.Title)
+			}
+			if strings.Join(titles, "|") != strings.Join(tt.wantTitles, "|") {
+				t.Errorf("issues = %q, want %q", titles, tt.wantTitles)
+			}
+			if summary.TotalIssues != len(tt.wantTitles) || got.Summary.TotalIssues != len(tt.wantTitles) {
+				t.Errorf("TotalIssues = %d, stored %d, want %d", summary.TotalIssues, got.Summary.TotalIssues, len(tt.wantTitles))
+			}
+			if got.Summary.OverallScore != tt.wantScore {
+				t.Errorf("OverallScore = %d, want %d", got.Summary.OverallScore, tt.wantScore)
+			}
+			if len(got.Summary.KeyFindings) == 0 || got.Summary.KeyFindings[0] != tt.wantFinding {
+				t.Errorf("KeyFindings = %q, want %q first", got.Summary.KeyFindings, tt.wantFinding)
+			}
+
+			var rows int
+			if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM code_issues WHERE analysis_id = $1`, analysis.ID).Scan(&rows); err != nil {
+				t.Fatalf("count code_issues: %v", err)
+			}
+			if rows != len(tt.wantTitles) {
+				t.Errorf("%d code_issues rows, want %d", rows, len(tt.wantTitles))
+			}
+		})
+	}
+
+	// N+1 query was filed as issue 4; it's now issue 2
+	filed, err := s.ClaimIssueFiling(ctx, analysis.ID, 2)
+	if !errors.Is(err, ErrIssueAlreadyFiled) || filed == nil || filed.GitHubNumber == nil || *filed.GitHubNumber != 42 {
+		t.Errorf("ClaimIssueFiling(2) = %+v, %v, want GitHub issue 42", filed, err)
+	}
+	if _, err := s.ClaimIssueFiling(ctx, analysis.ID, 3); err != nil {
+		t.Errorf("ClaimIssueFiling(3) = %v, want the unfiled issue claimed", err)
+	}
+}
+
+func TestSetParameters(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+	user := newTestUser(t, pool, "params@example.com", 100000)
+
+	scoring := DefaultScoringConfig()
+	scoring.EntryPoints = []string{"cmd/app/main.go"}
+
+	tests := []struct {
+		name   string
+		params *AnalysisParameters
+	}{
+		{
+			name: "GitHub repository",
+			params: &AnalysisParameters{
+				RepoURL: "https://github.com/acme/app", Ref: "0123abc", Mode: ModeDeep, MaxFiles: 20, Scoring: scoring,
+				MaxFilesPerLanguage: 8, MaxFileBytes: 100000, MaxREADMEBytes: 20000, ExcludedLanguages: []string{"Markdown"},
+			},
+		},
+		{
+			name: "upload",
+			params: &AnalysisParameters{
+				Mode: ModeDeep, MaxFiles: 10, Scoring: DefaultScoringConfig(), MaxFileBytes: 100000,
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &Repository{UserID: user.ID, GitHubURL: fmt.Sprintf("https://github.com/acme/app%d", i), Owner: "acme", Name: fmt.Sprintf("app%d", i)}
+			_, analysis, _, err := s.CreateWithRepository(ctx, repo, tt.params.Mode, 0, AnalysisLimits{})
+			if err != nil {
+				t.Fatalf("CreateWithRepository: %v", err)
+			}
+			if err := s.SetParameters(ctx, analysis.ID, tt.params); err != nil {
+				t.Fatalf("SetParameters: %v", err)
+			}
+
+			got, err := s.ByID(ctx, analysis.ID)
+			if err != nil {
+				t.Fatalf("ByID: %v", err)
+			}
+			p := got.Parameters
+			if p == nil {
+				t.Fatal("Parameters = nil")
+			}
+			if p.RepoURL != tt.params.RepoURL || p.Ref != tt.params.Ref || p.MaxFiles != tt.params.MaxFiles ||
+				p.MaxFilesPerLanguage != tt.params.MaxFilesPerLanguage || p.MaxFileBytes != tt.params.MaxFileBytes ||
+				p.MaxREADMEBytes != tt.params.MaxREADMEBytes || strings.Join(p.ExcludedLanguages, ",") != strings.Join(tt.params.ExcludedLanguages, ",") {
+				t.Errorf("Parameters = %+v, want %+v", p, tt.params)
+			}
+			if p.Scoring == nil || strings.Join(p.Scoring.EntryPoints, ",") != strings.Join(tt.params.Scoring.EntryPoints, ",") {
+				t.Errorf("Scoring = %+v, want %+v", p.Scoring, tt.params.Scoring)
+			}
+			if p.Reproducible() != (tt.params.RepoURL != "") {
+				t.Errorf("Reproducible = %v", p.Reproducible())
+			}
+		})
+	}
+}
+
+func TestSkippedFilesIssue(t *testing.T) {
+	tests := []struct {
+		name      string
+		skipped   []SkippedFile
+		wantTitle string
+		wantFile  string
+		wantLines []string
+	}{
+		{
+			name:      "one file",
+			skipped:   []SkippedFile{{Path: "assets/logo.png", Reason: SkipBinary}},
+			wantTitle: "1 selected file was left out of the analysis",
+			wantFile:  "assets/logo.png",
+			wantLines: []string{"assets/logo.png: binary content"},
+		},
+		{
+			name: "every reason",
+			skipped: []SkippedFile{
+				{Path: "data/dump.sql", Reason: SkipTooLarge},
+				{Path: "bin/tool", Reason: SkipBinary},
+				{Path: "main.go", Reason: SkipFetchError},
+			},
+			wantTitle: "3 selected files were left out of the analysis",
+			wantLines: []string{"data/dump.sql: too large", "bin/tool: binary content", "main.go: could not be fetched"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issue := SkippedFilesIssue(tt.skipped)
+			if issue.Severity != SeverityInfo || issue.Category != CategoryOther {
+				t.Errorf("severity/category = %s/%s, want %s/%s", issue.Severity, issue.Category, SeverityInfo, CategoryOther)
+			}
+			if issue.Title != tt.wantTitle {
+				t.Errorf("Title = %q, want %q", issue.Title, tt.wantTitle)
+			}
+			if issue.File != tt.wantFile {
+				t.Errorf("File = %q, want %q", issue.File, tt.wantFile)
+			}
+			if got := strings.Split(issue.Description, "\n"); strings.Join(got, "|") != strings.Join(tt.wantLines, "|") {
+				t.Errorf("Description lines = %q, want %q", got, tt.wantLines)
+			}
+
+			summary := &AnalysisSummary{}
+			summary.Recompute([]Issue{issue})
+			if summary.IssuesBySeverity[string(SeverityInfo)] != 1 {
+				t.Errorf("IssuesBySeverity = %v, want one INFO issue", summary.IssuesBySeverity)
+			}
+		})
+	}
+}
+
+func TestRecomputeCountsCritical(t *testing.T) {
+	var summary AnalysisSummary
+	summary.OmittedBySeverity = map[string]int{string(SeverityCritical): 1}
+	summary.Recompute([]Issue{
+		{Title: "Exposed secret", Severity: SeverityCritical, Category: CategorySecurity},
+		{Title: "SQL injection", Severity: SeverityHigh, Category: CategorySecurity},
+	})
+
+	if got := summary.IssuesBySeverity[string(SeverityCritical)]; got != 2 {
+		t.Errorf("critical issues = %d, want 2 including the omitted one", got)
+	}
+	if summary.TotalIssues != 3 {
+		t.Errorf("TotalIssues = %d, want 3", summary.TotalIssues)
+	}
+	// 100 - 2 critical * 20 - 1 high * 10
+	if summary.OverallScore != 50 {
+		t.Errorf("OverallScore = %d, want 50", summary.OverallScore)
+	}
+}
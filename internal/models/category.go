@@ -0,0 +1,126 @@
+package models
+
+import "strings"
+
+// Issue categories. The AI is asked for one of these, and anything else it
+// returns is mapped onto them by NormalizeCategory.
+const (
+	CategorySecurity        = "security"
+	CategoryPerformance     = "performance"
+	CategoryMaintainability = "maintainability"
+	CategoryReliability     = "reliability"
+	CategoryStyle           = "style"
+	CategoryDependency      = "dependency"
+	CategorySecret          = "secret" // hardcoded credentials and keys
+	CategoryOther           = "other"
+)
+
+// Categories lists every canonical category except CategoryOther.
+var Categories = []string{
+	CategorySecurity,
+	CategoryPerformance,
+	CategoryMaintainability,
+	CategoryReliability,
+	CategoryStyle,
+	CategoryDependency,
+	CategorySecret,
+}
+
+// categoryAliases maps other spellings seen in AI output (and in analyses
+// stored before categories were normalized) to a category.
+var categoryAliases = map[string]string{
+	"sec":            CategorySecurity,
+	"vulnerability":  CategorySecurity,
+	"vuln":           CategorySecurity,
+	"auth":           CategorySecurity,
+	"authentication": CategorySecurity,
+	"authorization":  CategorySecurity,
+	"injection":      CategorySecurity,
+	"xss":            CategorySecurity,
+	"csrf":           CategorySecurity,
+
+	"perf":         CategoryPerformance,
+	"speed":        CategoryPerformance,
+	"efficiency":   CategoryPerformance,
+	"memory":       CategoryPerformance,
+	"optimization": CategoryPerformance,
+
+	"quality":        CategoryMaintainability,
+	"code quality":   CategoryMaintainability,
+	"maintenance":    CategoryMaintainability,
+	"readability":    CategoryMaintainability,
+	"complexity":     CategoryMaintainability,
+	"design":         CategoryMaintainability,
+	"architecture":   CategoryMaintainability,
+	"refactoring":    CategoryMaintainability,
+	"documentation":  CategoryMaintainability,
+	"docs":           CategoryMaintainability,
+	"best practice":  CategoryMaintainability,
+	"best practices": CategoryMaintainability,
+
+	"bug":            CategoryReliability,
+	"bugs":           CategoryReliability,
+	"error":          CategoryReliability,
+	"errors":         CategoryReliability,
+	"error handling": CategoryReliability,
+	"correctness":    CategoryReliability,
+	"logic":          CategoryReliability,
+	"crash":          CategoryReliability,
+	"robustness":     CategoryReliability,
+	"concurrency":    CategoryReliability,
+	"race condition": CategoryReliability,
+
+	"formatting":  CategoryStyle,
+	"naming":      CategoryStyle,
+	"convention":  CategoryStyle,
+	"conventions": CategoryStyle,
+	"lint":        CategoryStyle,
+	"code style":  CategoryStyle,
+
+	"dependencies":          CategoryDependency,
+	"deps":                  CategoryDependency,
+	"supply chain":          CategoryDependency,
+	"package":               CategoryDependency,
+	"packages":              CategoryDependency,
+	"library":               CategoryDependency,
+	"libraries":             CategoryDependency,
+	"outdated":              CategoryDependency,
+	"vulnerable dependency": CategoryDependency,
+
+	"secrets":          CategorySecret,
+	"credential":       CategorySecret,
+	"credentials":      CategorySecret,
+	"hardcoded secret": CategorySecret,
+	"api key":          CategorySecret,
+	"password":         CategorySecret,
+}
+
+// NormalizeCategory maps a category in any case or common spelling, e.g.
+// "Security", "sec" or "code_quality", to a canonical category. Unknown
+// categories become CategoryOther.
+func NormalizeCategory(s string) string {
+	if category, ok := LookupCategory(s); ok {
+		return category
+	}
+	return CategoryOther
+}
+
+// LookupCategory is NormalizeCategory for input that must name a category,
+// such as a filter: ok is false for unknown categories instead of mapping
+// them to CategoryOther, though "other" itself is known.
+func LookupCategory(s string) (category string, ok bool) {
+	normalized := strings.ToLower(s)
+	normalized = strings.NewReplacer("_", " ", "-", " ").Replace(normalized)
+	normalized = strings.Join(strings.Fields(normalized), " ")
+
+	if normalized == CategoryOther {
+		return CategoryOther, true
+	}
+	for _, category := range Categories {
+		if normalized == category {
+			return category, true
+		}
+	}
+	category, ok = categoryAliases[normalized]
+	return category, ok
+}
@@ -0,0 +1,41 @@
+package models
+
+import "testing"
+
+func TestLookupCategory(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"security", CategorySecurity, true},
+		{"Security", CategorySecurity, true},
+		{"  PERFORMANCE ", CategoryPerformance, true},
+		{"code_quality", CategoryMaintainability, true},
+		{"hardcoded-secret", CategorySecret, true},
+		{"Vulnerable  Dependency", CategoryDependency, true},
+		{"other", CategoryOther, true},
+		{"Other", CategoryOther, true},
+		{"", "", false},
+		{"testing", "", false},
+		{"securityy", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := LookupCategory(tt.in)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("LookupCategory(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+
+			// NormalizeCategory agrees, with unknown categories as other
+			want := tt.want
+			if !tt.wantOK {
+				want = CategoryOther
+			}
+			if got := NormalizeCategory(tt.in); got != want {
+				t.Errorf("NormalizeCategory(%q) = %q, want %q", tt.in, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// LanguageOtherThreshold is the share (in percent) below which a language is
+// folded into the "Other" bucket by LanguagePercentages.
+const LanguageOtherThreshold = 2.0
+
+// LanguageStat is one slice of the language breakdown chart.
+type LanguageStat struct {
+	Language string  `json:"language"`
+	Files    int     `json:"files"`
+	Percent  float64 `json:"percent"`
+}
+
+// LanguagePercentages returns the language breakdown sorted by file count,
+// with each language's share of the total. Languages under
+// LanguageOtherThreshold percent are combined into a trailing "Other" entry.
+func (cs *CodeStructure) LanguagePercentages() []LanguageStat {
+	if cs == nil || len(cs.LanguageBreakdown) == 0 {
+		return []LanguageStat{}
+	}
+
+	total := 0
+	for _, count := range cs.LanguageBreakdown {
+		total += count
+	}
+	if total == 0 {
+		return []LanguageStat{}
+	}
+
+	stats := make([]LanguageStat, 0, len(cs.LanguageBreakdown))
+	other := LanguageStat{Language: "Other"}
+	for lang, count := range cs.LanguageBreakdown {
+		percent := float64(count) * 100 / float64(total)
+		if percent < LanguageOtherThreshold {
+			other.Files += count
+			other.Percent += percent
+			continue
+		}
+		stats = append(stats, LanguageStat{Language: lang, Files: count, Percent: percent})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Files != stats[j].Files {
+			return stats[i].Files > stats[j].Files
+		}
+		return stats[i].Language < stats[j].Language
+	})
+
+	if other.Files > 0 {
+		stats = append(stats, other)
+	}
+
+	return stats
+}
+
+// Testing maturity levels reported by TestMaturity.
+const (
+	TestMaturityNone     = "none"
+	TestMaturityLow      = "low"
+	TestMaturityModerate = "moderate"
+	TestMaturityGood     = "good"
+)
+
+// testDirs are directory names that hold tests in common layouts, e.g.
+// Maven's src/test, Rust's tests and Jest's __tests__.
+var testDirs = map[string]bool{
+	"test": true, "tests": true, "__tests__": true, "spec": true, "specs": true,
+}
+
+// IsTestPath reports whether path is a test file under the common layout of
+// its language: Go's _test.go, Python's test_*.py, JavaScript's .test.js and
+// .spec.js, Ruby's _spec.rb, JUnit-style FooTest.java, or any file under a
+// test directory.
+func IsTestPath(filePath string) bool {
+	dir, name := splitPath(strings.Trim(filePath, "/"))
+	lower := strings.ToLower(name)
+
+	if strings.Contains(lower, "_test.") || strings.Contains(lower, ".test.") ||
+		strings.Contains(lower, ".spec.") || strings.Contains(lower, "_spec.") ||
+		strings.HasPrefix(lower, "test_") || lower == "conftest.py" {
+		return true
+	}
+
+	// FooTest.java, FooTests.cs, FooSpec.scala; case matters so "latest.kt"
+	// isn't a test
+	base := strings.TrimSuffix(name, path.Ext(name))
+	if strings.HasSuffix(base, "Test") || strings.HasSuffix(base, "Tests") || strings.HasSuffix(base, "Spec") {
+		return true
+	}
+
+	for _, segment := range strings.Split(strings.ToLower(dir), "/") {
+		if testDirs[segment] {
+			return true
+		}
+	}
+	return false
+}
+
+// TestRatio returns the number of test files per source file. ok is false
+// when no source files were counted.
+func (cs *CodeStructure) TestRatio() (ratio float64, ok bool) {
+	if cs == nil || cs.SourceFiles == 0 {
+		return 0, false
+	}
+	return float64(cs.TestFiles) / float64(cs.SourceFiles), true
+}
+
+// TestRatioPercent returns TestRatio as a whole percentage, for display.
+func (cs *CodeStructure) TestRatioPercent() int {
+	ratio, _ := cs.TestRatio()
+	return int(ratio*100 + 0.5)
+}
+
+// TestMaturity classifies the test-to-source ratio, or returns "" when no
+// source files were counted. The thresholds are a rough signal: a ratio of
+// one test file per two source files counts as good.
+func (cs *CodeStructure) TestMaturity() string {
+	ratio, ok := cs.TestRatio()
+	switch {
+	case !ok:
+		return ""
+	case cs.TestFiles == 0:
+		return TestMaturityNone
+	case ratio < 0.2:
+		return TestMaturityLow
+	case ratio < 0.5:
+		return TestMaturityModerate
+	default:
+		return TestMaturityGood
+	}
+}
+
+// TreeNode is a nested directory/file node built from a CodeStructure.
+type TreeNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Type     string      `json:"type"` // "dir" or "file"
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// ToTree builds a nested tree from the flat directory and file lists.
+// The root node has an empty name and path. Children are ordered with
+// directories first, then alphabetically by name.
+func (cs *CodeStructure) ToTree() *TreeNode {
+	root := &TreeNode{Type: "dir"}
+	if cs == nil {
+		return root
+	}
+
+	// Index of directory path -> node so intermediate dirs are created once
+	dirs := map[string]*TreeNode{"": root}
+
+	var ensureDir func(path string) *TreeNode
+	ensureDir = func(path string) *TreeNode {
+		if node, ok := dirs[path]; ok {
+			return node
+		}
+		parentPath, name := splitPath(path)
+		parent := ensureDir(parentPath)
+		node := &TreeNode{Name: name, Path: path, Type: "dir"}
+		parent.Children = append(parent.Children, node)
+		dirs[path] = node
+		return node
+	}
+
+	for _, dir := range cs.Directories {
+		ensureDir(strings.Trim(dir, "/"))
+	}
+
+	for _, file := range cs.Files {
+		file = strings.Trim(file, "/")
+		if file == "" {
+			continue
+		}
+		parentPath, name := splitPath(file)
+		parent := ensureDir(parentPath)
+		parent.Children = append(parent.Children, &TreeNode{Name: name, Path: file, Type: "file"})
+	}
+
+	sortTree(root)
+	return root
+}
+
+// splitPath splits "a/b/c" into ("a/b", "c").
+func splitPath(path string) (parent, name string) {
+	idx := strings.LastIndex(path, "/")
+	if idx == -1 {
+		return "", path
+	}
+	return path[:idx], path[idx+1:]
+}
+
+func sortTree(node *TreeNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.Type != b.Type {
+			return a.Type == "dir"
+		}
+		return a.Name < b.Name
+	})
+	for _, child := range node.Children {
+		if child.Type == "dir" {
+			sortTree(child)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import "testing"
+
+func TestIsTestPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"internal/models/user_test.go", true},
+		{"pkg/test_parser.py", true},
+		{"conftest.py", true},
+		{"src/app.test.js", true},
+		{"src/app.spec.ts", true},
+		{"spec/models/user_spec.rb", true},
+		{"src/test/java/com/acme/UserTest.java", true},
+		{"Acme.Tests/UserTests.cs", true},
+		{"tests/integration.rs", true},
+		{"web/__tests__/App.jsx", true},
+		{"internal/models/user.go", false},
+		{"src/latest.kt", false},
+		{"src/contest.py", false},
+		{"testdata.go", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := IsTestPath(tt.path); got != tt.want {
+				t.Errorf("IsTestPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestRatioAndMaturity(t *testing.T) {
+	tests := []struct {
+		name         string
+		cs           *CodeStructure
+		wantOK       bool
+		wantPercent  int
+		wantMaturity string
+	}{
+		{"nil structure", nil, false, 0, ""},
+		{"no source files", &CodeStructure{TestFiles: 3}, false, 0, ""},
+		{"no tests", &CodeStructure{SourceFiles: 10}, true, 0, TestMaturityNone},
+		{"low", &CodeStructure{SourceFiles: 20, TestFiles: 3}, true, 15, TestMaturityLow},
+		{"moderate at 20%", &CodeStructure{SourceFiles: 10, TestFiles: 2}, true, 20, TestMaturityModerate},
+		{"good at 50%", &CodeStructure{SourceFiles: 10, TestFiles: 5}, true, 50, TestMaturityGood},
+		{"more tests than sources", &CodeStructure{SourceFiles: 4, TestFiles: 6}, true, 150, TestMaturityGood},
+		{"rounds to whole percent", &CodeStructure{SourceFiles: 3, TestFiles: 1}, true, 33, TestMaturityModerate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.cs.TestRatio(); ok != tt.wantOK {
+				t.Errorf("TestRatio ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got := tt.cs.TestRatioPercent(); got != tt.wantPercent {
+				t.Errorf("TestRatioPercent = %d, want %d", got, tt.wantPercent)
+			}
+			if got := tt.cs.TestMaturity(); got != tt.wantMaturity {
+				t.Errorf("TestMaturity = %q, want %q", got, tt.wantMaturity)
+			}
+		})
+	}
+}
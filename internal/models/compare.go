@@ -0,0 +1,49 @@
+package models
+
+import "strings"
+
+// IssueDiff lists how the issues of two analyses differ.
+type IssueDiff struct {
+	New       []Issue `json:"new"`       // only in the head analysis
+	Resolved  []Issue `json:"resolved"`  // only in the base analysis
+	Unchanged []Issue `json:"unchanged"` // in both, as reported by the head
+}
+
+// issueKey identifies an issue across analyses. Lines aren't part of it:
+// they shift whenever code above the issue changes.
+func issueKey(issue Issue) string {
+	title := strings.Join(strings.Fields(strings.ToLower(issue.Title)), " ")
+	return NormalizeCategory(issue.Category) + "\x00" + issue.File + "\x00" + title
+}
+
+// DiffIssues compares the issues found in base with those found in head.
+// Issues match on category, file and title; a key reported n times in base
+// matches at most n issues in head.
+func DiffIssues(base, head []Issue) IssueDiff {
+	diff := IssueDiff{New: []Issue{}, Resolved: []Issue{}, Unchanged: []Issue{}}
+
+	remaining := make(map[string]int, len(base))
+	for _, issue := range base {
+		remaining[issueKey(issue)]++
+	}
+
+	for _, issue := range head {
+		key := issueKey(issue)
+		if remaining[key] > 0 {
+			remaining[key]--
+			diff.Unchanged = append(diff.Unchanged, issue)
+			continue
+		}
+		diff.New = append(diff.New, issue)
+	}
+
+	for _, issue := range base {
+		key := issueKey(issue)
+		if remaining[key] > 0 {
+			remaining[key]--
+			diff.Resolved = append(diff.Resolved, issue)
+		}
+	}
+
+	return diff
+}
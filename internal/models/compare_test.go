@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDiffIssues(t *testing.T) {
+	issue := func(category, file, title string, line int) Issue {
+		return Issue{Category: category, File: file, Title: title, Line: line}
+	}
+	titles := func(issues []Issue) []string {
+		out := []string{}
+		for _, i := range issues {
+			out = append(out, i.Title)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name                                 string
+		base, head                           []Issue
+		wantNew, wantResolved, wantUnchanged []string
+	}{
+		{
+			name:          "no issues",
+			wantNew:       []string{},
+			wantResolved:  []string{},
+			wantUnchanged: []string{},
+		},
+		{
+			name:          "new, resolved and unchanged",
+			base:          []Issue{issue("security", "a.go", "SQL injection", 1), issue("performance", "b.go", "N+1 query", 2)},
+			head:          []Issue{issue("security", "a.go", "SQL injection", 1), issue("testing", "c.go", "No tests", 3)},
+			wantNew:       []string{"No tests"},
+			wantResolved:  []string{"N+1 query"},
+			wantUnchanged: []string{"SQL injection"},
+		},
+		{
+			name:          "moved lines, title case and category spelling still match",
+			base:          []Issue{issue("Security", "a.go", "SQL  Injection", 10)},
+			head:          []Issue{issue("sec", "a.go", "sql injection", 42)},
+			wantNew:       []string{},
+			wantResolved:  []string{},
+			wantUnchanged: []string{"sql injection"},
+		},
+		{
+			name:          "same title in another file is new",
+			base:          []Issue{issue("security", "a.go", "Hardcoded secret", 1)},
+			head:          []Issue{issue("security", "b.go", "Hardcoded secret", 1)},
+			wantNew:       []string{"Hardcoded secret"},
+			wantResolved:  []string{"Hardcoded secret"},
+			wantUnchanged: []string{},
+		},
+		{
+			name:          "repeats match one for one",
+			base:          []Issue{issue("security", "a.go", "Unchecked input", 1), issue("security", "a.go", "Unchecked input", 9)},
+			head:          []Issue{issue("security", "a.go", "Unchecked input", 1)},
+			wantNew:       []string{},
+			wantResolved:  []string{"Unchecked input"},
+			wantUnchanged: []string{"Unchecked input"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffIssues(tt.base, tt.head)
+			if got := titles(diff.New); !reflect.DeepEqual(got, tt.wantNew) {
+				t.Errorf("New = %q, want %q", got, tt.wantNew)
+			}
+			if got := titles(diff.Resolved); !reflect.DeepEqual(got, tt.wantResolved) {
+				t.Errorf("Resolved = %q, want %q", got, tt.wantResolved)
+			}
+			if got := titles(diff.Unchanged); !reflect.DeepEqual(got, tt.wantUnchanged) {
+				t.Errorf("Unchanged = %q, want %q", got, tt.wantUnchanged)
+			}
+		})
+	}
+}
+
+func TestLinkComparison(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+	user := newTestUser(t, pool, "compare@example.com", 100000)
+
+	var ids []int64
+	for i := 0; i < 2; i++ {
+		repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+		_, analysis, reused, err := s.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{ReserveTokens: 5000})
+		if err != nil {
+			t.Fatalf("CreateWithRepository: %v", err)
+		}
+		if reused {
+			t.Fatal("comparison analysis was reused")
+		}
+		ids = append(ids, analysis.ID)
+	}
+	if ids[0] == ids[1] {
+		t.Fatalf("both refs got analysis %d", ids[0])
+	}
+
+	if err := s.LinkComparison(ctx, ids[0], ids[1], "main", "feature"); err != nil {
+		t.Fatalf("LinkComparison: %v", err)
+	}
+
+	base, err := s.ByID(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("ByID base: %v", err)
+	}
+	head, err := s.ByID(ctx, ids[1])
+	if err != nil {
+		t.Fatalf("ByID head: %v", err)
+	}
+	if base.RequestedRef == nil || *base.RequestedRef != "main" || base.CompareBaseID != nil {
+		t.Errorf("base ref %v, base id %v; want main and none", base.RequestedRef, base.CompareBaseID)
+	}
+	if head.RequestedRef == nil || *head.RequestedRef != "feature" || head.CompareBaseID == nil || *head.CompareBaseID != ids[0] {
+		t.Errorf("head ref %v, base id %v; want feature and %d", head.RequestedRef, head.CompareBaseID, ids[0])
+	}
+}
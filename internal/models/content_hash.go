@@ -0,0 +1,78 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// FileHash identifies the content of one analyzed file without storing it.
+type FileHash struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"` // hex SHA-256 of the content
+	Size int    `json:"size"`
+}
+
+// HashFiles returns the content hash of each file, sorted by path so the
+// result doesn't depend on the order files were fetched in.
+func HashFiles(files []FileContent) []FileHash {
+	hashes := make([]FileHash, 0, len(files))
+	for _, file := range files {
+		sum := sha256.Sum256([]byte(file.Content))
+		hashes = append(hashes, FileHash{
+			Path: file.Path,
+			Hash: hex.EncodeToString(sum[:]),
+			Size: len(file.Content),
+		})
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].Path < hashes[j].Path })
+	return hashes
+}
+
+// TreeHash combines sorted file hashes into one hash of the whole set. It
+// changes when any file is added, removed, renamed or edited.
+func TreeHash(hashes []FileHash) string {
+	h := sha256.New()
+	for _, fh := range hashes {
+		h.Write([]byte(fh.Path))
+		h.Write([]byte{0})
+		h.Write([]byte(fh.Hash))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FileDrift lists how the analyzed files differ between two analyses.
+type FileDrift struct {
+	Unchanged bool     `json:"unchanged"`
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Changed   []string `json:"changed"`
+}
+
+// CompareFileHashes reports the files added, removed and changed going from
+// before to after. Both must be sorted by path, as HashFiles returns them.
+func CompareFileHashes(before, after []FileHash) FileDrift {
+	drift := FileDrift{Added: []string{}, Removed: []string{}, Changed: []string{}}
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case j == len(after) || i < len(before) && before[i].Path < after[j].Path:
+			drift.Removed = append(drift.Removed, before[i].Path)
+			i++
+		case i == len(before) || after[j].Path < before[i].Path:
+			drift.Added = append(drift.Added, after[j].Path)
+			j++
+		default:
+			if before[i].Hash != after[j].Hash {
+				drift.Changed = append(drift.Changed, after[j].Path)
+			}
+			i++
+			j++
+		}
+	}
+
+	drift.Unchanged = len(drift.Added) == 0 && len(drift.Removed) == 0 && len(drift.Changed) == 0
+	return drift
+}
@@ -5,9 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"io/fs"
+	"log"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib" // Register pgx driver for database/sql
 	"github.com/pressly/goose/v3"
@@ -31,6 +33,11 @@ type DatabaseConfig struct {
 	MinConns        int32
 	MaxConnLifetime time.Duration
 	MaxConnIdleTime time.Duration
+
+	// ConnectTimeout is how long NewDatabase keeps retrying a database that
+	// isn't reachable yet, e.g. still starting next to the app. Zero tries
+	// once.
+	ConnectTimeout time.Duration
 }
 
 func DefaultDatabaseConfig(url string) DatabaseConfig {
@@ -62,8 +69,8 @@ func NewDatabase(ctx context.Context, cfg DatabaseConfig) (*Database, error) {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
 	}
 
-	// Verify connectivity
-	if err := pool.Ping(ctx); err != nil {
+	// Verify connectivity, waiting for a database that is still starting
+	if err := pingWithRetry(ctx, pool.Ping, cfg.ConnectTimeout); err != nil {
 		pool.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
@@ -78,6 +85,50 @@ func NewDatabase(ctx context.Context, cfg DatabaseConfig) (*Database, error) {
 	return &Database{Pool: pool, DB: sqlDB}, nil
 }
 
+const (
+	// pingAttemptTimeout bounds each startup ping, so a database that
+	// accepts connections but doesn't answer can't use up the whole wait.
+	pingAttemptTimeout = 5 * time.Second
+	// pingInitialBackoff and pingMaxBackoff bound the wait between startup
+	// pings; it doubles after each failed attempt.
+	pingInitialBackoff = 500 * time.Millisecond
+	pingMaxBackoff     = 5 * time.Second
+)
+
+// pingWithRetry calls ping until it succeeds, backing off between attempts,
+// for at most timeout. A zero timeout pings once. Returns the last ping
+// error once the time is up or ctx is done.
+func pingWithRetry(ctx context.Context, ping func(context.Context) error, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := pingInitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, pingAttemptTimeout)
+		err := ping(attemptCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("Database ready after %d attempts", attempt)
+			}
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return err
+		}
+		wait := min(backoff, remaining).Round(time.Millisecond)
+		log.Printf("Database not ready (attempt %d), retrying in %s: %v", attempt, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, pingMaxBackoff)
+	}
+}
+
 // Close should be called while shutting down db connection- via defer
 func (db *Database) Close() {
 	db.Pool.Close()
@@ -106,6 +157,13 @@ func (db *Database) BeginTx(ctx context.Context) (pgx.Tx, error) {
 	return db.Pool.Begin(ctx)
 }
 
+// querier is implemented by both the pool and a transaction, so statements
+// can run on their own or as part of a larger transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // QueryTimeout is the default timeout for database queries.
 // Individual queries can override this with their own context timeout.
 const QueryTimeout = 10 * time.Second
@@ -163,3 +221,41 @@ func MigrateFS(db *sql.DB, migrationFS fs.FS, dir string) error {
 	}()
 	return Migrate(db, dir)
 }
+
+// MigrationInfo describes a single migration and whether it has been applied.
+type MigrationInfo struct {
+	Version   int64      `json:"version"`
+	Source    string     `json:"source"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// MigrationStatus reports the state of every migration in migrationFS
+// against the database, ordered by version.
+func MigrationStatus(ctx context.Context, db *sql.DB, migrationFS fs.FS) ([]MigrationInfo, error) {
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrationFS)
+	if err != nil {
+		return nil, fmt.Errorf("migration status: %w", err)
+	}
+
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migration status: %w", err)
+	}
+
+	infos := make([]MigrationInfo, 0, len(statuses))
+	for _, st := range statuses {
+		info := MigrationInfo{
+			Version: st.Source.Version,
+			Source:  st.Source.Path,
+			Applied: st.State == goose.StateApplied,
+		}
+		if info.Applied && !st.AppliedAt.IsZero() {
+			appliedAt := st.AppliedAt
+			info.AppliedAt = &appliedAt
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPingWithRetry(t *testing.T) {
+	errDown := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		failures  int // pings failing before one succeeds; -1 never succeeds
+		timeout   time.Duration
+		cancel    bool // ctx is done before the first retry
+		wantErr   bool
+		wantPings int // 0 checks only that it retried
+	}{
+		{name: "up straight away", failures: 0, timeout: time.Second, wantPings: 1},
+		{name: "up after two failures", failures: 2, timeout: 10 * time.Second, wantPings: 3},
+		{name: "zero timeout pings once", failures: -1, wantErr: true, wantPings: 1},
+		{name: "down for the whole timeout", failures: -1, timeout: 700 * time.Millisecond, wantErr: true},
+		{name: "context done", failures: -1, timeout: 10 * time.Second, cancel: true, wantErr: true, wantPings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pings := 0
+			ping := func(ctx context.Context) error {
+				pings++
+				if tt.cancel {
+					cancel()
+				}
+				if tt.failures < 0 || pings <= tt.failures {
+					return errDown
+				}
+				return nil
+			}
+
+			err := pingWithRetry(ctx, ping, tt.timeout)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("pingWithRetry = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errDown) {
+				t.Errorf("pingWithRetry = %v, want the last ping error", err)
+			}
+			switch {
+			case tt.wantPings > 0 && pings != tt.wantPings:
+				t.Errorf("pinged %d times, want %d", pings, tt.wantPings)
+			case tt.wantPings == 0 && pings < 2:
+				t.Errorf("pinged %d times, want retries until the timeout", pings)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// emailDomainCheckTimeout bounds the DNS lookups done at signup so a slow
+// resolver can't stall registration.
+const emailDomainCheckTimeout = 3 * time.Second
+
+// DomainResolver looks up the DNS records used to tell whether an email
+// domain can receive mail. *net.Resolver satisfies it.
+type DomainResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// EnableEmailDomainCheck makes Create reject emails whose domain has no MX or
+// address records. Pass nil to turn the check off.
+func (s *UserService) EnableEmailDomainCheck(resolver DomainResolver) {
+	s.domainResolver = resolver
+}
+
+// emailDomainResolves reports whether domain can receive mail. Only an
+// authoritative "no such host" answer counts as unresolvable; timeouts and
+// other DNS failures return true so signups fall back to the syntax check.
+func emailDomainResolves(ctx context.Context, resolver DomainResolver, domain string) bool {
+	ctx, cancel := context.WithTimeout(ctx, emailDomainCheckTimeout)
+	defer cancel()
+
+	mx, err := resolver.LookupMX(ctx, domain)
+	if err == nil && len(mx) > 0 {
+		return true
+	}
+	if err != nil && !isDNSNotFound(err) {
+		return true
+	}
+
+	// Without MX records mail goes to the domain's A/AAAA address (RFC 5321)
+	_, err = resolver.LookupHost(ctx, domain)
+	if err != nil && isDNSNotFound(err) {
+		return false
+	}
+	return true
+}
+
+// isDNSNotFound reports whether err says the name doesn't exist.
+func isDNSNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
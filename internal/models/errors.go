@@ -3,15 +3,35 @@ package models
 import (
 	"errors"
 	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// pgUniqueViolation is the PostgreSQL SQLSTATE for unique constraint violations.
+const pgUniqueViolation = "23505"
+
 // User related errors
 var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrEmailAlreadyExists = errors.New("email already exists")
 	ErrInvalidCredentials = errors.New("invalid email or password")
 	ErrInvalidEmail       = errors.New("invalid email format")
+	ErrEmailDomainInvalid = errors.New("email domain does not accept mail")
 	ErrPasswordTooShort   = errors.New("password must be at least 8 characters")
+	ErrInvalidQuotaLimit  = errors.New("quota limit must not be negative")
+	ErrQuotaExceeded      = errors.New("API quota exceeded")
+)
+
+// Preference related errors
+var (
+	ErrInvalidMaxFiles      = errors.New("invalid max files")
+	ErrInvalidScoringConfig = errors.New("invalid scoring profile")
+)
+
+// Invite related errors
+var (
+	ErrInviteCodeInvalid = errors.New("invite code is invalid")
+	ErrInviteCodeUsed    = errors.New("invite code has already been used")
 )
 
 // Session related errors
@@ -30,8 +50,27 @@ var (
 // Analysis related errors
 var (
 	ErrAnalysisNotFound = errors.New("analysis not found")
+	// ErrAnalysisNotRunning is returned when an analysis is no longer in the
+	// state an operation needs, e.g. it was cancelled or already finished.
+	ErrAnalysisNotRunning = errors.New("analysis is not pending or processing")
+	// ErrTooManyInFlight is returned when a user already has the maximum
+	// number of analyses pending or processing.
+	ErrTooManyInFlight = errors.New("too many analyses in progress")
+	// ErrIssueAlreadyFiled is returned when an analysis issue was already
+	// filed as a GitHub issue, or is being filed.
+	ErrIssueAlreadyFiled = errors.New("issue already filed on GitHub")
+	// ErrIssueNotFound is returned when an analysis has no issue with the
+	// given number.
+	ErrIssueNotFound = errors.New("issue not found")
 )
 
+// isUniqueViolation reports whether err is (or wraps) a PostgreSQL unique
+// constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
+
 type FileError struct {
 	Issue string
 }
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestUniqueViolationMapping(t *testing.T) {
+	unique := &pgconn.PgError{Code: pgUniqueViolation, Message: `duplicate key value violates unique constraint "users_email_key"`}
+	foreignKey := &pgconn.PgError{Code: "23503", Message: "insert or update violates foreign key constraint"}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantTyped bool
+	}{
+		{"unique violation", unique, true},
+		{"wrapped unique violation", fmt.Errorf("scan: %w", unique), true},
+		{"other constraint", foreignKey, false},
+		// Only the SQLSTATE counts, not the message
+		{"message without a code", errors.New(`duplicate key value violates unique constraint "users_email_key"`), false},
+	}
+
+	mappings := []struct {
+		name  string
+		fn    func(error) error
+		typed error
+	}{
+		{"users", createUserError, ErrEmailAlreadyExists},
+		{"repositories", upsertRepositoryError, ErrRepositoryAlreadyExists},
+	}
+
+	for _, m := range mappings {
+		for _, tt := range tests {
+			t.Run(m.name+"/"+tt.name, func(t *testing.T) {
+				err := m.fn(tt.err)
+				if got := errors.Is(err, m.typed); got != tt.wantTyped {
+					t.Fatalf("errors.Is(%v, %v) = %v, want %v", err, m.typed, got, tt.wantTyped)
+				}
+				if !tt.wantTyped && !errors.Is(err, tt.err) {
+					t.Errorf("error %v doesn't wrap %v", err, tt.err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// issueFilingTimeout is how long a claim to file an issue holds without
+// being recorded as filed. After it, the filing is assumed to have crashed
+// and the issue can be claimed again.
+const issueFilingTimeout = 5 * time.Minute
+
+// FiledIssue is an analysis issue filed as a GitHub issue. GitHubNumber and
+// GitHubURL are nil while it is being filed.
+type FiledIssue struct {
+	AnalysisID   int64
+	IssueNumber  int // position of the issue in the analysis, from 1
+	GitHubNumber *int
+	GitHubURL    *string
+	CreatedAt    time.Time
+}
+
+// ClaimIssueFiling claims issue number issueNumber of an analysis for
+// filing, so it is filed at most once, returning nil once claimed. If it
+// was already filed, or another request is filing it, the existing record
+// is returned with ErrIssueAlreadyFiled. A claim is released with ReleaseIssueFiling if the
+// filing fails, and completed with RecordIssueFiled.
+func (s *AnalysisService) ClaimIssueFiling(ctx context.Context, analysisID int64, issueNumber int) (*FiledIssue, error) {
+	query := `
+		INSERT INTO filed_github_issues (analysis_id, issue_number)
+		VALUES ($1, $2)
+		ON CONFLICT (analysis_id, issue_number) DO UPDATE SET created_at = NOW()
+		WHERE filed_github_issues.github_number IS NULL AND filed_github_issues.created_at < $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, query, analysisID, issueNumber, time.Now().Add(-issueFilingTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim issue filing: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil, nil
+	}
+
+	filed := &FiledIssue{AnalysisID: analysisID, IssueNumber: issueNumber}
+	err = s.pool.QueryRow(ctx, `
+		SELECT github_number, github_url, created_at
+		FROM filed_github_issues
+		WHERE analysis_id = $1 AND issue_number = $2
+	`, analysisID, issueNumber).Scan(&filed.GitHubNumber, &filed.GitHubURL, &filed.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Released between the insert and the select
+		return nil, ErrIssueAlreadyFiled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load filed issue: %w", err)
+	}
+	return filed, ErrIssueAlreadyFiled
+}
+
+// RecordIssueFiled completes a claim made with ClaimIssueFiling with the
+// GitHub issue that was opened.
+func (s *AnalysisService) RecordIssueFiled(ctx context.Context, analysisID int64, issueNumber, githubNumber int, githubURL string) error {
+	query := `
+		UPDATE filed_github_issues
+		SET github_number = $3, github_url = $4
+		WHERE analysis_id = $1 AND issue_number = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, analysisID, issueNumber, githubNumber, githubURL)
+	if err != nil {
+		return fmt.Errorf("failed to record filed issue: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseIssueFiling drops a claim made with ClaimIssueFiling whose filing
+// failed, so the issue can be filed again. Issues already filed are kept.
+func (s *AnalysisService) ReleaseIssueFiling(ctx context.Context, analysisID int64, issueNumber int) error {
+	query := `
+		DELETE FROM filed_github_issues
+		WHERE analysis_id = $1 AND issue_number = $2 AND github_number IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, analysisID, issueNumber)
+	if err != nil {
+		return fmt.Errorf("failed to release issue filing: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIssueFilingIsIdempotent(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses", "filed_github_issues")
+	user := newTestUser(t, pool, "filer@example.com", 1000)
+
+	repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+	_, analysis, _, err := s.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+	if err != nil {
+		t.Fatalf("CreateWithRepository: %v", err)
+	}
+
+	// Concurrent requests to file the same issue: one wins
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.ClaimIssueFiling(ctx, analysis.ID, 1)
+			if err != nil && !errors.Is(err, ErrIssueAlreadyFiled) {
+				t.Errorf("ClaimIssueFiling: %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Fatalf("%d claims succeeded, want 1", claimed)
+	}
+
+	// A failed filing can be retried
+	if err := s.ReleaseIssueFiling(ctx, analysis.ID, 1); err != nil {
+		t.Fatalf("ReleaseIssueFiling: %v", err)
+	}
+	if _, err := s.ClaimIssueFiling(ctx, analysis.ID, 1); err != nil {
+		t.Fatalf("claim after release: %v", err)
+	}
+
+	// A filed issue can't be filed again, even after the claim timeout
+	if err := s.RecordIssueFiled(ctx, analysis.ID, 1, 31, "https://github.com/acme/app/issues/31"); err != nil {
+		t.Fatalf("RecordIssueFiled: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `UPDATE filed_github_issues SET created_at = $1`, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("age claim: %v", err)
+	}
+	if err := s.ReleaseIssueFiling(ctx, analysis.ID, 1); err != nil {
+		t.Fatalf("ReleaseIssueFiling: %v", err)
+	}
+	filed, err := s.ClaimIssueFiling(ctx, analysis.ID, 1)
+	if !errors.Is(err, ErrIssueAlreadyFiled) {
+		t.Fatalf("claim of a filed issue = %v, want ErrIssueAlreadyFiled", err)
+	}
+	if filed == nil || filed.GitHubNumber == nil || *filed.GitHubNumber != 31 {
+		t.Errorf("filed issue = %+v, want GitHub issue 31", filed)
+	}
+
+	// Other issues of the analysis are independent
+	if _, err := s.ClaimIssueFiling(ctx, analysis.ID, 2); err != nil {
+		t.Errorf("claim of another issue: %v", err)
+	}
+}
+
+func TestIssueFilingStaleClaim(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	s := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses", "filed_github_issues")
+	user := newTestUser(t, pool, "stale@example.com", 1000)
+
+	repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+	_, analysis, _, err := s.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+	if err != nil {
+		t.Fatalf("CreateWithRepository: %v", err)
+	}
+
+	if _, err := s.ClaimIssueFiling(ctx, analysis.ID, 1); err != nil {
+		t.Fatalf("ClaimIssueFiling: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `UPDATE filed_github_issues SET created_at = $1`, time.Now().Add(-issueFilingTimeout-time.Minute)); err != nil {
+		t.Fatalf("age claim: %v", err)
+	}
+	if _, err := s.ClaimIssueFiling(ctx, analysis.ID, 1); err != nil {
+		t.Errorf("claim after a crashed filing = %v, want it claimed again", err)
+	}
+}
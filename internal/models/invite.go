@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// inviteCodeBytes is the random part of an invite code; 10 bytes encode to
+// 16 base32 characters.
+const inviteCodeBytes = 10
+
+// Invite is a single-use code that lets someone sign up while invites are
+// required.
+type Invite struct {
+	ID        int64      `json:"id"`
+	Code      string     `json:"code"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+type InviteService struct {
+	pool *pgxpool.Pool
+}
+
+func NewInviteService(pool *pgxpool.Pool) *InviteService {
+	return &InviteService{pool: pool}
+}
+
+// Create generates and stores a new unused invite code.
+func (s *InviteService) Create(ctx context.Context) (*Invite, error) {
+	b := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate invite code: %w", err)
+	}
+
+	invite := &Invite{Code: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)}
+
+	query := `
+		INSERT INTO invite_codes (code)
+		VALUES ($1)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	err := s.pool.QueryRow(ctx, query, invite.Code).Scan(&invite.ID, &invite.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invite code: %w", err)
+	}
+
+	return invite, nil
+}
+
+// Consume marks an invite code as used. It returns ErrInviteCodeInvalid if
+// the code doesn't exist and ErrInviteCodeUsed if it was already consumed.
+// Codes are matched case-insensitively, ignoring surrounding whitespace.
+func (s *InviteService) Consume(ctx context.Context, code string) error {
+	code = normalizeInviteCode(code)
+	if code == "" {
+		return ErrInviteCodeInvalid
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE invite_codes SET used_at = NOW()
+		WHERE code = $1 AND used_at IS NULL
+	`, code)
+	if err != nil {
+		return fmt.Errorf("failed to consume invite code: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	var exists bool
+	err = s.pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM invite_codes WHERE code = $1)`, code).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look up invite code: %w", err)
+	}
+	if exists {
+		return ErrInviteCodeUsed
+	}
+	return ErrInviteCodeInvalid
+}
+
+// Release makes a consumed invite code usable again, for when the signup it
+// was consumed for fails.
+func (s *InviteService) Release(ctx context.Context, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, `UPDATE invite_codes SET used_at = NULL WHERE code = $1`, normalizeInviteCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to release invite code: %w", err)
+	}
+	return nil
+}
+
+func normalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
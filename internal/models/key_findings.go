@@ -0,0 +1,113 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultMaxKeyFindings is how many key findings a summary keeps unless
+// configured otherwise.
+const DefaultMaxKeyFindings = 5
+
+// Where a summary's key findings came from.
+const (
+	KeyFindingsSourceAI     = "ai"
+	KeyFindingsSourceIssues = "issues"
+)
+
+// CapKeyFindings returns the first limit distinct findings, in order,
+// trimmed. Findings differing only in case, whitespace or trailing
+// punctuation are duplicates; empty ones are dropped.
+func CapKeyFindings(findings []string, limit int) []string {
+	capped := []string{}
+	seen := make(map[string]bool, len(findings))
+	for _, finding := range findings {
+		if len(capped) >= limit {
+			break
+		}
+		finding = strings.Join(strings.Fields(finding), " ")
+		key := strings.ToLower(strings.TrimRight(finding, ".!;:"))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		capped = append(capped, finding)
+	}
+	return capped
+}
+
+// KeyFindingsFromIssues derives up to limit key findings from the titles
+// of the most severe issues of medium severity or above, most severe first
+// and in their original order within a severity.
+func KeyFindingsFromIssues(issues []Issue, limit int) []string {
+	important := make([]Issue, 0, len(issues))
+	for _, issue := range issues {
+		if issue.Severity.Rank() <= SeverityMedium.Rank() {
+			important = append(important, issue)
+		}
+	}
+	sort.SliceStable(important, func(i, j int) bool {
+		return important[i].Severity.Rank() < important[j].Severity.Rank()
+	})
+
+	titles := make([]string, len(important))
+	for i, issue := range important {
+		titles[i] = issue.Title
+	}
+	return CapKeyFindings(titles, limit)
+}
+
+// SetAIKeyFindings replaces the key findings with the first distinct ones of
+// findings, as extracted from the AI response. Without any, the findings
+// derived from the issues are kept.
+func (s *AnalysisSummary) SetAIKeyFindings(findings []string) {
+	capped := CapKeyFindings(findings, s.keyFindingsLimit())
+	if len(capped) == 0 {
+		return
+	}
+	s.KeyFindings = capped
+	s.KeyFindingsSource = KeyFindingsSourceAI
+}
+
+// DropKeyFindingsAbout clears key findings from the AI that mention the
+// title of a resolved issue no remaining issue shares, so Recompute derives
+// them from the remaining issues instead. A merged duplicate leaves an issue
+// with the same title behind, which keeps the findings.
+func (s *AnalysisSummary) DropKeyFindingsAbout(resolved, remaining []Issue) {
+	if s.KeyFindingsSource != KeyFindingsSourceAI {
+		return
+	}
+
+	titles := make(map[string]bool, len(remaining))
+	for _, issue := range remaining {
+		titles[normalizeTitle(issue.Title)] = true
+	}
+
+	for _, issue := range resolved {
+		title := normalizeTitle(issue.Title)
+		if title == "" || titles[title] {
+			continue
+		}
+		for _, finding := range s.KeyFindings {
+			if strings.Contains(normalizeTitle(finding), title) {
+				s.KeyFindings = nil
+				s.KeyFindingsSource = ""
+				return
+			}
+		}
+	}
+}
+
+// normalizeTitle lowercases s and collapses its whitespace, for comparing
+// issue titles with key findings.
+func normalizeTitle(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// keyFindingsLimit is the most key findings the summary keeps.
+func (s *AnalysisSummary) keyFindingsLimit() int {
+	if s.MaxKeyFindings > 0 {
+		return s.MaxKeyFindings
+	}
+	return DefaultMaxKeyFindings
+}
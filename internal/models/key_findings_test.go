@@ -0,0 +1,138 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+var recomputeIssues = []Issue{
+	{Severity: SeverityCritical, Category: "security", Title: "SQL injection in search"},
+	{Severity: SeverityHigh, Category: "security", Title: "Hardcoded secret"},
+	{Severity: SeverityHigh, Category: "security", Title: "Hardcoded secret"},
+	{Severity: SeverityMedium, Category: "performance", Title: "N+1 query"},
+	{Severity: SeverityLow, Category: "style", Title: "Long function"},
+}
+
+func TestSummaryRecompute(t *testing.T) {
+	tests := []struct {
+		name         string
+		issues       []Issue
+		omitted      map[string]int
+		wantTotal    int
+		wantSeverity map[string]int
+		wantScore    int
+	}{
+		{
+			name:         "all issues",
+			issues:       recomputeIssues,
+			wantTotal:    5,
+			wantSeverity: map[string]int{"CRITICAL": 1, "HIGH": 2, "MEDIUM": 1, "LOW": 1},
+			wantScore:    100 - 20 - 2*10 - 5 - 3,
+		},
+		{
+			name:         "after resolving the critical issue and a duplicate",
+			issues:       recomputeIssues[2:],
+			wantTotal:    3,
+			wantSeverity: map[string]int{"HIGH": 1, "MEDIUM": 1, "LOW": 1},
+			wantScore:    100 - 10 - 5 - 3,
+		},
+		{
+			name:         "omitted issues still count",
+			issues:       recomputeIssues[4:],
+			omitted:      map[string]int{"MEDIUM": 2},
+			wantTotal:    3,
+			wantSeverity: map[string]int{"MEDIUM": 2, "LOW": 1},
+			wantScore:    100 - 2*5 - 3,
+		},
+		{
+			name:         "none left",
+			wantTotal:    0,
+			wantSeverity: map[string]int{},
+			wantScore:    100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AnalysisSummary{OmittedBySeverity: tt.omitted}
+			s.Recompute(tt.issues)
+			if s.TotalIssues != tt.wantTotal {
+				t.Errorf("TotalIssues = %d, want %d", s.TotalIssues, tt.wantTotal)
+			}
+			if !reflect.DeepEqual(s.IssuesBySeverity, tt.wantSeverity) {
+				t.Errorf("IssuesBySeverity = %v, want %v", s.IssuesBySeverity, tt.wantSeverity)
+			}
+			if s.OverallScore != tt.wantScore {
+				t.Errorf("OverallScore = %d, want %d", s.OverallScore, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestDropKeyFindingsAbout(t *testing.T) {
+	aiFindings := []string{"SQL injection in search exposes the users table", "Secrets are committed"}
+
+	tests := []struct {
+		name         string
+		source       string
+		resolved     []Issue
+		remaining    []Issue
+		wantFindings []string
+		wantSource   string
+	}{
+		{
+			name:         "finding mentions a resolved issue",
+			source:       KeyFindingsSourceAI,
+			resolved:     recomputeIssues[:1],
+			remaining:    recomputeIssues[1:],
+			wantFindings: []string{"Hardcoded secret", "N+1 query"},
+			wantSource:   KeyFindingsSourceIssues,
+		},
+		{
+			name:         "title matches case- and space-insensitively",
+			source:       KeyFindingsSourceAI,
+			resolved:     []Issue{{Title: "  sql   INJECTION "}},
+			remaining:    recomputeIssues[1:],
+			wantFindings: []string{"Hardcoded secret", "N+1 query"},
+			wantSource:   KeyFindingsSourceIssues,
+		},
+		{
+			name:         "no finding mentions the resolved issue",
+			source:       KeyFindingsSourceAI,
+			resolved:     recomputeIssues[4:],
+			remaining:    recomputeIssues[:4],
+			wantFindings: aiFindings,
+			wantSource:   KeyFindingsSourceAI,
+		},
+		{
+			name:         "merged duplicate leaves its title behind",
+			source:       KeyFindingsSourceAI,
+			resolved:     []Issue{{Title: "SQL injection"}},
+			remaining:    []Issue{{Severity: SeverityHigh, Title: "sql injection"}},
+			wantFindings: aiFindings,
+			wantSource:   KeyFindingsSourceAI,
+		},
+		{
+			name:         "findings from issues are always derived again",
+			source:       KeyFindingsSourceIssues,
+			resolved:     recomputeIssues[:1],
+			remaining:    recomputeIssues[1:],
+			wantFindings: []string{"Hardcoded secret", "N+1 query"},
+			wantSource:   KeyFindingsSourceIssues,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AnalysisSummary{KeyFindings: aiFindings, KeyFindingsSource: tt.source}
+			s.DropKeyFindingsAbout(tt.resolved, tt.remaining)
+			s.Recompute(tt.remaining)
+			if !reflect.DeepEqual(s.KeyFindings, tt.wantFindings) {
+				t.Errorf("KeyFindings = %q, want %q", s.KeyFindings, tt.wantFindings)
+			}
+			if s.KeyFindingsSource != tt.wantSource {
+				t.Errorf("KeyFindingsSource = %q, want %q", s.KeyFindingsSource, tt.wantSource)
+			}
+		})
+	}
+}
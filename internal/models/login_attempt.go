@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrLoginLocked matches every *LoginLockedError.
+var ErrLoginLocked = errors.New("too many failed sign-in attempts")
+
+// LoginLockedError is returned by LoginAttemptService.Check while an account
+// or IP has too many recent failed sign-ins.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed sign-in attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrLoginLocked) match.
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrLoginLocked
+}
+
+// LoginThrottle configures when sign-ins are locked out.
+type LoginThrottle struct {
+	// MaxFailures locks an account after this many failed sign-ins in a row
+	// within Lockout; a successful sign-in resets the count. 0 disables it.
+	MaxFailures int
+	// MaxFailuresPerIP locks an IP after this many failed sign-ins within
+	// Lockout, across all accounts. Successes don't reset it, so an attacker
+	// can't clear it by signing into their own account. 0 disables it.
+	MaxFailuresPerIP int
+	// Lockout is the window failures are counted over. A lock lifts once
+	// enough of the failures are older than it.
+	Lockout time.Duration
+}
+
+// LoginAttemptService records sign-in attempts, which doubles as their
+// audit log for the lockout window, and locks out accounts and IPs with too
+// many recent failures.
+type LoginAttemptService struct {
+	pool     *pgxpool.Pool
+	throttle LoginThrottle
+}
+
+func NewLoginAttemptService(pool *pgxpool.Pool, throttle LoginThrottle) *LoginAttemptService {
+	return &LoginAttemptService{pool: pool, throttle: throttle}
+}
+
+// Record stores a sign-in attempt for email from ip.
+func (s *LoginAttemptService) Record(ctx context.Context, email, ip string, succeeded bool) error {
+	query := `
+		INSERT INTO login_attempts (email, ip, succeeded)
+		VALUES ($1, $2, $3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, query, normalizeLoginEmail(email), ip, succeeded); err != nil {
+		return fmt.Errorf("failed to record login attempt: %w", err)
+	}
+
+	return nil
+}
+
+// Check returns a *LoginLockedError if email or ip is locked out, with the
+// longer of the two waits.
+func (s *LoginAttemptService) Check(ctx context.Context, email, ip string) error {
+	if s.throttle.Lockout <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var retryAfter time.Duration
+
+	if s.throttle.MaxFailures > 0 {
+		// Failures since the account's last successful sign-in
+		wait, err := s.lockedFor(ctx, `
+			SELECT created_at FROM login_attempts
+			WHERE email = $1 AND NOT succeeded AND created_at > $2
+			  AND created_at > COALESCE(
+			      (SELECT MAX(created_at) FROM login_attempts WHERE email = $1 AND succeeded),
+			      '-infinity')
+			ORDER BY created_at DESC
+			OFFSET $3 LIMIT 1
+		`, normalizeLoginEmail(email), s.throttle.MaxFailures)
+		if err != nil {
+			return err
+		}
+		retryAfter = max(retryAfter, wait)
+	}
+
+	if s.throttle.MaxFailuresPerIP > 0 && ip != "" {
+		wait, err := s.lockedFor(ctx, `
+			SELECT created_at FROM login_attempts
+			WHERE ip = $1 AND NOT succeeded AND created_at > $2
+			ORDER BY created_at DESC
+			OFFSET $3 LIMIT 1
+		`, ip, s.throttle.MaxFailuresPerIP)
+		if err != nil {
+			return err
+		}
+		retryAfter = max(retryAfter, wait)
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// lockedFor runs a query selecting the maxFailures-th most recent failure
+// in the lockout window and returns how long until it leaves the window, or
+// 0 if there haven't been that many failures.
+func (s *LoginAttemptService) lockedFor(ctx context.Context, query, key string, maxFailures int) (time.Duration, error) {
+	var failedAt time.Time
+	err := s.pool.QueryRow(ctx, query, key, time.Now().Add(-s.throttle.Lockout), maxFailures-1).Scan(&failedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to count login attempts: %w", err)
+	}
+
+	return max(time.Until(failedAt.Add(s.throttle.Lockout)), 0), nil
+}
+
+// PruneOld deletes attempts older than the lockout window, which no longer
+// count towards a lock. Returns the number of attempts deleted.
+func (s *LoginAttemptService) PruneOld(ctx context.Context) (int, error) {
+	if s.throttle.Lockout <= 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM login_attempts WHERE created_at < $1`, time.Now().Add(-s.throttle.Lockout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune login attempts: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// Pruner returns a Pruner running PruneOld, for StartPruners.
+func (s *LoginAttemptService) Pruner() Pruner {
+	return Pruner{Name: "expired login attempts", Prune: s.PruneOld}
+}
+
+// normalizeLoginEmail matches the normalization Authenticate applies.
+func normalizeLoginEmail(email string) string {
+	return strings.TrimSpace(strings.ToLower(email))
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginLockedErrorIs(t *testing.T) {
+	var err error = &LoginLockedError{RetryAfter: time.Minute}
+	if !errors.Is(err, ErrLoginLocked) {
+		t.Error("errors.Is(*LoginLockedError, ErrLoginLocked) = false")
+	}
+}
+
+func TestLoginAttemptLockout(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+
+	throttle := LoginThrottle{MaxFailures: 3, MaxFailuresPerIP: 5, Lockout: 15 * time.Minute}
+	s := NewLoginAttemptService(pool, throttle)
+
+	type attempt struct {
+		email     string
+		ip        string
+		succeeded bool
+		age       time.Duration
+	}
+	fail := func(email, ip string, age time.Duration) attempt { return attempt{email, ip, false, age} }
+
+	tests := []struct {
+		name       string
+		attempts   []attempt
+		email, ip  string
+		wantLocked bool
+	}{
+		{
+			name:     "under the account limit",
+			attempts: []attempt{fail("a@x.io", "1.1.1.1", 0), fail("a@x.io", "1.1.1.1", 0)},
+			email:    "a@x.io", ip: "2.2.2.2",
+		},
+		{
+			name:     "account limit reached",
+			attempts: []attempt{fail("a@x.io", "1.1.1.1", 0), fail("a@x.io", "1.1.1.2", 0), fail("a@x.io", "1.1.1.3", 0)},
+			email:    "a@x.io", ip: "2.2.2.2",
+			wantLocked: true,
+		},
+		{
+			name:     "emails match case-insensitively",
+			attempts: []attempt{fail("A@X.io", "1.1.1.1", 0), fail("a@x.io ", "1.1.1.1", 0), fail("a@x.IO", "1.1.1.1", 0)},
+			email:    "a@x.io", ip: "2.2.2.2",
+			wantLocked: true,
+		},
+		{
+			name: "a success resets the account count",
+			attempts: []attempt{
+				fail("a@x.io", "1.1.1.1", 2*time.Minute), fail("a@x.io", "1.1.1.1", 2*time.Minute), fail("a@x.io", "1.1.1.1", 2*time.Minute),
+				{"a@x.io", "1.1.1.1", true, time.Minute},
+			},
+			email: "a@x.io", ip: "2.2.2.2",
+		},
+		{
+			name:     "failures older than the window don't count",
+			attempts: []attempt{fail("a@x.io", "1.1.1.1", 20*time.Minute), fail("a@x.io", "1.1.1.1", 20*time.Minute), fail("a@x.io", "1.1.1.1", 0)},
+			email:    "a@x.io", ip: "2.2.2.2",
+		},
+		{
+			name: "IP limit reached across accounts",
+			attempts: []attempt{
+				fail("a@x.io", "9.9.9.9", 0), fail("b@x.io", "9.9.9.9", 0), fail("c@x.io", "9.9.9.9", 0),
+				fail("d@x.io", "9.9.9.9", 0), fail("e@x.io", "9.9.9.9", 0),
+			},
+			email: "new@x.io", ip: "9.9.9.9",
+			wantLocked: true,
+		},
+		{
+			name: "a success doesn't reset the IP count",
+			attempts: []attempt{
+				fail("a@x.io", "9.9.9.9", 0), fail("b@x.io", "9.9.9.9", 0), fail("c@x.io", "9.9.9.9", 0),
+				fail("d@x.io", "9.9.9.9", 0), fail("e@x.io", "9.9.9.9", 0),
+				{"mine@x.io", "9.9.9.9", true, 0},
+			},
+			email: "new@x.io", ip: "9.9.9.9",
+			wantLocked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncate(t, pool, "login_attempts")
+			for _, a := range tt.attempts {
+				_, err := pool.Exec(ctx, `INSERT INTO login_attempts (email, ip, succeeded, created_at) VALUES ($1, $2, $3, $4)`,
+					normalizeLoginEmail(a.email), a.ip, a.succeeded, time.Now().Add(-a.age))
+				if err != nil {
+					t.Fatalf("insert attempt: %v", err)
+				}
+			}
+
+			err := s.Check(ctx, tt.email, tt.ip)
+			if locked := errors.Is(err, ErrLoginLocked); locked != tt.wantLocked {
+				t.Fatalf("Check = %v, want locked %v", err, tt.wantLocked)
+			}
+			var lockedErr *LoginLockedError
+			if errors.As(err, &lockedErr) && (lockedErr.RetryAfter <= 0 || lockedErr.RetryAfter > throttle.Lockout) {
+				t.Errorf("RetryAfter = %s, want within the %s lockout", lockedErr.RetryAfter, throttle.Lockout)
+			}
+		})
+	}
+}
+
+func TestLoginAttemptPruneOld(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	truncate(t, pool, "login_attempts")
+
+	s := NewLoginAttemptService(pool, LoginThrottle{MaxFailures: 3, Lockout: 15 * time.Minute})
+	for _, age := range []time.Duration{time.Hour, 16 * time.Minute, time.Minute} {
+		_, err := pool.Exec(ctx, `INSERT INTO login_attempts (email, ip, succeeded, created_at) VALUES ('a@x.io', '1.1.1.1', false, $1)`, time.Now().Add(-age))
+		if err != nil {
+			t.Fatalf("insert attempt: %v", err)
+		}
+	}
+
+	pruned, err := s.PruneOld(ctx)
+	if err != nil {
+		t.Fatalf("PruneOld: %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("pruned %d attempts, want 2", pruned)
+	}
+
+	var left int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM login_attempts`).Scan(&left); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if left != 1 {
+		t.Errorf("%d attempts left, want 1", left)
+	}
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSort is returned by list methods for a sort key the list
+// doesn't allow.
+var ErrInvalidSort = errors.New("invalid sort column")
+
+// Page selects part of a list. The zero value is the first page in the
+// list's default order.
+type Page struct {
+	// Limit is the most rows returned. 0 uses the list's default, and it is
+	// capped at the list's maximum.
+	Limit  int
+	Offset int
+	// Sort is one of the list's sort keys, prefixed with "-" for descending
+	// order, e.g. "-created_at". Empty uses the list's default order.
+	Sort string
+}
+
+// listOrder is how a list can be sorted and paged. Sort keys map to SQL
+// expressions, so only whitelisted columns ever reach the query.
+type listOrder struct {
+	columns      map[string]string // sort key -> SQL expression
+	defaultSort  string            // sort key used when Page.Sort is empty
+	tieBreaker   string            // unique expression keeping equal rows in a stable order
+	defaultLimit int
+	maxLimit     int
+}
+
+// clause returns the ORDER BY, LIMIT and OFFSET clauses for page. The limit
+// and offset are returned as args for placeholders numbered from firstArg,
+// so they follow the query's own args.
+func (o listOrder) clause(page Page, firstArg int) (string, []any, error) {
+	sort := page.Sort
+	if sort == "" {
+		sort = o.defaultSort
+	}
+
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+
+	column, ok := o.columns[sort]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %q", ErrInvalidSort, page.Sort)
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = o.defaultLimit
+	}
+	limit = min(limit, o.maxLimit)
+	offset := max(page.Offset, 0)
+
+	clause := fmt.Sprintf("ORDER BY %s %s NULLS LAST, %s LIMIT $%d OFFSET $%d",
+		column, direction, o.tieBreaker, firstArg, firstArg+1)
+
+	return clause, []any{limit, offset}, nil
+}
+
+// Sort keys accepted by each list method.
+var (
+	// AnalysisService.ByUserID
+	analysisListOrder = listOrder{
+		columns: map[string]string{
+			"created_at":   "a.created_at",
+			"completed_at": "a.completed_at",
+			"status":       "a.status",
+			"tokens_used":  "a.tokens_used",
+		},
+		defaultSort:  "-created_at",
+		tieBreaker:   "a.id DESC",
+		defaultLimit: 50,
+		maxLimit:     200,
+	}
+
+	// RepositoryService.ByUserID
+	repositoryListOrder = listOrder{
+		columns: map[string]string{
+			"updated_at": "r.updated_at",
+			"created_at": "r.created_at",
+			"name":       "lower(r.name)",
+			"stars":      "r.stars_count",
+		},
+		defaultSort:  "-updated_at",
+		tieBreaker:   "r.id DESC",
+		defaultLimit: 100,
+		maxLimit:     500,
+	}
+
+	// AnalysisService.IssuesBySeverity
+	issueListOrder = listOrder{
+		columns: map[string]string{
+			"created_at": "ci.created_at",
+			"file":       "ci.affected_file",
+			"category":   "ci.issue_type",
+		},
+		defaultSort:  "-created_at",
+		tieBreaker:   "ci.id",
+		defaultLimit: 100,
+		maxLimit:     500,
+	}
+)
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ErrPasswordTooWeak matches every *PasswordTooWeakError.
+var ErrPasswordTooWeak = errors.New("password is too weak")
+
+// PasswordTooWeakError is returned by Create for a password that meets the
+// length rule but not the password policy. Guidance tells the user what to
+// change.
+type PasswordTooWeakError struct {
+	Guidance string
+}
+
+func (e *PasswordTooWeakError) Error() string {
+	return "password is too weak: " + e.Guidance
+}
+
+// Is makes errors.Is(err, ErrPasswordTooWeak) match.
+func (e *PasswordTooWeakError) Is(target error) bool {
+	return target == ErrPasswordTooWeak
+}
+
+// PasswordPolicy is checked on top of the 8 character minimum. The zero
+// value only enforces the minimum.
+type PasswordPolicy struct {
+	// MinClasses is how many of lowercase letters, uppercase letters,
+	// digits and symbols a password must mix, from 0 to 4
+	MinClasses int
+	// RejectCommon rejects well-known passwords, also with digits or
+	// symbols appended, e.g. "Password123!"
+	RejectCommon bool
+}
+
+// commonPasswords are lowercase words from the top of breach lists. Short
+// ones are included because they are usually padded with digits to pass
+// length rules.
+var commonPasswords = map[string]bool{
+	"password": true, "passw0rd": true, "qwerty": true, "qwertyuiop": true,
+	"letmein": true, "welcome": true, "admin": true, "administrator": true,
+	"iloveyou": true, "sunshine": true, "princess": true, "football": true,
+	"baseball": true, "superman": true, "trustno1": true, "dragon": true,
+	"monkey": true, "master": true, "abc": true, "abcdef": true,
+	"abcdefgh": true, "asdfghjkl": true, "zxcvbnm": true, "changeme": true,
+	"secret": true, "login": true, "starwars": true, "whatever": true,
+	"github": true, "computer": true, "internet": true, "qazwsx": true,
+}
+
+// Check returns a *PasswordTooWeakError if password breaks the policy.
+func (p PasswordPolicy) Check(password string) error {
+	if p.RejectCommon && isCommonPassword(password) {
+		return &PasswordTooWeakError{Guidance: "this password is too common; choose something harder to guess"}
+	}
+
+	if p.MinClasses > 0 && characterClasses(password) < p.MinClasses {
+		return &PasswordTooWeakError{Guidance: "mix at least " + classCountWords[p.MinClasses] + " of lowercase letters, uppercase letters, digits and symbols"}
+	}
+
+	return nil
+}
+
+// classCountWords spells out MinClasses for guidance messages.
+var classCountWords = [...]string{"zero", "one", "two", "three", "all four"}
+
+// characterClasses counts which of lowercase, uppercase, digits and other
+// characters appear in password.
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// isCommonPassword reports whether password is a common one, ignoring case
+// and any digits or symbols added at the end.
+func isCommonPassword(password string) bool {
+	base := strings.TrimRightFunc(strings.ToLower(password), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return commonPasswords[base] || commonPasswords[strings.ToLower(password)]
+}
+
+// SetPasswordPolicy sets the policy Create checks passwords against.
+func (s *UserService) SetPasswordPolicy(policy PasswordPolicy) {
+	s.passwordPolicy = policy
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		wantWeak bool
+	}{
+		{"zero policy allows anything", PasswordPolicy{}, "password", false},
+		{"common password", PasswordPolicy{RejectCommon: true}, "password", true},
+		{"common password in another case", PasswordPolicy{RejectCommon: true}, "PassWord", true},
+		{"common password padded with digits", PasswordPolicy{RejectCommon: true}, "Password123!", true},
+		{"common password with leetspeak", PasswordPolicy{RejectCommon: true}, "passw0rd", true},
+		{"uncommon password", PasswordPolicy{RejectCommon: true}, "correct horse battery", false},
+		{"one class short of two", PasswordPolicy{MinClasses: 2}, "alllowercase", true},
+		{"two classes", PasswordPolicy{MinClasses: 2}, "lowercase42", false},
+		{"three of three", PasswordPolicy{MinClasses: 3}, "Lowercase42", false},
+		{"symbols count as a class", PasswordPolicy{MinClasses: 3}, "lower case-42", false},
+		{"two of four", PasswordPolicy{MinClasses: 4}, "Lowercase", true},
+		{"all four", PasswordPolicy{MinClasses: 4}, "Lower-case42", false},
+		{"non-ASCII letters", PasswordPolicy{MinClasses: 2}, "Ñandú-pájaro", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.password)
+			if weak := errors.Is(err, ErrPasswordTooWeak); weak != tt.wantWeak {
+				t.Fatalf("Check(%q) = %v, want weak %v", tt.password, err, tt.wantWeak)
+			}
+			var weakErr *PasswordTooWeakError
+			if errors.As(err, &weakErr) && weakErr.Guidance == "" {
+				t.Error("weak password error has no guidance")
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"regexp"
@@ -19,9 +21,12 @@ import (
 // MustCompile for fail fast impl
 var GitHubURLPattern = regexp.MustCompile(`^(?:https?://)?github\.com/([a-zA-Z0-9_.-]+)/([a-zA-Z0-9_.-]+?)(?:\.git)?/?$`)
 
+// Repository is stored once per GitHub URL and shared by every user who
+// analyzes it. UserID is only set when the repository was loaded through a
+// user association (ByUserID, ByUserAndURL, Create).
 type Repository struct {
 	ID              int64     `json:"id"`
-	UserID          int64     `json:"user_id"`
+	UserID          int64     `json:"user_id,omitempty"`
 	GitHubURL       string    `json:"github_url"`
 	Owner           string    `json:"owner"`
 	Name            string    `json:"name"`
@@ -29,10 +34,28 @@ type Repository struct {
 	PrimaryLanguage *string   `json:"primary_language,omitempty"`
 	StarsCount      int       `json:"stars_count"`
 	ForksCount      int       `json:"forks_count"`
+	License         *string   `json:"license,omitempty"` // SPDX id; nil when no license file was found
+	Private         bool      `json:"private"`           // as GitHub last reported it
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
 
+// GistURLPattern matches gist URLs, with or without the owner:
+// - https://gist.github.com/owner/0123456789abcdef0123
+// - gist.github.com/0123456789abcdef0123
+var GistURLPattern = regexp.MustCompile(`^(?:https?://)?gist\.github\.com/(?:([a-zA-Z0-9-]+)/)?([0-9a-fA-F]{20,32})/?$`)
+
+// GistURLPrefix starts the stored URL of repositories created from a gist,
+// which is followed by "owner/id".
+const GistURLPrefix = "https://gist.github.com/"
+
+// UploadURLPrefix marks repositories created from an uploaded archive rather
+// than a GitHub URL. Each upload gets its own repository record.
+const UploadURLPrefix = "upload:"
+
+// UploadOwner is the owner shown for repositories created from uploads.
+const UploadOwner = "upload"
+
 type RepositoryService struct {
 	pool *pgxpool.Pool
 }
@@ -54,37 +77,125 @@ func ParseGitHubURL(url string) (owner, repo string, err error) {
 	return matches[1], matches[2], nil
 }
 
-// save repo data to db
+// ParseGistURL extracts the owner, if present, and the id from a gist URL.
+func ParseGistURL(url string) (owner, gistID string, err error) {
+	matches := GistURLPattern.FindStringSubmatch(strings.TrimSpace(url))
+	if matches == nil {
+		return "", "", ErrInvalidRepositoryURL
+	}
+	return matches[1], strings.ToLower(matches[2]), nil
+}
+
+// repositoryKey returns the URL a GitHub repository is stored under. GitHub
+// owner and repository names are case-insensitive, so they are lowercased
+// for every user's spelling to share one record.
+func repositoryKey(owner, name string) string {
+	return fmt.Sprintf("https://github.com/%s/%s", strings.ToLower(owner), strings.ToLower(name))
+}
+
+// Create upserts the shared repository record and associates it with repo.UserID.
 func (s *RepositoryService) Create(ctx context.Context, repo *Repository) (*Repository, error) {
-	// Validate URL format
-	owner, name, err := ParseGitHubURL(repo.GitHubURL)
+	result, err := s.Upsert(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Associate(ctx, repo.UserID, result.ID); err != nil {
+		return nil, err
+	}
+
+	result.UserID = repo.UserID
+	return result, nil
+}
+
+// CreateUpload stores a repository record for an uploaded archive and
+// associates it with the user.
+func (s *RepositoryService) CreateUpload(ctx context.Context, userID int64, name string) (*Repository, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate upload id: %w", err)
+	}
+
+	query := `
+		INSERT INTO repositories (github_url, owner, name)
+		VALUES ($1, $2, $3)
+		RETURNING id, github_url, owner, name, description, primary_language, stars_count, forks_count, private, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	result := &Repository{}
+	err := s.pool.QueryRow(ctx, query, UploadURLPrefix+hex.EncodeToString(idBytes), UploadOwner, name).Scan(
+		&result.ID,
+		&result.GitHubURL,
+		&result.Owner,
+		&result.Name,
+		&result.Description,
+		&result.PrimaryLanguage,
+		&result.StarsCount,
+		&result.ForksCount,
+		&result.Private,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+	)
 	if err != nil {
+		return nil, fmt.Errorf("failed to create upload repository: %w", err)
+	}
+
+	if err := s.Associate(ctx, userID, result.ID); err != nil {
 		return nil, err
 	}
 
-	// Normalize the URL
-	repo.Owner = owner
-	repo.Name = name
-	repo.GitHubURL = fmt.Sprintf("https://github.com/%s/%s", owner, name)
+	result.UserID = userID
+	return result, nil
+}
+
+// Upsert saves repository metadata keyed by its canonical URL.
+// If another user already stored the repo, its metadata is refreshed in place.
+//
+// Gists are stored as pseudo-repositories named after the gist id; their
+// owner must be set by the caller, as gist URLs may omit it.
+func (s *RepositoryService) Upsert(ctx context.Context, repo *Repository) (*Repository, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	return upsertRepository(ctx, s.pool, repo)
+}
+
+// upsertRepository runs Upsert on q.
+func upsertRepository(ctx context.Context, q querier, repo *Repository) (*Repository, error) {
+	if _, gistID, err := ParseGistURL(repo.GitHubURL); err == nil {
+		repo.Name = gistID
+		repo.GitHubURL = GistURLPrefix + repo.Owner + "/" + gistID
+	} else {
+		// Validate URL format
+		owner, name, err := ParseGitHubURL(repo.GitHubURL)
+		if err != nil {
+			return nil, err
+		}
+
+		// Normalize the URL
+		repo.Owner = owner
+		repo.Name = name
+		repo.GitHubURL = repositoryKey(owner, name)
+	}
 
 	query := `
-		INSERT INTO repositories (user_id, github_url, owner, name, description, primary_language, stars_count, forks_count)
+		INSERT INTO repositories (github_url, owner, name, description, primary_language, stars_count, forks_count, private)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (user_id, github_url) DO UPDATE SET
+		ON CONFLICT (github_url) DO UPDATE SET
 			description = EXCLUDED.description,
 			primary_language = EXCLUDED.primary_language,
 			stars_count = EXCLUDED.stars_count,
 			forks_count = EXCLUDED.forks_count,
+			private = EXCLUDED.private,
 			updated_at = NOW()
-		RETURNING id, user_id, github_url, owner, name, description, primary_language, stars_count, forks_count, created_at, updated_at
+		RETURNING id, github_url, owner, name, description, primary_language, stars_count, forks_count, private, created_at, updated_at
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
-	defer cancel()
-
 	result := &Repository{}
-	err = s.pool.QueryRow(ctx, query,
-		repo.UserID,
+	err := q.QueryRow(ctx, query,
 		repo.GitHubURL,
 		repo.Owner,
 		repo.Name,
@@ -92,9 +203,9 @@ func (s *RepositoryService) Create(ctx context.Context, repo *Repository) (*Repo
 		repo.PrimaryLanguage,
 		repo.StarsCount,
 		repo.ForksCount,
+		repo.Private,
 	).Scan(
 		&result.ID,
-		&result.UserID,
 		&result.GitHubURL,
 		&result.Owner,
 		&result.Name,
@@ -102,21 +213,185 @@ func (s *RepositoryService) Create(ctx context.Context, repo *Repository) (*Repo
 		&result.PrimaryLanguage,
 		&result.StarsCount,
 		&result.ForksCount,
+		&result.Private,
 		&result.CreatedAt,
 		&result.UpdatedAt,
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create repository: %w", err)
+		return nil, upsertRepositoryError(err)
 	}
 
 	return result, nil
 }
 
+// upsertRepositoryError maps a failed upsert into repositories to the error
+// Upsert returns.
+func upsertRepositoryError(err error) error {
+	if isUniqueViolation(err) {
+		return ErrRepositoryAlreadyExists
+	}
+	return fmt.Errorf("failed to upsert repository: %w", err)
+}
+
+// SetLicense stores the SPDX id of a repository's license. A nil license
+// records that the repository has none.
+func (s *RepositoryService) SetLicense(ctx context.Context, repositoryID int64, license *string) error {
+	query := `UPDATE repositories SET license = $1, updated_at = NOW() WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, license, repositoryID)
+	if err != nil {
+		return fmt.Errorf("failed to update repository license: %w", err)
+	}
+
+	return nil
+}
+
+// RefreshCandidate is a repository due for a metadata refresh, with the
+// encrypted GitHub token of the user who analyzed it most recently.
+type RefreshCandidate struct {
+	RepositoryID   int64
+	Owner          string
+	Name           string
+	ETag           *string
+	EncryptedToken string
+}
+
+// RefreshCandidates returns repositories analyzed since the given time whose
+// metadata wasn't refreshed within minAge, oldest refresh first.
+func (s *RepositoryService) RefreshCandidates(ctx context.Context, since time.Time, minAge time.Duration, limit int) ([]RefreshCandidate, error) {
+	query := `
+		SELECT c.id, c.owner, c.name, c.metadata_etag, c.token
+		FROM (
+			SELECT DISTINCT ON (r.id) r.id, r.owner, r.name, r.metadata_etag, r.metadata_refreshed_at,
+			       u.github_access_token_encrypted AS token
+			FROM repositories r
+			JOIN analyses a ON a.repository_id = r.id
+			JOIN users u ON u.id = a.user_id
+			WHERE a.created_at > $1
+			  AND r.github_url NOT LIKE 'upload:%'
+			  AND r.github_url NOT LIKE 'https://gist.github.com/%'
+			  AND u.github_access_token_encrypted IS NOT NULL
+			  AND (r.metadata_refreshed_at IS NULL OR r.metadata_refreshed_at < $2)
+			ORDER BY r.id, a.created_at DESC
+		) c
+		ORDER BY c.metadata_refreshed_at NULLS FIRST
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, query, since, time.Now().Add(-minAge), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories to refresh: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []RefreshCandidate
+	for rows.Next() {
+		var c RefreshCandidate
+		if err := rows.Scan(&c.RepositoryID, &c.Owner, &c.Name, &c.ETag, &c.EncryptedToken); err != nil {
+			return nil, fmt.Errorf("failed to scan repository to refresh: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating repositories to refresh: %w", err)
+	}
+
+	return candidates, nil
+}
+
+// UpdateMetadata stores freshly fetched GitHub metadata and its ETag. An
+// empty description, language or ETag is stored as NULL.
+func (s *RepositoryService) UpdateMetadata(ctx context.Context, repositoryID int64, description, primaryLanguage *string, stars, forks int, private bool, etag string) error {
+	query := `
+		UPDATE repositories
+		SET description = NULLIF($1, ''), primary_language = NULLIF($2, ''), stars_count = $3, forks_count = $4, private = $5,
+		    metadata_etag = NULLIF($6, ''), metadata_refreshed_at = NOW(), updated_at = NOW()
+		WHERE id = $7
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, description, primaryLanguage, stars, forks, private, etag, repositoryID)
+	if err != nil {
+		return fmt.Errorf("failed to update repository metadata: %w", err)
+	}
+
+	return nil
+}
+
+// MarkRefreshed records that a repository's metadata was checked and found
+// unchanged.
+func (s *RepositoryService) MarkRefreshed(ctx context.Context, repositoryID int64) error {
+	query := `UPDATE repositories SET metadata_refreshed_at = NOW() WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, repositoryID)
+	if err != nil {
+		return fmt.Errorf("failed to mark repository refreshed: %w", err)
+	}
+
+	return nil
+}
+
+// Associate links a user to a repository. Linking twice is a no-op.
+func (s *RepositoryService) Associate(ctx context.Context, userID, repositoryID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	return associateRepository(ctx, s.pool, userID, repositoryID)
+}
+
+// associateRepository runs Associate on q.
+func associateRepository(ctx context.Context, q querier, userID, repositoryID int64) error {
+	query := `
+		INSERT INTO user_repositories (user_id, repository_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, repository_id) DO NOTHING
+	`
+
+	_, err := q.Exec(ctx, query, userID, repositoryID)
+	if err != nil {
+		return fmt.Errorf("failed to associate repository: %w", err)
+	}
+
+	return nil
+}
+
+// Dissociate removes a user's link to a repository.
+// The shared repository record and other users' links are left intact.
+func (s *RepositoryService) Dissociate(ctx context.Context, userID, repositoryID int64) error {
+	query := `DELETE FROM user_repositories WHERE user_id = $1 AND repository_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	result, err := s.pool.Exec(ctx, query, userID, repositoryID)
+	if err != nil {
+		return fmt.Errorf("failed to dissociate repository: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRepositoryNotFound
+	}
+
+	return nil
+}
+
 // ByID retrieves a repository by its ID.
 func (s *RepositoryService) ByID(ctx context.Context, id int64) (*Repository, error) {
 	query := `
-		SELECT id, user_id, github_url, owner, name, description, primary_language, stars_count, forks_count, created_at, updated_at
+		SELECT id, github_url, owner, name, description, primary_language, stars_count, forks_count, private, created_at, updated_at
 		FROM repositories
 		WHERE id = $1
 	`
@@ -127,7 +402,6 @@ func (s *RepositoryService) ByID(ctx context.Context, id int64) (*Repository, er
 	repo := &Repository{}
 	err := s.pool.QueryRow(ctx, query, id).Scan(
 		&repo.ID,
-		&repo.UserID,
 		&repo.GitHubURL,
 		&repo.Owner,
 		&repo.Name,
@@ -135,6 +409,7 @@ func (s *RepositoryService) ByID(ctx context.Context, id int64) (*Repository, er
 		&repo.PrimaryLanguage,
 		&repo.StarsCount,
 		&repo.ForksCount,
+		&repo.Private,
 		&repo.CreatedAt,
 		&repo.UpdatedAt,
 	)
@@ -149,19 +424,26 @@ func (s *RepositoryService) ByID(ctx context.Context, id int64) (*Repository, er
 	return repo, nil
 }
 
-// ByUserID retrieves all repositories for a user, ordered by most recent.
-func (s *RepositoryService) ByUserID(ctx context.Context, userID int64) ([]*Repository, error) {
+// ByUserID lists a page of the repositories associated with a user, most
+// recently updated first unless page.Sort says otherwise.
+func (s *RepositoryService) ByUserID(ctx context.Context, userID int64, page Page) ([]*Repository, error) {
+	order, orderArgs, err := repositoryListOrder.clause(page, 2)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, user_id, github_url, owner, name, description, primary_language, stars_count, forks_count, created_at, updated_at
-		FROM repositories
-		WHERE user_id = $1
-		ORDER BY updated_at DESC
-	`
+		SELECT r.id, ur.user_id, r.github_url, r.owner, r.name, r.description, r.primary_language,
+		       r.stars_count, r.forks_count, r.private, r.created_at, r.updated_at
+		FROM repositories r
+		JOIN user_repositories ur ON ur.repository_id = r.id
+		WHERE ur.user_id = $1
+	` + order
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	rows, err := s.pool.Query(ctx, query, userID)
+	rows, err := s.pool.Query(ctx, query, append([]any{userID}, orderArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list repositories: %w", err)
 	}
@@ -180,6 +462,7 @@ func (s *RepositoryService) ByUserID(ctx context.Context, userID int64) ([]*Repo
 			&repo.PrimaryLanguage,
 			&repo.StarsCount,
 			&repo.ForksCount,
+			&repo.Private,
 			&repo.CreatedAt,
 			&repo.UpdatedAt,
 		)
@@ -196,19 +479,103 @@ func (s *RepositoryService) ByUserID(ctx context.Context, userID int64) ([]*Repo
 	return repos, nil
 }
 
-// ByUserAndURL finds a repository by user ID and GitHub URL.
+// RepositoryHealth is a repository with the outcome of the user's analyses
+// of it. Fields are nil when there is no such analysis.
+type RepositoryHealth struct {
+	Repository *Repository `json:"repository"`
+	// Status of the most recent analysis, whatever its outcome
+	LatestStatus *AnalysisStatus `json:"latest_status"`
+	// Overall score and completion time of the most recent completed analysis
+	LatestScore  *int       `json:"latest_score"`
+	LastAnalyzed *time.Time `json:"last_analyzed_at"`
+}
+
+// ByUserIDWithLatestScore lists the user's repositories, like ByUserID,
+// each with the status of the user's latest analysis and the score of the
+// latest completed one.
+func (s *RepositoryService) ByUserIDWithLatestScore(ctx context.Context, userID int64) ([]*RepositoryHealth, error) {
+	query := `
+		SELECT r.id, ur.user_id, r.github_url, r.owner, r.name, r.description, r.primary_language,
+		       r.stars_count, r.forks_count, r.private, r.created_at, r.updated_at,
+		       latest.status, done.score, done.completed_at
+		FROM repositories r
+		JOIN user_repositories ur ON ur.repository_id = r.id
+		LEFT JOIN LATERAL (
+			SELECT a.status
+			FROM analyses a
+			WHERE a.repository_id = r.id AND a.user_id = ur.user_id
+			ORDER BY a.created_at DESC
+			LIMIT 1
+		) latest ON true
+		LEFT JOIN LATERAL (
+			SELECT (a.ai_analysis::jsonb -> 'summary' ->> 'overall_score')::int AS score, a.completed_at
+			FROM analyses a
+			WHERE a.repository_id = r.id AND a.user_id = ur.user_id AND a.status = $2
+			ORDER BY a.completed_at DESC
+			LIMIT 1
+		) done ON true
+		WHERE ur.user_id = $1
+		ORDER BY r.updated_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, query, userID, StatusCompleted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repository health: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*RepositoryHealth
+	for rows.Next() {
+		repo := &Repository{}
+		health := &RepositoryHealth{Repository: repo}
+		err := rows.Scan(
+			&repo.ID,
+			&repo.UserID,
+			&repo.GitHubURL,
+			&repo.Owner,
+			&repo.Name,
+			&repo.Description,
+			&repo.PrimaryLanguage,
+			&repo.StarsCount,
+			&repo.ForksCount,
+			&repo.Private,
+			&repo.CreatedAt,
+			&repo.UpdatedAt,
+			&health.LatestStatus,
+			&health.LatestScore,
+			&health.LastAnalyzed,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan repository health: %w", err)
+		}
+		result = append(result, health)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating repository health: %w", err)
+	}
+
+	return result, nil
+}
+
+// ByUserAndURL finds a repository associated with a user by its GitHub URL.
 func (s *RepositoryService) ByUserAndURL(ctx context.Context, userID int64, githubURL string) (*Repository, error) {
 	// Normalize URL
 	owner, name, err := ParseGitHubURL(githubURL)
 	if err != nil {
 		return nil, err
 	}
-	normalizedURL := fmt.Sprintf("https://github.com/%s/%s", owner, name)
+	normalizedURL := repositoryKey(owner, name)
 
 	query := `
-		SELECT id, user_id, github_url, owner, name, description, primary_language, stars_count, forks_count, created_at, updated_at
-		FROM repositories
-		WHERE user_id = $1 AND github_url = $2
+		SELECT r.id, ur.user_id, r.github_url, r.owner, r.name, r.description, r.primary_language,
+		       r.stars_count, r.forks_count, r.private, r.created_at, r.updated_at
+		FROM repositories r
+		JOIN user_repositories ur ON ur.repository_id = r.id
+		WHERE ur.user_id = $1 AND r.github_url = $2
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
@@ -225,6 +592,7 @@ func (s *RepositoryService) ByUserAndURL(ctx context.Context, userID int64, gith
 		&repo.PrimaryLanguage,
 		&repo.StarsCount,
 		&repo.ForksCount,
+		&repo.Private,
 		&repo.CreatedAt,
 		&repo.UpdatedAt,
 	)
@@ -239,16 +607,43 @@ func (s *RepositoryService) ByUserAndURL(ctx context.Context, userID int64, gith
 	return repo, nil
 }
 
-// on delete, the associated analysis is also deleted (on cascade)
-func (s *RepositoryService) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM repositories WHERE id = $1`
+// CountByUser returns the number of repositories associated with a user.
+func (s *RepositoryService) CountByUser(ctx context.Context, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM user_repositories WHERE user_id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	result, err := s.pool.Exec(ctx, query, id)
+	var count int
+	err := s.pool.QueryRow(ctx, query, userID).Scan(&count)
 	if err != nil {
-		return fmt.Errorf("failed to delete repository: %w", err)
+		return 0, fmt.Errorf("failed to count repositories: %w", err)
+	}
+
+	return count, nil
+}
+
+// WebhookSubscriber is a user who registered a push webhook for a repository.
+type WebhookSubscriber struct {
+	UserID          int64
+	RepositoryID    int64
+	EncryptedSecret string
+}
+
+// SetWebhookSecret stores the encrypted webhook secret for a user's repository.
+func (s *RepositoryService) SetWebhookSecret(ctx context.Context, userID, repositoryID int64, encryptedSecret string) error {
+	query := `
+		UPDATE user_repositories
+		SET webhook_secret = $3
+		WHERE user_id = $1 AND repository_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	result, err := s.pool.Exec(ctx, query, userID, repositoryID, encryptedSecret)
+	if err != nil {
+		return fmt.Errorf("failed to set webhook secret: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
@@ -258,20 +653,45 @@ func (s *RepositoryService) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
-// CountByUser returns the number of repositories for a user.
-func (s *RepositoryService) CountByUser(ctx context.Context, userID int64) (int, error) {
-	query := `SELECT COUNT(*) FROM repositories WHERE user_id = $1`
+// WebhookSubscribers returns every user with a webhook secret for the repository
+// at githubURL.
+func (s *RepositoryService) WebhookSubscribers(ctx context.Context, githubURL string) ([]WebhookSubscriber, error) {
+	owner, name, err := ParseGitHubURL(githubURL)
+	if err != nil {
+		return nil, err
+	}
+	normalizedURL := repositoryKey(owner, name)
+
+	query := `
+		SELECT ur.user_id, ur.repository_id, ur.webhook_secret
+		FROM user_repositories ur
+		JOIN repositories r ON r.id = ur.repository_id
+		WHERE r.github_url = $1 AND ur.webhook_secret IS NOT NULL
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	var count int
-	err := s.pool.QueryRow(ctx, query, userID).Scan(&count)
+	rows, err := s.pool.Query(ctx, query, normalizedURL)
 	if err != nil {
-		return 0, fmt.Errorf("failed to count repositories: %w", err)
+		return nil, fmt.Errorf("failed to list webhook subscribers: %w", err)
 	}
+	defer rows.Close()
 
-	return count, nil
+	var subscribers []WebhookSubscriber
+	for rows.Next() {
+		var sub WebhookSubscriber
+		if err := rows.Scan(&sub.UserID, &sub.RepositoryID, &sub.EncryptedSecret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscriber: %w", err)
+		}
+		subscribers = append(subscribers, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook subscribers: %w", err)
+	}
+
+	return subscribers, nil
 }
 
 // HELPER FUNCS ------------------------------------------------------
@@ -281,8 +701,22 @@ func (r *Repository) FullName() string {
 	return fmt.Sprintf("%s/%s", r.Owner, r.Name)
 }
 
+// IsUpload reports whether the repository was created from an uploaded
+// archive, so it has no GitHub page.
+func (r *Repository) IsUpload() bool {
+	return strings.HasPrefix(r.GitHubURL, UploadURLPrefix)
+}
+
+// IsGist reports whether the repository was created from a gist.
+func (r *Repository) IsGist() bool {
+	return strings.HasPrefix(r.GitHubURL, GistURLPrefix)
+}
+
 // CanonicalURL returns the full GitHub URL.
 func (r *Repository) CanonicalURL() string {
+	if r.IsGist() {
+		return r.GitHubURL
+	}
 	return fmt.Sprintf("https://github.com/%s/%s", r.Owner, r.Name)
 }
 
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRepositorySharedAcrossUsers(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repos := NewRepositoryService(pool)
+	analyses := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+
+	alice := newTestUser(t, pool, "alice@example.com", 1000)
+	bob := newTestUser(t, pool, "bob@example.com", 1000)
+
+	var repoIDs, analysisIDs []int64
+	for _, user := range []*User{alice, bob} {
+		repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app", StarsCount: int(user.ID)}
+		saved, analysis, reused, err := analyses.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+		if err != nil {
+			t.Fatalf("CreateWithRepository for user %d: %v", user.ID, err)
+		}
+		if reused {
+			t.Errorf("user %d reused another user's analysis", user.ID)
+		}
+		repoIDs = append(repoIDs, saved.ID)
+		analysisIDs = append(analysisIDs, analysis.ID)
+	}
+
+	if repoIDs[0] != repoIDs[1] {
+		t.Errorf("repository stored twice, as %d and %d", repoIDs[0], repoIDs[1])
+	}
+	if analysisIDs[0] == analysisIDs[1] {
+		t.Errorf("both users got analysis %d", analysisIDs[0])
+	}
+
+	var rows int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM repositories`).Scan(&rows); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("%d repository rows, want 1", rows)
+	}
+
+	// Dropping one user's link leaves the other's repository and analysis
+	if err := repos.Dissociate(ctx, alice.ID, repoIDs[0]); err != nil {
+		t.Fatalf("Dissociate: %v", err)
+	}
+	if _, err := repos.ByUserAndURL(ctx, alice.ID, "https://github.com/acme/app"); !errors.Is(err, ErrRepositoryNotFound) {
+		t.Errorf("alice's repository after Dissociate: %v, want ErrRepositoryNotFound", err)
+	}
+	if _, err := repos.ByUserAndURL(ctx, bob.ID, "https://github.com/acme/app"); err != nil {
+		t.Errorf("bob's repository after alice's Dissociate: %v", err)
+	}
+	if _, err := analyses.ByID(ctx, analysisIDs[1]); err != nil {
+		t.Errorf("bob's analysis after alice's Dissociate: %v", err)
+	}
+}
+
+func TestByUserIDWithLatestScore(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repos := NewRepositoryService(pool)
+	analyses := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+
+	user := newTestUser(t, pool, "health@example.com", 100000)
+	other := newTestUser(t, pool, "other@example.com", 100000)
+
+	// analyze creates an analysis of owner/name for u and drives it to
+	// status, completing it with score
+	analyze := func(u *User, name string, status AnalysisStatus, score int) {
+		t.Helper()
+		repo := &Repository{UserID: u.ID, GitHubURL: "https://github.com/acme/" + name, Owner: "acme", Name: name}
+		_, analysis, _, err := analyses.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+		if err != nil {
+			t.Fatalf("CreateWithRepository: %v", err)
+		}
+		if status == StatusPending {
+			return
+		}
+		if err := analyses.MarkProcessing(ctx, analysis.ID); err != nil {
+			t.Fatalf("MarkProcessing: %v", err)
+		}
+		switch status {
+		case StatusCompleted:
+			err = analyses.Complete(ctx, analysis.ID, "{}", &AnalysisSummary{OverallScore: score}, nil, 10)
+		case StatusFailed:
+			err = analyses.Fail(ctx, analysis.ID, "boom")
+		}
+		if err != nil {
+			t.Fatalf("finish analysis: %v", err)
+		}
+	}
+
+	analyze(user, "scored", StatusCompleted, 40)
+	analyze(user, "scored", StatusCompleted, 85)
+	analyze(user, "regressed", StatusCompleted, 70)
+	analyze(user, "regressed", StatusFailed, 0)
+	analyze(user, "queued", StatusPending, 0)
+	analyze(other, "scored", StatusCompleted, 10)
+	analyze(other, "theirs", StatusCompleted, 99)
+
+	health, err := repos.ByUserIDWithLatestScore(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ByUserIDWithLatestScore: %v", err)
+	}
+
+	byName := make(map[string]*RepositoryHealth)
+	for _, h := range health {
+		byName[h.Repository.Name] = h
+	}
+	if len(byName) != 3 || byName["theirs"] != nil {
+		t.Fatalf("got repositories %v, want scored, regressed and queued", byName)
+	}
+
+	tests := []struct {
+		name       string
+		wantScore  *int
+		wantStatus AnalysisStatus
+	}{
+		{"scored", ptr(85), StatusCompleted},
+		{"regressed", ptr(70), StatusFailed},
+		{"queued", nil, StatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := byName[tt.name]
+			switch {
+			case tt.wantScore == nil && h.LatestScore != nil:
+				t.Errorf("score = %d, want null", *h.LatestScore)
+			case tt.wantScore != nil && (h.LatestScore == nil || *h.LatestScore != *tt.wantScore):
+				t.Errorf("score = %v, want %d", h.LatestScore, *tt.wantScore)
+			}
+			if (h.LastAnalyzed == nil) != (tt.wantScore == nil) {
+				t.Errorf("last analyzed = %v with score %v", h.LastAnalyzed, h.LatestScore)
+			}
+			if h.LatestStatus == nil || *h.LatestStatus != tt.wantStatus {
+				t.Errorf("status = %v, want %s", h.LatestStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestUpdateMetadata(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repos := NewRepositoryService(pool)
+	analyses := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+	user := newTestUser(t, pool, "metadata@example.com", 1000)
+
+	repo := &Repository{UserID: user.ID, GitHubURL: "https://github.com/acme/app", Owner: "acme", Name: "app"}
+	saved, _, _, err := analyses.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+	if err != nil {
+		t.Fatalf("CreateWithRepository: %v", err)
+	}
+
+	tests := []struct {
+		name                      string
+		description, language     *string
+		etag                      string
+		wantDescription, wantLang *string
+		wantETag                  *string
+	}{
+		{
+			name:        "values are stored",
+			description: ptr("A web app"), language: ptr("Go"), etag: `"abc"`,
+			wantDescription: ptr("A web app"), wantLang: ptr("Go"), wantETag: ptr(`"abc"`),
+		},
+		{name: "empty values are NULL", description: ptr(""), language: ptr("")},
+		{name: "nil values are NULL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repos.UpdateMetadata(ctx, saved.ID, tt.description, tt.language, 3, 1, false, tt.etag); err != nil {
+				t.Fatalf("UpdateMetadata: %v", err)
+			}
+
+			var description, language, etag *string
+			err := pool.QueryRow(ctx, `SELECT description, primary_language, metadata_etag FROM repositories WHERE id = $1`, saved.ID).
+				Scan(&description, &language, &etag)
+			if err != nil {
+				t.Fatalf("select: %v", err)
+			}
+			for _, c := range []struct {
+				column    string
+				got, want *string
+			}{
+				{"description", description, tt.wantDescription},
+				{"primary_language", language, tt.wantLang},
+				{"metadata_etag", etag, tt.wantETag},
+			} {
+				if (c.got == nil) != (c.want == nil) || c.got != nil && *c.got != *c.want {
+					t.Errorf("%s = %v, want %v", c.column, deref(c.got), deref(c.want))
+				}
+			}
+		})
+	}
+}
+
+// deref returns *s, or "<nil>" for a nil s.
+func deref(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+func TestRepositoryKey(t *testing.T) {
+	tests := []struct{ owner, name, want string }{
+		{"acme", "app", "https://github.com/acme/app"},
+		{"Acme", "App", "https://github.com/acme/app"},
+		{"ACME", "my-App.js", "https://github.com/acme/my-app.js"},
+	}
+
+	for _, tt := range tests {
+		if got := repositoryKey(tt.owner, tt.name); got != tt.want {
+			t.Errorf("repositoryKey(%q, %q) = %q, want %q", tt.owner, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRepositoryCaseVariantsShareOneRecord(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repos := NewRepositoryService(pool)
+	analyses := NewAnalysisService(pool)
+	truncate(t, pool, "users", "repositories", "analyses")
+
+	alice := newTestUser(t, pool, "alice@example.com", 1000)
+	bob := newTestUser(t, pool, "bob@example.com", 1000)
+
+	tests := []struct {
+		user        *User
+		url         string
+		owner, name string
+	}{
+		{alice, "https://github.com/Foo/Bar", "Foo", "Bar"},
+		{bob, "https://github.com/foo/bar", "foo", "bar"},
+	}
+
+	var repoIDs []int64
+	for _, tt := range tests {
+		repo := &Repository{UserID: tt.user.ID, GitHubURL: tt.url, Owner: tt.owner, Name: tt.name}
+		saved, _, _, err := analyses.CreateWithRepository(ctx, repo, ModeDeep, 0, AnalysisLimits{})
+		if err != nil {
+			t.Fatalf("CreateWithRepository(%s): %v", tt.url, err)
+		}
+		repoIDs = append(repoIDs, saved.ID)
+	}
+	if repoIDs[0] != repoIDs[1] {
+		t.Fatalf("Foo/Bar and foo/bar stored as %d and %d", repoIDs[0], repoIDs[1])
+	}
+
+	// Every spelling finds the shared record
+	for _, url := range []string{"https://github.com/foo/bar", "https://github.com/FOO/BAR"} {
+		for _, user := range []*User{alice, bob} {
+			repo, err := repos.ByUserAndURL(ctx, user.ID, url)
+			if err != nil {
+				t.Errorf("ByUserAndURL(%d, %s): %v", user.ID, url, err)
+			} else if repo.ID != repoIDs[0] {
+				t.Errorf("ByUserAndURL(%d, %s) = %d, want %d", user.ID, url, repo.ID, repoIDs[0])
+			}
+		}
+	}
+
+	for _, user := range []*User{alice, bob} {
+		if err := repos.SetWebhookSecret(ctx, user.ID, repoIDs[0], "secret"); err != nil {
+			t.Fatalf("SetWebhookSecret: %v", err)
+		}
+	}
+	subscribers, err := repos.WebhookSubscribers(ctx, "https://github.com/Foo/bar")
+	if err != nil {
+		t.Fatalf("WebhookSubscribers: %v", err)
+	}
+	if len(subscribers) != 2 {
+		t.Errorf("%d webhook subscribers, want 2", len(subscribers))
+	}
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxScoringEntries is the most names a scoring profile may list in
+	// each of its sections.
+	MaxScoringEntries = 200
+	// maxScoringNameLength is the longest file, directory, extension or
+	// language name in a scoring profile.
+	maxScoringNameLength = 100
+	// MaxDirScore is the highest base score of an important directory;
+	// entry points score 100.
+	MaxDirScore = 100
+	// MaxExtensionBoost bounds an extension boost either way.
+	MaxExtensionBoost = 100
+)
+
+// ScoringConfig controls how repository files are ranked before the top N
+// are fetched for analysis.
+type ScoringConfig struct {
+	// File names (lowercase) that are always fetched first
+	EntryPoints []string `json:"entry_points"`
+	// File names (lowercase) that describe the project setup
+	ConfigFiles []string `json:"config_files"`
+	// Directory names (lowercase) and the base score for files under them.
+	// A file scores by the best-scoring directory anywhere in its path.
+	ImportantDirs map[string]int `json:"important_dirs"`
+	// File names (lowercase) never worth fetching, e.g. lockfiles
+	IgnoredFiles []string `json:"ignored_files"`
+	// Extra score per file extension
+	ExtensionBoost map[string]int `json:"extension_boost"`
+	// Languages, as named in the language breakdown (e.g. "JavaScript"), or
+	// extensions (e.g. ".css") never fetched and left out of the breakdown
+	ExcludedLanguages []string `json:"excluded_languages,omitempty"`
+}
+
+// DefaultScoringConfig returns the built-in scoring profile.
+func DefaultScoringConfig() *ScoringConfig {
+	return &ScoringConfig{
+		EntryPoints: []string{"main.go", "main.py", "main.rs", "main.ts", "main.js",
+			"app.go", "app.py", "app.ts", "app.js", "index.ts", "index.js",
+			"server.go", "server.ts", "server.js", "cmd.go"},
+		ConfigFiles: []string{"go.mod", "go.sum", "package.json", "cargo.toml",
+			"requirements.txt", "pyproject.toml", "dockerfile", "docker-compose.yml",
+			"makefile", ".env.example", "config.yaml", "config.json", "tsconfig.json"},
+		ImportantDirs: map[string]int{
+			"cmd":         85,
+			"internal":    80,
+			"pkg":         75,
+			"src":         75,
+			"lib":         70,
+			"api":         80,
+			"handlers":    85,
+			"controllers": 85,
+			"services":    80,
+			"models":      80,
+			"routes":      75,
+			"middleware":  75,
+			"utils":       60,
+			"helpers":     60,
+			"core":        80,
+			// Frontend layouts (React, Vue, Next.js, Svelte...)
+			"components":  80,
+			"pages":       75,
+			"app":         75,
+			"views":       75,
+			"screens":     75,
+			"containers":  75,
+			"features":    75,
+			"store":       70,
+			"stores":      70,
+			"hooks":       70,
+			"composables": 70,
+			"layouts":     65,
+		},
+		IgnoredFiles: []string{"package-lock.json", "yarn.lock", "pnpm-lock.yaml",
+			"composer.lock", "gemfile.lock", "cargo.lock", "poetry.lock"},
+		ExtensionBoost: map[string]int{
+			".go":     20,
+			".py":     20,
+			".rs":     20,
+			".ts":     18,
+			".js":     15,
+			".tsx":    18,
+			".jsx":    18,
+			".vue":    18,
+			".svelte": 18,
+			".java":   18,
+			".c":      15,
+			".cpp":    15,
+			".h":      10,
+			".rb":     15,
+			".php":    15,
+			".sql":    12,
+		},
+	}
+}
+
+// FillDefaults replaces any section left unset in a stored profile with the
+// built-in one, so a partial profile only overrides what it names.
+func (sc *ScoringConfig) FillDefaults() {
+	def := DefaultScoringConfig()
+	if sc.EntryPoints == nil {
+		sc.EntryPoints = def.EntryPoints
+	}
+	if sc.ConfigFiles == nil {
+		sc.ConfigFiles = def.ConfigFiles
+	}
+	if sc.ImportantDirs == nil {
+		sc.ImportantDirs = def.ImportantDirs
+	}
+	if sc.ExtensionBoost == nil {
+		sc.ExtensionBoost = def.ExtensionBoost
+	}
+	if sc.IgnoredFiles == nil {
+		sc.IgnoredFiles = def.IgnoredFiles
+	}
+}
+
+// Validate checks a scoring profile supplied by a user. Sections may be
+// left unset; names must be lowercase, as they are matched against
+// lowercased paths, and scores within bounds. Errors wrap
+// ErrInvalidScoringConfig and name the offending section.
+func (sc *ScoringConfig) Validate() error {
+	lists := []struct {
+		section string
+		names   []string
+	}{
+		{"entry_points", sc.EntryPoints},
+		{"config_files", sc.ConfigFiles},
+		{"ignored_files", sc.IgnoredFiles},
+	}
+	for _, list := range lists {
+		if len(list.names) > MaxScoringEntries {
+			return fmt.Errorf("%w: %s has more than %d entries", ErrInvalidScoringConfig, list.section, MaxScoringEntries)
+		}
+		for _, name := range list.names {
+			if err := validScoringName(name, true); err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidScoringConfig, list.section, err)
+			}
+			if strings.Contains(name, "/") {
+				return fmt.Errorf("%w: %s: %q is a path, not a file name", ErrInvalidScoringConfig, list.section, name)
+			}
+		}
+	}
+
+	if len(sc.ImportantDirs) > MaxScoringEntries {
+		return fmt.Errorf("%w: important_dirs has more than %d entries", ErrInvalidScoringConfig, MaxScoringEntries)
+	}
+	for dir, score := range sc.ImportantDirs {
+		if err := validScoringName(dir, true); err != nil {
+			return fmt.Errorf("%w: important_dirs: %v", ErrInvalidScoringConfig, err)
+		}
+		if strings.Contains(dir, "/") {
+			return fmt.Errorf("%w: important_dirs: %q is a path, not a directory name", ErrInvalidScoringConfig, dir)
+		}
+		if score < 0 || score > MaxDirScore {
+			return fmt.Errorf("%w: important_dirs: score of %q must be between 0 and %d", ErrInvalidScoringConfig, dir, MaxDirScore)
+		}
+	}
+
+	if len(sc.ExtensionBoost) > MaxScoringEntries {
+		return fmt.Errorf("%w: extension_boost has more than %d entries", ErrInvalidScoringConfig, MaxScoringEntries)
+	}
+	for ext, boost := range sc.ExtensionBoost {
+		if err := validScoringName(ext, true); err != nil {
+			return fmt.Errorf("%w: extension_boost: %v", ErrInvalidScoringConfig, err)
+		}
+		if !strings.HasPrefix(ext, ".") || strings.ContainsAny(ext, "/ ") {
+			return fmt.Errorf("%w: extension_boost: %q must be an extension like \".go\"", ErrInvalidScoringConfig, ext)
+		}
+		if boost < -MaxExtensionBoost || boost > MaxExtensionBoost {
+			return fmt.Errorf("%w: extension_boost: boost of %q must be between -%d and %d", ErrInvalidScoringConfig, ext, MaxExtensionBoost, MaxExtensionBoost)
+		}
+	}
+
+	if len(sc.ExcludedLanguages) > MaxScoringEntries {
+		return fmt.Errorf("%w: excluded_languages has more than %d entries", ErrInvalidScoringConfig, MaxScoringEntries)
+	}
+	for _, language := range sc.ExcludedLanguages {
+		if err := validScoringName(language, false); err != nil {
+			return fmt.Errorf("%w: excluded_languages: %v", ErrInvalidScoringConfig, err)
+		}
+	}
+
+	return nil
+}
+
+// validScoringName checks one name in a scoring profile.
+func validScoringName(name string, lowercase bool) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return fmt.Errorf("names must not be empty")
+	case len(name) > maxScoringNameLength:
+		return fmt.Errorf("%q is longer than %d characters", name, maxScoringNameLength)
+	case lowercase && name != strings.ToLower(name):
+		return fmt.Errorf("%q must be lowercase", name)
+	}
+	return nil
+}
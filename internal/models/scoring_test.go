@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestScoringConfigValidate(t *testing.T) {
+	tooMany := make([]string, MaxScoringEntries+1)
+	for i := range tooMany {
+		tooMany[i] = "file" + strings.Repeat("x", i%50) + ".go"
+	}
+
+	tests := []struct {
+		name    string
+		config  ScoringConfig
+		wantErr string // substring of the error; empty when valid
+	}{
+		{name: "empty"},
+		{name: "defaults", config: *DefaultScoringConfig()},
+		{
+			name: "custom",
+			config: ScoringConfig{
+				EntryPoints:       []string{"main.kt"},
+				ImportantDirs:     map[string]int{"domain": 90, "legacy": 0},
+				ExtensionBoost:    map[string]int{".kt": 20, ".css": -10},
+				ExcludedLanguages: []string{"JavaScript", ".min.js"},
+			},
+		},
+		{name: "uppercase entry point", config: ScoringConfig{EntryPoints: []string{"Main.kt"}}, wantErr: "entry_points"},
+		{name: "empty config file", config: ScoringConfig{ConfigFiles: []string{" "}}, wantErr: "config_files"},
+		{name: "path as file name", config: ScoringConfig{IgnoredFiles: []string{"vendor/lock.json"}}, wantErr: "ignored_files"},
+		{name: "too many entries", config: ScoringConfig{EntryPoints: tooMany}, wantErr: "more than"},
+		{name: "long name", config: ScoringConfig{EntryPoints: []string{strings.Repeat("a", 101)}}, wantErr: "longer than"},
+		{name: "directory score too high", config: ScoringConfig{ImportantDirs: map[string]int{"src": 1000}}, wantErr: "important_dirs"},
+		{name: "negative directory score", config: ScoringConfig{ImportantDirs: map[string]int{"src": -1}}, wantErr: "important_dirs"},
+		{name: "nested directory", config: ScoringConfig{ImportantDirs: map[string]int{"src/app": 50}}, wantErr: "important_dirs"},
+		{name: "extension without dot", config: ScoringConfig{ExtensionBoost: map[string]int{"go": 10}}, wantErr: "extension_boost"},
+		{name: "boost too low", config: ScoringConfig{ExtensionBoost: map[string]int{".go": -500}}, wantErr: "extension_boost"},
+		{name: "empty language", config: ScoringConfig{ExcludedLanguages: []string{""}}, wantErr: "excluded_languages"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidScoringConfig) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want ErrInvalidScoringConfig mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPreferencesRoundTrip(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := t.Context()
+	truncate(t, pool, "users", "user_preferences")
+	user := newTestUser(t, pool, "prefs@example.com", 1000)
+	users := NewUserService(pool, bcrypt.MinCost)
+
+	prefs, err := users.GetPreferences(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetPreferences: %v", err)
+	}
+	if prefs.MaxFiles != DefaultMaxFiles || len(prefs.Scoring.EntryPoints) == 0 {
+		t.Errorf("defaults = %d files and %d entry points", prefs.MaxFiles, len(prefs.Scoring.EntryPoints))
+	}
+
+	custom := &ScoringConfig{EntryPoints: []string{"main.kt"}, ExtensionBoost: map[string]int{".kt": 30}}
+	if err := users.SavePreferences(ctx, &UserPreferences{UserID: user.ID, Scoring: custom, MaxFiles: 25}); err != nil {
+		t.Fatalf("SavePreferences: %v", err)
+	}
+	prefs, err = users.GetPreferences(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetPreferences: %v", err)
+	}
+	if prefs.MaxFiles != 25 || len(prefs.Scoring.EntryPoints) != 1 || prefs.Scoring.ExtensionBoost[".kt"] != 30 {
+		t.Errorf("saved preferences read back as %+v", prefs)
+	}
+	if len(prefs.Scoring.ConfigFiles) == 0 {
+		t.Error("sections left out weren't filled with the defaults")
+	}
+
+	invalid := []*UserPreferences{
+		{UserID: user.ID, Scoring: custom, MaxFiles: MaxFilesLimit + 1},
+		{UserID: user.ID, Scoring: &ScoringConfig{ImportantDirs: map[string]int{"src": 1000}}, MaxFiles: 10},
+	}
+	for _, p := range invalid {
+		err := users.SavePreferences(ctx, p)
+		if !errors.Is(err, ErrInvalidMaxFiles) && !errors.Is(err, ErrInvalidScoringConfig) {
+			t.Errorf("SavePreferences(%+v) = %v, want a validation error", p, err)
+		}
+	}
+}
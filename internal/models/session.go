@@ -18,14 +18,19 @@ const (
 	MinBytesPerToken = 32
 	TokenLength      = 32
 	SessionDuration  = 24 * time.Hour
+
+	// TouchInterval throttles last_seen_at writes so an active user
+	// doesn't cause an UPDATE on every request.
+	TouchInterval = 1 * time.Minute
 )
 
 type Session struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	TokenHash string    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	TokenHash  string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
 }
 
 // IsExpired returns true if the session has expired.
@@ -46,12 +51,17 @@ func (s *Session) TimeUntilExpiry() time.Duration {
 type SessionService struct {
 	pool            *pgxpool.Pool
 	sessionDuration time.Duration
+	idleTimeout     time.Duration // 0 disables idle expiry
 }
 
-func NewSessionService(pool *pgxpool.Pool, sessionDuration time.Duration) *SessionService {
+// NewSessionService creates a SessionService.
+// Sessions expire at sessionDuration after creation, or earlier if unused
+// for longer than idleTimeout. Pass 0 to disable idle expiry.
+func NewSessionService(pool *pgxpool.Pool, sessionDuration, idleTimeout time.Duration) *SessionService {
 	return &SessionService{
 		pool:            pool,
 		sessionDuration: sessionDuration,
+		idleTimeout:     idleTimeout,
 	}
 }
 
@@ -76,7 +86,7 @@ func (s *SessionService) Create(ctx context.Context, userID int64) (token string
 	query := `
 		INSERT INTO sessions (user_id, token_hash, expires_at)
 		VALUES ($1, $2, $3)
-		RETURNING id, user_id, token_hash, created_at, expires_at
+		RETURNING id, user_id, token_hash, created_at, expires_at, last_seen_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
@@ -89,6 +99,7 @@ func (s *SessionService) Create(ctx context.Context, userID int64) (token string
 		&session.TokenHash,
 		&session.CreatedAt,
 		&session.ExpiresAt,
+		&session.LastSeenAt,
 	)
 
 	if err != nil {
@@ -101,7 +112,7 @@ func (s *SessionService) Create(ctx context.Context, userID int64) (token string
 // User retrieves the user associated with a session token.
 // 1. Hash the provided token
 // 2. Look up session by hash
-// 3. Check if expired
+// 3. Check if expired (absolute or idle)
 // 4. Return associated user
 func (s *SessionService) User(ctx context.Context, token string) (*User, error) {
 	tokenHash := hashSessionToken(token)
@@ -113,7 +124,7 @@ func (s *SessionService) User(ctx context.Context, token string) (*User, error)
 			u.api_quota_used, u.api_quota_limit, u.created_at, u.updated_at,
 			u.github_id, u.github_username, u.github_access_token_encrypted,
 			u.github_token_expires_at, u.github_connected_at,
-			s.expires_at
+			s.expires_at, s.last_seen_at
 		FROM sessions s
 		JOIN users u ON s.user_id = u.id
 		WHERE s.token_hash = $1
@@ -124,6 +135,7 @@ func (s *SessionService) User(ctx context.Context, token string) (*User, error)
 
 	user := &User{}
 	var expiresAt time.Time
+	var lastSeenAt *time.Time
 
 	err := s.pool.QueryRow(ctx, query, tokenHash).Scan(
 		&user.ID,
@@ -140,6 +152,7 @@ func (s *SessionService) User(ctx context.Context, token string) (*User, error)
 		&user.GitHubTokenExpiresAt,
 		&user.GitHubConnectedAt,
 		&expiresAt,
+		&lastSeenAt,
 	)
 
 	if err != nil {
@@ -156,6 +169,12 @@ func (s *SessionService) User(ctx context.Context, token string) (*User, error)
 		return nil, ErrSessionExpired
 	}
 
+	// Reject sessions that have sat unused past the idle window
+	if s.idleTimeout > 0 && lastSeenAt != nil && time.Since(*lastSeenAt) > s.idleTimeout {
+		go s.deleteByHash(context.Background(), tokenHash)
+		return nil, ErrSessionExpired
+	}
+
 	return user, nil
 }
 
@@ -198,17 +217,22 @@ func (s *SessionService) DeleteAllForUser(ctx context.Context, userID int64) err
 	return nil
 }
 
-// DeleteExpired removes all expired sessions from the database.
+// DeleteExpired removes all expired and idle sessions from the database.
 // Should be called periodically (e.g., via cron job or background goroutine).
 //
 // Returns the number of sessions deleted.
 func (s *SessionService) DeleteExpired(ctx context.Context) (int64, error) {
 	query := `DELETE FROM sessions WHERE expires_at < NOW()`
+	args := []any{}
+	if s.idleTimeout > 0 {
+		query += ` OR last_seen_at < $1`
+		args = append(args, time.Now().Add(-s.idleTimeout))
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	result, err := s.pool.Exec(ctx, query)
+	result, err := s.pool.Exec(ctx, query, args...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
 	}
@@ -264,6 +288,31 @@ func (s *SessionService) Extend(ctx context.Context, token string, duration time
 	return nil
 }
 
+// Touch records activity on a session by updating last_seen_at.
+// Unlike Extend, it never changes expires_at. Writes are throttled to
+// once per TouchInterval, so calling it on every request is cheap.
+func (s *SessionService) Touch(ctx context.Context, token string) error {
+	tokenHash := hashSessionToken(token)
+
+	query := `
+		UPDATE sessions
+		SET last_seen_at = NOW()
+		WHERE token_hash = $1
+		  AND expires_at > NOW()
+		  AND (last_seen_at IS NULL OR last_seen_at < $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.pool.Exec(ctx, query, tokenHash, time.Now().Add(-TouchInterval))
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	return nil
+}
+
 // StartCleanupRoutine starts a background goroutine that periodically
 // cleans up expired sessions. Returns a channel that can be closed to stop cleanup.
 func (s *SessionService) StartCleanupRoutine(interval time.Duration) chan struct{} {
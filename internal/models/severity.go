@@ -0,0 +1,89 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity is how serious an issue is. Values are stored upper case.
+type Severity string
+
+const (
+	SeverityCritical Severity = "CRITICAL" // e.g. remote code execution, exposed secrets
+	SeverityHigh     Severity = "HIGH"
+	SeverityMedium   Severity = "MEDIUM"
+	SeverityLow      Severity = "LOW"
+	SeverityInfo     Severity = "INFO"
+)
+
+// Severities lists every severity, most serious first.
+var Severities = []Severity{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo}
+
+// severityAliases maps other spellings seen in AI output to a severity.
+var severityAliases = map[string]Severity{
+	"BLOCKER":       SeverityCritical,
+	"SEVERE":        SeverityHigh,
+	"MAJOR":         SeverityHigh,
+	"MODERATE":      SeverityMedium,
+	"WARNING":       SeverityMedium,
+	"MINOR":         SeverityLow,
+	"INFORMATIONAL": SeverityInfo,
+	"NOTE":          SeverityInfo,
+}
+
+// ParseSeverity normalizes a severity in any case, accepting common aliases
+// such as "severe" or "warning".
+func ParseSeverity(s string) (Severity, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(s))
+
+	for _, sev := range Severities {
+		if normalized == string(sev) {
+			return sev, nil
+		}
+	}
+	if sev, ok := severityAliases[normalized]; ok {
+		return sev, nil
+	}
+
+	return "", fmt.Errorf("unknown severity %q", s)
+}
+
+// Rank orders severities, 0 being the most serious. Unknown severities
+// rank after all known ones.
+func (s Severity) Rank() int {
+	for i, sev := range Severities {
+		if s == sev {
+			return i
+		}
+	}
+	return len(Severities)
+}
+
+// CapIssuesBySeverity keeps at most caps[severity] issues of each severity,
+// in their original order, and returns them with how many of each severity
+// were dropped. Severities without a positive cap are kept in full.
+func CapIssuesBySeverity(issues []Issue, caps map[Severity]int) (kept []Issue, omitted map[string]int) {
+	kept = make([]Issue, 0, len(issues))
+	counts := make(map[Severity]int)
+	for _, issue := range issues {
+		if limit := caps[issue.Severity]; limit > 0 && counts[issue.Severity] >= limit {
+			if omitted == nil {
+				omitted = make(map[string]int)
+			}
+			omitted[string(issue.Severity)]++
+			continue
+		}
+		counts[issue.Severity]++
+		kept = append(kept, issue)
+	}
+	return kept, omitted
+}
+
+// SortIssuesBySeverity sorts issues most serious first, keeping the original
+// order within a severity.
+func SortIssuesBySeverity(issues []Issue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Severity.Rank() < issues[j].Severity.Rank()
+	})
+}
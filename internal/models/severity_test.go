@@ -0,0 +1,61 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Severity
+		wantErr bool
+	}{
+		{in: "high", want: SeverityHigh},
+		{in: "High", want: SeverityHigh},
+		{in: "CRITICAL", want: SeverityCritical},
+		{in: " medium\n", want: SeverityMedium},
+		{in: "info", want: SeverityInfo},
+		{in: "severe", want: SeverityHigh},
+		{in: "Warning", want: SeverityMedium},
+		{in: "blocker", want: SeverityCritical},
+		{in: "catastrophic", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSeverity(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSeverity(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSeverity(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortIssuesBySeverity(t *testing.T) {
+	issues := []Issue{
+		{Title: "low", Severity: SeverityLow},
+		{Title: "unknown", Severity: "URGENT"},
+		{Title: "high 1", Severity: SeverityHigh},
+		{Title: "info", Severity: SeverityInfo},
+		{Title: "critical", Severity: SeverityCritical},
+		{Title: "high 2", Severity: SeverityHigh},
+		{Title: "medium", Severity: SeverityMedium},
+	}
+
+	SortIssuesBySeverity(issues)
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.Title)
+	}
+	// Stable within a severity, and unknown severities last
+	want := []string{"critical", "high 1", "high 2", "medium", "low", "info", "unknown"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rahul4469/github-analyzer/migrations"
+)
+
+// newTestPool connects to the database at TEST_DATABASE_URL and migrates it,
+// or skips the test when it is unset. The database is shared by every test,
+// so each clears the tables it uses.
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := NewDatabase(context.Background(), DefaultDatabaseConfig(url))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	if err := MigrateFS(db.DB, migrations.FS, "."); err != nil {
+		t.Fatalf("MigrateFS: %v", err)
+	}
+	return db.Pool
+}
+
+// truncate empties tables, and those referencing them, for a test.
+func truncate(t *testing.T, pool *pgxpool.Pool, tables ...string) {
+	t.Helper()
+	for _, table := range tables {
+		if _, err := pool.Exec(context.Background(), "TRUNCATE "+table+" RESTART IDENTITY CASCADE"); err != nil {
+			t.Fatalf("truncate %s: %v", table, err)
+		}
+	}
+}
@@ -63,8 +63,10 @@ func (u *User) QuotaPercentUsed() int {
 // UserService handles all user-related database operations.
 // It encapsulates the database pool and provides a clean API for user management.
 type UserService struct {
-	pool       *pgxpool.Pool
-	bcryptCost int
+	pool           *pgxpool.Pool
+	bcryptCost     int
+	domainResolver DomainResolver // nil skips the email domain check
+	passwordPolicy PasswordPolicy
 }
 
 // NewUserService creates a new UserService.
@@ -81,7 +83,11 @@ func NewUserService(pool *pgxpool.Pool, bcryptCost int) *UserService {
 //
 // Returns ErrEmailAlreadyExists if the email is taken.
 // Returns ErrInvalidEmail if the email format is invalid.
+// Returns ErrEmailDomainInvalid if the domain check is enabled and the email
+// domain doesn't exist.
 // Returns ErrPasswordTooShort if password is less than 8 characters.
+// Returns a *PasswordTooWeakError, matching ErrPasswordTooWeak, if the
+// password breaks the password policy.
 func (s *UserService) Create(ctx context.Context, email, password string, defaultQuota int) (*User, error) {
 	// Validate inputs
 	email = strings.TrimSpace(strings.ToLower(email))
@@ -89,9 +95,19 @@ func (s *UserService) Create(ctx context.Context, email, password string, defaul
 		return nil, ErrInvalidEmail
 	}
 
+	if s.domainResolver != nil {
+		domain := email[strings.LastIndex(email, "@")+1:]
+		if !emailDomainResolves(ctx, s.domainResolver, domain) {
+			return nil, ErrEmailDomainInvalid
+		}
+	}
+
 	if len(password) < 8 {
 		return nil, ErrPasswordTooShort
 	}
+	if err := s.passwordPolicy.Check(password); err != nil {
+		return nil, err
+	}
 
 	// Hash password with bcrypt
 	// bcrypt automatically generates a salt and includes it in the hash
@@ -130,16 +146,22 @@ func (s *UserService) Create(ctx context.Context, email, password string, defaul
 	)
 
 	if err != nil {
-		// Check for unique constraint violation (duplicate email)
-		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint") {
-			return nil, ErrEmailAlreadyExists
-		}
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, createUserError(err)
 	}
 
 	return user, nil
 }
 
+// createUserError maps a failed insert into users to the error Create
+// returns. Emails are stored lowercased, so the unique constraint is
+// case-insensitive.
+func createUserError(err error) error {
+	if isUniqueViolation(err) {
+		return ErrEmailAlreadyExists
+	}
+	return fmt.Errorf("failed to create user: %w", err)
+}
+
 // Authenticate verifies credentials and returns the user if valid.
 // Uses constant-time comparison to prevent timing attacks.
 //
@@ -303,34 +325,33 @@ func (s *UserService) ClearGitHubToken(ctx context.Context, userID int64) error
 }
 
 // UpdateAPIQuota adds the specified number of tokens to the user's usage.
-// Returns an error if this would exceed their quota limit.
+// Returns an error wrapping ErrQuotaExceeded, and charges nothing, if that
+// would exceed the user's limit. The check and the charge are one
+// statement, so concurrent charges can't overshoot the limit.
 func (s *UserService) UpdateAPIQuota(ctx context.Context, userID int64, tokensUsed int) error {
-	// First check if user has enough quota
-	user, err := s.ByID(ctx, userID)
-	if err != nil {
-		return err
-	}
-
-	if user.APIQuotaUsed+tokensUsed > user.APIQuotaLimit {
-		return fmt.Errorf("quota exceeded: would use %d tokens but limit is %d (currently used: %d)",
-			user.APIQuotaUsed+tokensUsed, user.APIQuotaLimit, user.APIQuotaUsed)
-	}
-
 	query := `
 		UPDATE users
 		SET api_quota_used = api_quota_used + $1, updated_at = NOW()
-		WHERE id = $2
+		WHERE id = $2 AND api_quota_used + $1 <= api_quota_limit
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	_, err = s.pool.Exec(ctx, query, tokensUsed, userID)
+	tag, err := s.pool.Exec(ctx, query, tokensUsed, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update API quota: %w", err)
 	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
 
-	return nil
+	user, err := s.ByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: would use %d tokens but limit is %d (currently used: %d)",
+		ErrQuotaExceeded, user.APIQuotaUsed+tokensUsed, user.APIQuotaLimit, user.APIQuotaUsed)
 }
 
 // ResetAPIQuota resets the user's API quota usage to zero.
@@ -353,6 +374,35 @@ func (s *UserService) ResetAPIQuota(ctx context.Context, userID int64) error {
 	return nil
 }
 
+// SetQuotaLimit sets the user's API quota limit, e.g. after a plan change.
+// Usage is left as is; see ResetAPIQuota.
+// Returns ErrInvalidQuotaLimit if limit is negative.
+func (s *UserService) SetQuotaLimit(ctx context.Context, userID int64, limit int) error {
+	if limit < 0 {
+		return ErrInvalidQuotaLimit
+	}
+
+	query := `
+		UPDATE users
+		SET api_quota_limit = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	result, err := s.pool.Exec(ctx, query, limit, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set quota limit: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 // hashToken creates a SHA256 hash of a token.
 // Used for GitHub tokens and session tokens.
 func hashToken(token string) string {
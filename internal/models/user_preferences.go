@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// DefaultMaxFiles is how many files are fetched when the user has no preference.
+	DefaultMaxFiles = 15
+	// MaxFilesLimit is the most files a user may ask to fetch per analysis.
+	MaxFilesLimit = 50
+)
+
+// UserPreferences holds a user's saved analysis defaults.
+type UserPreferences struct {
+	UserID    int64          `json:"user_id"`
+	Scoring   *ScoringConfig `json:"scoring"`
+	MaxFiles  int            `json:"max_files"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// GetPreferences returns the user's saved preferences, or the defaults if
+// none have been saved.
+func (s *UserService) GetPreferences(ctx context.Context, userID int64) (*UserPreferences, error) {
+	query := `
+		SELECT scoring_profile, max_files, updated_at
+		FROM user_preferences
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	prefs := &UserPreferences{UserID: userID}
+	var scoringJSON []byte
+	err := s.pool.QueryRow(ctx, query, userID).Scan(&scoringJSON, &prefs.MaxFiles, &prefs.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			prefs.Scoring = DefaultScoringConfig()
+			prefs.MaxFiles = DefaultMaxFiles
+			return prefs, nil
+		}
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+
+	prefs.Scoring = &ScoringConfig{}
+	if len(scoringJSON) > 0 {
+		if err := json.Unmarshal(scoringJSON, prefs.Scoring); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal scoring profile: %w", err)
+		}
+	}
+	prefs.Scoring.FillDefaults()
+
+	return prefs, nil
+}
+
+// SavePreferences creates or replaces the user's preferences. Invalid
+// preferences return an error wrapping ErrInvalidMaxFiles or
+// ErrInvalidScoringConfig.
+func (s *UserService) SavePreferences(ctx context.Context, prefs *UserPreferences) error {
+	if prefs.MaxFiles < 1 || prefs.MaxFiles > MaxFilesLimit {
+		return fmt.Errorf("%w: must be between 1 and %d", ErrInvalidMaxFiles, MaxFilesLimit)
+	}
+	if prefs.Scoring != nil {
+		if err := prefs.Scoring.Validate(); err != nil {
+			return err
+		}
+	}
+
+	scoringJSON, err := json.Marshal(prefs.Scoring)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scoring profile: %w", err)
+	}
+
+	query := `
+		INSERT INTO user_preferences (user_id, scoring_profile, max_files, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET scoring_profile = EXCLUDED.scoring_profile,
+		    max_files = EXCLUDED.max_files,
+		    updated_at = NOW()
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	err = s.pool.QueryRow(ctx, query, prefs.UserID, scoringJSON, prefs.MaxFiles).Scan(&prefs.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserServiceBcryptCost(t *testing.T) {
+	pool := newTestPool(t)
+	truncate(t, pool, "users")
+	ctx := context.Background()
+
+	// Not the default cost, so the hash shows which one was used
+	const cost = bcrypt.MinCost + 1
+	users := NewUserService(pool, cost)
+	if _, err := users.Create(ctx, "cost@example.com", "correct-horse-battery", 1000); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	user, err := users.ByEmail(ctx, "cost@example.com")
+	if err != nil {
+		t.Fatalf("ByEmail: %v", err)
+	}
+	got, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if err != nil {
+		t.Fatalf("bcrypt.Cost: %v", err)
+	}
+	if got != cost {
+		t.Errorf("password hashed with cost %d, want %d", got, cost)
+	}
+}
+
+func TestCreateDuplicateEmail(t *testing.T) {
+	pool := newTestPool(t)
+	truncate(t, pool, "users")
+	ctx := context.Background()
+
+	users := NewUserService(pool, bcrypt.MinCost)
+	if _, err := users.Create(ctx, "dup@example.com", "correct-horse-battery", 1000); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := users.Create(ctx, "Dup@Example.com", "correct-horse-battery", 1000); !errors.Is(err, ErrEmailAlreadyExists) {
+		t.Errorf("Create with the email in another case = %v, want ErrEmailAlreadyExists", err)
+	}
+}
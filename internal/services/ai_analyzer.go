@@ -3,11 +3,15 @@ package services
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,20 +19,165 @@ import (
 	"github.com/rahul4469/github-analyzer/internal/models"
 )
 
+const (
+	// DefaultAIMaxRetries is how often a rate limited request is retried by default.
+	DefaultAIMaxRetries = 2
+	// aiBaseBackoff is the first retry wait when Retry-After is missing; it doubles per attempt.
+	aiBaseBackoff = 2 * time.Second
+	// aiMaxBackoff caps a single retry wait, whatever Retry-After asks for.
+	aiMaxBackoff = 60 * time.Second
+
+	// PromptVersion is part of every CacheKey. Bump it when the prompts or
+	// the response parsing change, so results of the old ones aren't reused.
+	PromptVersion = 2
+)
+
+// DefaultAIBaseURL is the Perplexity API. Any OpenAI-compatible gateway
+// serving /chat/completions can be used instead.
+const DefaultAIBaseURL = "https://api.perplexity.ai"
+
 type PerplexityService struct {
-	apiKey     string
-	model      string
-	httpClient *http.Client
+	baseURL        string
+	apiKey         string
+	model          string
+	languageModels map[string]string // lowercased primary language -> model
+	maxRetries     int               // retries after a 429 response
+	httpClient     *http.Client
+	systemPrompt   string // reviewer persona and focus
+	userPrompt     string // template containing PromptRepositoryPlaceholder
+	maxTokens      int    // completion token limit; 0 leaves it to the API
+	retryMaxTokens int    // limit for retrying a truncated response; 0 disables the retry
+
+	issueCaps      map[models.Severity]int // most issues stored per severity; unset severities are uncapped
+	maxKeyFindings int                     // most key findings kept in the summary
 }
 
-func NewPerplexityService(apiKey, model string) *PerplexityService {
+// NewPerplexityService creates a PerplexityService. languageModels maps a
+// repository's primary language to a preferred model; unmapped languages
+// use model. Rate limited requests are retried up to maxRetries times.
+// Requests go to baseURL + "/chat/completions"; an empty baseURL uses
+// DefaultAIBaseURL.
+func NewPerplexityService(baseURL, apiKey, model string, languageModels map[string]string, maxRetries int) *PerplexityService {
+	if baseURL == "" {
+		baseURL = DefaultAIBaseURL
+	}
+
+	normalized := make(map[string]string, len(languageModels))
+	for lang, m := range languageModels {
+		normalized[strings.ToLower(strings.TrimSpace(lang))] = m
+	}
+
 	return &PerplexityService{
-		apiKey: apiKey,
-		model:  model,
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		apiKey:         apiKey,
+		model:          model,
+		languageModels: normalized,
+		maxRetries:     maxRetries,
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second, // AI responses can take time
 		},
+		systemPrompt:   defaultSystemPrompt,
+		userPrompt:     defaultUserPrompt,
+		maxKeyFindings: models.DefaultMaxKeyFindings,
+	}
+}
+
+// PromptRepositoryPlaceholder marks where a user prompt template receives
+// the repository data: metadata, structure, README and source files. The
+// configuration checks a template contains it exactly once.
+const PromptRepositoryPlaceholder = "{{repository}}"
+
+// SetPrompts overrides the default prompts; an empty argument keeps the
+// default. system replaces the reviewer persona and focus, and is always
+// followed by the issue format instructions so responses stay parseable.
+// user is a template containing PromptRepositoryPlaceholder.
+func (s *PerplexityService) SetPrompts(system, user string) {
+	if strings.TrimSpace(user) != "" {
+		s.userPrompt = user
+	}
+	if strings.TrimSpace(system) != "" {
+		s.systemPrompt = strings.TrimSpace(system)
+	}
+}
+
+// SetTokenBudget sets the completion token limit sent with each request,
+// 0 leaving it to the API's default. A response cut off by the limit is
+// retried once with retryMaxTokens if that is higher; 0 disables the retry.
+// Without a limit the API's default is unknown, so nothing is retried.
+func (s *PerplexityService) SetTokenBudget(maxTokens, retryMaxTokens int) {
+	s.maxTokens = maxTokens
+	s.retryMaxTokens = retryMaxTokens
+}
+
+// SetIssueCaps limits how many issues of each severity are kept, e.g.
+// {"low": 50}, so a noisy response can't flood the result. Issues are kept
+// in the AI's order; the rest are only counted in the summary. 0 leaves a
+// severity uncapped.
+func (s *PerplexityService) SetIssueCaps(caps map[string]int) error {
+	parsed := make(map[models.Severity]int, len(caps))
+	for name, limit := range caps {
+		sev, err := models.ParseSeverity(name)
+		if err != nil {
+			return err
+		}
+		if limit < 0 {
+			return fmt.Errorf("cap for %s must not be negative", sev)
+		}
+		parsed[sev] = limit
+	}
+	s.issueCaps = parsed
+	return nil
+}
+
+// SetMaxKeyFindings sets how many key findings a summary keeps, whether
+// taken from the AI response or derived from the issues.
+func (s *PerplexityService) SetMaxKeyFindings(n int) error {
+	if n < 1 {
+		return fmt.Errorf("max key findings must be at least 1, got %d", n)
+	}
+	s.maxKeyFindings = n
+	return nil
+}
+
+// CacheKey identifies the result Analyze would produce for input: a hash
+// of the prompt version, model, prompts, token budget and issue caps, and of
+// what the input says about the repository at the analyzed revision - its
+// metadata, structure, README and the TreeHash of its files. Activity counts
+// change between runs without the code changing, so they're left out.
+// Analyses with equal keys can share a result.
+func (s *PerplexityService) CacheKey(input AnalysisInput) string {
+	h := sha256.New()
+	// fmt prints maps sorted by key, so the caps hash the same every time
+	fmt.Fprintf(h, "v%d\x00%s\x00%d\x00%d\x00%v\x00%d\x00",
+		PromptVersion, s.ModelFor(input.PrimaryLanguage), s.maxTokens, s.retryMaxTokens, s.issueCaps, s.maxKeyFindings)
+	for _, text := range []string{s.getSystemPrompt(), s.userPrompt} {
+		sum := sha256.Sum256([]byte(text))
+		h.Write(sum[:])
 	}
+
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00%t\x00%t\x00%d\x00",
+		input.RepoOwner, input.RepoName, input.Description, input.PrimaryLanguage, input.License,
+		input.NoLicense, input.MetadataOnly, input.READMESize)
+	readme := sha256.Sum256([]byte(input.README))
+	h.Write(readme[:])
+	if input.CodeStructure != nil {
+		// Marshaling sorts the language breakdown by key too
+		structure, _ := json.Marshal(input.CodeStructure)
+		h.Write(structure)
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(models.TreeHash(models.HashFiles(input.CodeFiles))))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ModelFor returns the model to use for a repository with the given primary
+// language, falling back to the default model.
+func (s *PerplexityService) ModelFor(language string) string {
+	if m, ok := s.languageModels[strings.ToLower(strings.TrimSpace(language))]; ok && m != "" {
+		return m
+	}
+	return s.model
 }
 
 // AnalysisInput contains all data needed for AI analysis.
@@ -38,20 +187,104 @@ type AnalysisInput struct {
 	Description     string
 	PrimaryLanguage string
 	README          string
+	READMESize      int // full README size in bytes, before truncation
 	CodeStructure   *models.CodeStructure
 	CodeFiles       []models.FileContent
+	MetadataOnly    bool                // no source files were fetched (metadata mode)
+	License         string              // SPDX id of the detected license, if any
+	NoLicense       bool                // GitHub confirmed the repository has no license file
+	Activity        *RepositoryActivity // nil for gists and uploads
+
+	// When set, Analyze fills it with the raw request and response, even
+	// if the call or parsing fails.
+	Capture *AIExchange
+}
+
+// RepositoryActivity is how much open work a repository has, a signal of
+// how actively it is maintained.
+type RepositoryActivity struct {
+	OpenIssues       int // open issues and pull requests, as GitHub counts them
+	OpenPullRequests int // -1 when unknown
+}
+
+// maxCapturedAIBytes caps each side of a captured AIExchange.
+const maxCapturedAIBytes = 64 << 10
+
+// AIExchange is the raw text sent to and received from the AI, with secrets
+// redacted and each side capped at maxCapturedAIBytes. Used for debugging
+// responses the parser can't handle.
+type AIExchange struct {
+	Request  string // system and user prompts
+	Response string // response body, or the error if there was none
+}
+
+// capturedText redacts secrets in s and caps it for an AIExchange.
+func capturedText(s string) string {
+	s, _ = redactContent(s)
+	return truncateString(s, maxCapturedAIBytes)
+}
+
+// Limits enforced by AnalysisInput.Validate. They sit well above what the
+// GitHub fetch produces, and only catch inputs that would blow the prompt up.
+const (
+	maxInputDescriptionBytes = 2000
+	maxInputREADMEBytes      = 1 << 20
+	maxInputCodeBytes        = 2 << 20
+	maxInputFiles            = models.MaxFilesLimit
+)
+
+// Validate checks that the input is worth sending to the AI: it needs a
+// repository name and at least some content (source files, a README or a
+// non-empty file structure), and its fields must be of sane size.
+func (in AnalysisInput) Validate() error {
+	if strings.TrimSpace(in.RepoOwner) == "" || strings.TrimSpace(in.RepoName) == "" {
+		return &AnalysisInputError{Field: "repo", Message: "owner and name are required", kind: ErrInvalidAnalysisInput}
+	}
+
+	hasStructure := in.CodeStructure != nil && in.CodeStructure.TotalFiles > 0
+	if len(in.CodeFiles) == 0 && strings.TrimSpace(in.README) == "" && !hasStructure {
+		return &AnalysisInputError{Message: "no source files, README or file structure", kind: ErrNothingToAnalyze}
+	}
+
+	if len(in.Description) > maxInputDescriptionBytes {
+		return &AnalysisInputError{Field: "description", Message: fmt.Sprintf("longer than %d bytes", maxInputDescriptionBytes), kind: ErrInvalidAnalysisInput}
+	}
+	if len(in.README) > maxInputREADMEBytes {
+		return &AnalysisInputError{Field: "readme", Message: fmt.Sprintf("longer than %d bytes", maxInputREADMEBytes), kind: ErrInvalidAnalysisInput}
+	}
+	if len(in.CodeFiles) > maxInputFiles {
+		return &AnalysisInputError{Field: "code_files", Message: fmt.Sprintf("more than %d files", maxInputFiles), kind: ErrInvalidAnalysisInput}
+	}
+
+	total := 0
+	for _, file := range in.CodeFiles {
+		total += len(file.Content)
+	}
+	if total > maxInputCodeBytes {
+		return &AnalysisInputError{Field: "code_files", Message: fmt.Sprintf("more than %d bytes of code", maxInputCodeBytes), kind: ErrInvalidAnalysisInput}
+	}
+
+	return nil
 }
 
 type AnalysisResult struct {
-	RawAnalysis string
-	Summary     *models.AnalysisSummary
-	Issues      []models.Issue
-	TokensUsed  int
+	RawAnalysis  string
+	Summary      *models.AnalysisSummary
+	Issues       []models.Issue
+	TokensUsed   int    // across all attempts
+	FinishReason string // of the response used, e.g. "stop"
+}
+
+// Truncated reports whether the response was cut off by the token limit,
+// so Issues may be incomplete.
+func (r *AnalysisResult) Truncated() bool {
+	return r.FinishReason == models.FinishReasonLength
 }
 
 type PerplexityRequest struct {
-	Model    string              `json:"model"`
-	Messages []PerplexityMessage `json:"messages"`
+	Model     string              `json:"model"`
+	Messages  []PerplexityMessage `json:"messages"`
+	MaxTokens int                 `json:"max_tokens,omitempty"`
 }
 
 type PerplexityMessage struct {
@@ -83,7 +316,8 @@ func (s *PerplexityService) Analyze(ctx context.Context, input AnalysisInput) (*
 
 	// Build the request to be sent to ai
 	request := PerplexityRequest{
-		Model: s.model,
+		Model:     s.ModelFor(input.PrimaryLanguage),
+		MaxTokens: s.maxTokens,
 		Messages: []PerplexityMessage{
 			{
 				Role:    "system",
@@ -96,33 +330,76 @@ func (s *PerplexityService) Analyze(ctx context.Context, input AnalysisInput) (*
 		},
 	}
 
-	reqBody, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	if input.Capture != nil {
+		input.Capture.Request = capturedText(request.Messages[0].Content + "\n\n" + prompt)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.perplexity.ai/chat/completions", bytes.NewReader(reqBody))
+	response, err := s.complete(ctx, request, input.Capture)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
+	}
+	tokensUsed := response.Usage.TotalTokens
+
+	// A response cut off by the token limit would silently yield only the
+	// issues before the cut, so give it one more try with a bigger budget.
+	// Only a limit we set is known to be below the retry's.
+	if response.Choices[0].FinishReason == models.FinishReasonLength && request.MaxTokens > 0 && request.MaxTokens < s.retryMaxTokens {
+		log.Printf("AI response was truncated, retrying with max_tokens=%d", s.retryMaxTokens)
+		request.MaxTokens = s.retryMaxTokens
+
+		retried, err := s.complete(ctx, request, input.Capture)
+		if err != nil {
+			// Keep the truncated response rather than failing the analysis
+			log.Printf("Retrying truncated AI response failed: %v", err)
+		} else {
+			response = retried
+			tokensUsed += retried.Usage.TotalTokens
+		}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	rawAnalysis := response.Choices[0].Message.Content
 
-	// Send the request and receive response using http.Do()
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to call Perplexity API: %w", err)
+	// Parse the structured response
+	issues := s.parseIssues(rawAnalysis)
+	if input.NoLicense {
+		issues = append(issues, missingLicenseIssue())
+	}
+	if issue, ok := testMaturityIssue(input.CodeStructure); ok {
+		issues = append(issues, issue)
 	}
-	defer resp.Body.Close()
+	models.SortIssuesBySeverity(issues)
+	issues, omitted := models.CapIssuesBySeverity(issues, s.issueCaps)
+	if len(omitted) > 0 {
+		log.Printf("Omitted issues over the severity caps: %v", omitted)
+	}
+	summary := s.buildSummary(issues, omitted, parseKeyFindings(rawAnalysis))
 
-	body, err := io.ReadAll(resp.Body)
+	return &AnalysisResult{
+		RawAnalysis:  rawAnalysis,
+		Summary:      summary,
+		Issues:       issues,
+		TokensUsed:   tokensUsed,
+		FinishReason: response.Choices[0].FinishReason,
+	}, nil
+}
+
+// complete sends a chat completion request and decodes the response. The
+// raw response, or the error, is recorded in capture when it is set.
+func (s *PerplexityService) complete(ctx context.Context, request PerplexityRequest, capture *AIExchange) (*PerplexityResponse, error) {
+	reqBody, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Perplexity API error (%d): %s", resp.StatusCode, string(body))
+	body, err := s.post(ctx, reqBody)
+	if err != nil {
+		if capture != nil {
+			capture.Response = capturedText(err.Error())
+		}
+		return nil, err
+	}
+	if capture != nil {
+		capture.Response = capturedText(string(body))
 	}
 
 	var response PerplexityResponse
@@ -134,32 +411,162 @@ func (s *PerplexityService) Analyze(ctx context.Context, input AnalysisInput) (*
 		return nil, fmt.Errorf("no response from Perplexity AI")
 	}
 
-	rawAnalysis := response.Choices[0].Message.Content
+	return &response, nil
+}
 
-	// Parse the structured response
-	issues := s.parseIssues(rawAnalysis)
-	summary := s.buildSummary(issues, rawAnalysis)
+// post sends a chat completion request and returns the response body.
+// Rate limited requests are retried with backoff, honoring Retry-After,
+// unless the wait would outlast ctx.
+func (s *PerplexityService) post(ctx context.Context, reqBody []byte) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/chat/completions", bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
 
-	return &AnalysisResult{
-		RawAnalysis: rawAnalysis,
-		Summary:     summary,
-		Issues:      issues,
-		TokensUsed:  response.Usage.TotalTokens,
-	}, nil
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+		req.Header.Set("Content-Type", "application/json")
+
+		// Send the request and receive response using http.Do()
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to call Perplexity API: %w", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			return body, nil
+		}
+
+		apiErr := newAIAPIError(resp.StatusCode, body)
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= s.maxRetries {
+			return nil, apiErr
+		}
+
+		wait := aiRetryWait(resp.Header.Get("Retry-After"), attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, apiErr
+		}
+
+		log.Printf("Perplexity rate limited, retrying in %s (attempt %d of %d)", wait, attempt+1, s.maxRetries)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, apiErr
+		case <-timer.C:
+		}
+	}
+}
+
+// aiRetryWait returns how long to wait before retrying a rate limited
+// request. Retry-After may be in seconds or an HTTP date; without it the
+// wait doubles from aiBaseBackoff. The result is capped at aiMaxBackoff.
+func aiRetryWait(retryAfter string, attempt int) time.Duration {
+	wait := aiMaxBackoff
+	if attempt < 5 {
+		wait = aiBaseBackoff << attempt
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(retryAfter)); err == nil && secs >= 0 {
+		wait = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(retryAfter); err == nil {
+		wait = time.Until(at)
+	}
+	if wait < 0 {
+		return 0
+	}
+	if wait > aiMaxBackoff {
+		return aiMaxBackoff
+	}
+	return wait
+}
+
+// missingLicenseIssue is reported for repositories without a license file.
+func missingLicenseIssue() models.Issue {
+	return models.Issue{
+		Severity:    models.SeverityInfo,
+		Category:    models.CategoryMaintainability,
+		Title:       "No license",
+		Description: "The repository has no license file, so others have no clear right to use, modify or distribute the code.",
+		Suggestion:  "Add a LICENSE file; see https://choosealicense.com for help picking one.",
+	}
+}
+
+// testMaturityIssue notes how well tested the repository looks from its
+// test-to-source file ratio. ok is false when no source files were counted.
+func testMaturityIssue(cs *models.CodeStructure) (issue models.Issue, ok bool) {
+	issue = models.Issue{
+		Severity: models.SeverityInfo,
+		Category: models.CategoryMaintainability,
+	}
+
+	switch cs.TestMaturity() {
+	case "":
+		return issue, false
+	case models.TestMaturityNone:
+		issue.Title = "No tests found"
+		issue.Description = fmt.Sprintf("None of the %d source files has a matching test file, so changes can't be verified automatically.", cs.SourceFiles)
+		issue.Suggestion = "Add automated tests, starting with the core logic and the code that changes most often."
+		return issue, true
+	case models.TestMaturityLow:
+		issue.Title = "Low testing maturity"
+		issue.Suggestion = "Add tests for the untested packages, starting with the core logic."
+	case models.TestMaturityModerate:
+		issue.Title = "Moderate testing maturity"
+		issue.Suggestion = "Extend tests to the remaining modules and edge cases."
+	default:
+		issue.Title = "Good testing maturity"
+		issue.Suggestion = "Keep tests alongside new code; measure line coverage to find remaining gaps."
+	}
+	issue.Description = fmt.Sprintf("Found %d test files for %d source files (a %d%% test-to-source ratio). File counts are only a rough signal of coverage.",
+		cs.TestFiles, cs.SourceFiles, cs.TestRatioPercent())
+	return issue, true
+}
+
+// newAIAPIError classifies a non-200 Perplexity response.
+func newAIAPIError(statusCode int, body []byte) *AIAPIError {
+	apiErr := &AIAPIError{
+		StatusCode: statusCode,
+		Message:    truncateString(strings.TrimSpace(string(body)), 500),
+	}
+
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		apiErr.kind = ErrAIRateLimited
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		apiErr.kind = ErrAIAuth
+	case statusCode >= 500:
+		apiErr.kind = ErrAIServer
+	}
+
+	return apiErr
 }
 
 func (s *PerplexityService) getSystemPrompt() string {
-	return `You are an expert code reviewer and software architect. Your task is to analyze code repositories and identify:
+	return s.systemPrompt + "\n\n" + issueFormatInstructions
+}
+
+// defaultSystemPrompt is the reviewer persona used unless overridden.
+const defaultSystemPrompt = `You are an expert code reviewer and software architect. Your task is to analyze code repositories and identify:
 
 1. **Bugs & Errors**: Logic errors, potential crashes, unhandled edge cases, null pointer issues
 2. **Security Vulnerabilities**: SQL injection, XSS, authentication flaws, secrets exposure, input validation issues
 3. **Performance Issues**: N+1 queries, memory leaks, inefficient algorithms, unnecessary allocations
 4. **Code Quality**: Poor error handling, missing validation, code smells, anti-patterns
-5. **Best Practice Violations**: Naming conventions, code organization, documentation gaps
-
-For each issue found, provide:
-- Severity: HIGH, MEDIUM, LOW, or INFO
-- Category: bug, security, performance, quality, or style
+5. **Best Practice Violations**: Naming conventions, code organization, documentation gaps`
+
+// issueFormatInstructions tell the AI how to lay out issues for the parser.
+// They follow the system prompt, whether default or overridden.
+const issueFormatInstructions = `For each issue found, provide:
+- Severity: CRITICAL, HIGH, MEDIUM, LOW, or INFO (reserve CRITICAL for exploitable
+  flaws such as remote code execution, authentication bypass or exposed secrets)
+- Category: security, secret, reliability, performance, maintainability,
+  dependency, or style
 - File and line number if identifiable
 - Clear description of the problem
 - Specific suggestion for fixing it
@@ -168,26 +575,54 @@ Format your response with a structured ISSUES section using this exact format:
 
 ## ISSUES
 
+[CRITICAL/secret] Hardcoded API key committed to the repository
+File: config/config.go:12
+Description: What's exposed and how it could be abused
+Suggestion: How to fix it
+
 [HIGH/security] Title of the issue
 File: path/to/file.go:123
 Description: Detailed description of what's wrong
 Suggestion: How to fix it
 
-[MEDIUM/bug] Another issue title
+[MEDIUM/reliability] Another issue title
 File: path/to/file.go:45
 Description: What's the problem
 Suggestion: How to fix it
 
 Also provide:
 - An OVERVIEW section with general assessment
+- A KEY FINDINGS section: a "## KEY FINDINGS" heading followed by a bulleted
+  list of the most important takeaways, one line each, most important first
 - A SUMMARY section with counts by severity
 - A RECOMMENDATIONS section with top priorities
 
 Be thorough but focus on real, actionable issues rather than style nitpicks.`
-}
 
-// buildPrompt constructs the analysis prompt with actual code.
+// defaultUserPrompt asks for the standard report after the repository data.
+const defaultUserPrompt = PromptRepositoryPlaceholder + `---
+
+## Analysis Request
+
+Please analyze this codebase thoroughly and provide:
+
+1. **OVERVIEW**: General assessment of code quality, architecture, and patterns used
+2. **ISSUES**: Specific bugs, security vulnerabilities, and problems found (use the format specified)
+3. **KEY FINDINGS**: The most important takeaways as a bulleted list, most important first
+4. **SUMMARY**: Count of issues by severity (CRITICAL/HIGH/MEDIUM/LOW/INFO)
+5. **RECOMMENDATIONS**: Top 3-5 priority improvements
+
+Focus on actionable, specific issues with file paths and line numbers where possible.
+`
+
+// buildPrompt fills the user prompt template with the repository data.
 func (s *PerplexityService) buildPrompt(input AnalysisInput) string {
+	return strings.Replace(s.userPrompt, PromptRepositoryPlaceholder, repositoryData(input), 1)
+}
+
+// repositoryData describes the repository with its actual code, for the
+// user prompt.
+func repositoryData(input AnalysisInput) string {
 	var prompt strings.Builder
 
 	prompt.WriteString(fmt.Sprintf("# Repository Analysis: %s/%s\n\n", input.RepoOwner, input.RepoName))
@@ -199,6 +634,17 @@ func (s *PerplexityService) buildPrompt(input AnalysisInput) string {
 	if input.Description != "" {
 		prompt.WriteString(fmt.Sprintf("- **Description**: %s\n", input.Description))
 	}
+	if input.License != "" {
+		prompt.WriteString(fmt.Sprintf("- **License**: %s\n", input.License))
+	}
+	if a := input.Activity; a != nil {
+		if a.OpenPullRequests >= 0 {
+			prompt.WriteString(fmt.Sprintf("- **Open Issues**: %d\n", max(a.OpenIssues-a.OpenPullRequests, 0)))
+			prompt.WriteString(fmt.Sprintf("- **Open Pull Requests**: %d\n", a.OpenPullRequests))
+		} else {
+			prompt.WriteString(fmt.Sprintf("- **Open Issues and Pull Requests**: %d\n", a.OpenIssues))
+		}
+	}
 	prompt.WriteString("\n")
 
 	// Code structure overview
@@ -209,8 +655,21 @@ func (s *PerplexityService) buildPrompt(input AnalysisInput) string {
 
 		if len(input.CodeStructure.LanguageBreakdown) > 0 {
 			prompt.WriteString("- **Languages**:\n")
-			for lang, count := range input.CodeStructure.LanguageBreakdown {
-				prompt.WriteString(fmt.Sprintf("  - %s: %d files\n", lang, count))
+			// Most files first, in a stable order so equal inputs give
+			// equal prompts (and CacheKeys)
+			breakdown := input.CodeStructure.LanguageBreakdown
+			langs := make([]string, 0, len(breakdown))
+			for lang := range breakdown {
+				langs = append(langs, lang)
+			}
+			sort.Slice(langs, func(i, j int) bool {
+				if breakdown[langs[i]] != breakdown[langs[j]] {
+					return breakdown[langs[i]] > breakdown[langs[j]]
+				}
+				return langs[i] < langs[j]
+			})
+			for _, lang := range langs {
+				prompt.WriteString(fmt.Sprintf("  - %s: %d files\n", lang, breakdown[lang]))
 			}
 		}
 
@@ -227,26 +686,41 @@ func (s *PerplexityService) buildPrompt(input AnalysisInput) string {
 		prompt.WriteString("\n")
 	}
 
-	// README (truncated if too long)
+	// README (already capped by GitHubService.GetREADME)
 	if input.README != "" {
-		prompt.WriteString("## README\n")
-		readme := input.README
-		if len(readme) > 2000 {
-			readme = readme[:2000] + "\n... (truncated)"
+		if input.READMESize > len(input.README) {
+			prompt.WriteString(fmt.Sprintf("## README (excerpt, full README is %d bytes)\n", input.READMESize))
+		} else {
+			prompt.WriteString("## README\n")
 		}
 		prompt.WriteString("```\n")
-		prompt.WriteString(readme)
+		prompt.WriteString(input.README)
 		prompt.WriteString("\n```\n\n")
 	}
 
 	// Actual code files - THE KEY PART
-	if len(input.CodeFiles) > 0 {
+	if input.MetadataOnly {
+		prompt.WriteString("## Source Code Files\n\n")
+		prompt.WriteString("Source files were not fetched for this analysis. Base your review on the metadata, ")
+		prompt.WriteString("structure and README above, and focus on architecture, project setup and documentation.\n\n")
+	} else if len(input.CodeFiles) > 0 {
 		prompt.WriteString("## Source Code Files\n\n")
 		prompt.WriteString("Analyze the following source code files for bugs, security issues, and improvements:\n\n")
+		for _, file := range input.CodeFiles {
+			if file.Generated {
+				prompt.WriteString("Files marked **Generated** were produced by code generators and aren't edited by hand. ")
+				prompt.WriteString("Don't report style, naming, duplication or maintainability issues in them; only report bugs or security issues.\n\n")
+				break
+			}
+		}
 
 		for _, file := range input.CodeFiles {
 			prompt.WriteString(fmt.Sprintf("### %s\n", file.Path))
-			prompt.WriteString(fmt.Sprintf("**Language**: %s | **Size**: %d bytes\n", file.Language, file.Size))
+			if file.Generated {
+				prompt.WriteString(fmt.Sprintf("**Language**: %s | **Size**: %d bytes | **Generated**\n", file.Language, file.Size))
+			} else {
+				prompt.WriteString(fmt.Sprintf("**Language**: %s | **Size**: %d bytes\n", file.Language, file.Size))
+			}
 			prompt.WriteString("```" + getLanguageTag(file.Language) + "\n")
 
 			// Truncate very long files
@@ -259,16 +733,6 @@ func (s *PerplexityService) buildPrompt(input AnalysisInput) string {
 		}
 	}
 
-	// Analysis request
-	prompt.WriteString("---\n\n")
-	prompt.WriteString("## Analysis Request\n\n")
-	prompt.WriteString("Please analyze this codebase thoroughly and provide:\n\n")
-	prompt.WriteString("1. **OVERVIEW**: General assessment of code quality, architecture, and patterns used\n")
-	prompt.WriteString("2. **ISSUES**: Specific bugs, security vulnerabilities, and problems found (use the format specified)\n")
-	prompt.WriteString("3. **SUMMARY**: Count of issues by severity (HIGH/MEDIUM/LOW/INFO)\n")
-	prompt.WriteString("4. **RECOMMENDATIONS**: Top 3-5 priority improvements\n\n")
-	prompt.WriteString("Focus on actionable, specific issues with file paths and line numbers where possible.\n")
-
 	return prompt.String()
 }
 
@@ -278,7 +742,7 @@ func (s *PerplexityService) parseIssues(response string) []models.Issue {
 
 	// Pattern to match issues in format: [SEVERITY/category] Title
 	// Followed by File:, Description:, Suggestion:
-	issuePattern := regexp.MustCompile(`\[(HIGH|MEDIUM|LOW|INFO)/(bug|security|performance|quality|style)\]\s*(.+?)(?:\n|$)`)
+	issuePattern := regexp.MustCompile(`(?i)\[(CRITICAL|HIGH|MEDIUM|LOW|INFO)/([^\]\n]+)\]\s*(.+?)(?:\n|$)`)
 	filePattern := regexp.MustCompile(`(?i)File:\s*([^\n:]+)(?::(\d+))?`)
 	descPattern := regexp.MustCompile(`(?i)Description:\s*(.+?)(?:\n(?:Suggestion:|File:|\[)|$)`)
 	suggPattern := regexp.MustCompile(`(?i)Suggestion:\s*(.+?)(?:\n\n|\n\[|$)`)
@@ -301,8 +765,11 @@ func (s *PerplexityService) parseIssues(response string) []models.Issue {
 			continue
 		}
 
-		severity := strings.ToUpper(issuesSection[loc[2]:loc[3]])
-		category := strings.ToLower(issuesSection[loc[4]:loc[5]])
+		severity, err := models.ParseSeverity(issuesSection[loc[2]:loc[3]])
+		if err != nil {
+			continue
+		}
+		category := models.NormalizeCategory(issuesSection[loc[4]:loc[5]])
 		title := strings.TrimSpace(issuesSection[loc[6]:loc[7]])
 
 		// Find the content between this issue and the next
@@ -359,11 +826,12 @@ func (s *PerplexityService) parseIssuesSimple(response string) []models.Issue {
 	// Look for severity indicators
 	severityPatterns := []struct {
 		pattern  *regexp.Regexp
-		severity string
+		severity models.Severity
 	}{
-		{regexp.MustCompile(`(?i)\*\*?(critical|high severity|high risk|severe)\*\*?[:\s]+(.+?)(?:\n|$)`), "HIGH"},
-		{regexp.MustCompile(`(?i)\*\*?(warning|medium severity|medium risk|moderate)\*\*?[:\s]+(.+?)(?:\n|$)`), "MEDIUM"},
-		{regexp.MustCompile(`(?i)\*\*?(minor|low severity|low risk|suggestion)\*\*?[:\s]+(.+?)(?:\n|$)`), "LOW"},
+		{regexp.MustCompile(`(?i)\*\*?(critical|critical severity|critical risk)\*\*?[:\s]+(.+?)(?:\n|$)`), models.SeverityCritical},
+		{regexp.MustCompile(`(?i)\*\*?(high severity|high risk|severe)\*\*?[:\s]+(.+?)(?:\n|$)`), models.SeverityHigh},
+		{regexp.MustCompile(`(?i)\*\*?(warning|medium severity|medium risk|moderate)\*\*?[:\s]+(.+?)(?:\n|$)`), models.SeverityMedium},
+		{regexp.MustCompile(`(?i)\*\*?(minor|low severity|low risk|suggestion)\*\*?[:\s]+(.+?)(?:\n|$)`), models.SeverityLow},
 	}
 
 	for _, sp := range severityPatterns {
@@ -372,7 +840,7 @@ func (s *PerplexityService) parseIssuesSimple(response string) []models.Issue {
 			if len(match) >= 3 {
 				issues = append(issues, models.Issue{
 					Severity:    sp.severity,
-					Category:    "quality",
+					Category:    models.CategoryMaintainability,
 					Title:       strings.TrimSpace(match[2]),
 					Description: strings.TrimSpace(match[2]),
 				})
@@ -386,26 +854,30 @@ func (s *PerplexityService) parseIssuesSimple(response string) []models.Issue {
 	for _, match := range bullets {
 		if len(match) >= 2 {
 			// Determine severity from content
-			severity := "LOW"
+			severity := models.SeverityLow
 			content := strings.ToLower(match[1])
-			if strings.Contains(content, "security") || strings.Contains(content, "vulnerability") ||
-				strings.Contains(content, "injection") || strings.Contains(content, "critical") {
-				severity = "HIGH"
+			if strings.Contains(content, "critical") || strings.Contains(content, "remote code execution") ||
+				strings.Contains(content, "hardcoded secret") || strings.Contains(content, "exposed secret") ||
+				strings.Contains(content, "leaked credential") {
+				severity = models.SeverityCritical
+			} else if strings.Contains(content, "security") || strings.Contains(content, "vulnerability") ||
+				strings.Contains(content, "injection") {
+				severity = models.SeverityHigh
 			} else if strings.Contains(content, "bug") || strings.Contains(content, "error") ||
 				strings.Contains(content, "crash") || strings.Contains(content, "fail") {
-				severity = "MEDIUM"
+				severity = models.SeverityMedium
 			}
 
 			// Determine category
-			category := "quality"
+			category := models.CategoryMaintainability
 			if strings.Contains(content, "security") || strings.Contains(content, "auth") ||
 				strings.Contains(content, "injection") || strings.Contains(content, "xss") {
-				category = "security"
+				category = models.CategorySecurity
 			} else if strings.Contains(content, "performance") || strings.Contains(content, "slow") ||
 				strings.Contains(content, "memory") || strings.Contains(content, "n+1") {
-				category = "performance"
+				category = models.CategoryPerformance
 			} else if strings.Contains(content, "bug") || strings.Contains(content, "error") {
-				category = "bug"
+				category = models.CategoryReliability
 			}
 
 			issues = append(issues, models.Issue{
@@ -420,43 +892,52 @@ func (s *PerplexityService) parseIssuesSimple(response string) []models.Issue {
 	return issues
 }
 
-func (s *PerplexityService) buildSummary(issues []models.Issue, rawAnalysis string) *models.AnalysisSummary {
-	summary := &models.AnalysisSummary{
-		TotalIssues:      len(issues),
-		IssuesBySeverity: make(map[string]int),
-		IssuesByCategory: make(map[string]int),
-		KeyFindings:      []string{},
-	}
+// buildSummary summarizes issues, with the key findings from the AI
+// response or, without any, derived from the most severe issues.
+func (s *PerplexityService) buildSummary(issues []models.Issue, omitted map[string]int, keyFindings []string) *models.AnalysisSummary {
+	summary := &models.AnalysisSummary{OmittedBySeverity: omitted, MaxKeyFindings: s.maxKeyFindings}
+	summary.Recompute(issues)
+	summary.SetAIKeyFindings(keyFindings)
+	return summary
+}
 
-	// Count by severity and category
-	for _, issue := range issues {
-		summary.IssuesBySeverity[issue.Severity]++
-		summary.IssuesByCategory[issue.Category]++
-	}
+var (
+	// keyFindingsHeading matches the KEY FINDINGS heading as a Markdown
+	// heading, bold line or numbered item, e.g. "## KEY FINDINGS" or
+	// "3. **Key Findings**:".
+	keyFindingsHeading = regexp.MustCompile(`(?im)^[ \t]*(?:#{1,6}[ \t]*)?(?:\d+\.[ \t]*)?\**[ \t]*key findings[ \t]*\**[ \t]*:?[ \t]*\**[ \t]*$`)
+	// sectionStart matches the line starting the next section: a Markdown
+	// heading, a line in bold on its own or a numbered item naming a
+	// section in capitals, e.g. "4. **SUMMARY**: ...".
+	sectionStart = regexp.MustCompile(`^(?:#{1,6}\s|\*\*[^*]+\*\*:?$|\d+\.\s+\*\*[A-Z][A-Z ]+\*\*)`)
+	// listItem matches a bulleted or numbered list item.
+	listItem = regexp.MustCompile(`^(?:[-*•]|\d+[.)])\s+(.+)$`)
+)
 
-	// Calculate overall score (0-100)
-	// Start at 100, deduct points for issues
-	score := 100
-	score -= summary.IssuesBySeverity["HIGH"] * 10
-	score -= summary.IssuesBySeverity["MEDIUM"] * 5
-	score -= summary.IssuesBySeverity["LOW"] * 3
-	score -= summary.IssuesBySeverity["INFO"] * 1
-	if score < 0 {
-		score = 0
+// parseKeyFindings extracts the list items of the KEY FINDINGS section of
+// the AI response, in order, without Markdown emphasis. Returns nil if the
+// response has no such section.
+func parseKeyFindings(response string) []string {
+	loc := keyFindingsHeading.FindStringIndex(response)
+	if loc == nil {
+		return nil
 	}
-	summary.OverallScore = score
 
-	// Extract key findings (top 5 high/medium issues)
-	for _, issue := range issues {
-		if len(summary.KeyFindings) >= 5 {
+	var findings []string
+	for _, line := range strings.Split(response[loc[1]:], "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if sectionStart.MatchString(line) {
 			break
 		}
-		if issue.Severity == "HIGH" || issue.Severity == "MEDIUM" {
-			summary.KeyFindings = append(summary.KeyFindings, issue.Title)
+		if m := listItem.FindStringSubmatch(line); m != nil {
+			finding := strings.NewReplacer("**", "", "__", "", "`", "").Replace(m[1])
+			findings = append(findings, strings.TrimSpace(finding))
 		}
 	}
-
-	return summary
+	return findings
 }
 
 // Helper functions
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestTestMaturityIssue(t *testing.T) {
+	tests := []struct {
+		name      string
+		cs        *models.CodeStructure
+		wantOK    bool
+		wantTitle string
+		wantText  string
+	}{
+		{"no source files", &models.CodeStructure{}, false, "", ""},
+		{"no tests", &models.CodeStructure{SourceFiles: 8}, true, "No tests found", "None of the 8 source files"},
+		{"low", &models.CodeStructure{SourceFiles: 20, TestFiles: 2}, true, "Low testing maturity", "a 10% test-to-source ratio"},
+		{"moderate", &models.CodeStructure{SourceFiles: 10, TestFiles: 3}, true, "Moderate testing maturity", "a 30% test-to-source ratio"},
+		{"good", &models.CodeStructure{SourceFiles: 10, TestFiles: 6}, true, "Good testing maturity", "Found 6 test files for 10 source files"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issue, ok := testMaturityIssue(tt.cs)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if issue.Severity != models.SeverityInfo {
+				t.Errorf("severity = %q, want %q", issue.Severity, models.SeverityInfo)
+			}
+			if issue.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", issue.Title, tt.wantTitle)
+			}
+			if !strings.Contains(issue.Description, tt.wantText) {
+				t.Errorf("description %q doesn't contain %q", issue.Description, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	newInput := func() AnalysisInput {
+		return AnalysisInput{
+			RepoOwner:       "acme",
+			RepoName:        "app",
+			PrimaryLanguage: "Go",
+			README:          "# App",
+			READMESize:      5,
+			CodeStructure:   &models.CodeStructure{TotalFiles: 2, Files: []string{"a.go", "b.go"}, LanguageBreakdown: map[string]int{"Go": 2}},
+			CodeFiles:       []models.FileContent{{Path: "a.go", Content: "package a"}, {Path: "b.go", Content: "package b"}},
+			Activity:        &RepositoryActivity{OpenIssues: 3, OpenPullRequests: 1},
+		}
+	}
+	newService := func() *PerplexityService {
+		return NewPerplexityService("", "key", "sonar", nil, 0)
+	}
+	base := newService().CacheKey(newInput())
+
+	tests := []struct {
+		name     string
+		service  func(*PerplexityService)
+		input    func(*AnalysisInput)
+		wantSame bool
+	}{
+		{name: "identical run", wantSame: true},
+		{
+			name:     "activity counts changed",
+			input:    func(in *AnalysisInput) { in.Activity = &RepositoryActivity{OpenIssues: 40, OpenPullRequests: -1} },
+			wantSame: true,
+		},
+		{
+			name: "files fetched in another order",
+			input: func(in *AnalysisInput) {
+				in.CodeFiles = []models.FileContent{in.CodeFiles[1], in.CodeFiles[0]}
+			},
+			wantSame: true,
+		},
+		{name: "file edited", input: func(in *AnalysisInput) { in.CodeFiles[0].Content = "package a // edited" }},
+		{name: "file renamed", input: func(in *AnalysisInput) { in.CodeFiles[1].Path = "c.go" }},
+		{name: "README edited", input: func(in *AnalysisInput) { in.README = "# App v2" }},
+		{name: "metadata only", input: func(in *AnalysisInput) { in.MetadataOnly = true }},
+		{name: "language mapped to another model", service: func(s *PerplexityService) { s.languageModels["go"] = "sonar-pro" }},
+		{name: "token budget", service: func(s *PerplexityService) { s.SetTokenBudget(4000, 8000) }},
+		{name: "issue caps", service: func(s *PerplexityService) { _ = s.SetIssueCaps(map[string]int{"low": 5}) }},
+		{name: "key findings", service: func(s *PerplexityService) { _ = s.SetMaxKeyFindings(3) }},
+		{name: "system prompt", service: func(s *PerplexityService) { s.SetPrompts("Focus on security.", "") }},
+		{name: "user prompt", service: func(s *PerplexityService) { s.SetPrompts("", "Review this:\n"+PromptRepositoryPlaceholder) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, in := newService(), newInput()
+			if tt.service != nil {
+				tt.service(s)
+			}
+			if tt.input != nil {
+				tt.input(&in)
+			}
+			if same := s.CacheKey(in) == base; same != tt.wantSame {
+				t.Errorf("key unchanged = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestBuildPromptActivity(t *testing.T) {
+	tests := []struct {
+		name     string
+		activity *RepositoryActivity
+		want     []string
+		wantNot  []string
+	}{
+		{name: "unknown", wantNot: []string{"Open Issues", "Open Pull Requests"}},
+		{
+			name:     "pull requests counted apart",
+			activity: &RepositoryActivity{OpenIssues: 10, OpenPullRequests: 4},
+			want:     []string{"- **Open Issues**: 6\n", "- **Open Pull Requests**: 4\n"},
+		},
+		{
+			name:     "pull requests not counted",
+			activity: &RepositoryActivity{OpenIssues: 10, OpenPullRequests: -1},
+			want:     []string{"- **Open Issues and Pull Requests**: 10\n"},
+			wantNot:  []string{"- **Open Pull Requests**"},
+		},
+	}
+
+	s := NewPerplexityService("", "key", "sonar", nil, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt := s.buildPrompt(AnalysisInput{RepoOwner: "acme", RepoName: "app", Activity: tt.activity})
+			for _, want := range tt.want {
+				if !strings.Contains(prompt, want) {
+					t.Errorf("prompt doesn't contain %q", want)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(prompt, unwanted) {
+					t.Errorf("prompt contains %q", unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeRetriesTruncatedResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxTokens      int
+		retryMaxTokens int
+		wantRequests   []int // max_tokens of each request sent
+		wantFinish     string
+	}{
+		{"retried with a bigger budget", 1000, 4000, []int{1000, 4000}, "stop"},
+		{"no explicit limit", 0, 4000, []int{0}, models.FinishReasonLength},
+		{"retry budget not higher", 4000, 4000, []int{4000}, models.FinishReasonLength},
+		{"retry disabled", 1000, 0, []int{1000}, models.FinishReasonLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req PerplexityRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("decode request: %v", err)
+				}
+				requests = append(requests, req.MaxTokens)
+
+				// Only the first response is cut off
+				finish := "stop"
+				if len(requests) == 1 {
+					finish = models.FinishReasonLength
+				}
+				fmt.Fprintf(w, `{"usage": {"total_tokens": 10}, "choices": [{"message": {"content": "No issues."}, "finish_reason": %q}]}`, finish)
+			}))
+			defer server.Close()
+
+			s := NewPerplexityService(server.URL, "key", "sonar", nil, 0)
+			s.SetTokenBudget(tt.maxTokens, tt.retryMaxTokens)
+
+			result, err := s.Analyze(context.Background(), AnalysisInput{RepoOwner: "acme", RepoName: "app"})
+			if err != nil {
+				t.Fatalf("Analyze: %v", err)
+			}
+			if !reflect.DeepEqual(requests, tt.wantRequests) {
+				t.Errorf("requests with max_tokens %v, want %v", requests, tt.wantRequests)
+			}
+			if result.FinishReason != tt.wantFinish {
+				t.Errorf("FinishReason = %q, want %q", result.FinishReason, tt.wantFinish)
+			}
+			if want := 10 * len(tt.wantRequests); result.TokensUsed != want {
+				t.Errorf("TokensUsed = %d, want %d", result.TokensUsed, want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeTypedAIErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusUnauthorized, ErrAIAuth},
+		{http.StatusForbidden, ErrAIAuth},
+		{http.StatusTooManyRequests, ErrAIRateLimited},
+		{http.StatusInternalServerError, ErrAIServer},
+		{http.StatusServiceUnavailable, ErrAIServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprintf(w, `{"error": {"message": %q}}`, http.StatusText(tt.status))
+			}))
+			defer server.Close()
+
+			// No retries, so a 429 fails straight away
+			s := NewPerplexityService(server.URL, "key", "sonar", nil, 0)
+			_, err := s.Analyze(context.Background(), AnalysisInput{RepoOwner: "acme", RepoName: "app", README: "# app"})
+
+			var apiErr *AIAPIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("error = %v, want an AIAPIError with status %d", err, tt.status)
+			}
+			for _, kind := range []error{ErrAIAuth, ErrAIRateLimited, ErrAIServer} {
+				if got := errors.Is(err, kind); got != (kind == tt.want) {
+					t.Errorf("errors.Is(err, %v) = %v", kind, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeRetriesRateLimited(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error": {"message": "rate limited"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"usage": {"total_tokens": 10}, "choices": [{"message": {"content": "No issues."}, "finish_reason": "stop"}]}`)
+	}))
+	defer server.Close()
+
+	s := NewPerplexityService(server.URL, "key", "sonar", nil, 1)
+	start := time.Now()
+	if _, err := s.Analyze(context.Background(), AnalysisInput{RepoOwner: "acme", RepoName: "app"}); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("%d requests sent, want 2", requests)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the 1s Retry-After", elapsed)
+	}
+}
+
+func TestAIRetryWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"seconds", "5", 0, 5 * time.Second},
+		{"zero seconds", "0", 3, 0},
+		{"missing, first attempt", "", 0, aiBaseBackoff},
+		{"missing, doubles per attempt", "", 2, 4 * aiBaseBackoff},
+		{"missing, capped", "", 10, aiMaxBackoff},
+		{"garbage falls back to backoff", "soon", 1, 2 * aiBaseBackoff},
+		{"seconds capped", "3600", 0, aiMaxBackoff},
+		{"date in the past", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+		{"date capped", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 0, aiMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aiRetryWait(tt.retryAfter, tt.attempt); got != tt.want {
+				t.Errorf("aiRetryWait(%q, %d) = %s, want %s", tt.retryAfter, tt.attempt, got, tt.want)
+			}
+		})
+	}
+
+	// An HTTP date has second precision, so allow for the truncation
+	at := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if got := aiRetryWait(at, 0); got < 8*time.Second || got > 10*time.Second {
+		t.Errorf("aiRetryWait(%q, 0) = %s, want about 10s", at, got)
+	}
+}
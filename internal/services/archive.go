@@ -0,0 +1,272 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// ArchiveLimits bounds what ExtractArchive unpacks, so a crafted archive
+// (e.g. a zip bomb) can't exhaust memory.
+type ArchiveLimits struct {
+	MaxFiles      int   // most files in the archive
+	MaxTotalBytes int64 // most uncompressed bytes across all files
+}
+
+// Archive is a source tree extracted in memory from an uploaded archive.
+// Tree mirrors a GitHub tree so the same scoring and structure code applies.
+type Archive struct {
+	Tree     *GitHubTree
+	contents map[string]string // path -> content, for files small enough to analyze
+}
+
+// ExtractArchive unpacks a zip or tar.gz archive held in data. Entries with
+// absolute paths or ".." elements are rejected with ErrUnsafeArchivePath;
+// symlinks are skipped. A single top-level directory shared by every entry,
+// as in GitHub's source downloads, is stripped from paths.
+func ExtractArchive(data []byte, limits ArchiveLimits) (*Archive, error) {
+	var files map[string][]byte
+	var sizes map[string]int
+	var err error
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		files, sizes, err = extractZip(data, limits)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		files, sizes, err = extractTarGz(data, limits)
+	default:
+		return nil, ErrUnsupportedArchive
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := commonRootDir(sizes)
+	archive := &Archive{Tree: &GitHubTree{}, contents: make(map[string]string)}
+	dirs := make(map[string]bool)
+
+	for name, size := range sizes {
+		p := strings.TrimPrefix(name, prefix)
+		archive.Tree.Tree = append(archive.Tree.Tree, GitHubTreeEntry{Path: p, Type: "blob", Size: size})
+		if content, ok := files[name]; ok {
+			archive.contents[p] = string(content)
+		}
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	for dir := range dirs {
+		archive.Tree.Tree = append(archive.Tree.Tree, GitHubTreeEntry{Path: dir, Type: "tree"})
+	}
+	sort.Slice(archive.Tree.Tree, func(i, j int) bool {
+		return archive.Tree.Tree[i].Path < archive.Tree.Tree[j].Path
+	})
+
+	return archive, nil
+}
+
+// README returns the content of the archive's top-level README, if any.
+func (a *Archive) README() string {
+	var names []string
+	for p := range a.contents {
+		base := strings.ToLower(p)
+		if !strings.Contains(p, "/") && (base == "readme" || strings.HasPrefix(base, "readme.")) {
+			names = append(names, p)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	// Prefer README.md over README.txt and the like
+	sort.Slice(names, func(i, j int) bool {
+		mdI := strings.HasSuffix(strings.ToLower(names[i]), ".md")
+		mdJ := strings.HasSuffix(strings.ToLower(names[j]), ".md")
+		if mdI != mdJ {
+			return mdI
+		}
+		return names[i] < names[j]
+	})
+	return a.contents[names[0]]
+}
+
+// errBinaryFile marks a file left out of an analysis because its content is
+// binary.
+var errBinaryFile = errors.New("file is binary")
+
+// ArchiveTopFiles scores the archive's files with the same rules as
+// FetchTopFiles and returns the contents of the top maxFiles, with the files
+// that were skipped.
+func (s *GitHubService) ArchiveTopFiles(a *Archive, maxFiles int, scoring *models.ScoringConfig) ([]models.FileContent, []models.SkippedFile) {
+	files, skipped, _ := s.selectTopFiles(a.Tree, maxFiles, scoring, func(p string) (string, error) {
+		content, ok := a.contents[p]
+		if !ok {
+			// Oversized files never reach fetch, so the content was binary
+			return "", errBinaryFile
+		}
+		return content, nil
+	})
+	return files, skipped
+}
+
+// ArchiveREADME returns the archive's README truncated like GetREADME does,
+// with its original size.
+func (s *GitHubService) ArchiveREADME(a *Archive) (readme string, originalSize int) {
+	readme = a.README()
+	return truncateREADME(readme, len(readme), s.maxREADMEBytes), len(readme)
+}
+
+func extractZip(data []byte, limits ArchiveLimits) (map[string][]byte, map[string]int, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedArchive, err)
+	}
+
+	ex := newArchiveExtractor(limits)
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			// Directories are rebuilt from file paths; symlinks are skipped
+			if err := checkArchivePath(f.Name); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if err := ex.add(f.Name, int64(f.UncompressedSize64), func() (io.ReadCloser, error) {
+			return f.Open()
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ex.files, ex.sizes, nil
+}
+
+func extractTarGz(data []byte, limits ArchiveLimits) (map[string][]byte, map[string]int, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedArchive, err)
+	}
+	defer gz.Close()
+
+	ex := newArchiveExtractor(limits)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedArchive, err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			// Directories are rebuilt from file paths; links and devices are skipped
+			if err := checkArchivePath(hdr.Name); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if err := ex.add(hdr.Name, hdr.Size, func() (io.ReadCloser, error) {
+			return io.NopCloser(tr), nil
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ex.files, ex.sizes, nil
+}
+
+// archiveExtractor collects regular files from an archive while enforcing
+// its limits.
+type archiveExtractor struct {
+	limits ArchiveLimits
+	total  int64
+	files  map[string][]byte // content of files small enough to analyze
+	sizes  map[string]int    // size of every file
+}
+
+func newArchiveExtractor(limits ArchiveLimits) *archiveExtractor {
+	return &archiveExtractor{
+		limits: limits,
+		files:  make(map[string][]byte),
+		sizes:  make(map[string]int),
+	}
+}
+
+// add records one file. Content is only read for files no larger than
+// maxFileBytes, and never beyond that many bytes whatever the header says.
+func (e *archiveExtractor) add(name string, size int64, open func() (io.ReadCloser, error)) error {
+	if err := checkArchivePath(name); err != nil {
+		return err
+	}
+
+	if e.limits.MaxFiles > 0 && len(e.sizes) >= e.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrArchiveTooLarge, e.limits.MaxFiles)
+	}
+	e.total += size
+	if e.limits.MaxTotalBytes > 0 && e.total > e.limits.MaxTotalBytes {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", ErrArchiveTooLarge, e.limits.MaxTotalBytes)
+	}
+
+	name = path.Clean(name)
+	e.sizes[name] = int(size)
+	if size > maxFileBytes || isBinaryExtension(name) {
+		return nil
+	}
+
+	rc, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, maxFileBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(content) > maxFileBytes || isBinaryContent(string(content)) {
+		return nil
+	}
+	e.files[name] = content
+	return nil
+}
+
+// checkArchivePath rejects entry names that could escape the extraction
+// root (zip-slip): absolute paths, ".." elements, backslashes and NULs.
+func checkArchivePath(name string) error {
+	if name == "" || strings.ContainsAny(name, "\\\x00") || path.IsAbs(name) {
+		return fmt.Errorf("%w: %q", ErrUnsafeArchivePath, name)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return fmt.Errorf("%w: %q", ErrUnsafeArchivePath, name)
+		}
+	}
+	return nil
+}
+
+// commonRootDir returns "dir/" when every path lies under the same top-level
+// directory, or "" otherwise.
+func commonRootDir(sizes map[string]int) string {
+	root := ""
+	for name := range sizes {
+		i := strings.Index(name, "/")
+		if i < 0 {
+			return ""
+		}
+		if root == "" {
+			root = name[:i+1]
+		} else if name[:i+1] != root {
+			return ""
+		}
+	}
+	return root
+}
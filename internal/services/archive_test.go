@@ -0,0 +1,154 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	name    string
+	content string
+}
+
+func buildZip(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatalf("zip Create(%q): %v", e.name, err)
+		}
+		w.Write([]byte(e.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("tar WriteHeader(%q): %v", e.name, err)
+		}
+		tw.Write([]byte(e.content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	limits := ArchiveLimits{MaxFiles: 10, MaxTotalBytes: 1 << 20}
+
+	tests := []struct {
+		name      string
+		entries   []archiveEntry
+		limits    ArchiveLimits
+		wantErr   error
+		wantPaths []string
+	}{
+		{
+			name: "strips a shared root directory",
+			entries: []archiveEntry{
+				{"repo-main/main.go", "package main"},
+				{"repo-main/pkg/util.go", "package pkg"},
+			},
+			limits:    limits,
+			wantPaths: []string{"main.go", "pkg", "pkg/util.go"},
+		},
+		{
+			name:    "zip-slip with parent directory",
+			entries: []archiveEntry{{"../../etc/cron.d/evil", "x"}},
+			limits:  limits,
+			wantErr: ErrUnsafeArchivePath,
+		},
+		{
+			name:    "zip-slip nested in a path",
+			entries: []archiveEntry{{"repo/../../evil.go", "x"}},
+			limits:  limits,
+			wantErr: ErrUnsafeArchivePath,
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{{"/etc/passwd", "x"}},
+			limits:  limits,
+			wantErr: ErrUnsafeArchivePath,
+		},
+		{
+			name:    "backslash path",
+			entries: []archiveEntry{{`..\evil.go`, "x"}},
+			limits:  limits,
+			wantErr: ErrUnsafeArchivePath,
+		},
+		{
+			name:    "too many files",
+			entries: []archiveEntry{{"a.go", "a"}, {"b.go", "b"}, {"c.go", "c"}},
+			limits:  ArchiveLimits{MaxFiles: 2, MaxTotalBytes: 1 << 20},
+			wantErr: ErrArchiveTooLarge,
+		},
+		{
+			name:    "too many bytes uncompressed",
+			entries: []archiveEntry{{"a.go", strings.Repeat("a", 600)}, {"b.go", strings.Repeat("b", 600)}},
+			limits:  ArchiveLimits{MaxFiles: 10, MaxTotalBytes: 1000},
+			wantErr: ErrArchiveTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		for format, build := range map[string]func(*testing.T, []archiveEntry) []byte{"zip": buildZip, "tar.gz": buildTarGz} {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				archive, err := ExtractArchive(build(t, tt.entries), tt.limits)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("err = %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ExtractArchive: %v", err)
+				}
+
+				var paths []string
+				for _, entry := range archive.Tree.Tree {
+					paths = append(paths, entry.Path)
+				}
+				if strings.Join(paths, ",") != strings.Join(tt.wantPaths, ",") {
+					t.Errorf("paths = %v, want %v", paths, tt.wantPaths)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractArchiveOversizedFile(t *testing.T) {
+	big := strings.Repeat("x", maxFileBytes+1)
+	archive, err := ExtractArchive(buildZip(t, []archiveEntry{{"big.go", big}, {"small.go", "package small"}}), ArchiveLimits{})
+	if err != nil {
+		t.Fatalf("ExtractArchive: %v", err)
+	}
+
+	if _, ok := archive.contents["big.go"]; ok {
+		t.Error("content of a file over maxFileBytes was kept")
+	}
+	if archive.contents["small.go"] != "package small" {
+		t.Errorf("small.go content = %q", archive.contents["small.go"])
+	}
+}
+
+func TestExtractArchiveUnsupported(t *testing.T) {
+	if _, err := ExtractArchive([]byte("not an archive"), ArchiveLimits{}); !errors.Is(err, ErrUnsupportedArchive) {
+		t.Errorf("err = %v, want ErrUnsupportedArchive", err)
+	}
+}
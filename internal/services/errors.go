@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GitHub related errors
+var (
+	ErrEmptyRepository    = errors.New("repository is empty")
+	ErrGitHubRateLimited  = errors.New("GitHub API rate limit exceeded")
+	ErrGitHubUnauthorized = errors.New("GitHub authentication failed: invalid or expired token")
+	ErrGitHubForbidden    = errors.New("GitHub access forbidden")
+	ErrGitHubNotFound     = errors.New("repository not found or not accessible")
+	ErrFileTooLarge       = errors.New("file exceeds the size limit")
+)
+
+// Uploaded archive errors
+var (
+	ErrUnsupportedArchive = errors.New("archive is not a valid zip or tar.gz file")
+	ErrArchiveTooLarge    = errors.New("archive exceeds the size limits")
+	ErrUnsafeArchivePath  = errors.New("archive contains an unsafe path")
+)
+
+// AI provider related errors
+var (
+	ErrAIRateLimited = errors.New("AI provider rate limit exceeded")
+	ErrAIAuth        = errors.New("AI provider authentication failed")
+	ErrAIServer      = errors.New("AI provider server error")
+)
+
+// Analysis input errors
+var (
+	ErrNothingToAnalyze     = errors.New("nothing to analyze")
+	ErrInvalidAnalysisInput = errors.New("invalid analysis input")
+)
+
+// AnalysisInputError is returned by AnalysisInput.Validate. It unwraps to
+// ErrNothingToAnalyze or ErrInvalidAnalysisInput.
+type AnalysisInputError struct {
+	Field   string
+	Message string
+	kind    error
+}
+
+func (e *AnalysisInputError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%v: %s", e.kind, e.Message)
+	}
+	return fmt.Sprintf("%v: %s: %s", e.kind, e.Field, e.Message)
+}
+
+func (e *AnalysisInputError) Unwrap() error {
+	return e.kind
+}
+
+// GitHubAPIError is returned for non-2xx GitHub responses.
+// It unwraps to one of the ErrGitHub* sentinels when the status is recognised,
+// so callers can branch with errors.Is and read details with errors.As.
+type GitHubAPIError struct {
+	StatusCode int
+	Message    string
+	ResetAt    time.Time // Only set when rate limited
+	kind       error
+}
+
+func (e *GitHubAPIError) Error() string {
+	if e.kind == ErrGitHubRateLimited && !e.ResetAt.IsZero() {
+		return fmt.Sprintf("%v (resets at %s)", e.kind, e.ResetAt.Format(time.RFC3339))
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("GitHub API error (%d): %s", e.StatusCode, e.Message)
+	}
+	if e.kind != nil {
+		return e.kind.Error()
+	}
+	return fmt.Sprintf("GitHub API error: %d", e.StatusCode)
+}
+
+func (e *GitHubAPIError) Unwrap() error {
+	return e.kind
+}
+
+// AIAPIError is returned for non-200 responses from the AI provider.
+// Like GitHubAPIError, it unwraps to one of the ErrAI* sentinels when the
+// status is recognised.
+type AIAPIError struct {
+	StatusCode int
+	Message    string
+	kind       error
+}
+
+func (e *AIAPIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("Perplexity API error (%d): %s", e.StatusCode, e.Message)
+	}
+	if e.kind != nil {
+		return e.kind.Error()
+	}
+	return fmt.Sprintf("Perplexity API error: %d", e.StatusCode)
+}
+
+func (e *AIAPIError) Unwrap() error {
+	return e.kind
+}
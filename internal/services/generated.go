@@ -0,0 +1,51 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// generatedFileScore is the most a generated file scores, so hand-written
+// files are always fetched before it.
+const generatedFileScore = 5
+
+// generatedSuffixes are file name endings (lowercase) of well-known code
+// generators: protobuf and gRPC, gqlgen/oapi-codegen/mockgen style Go,
+// Kubernetes deepcopy, Dart build_runner and minified bundles.
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", "_pb2.py", "_pb2_grpc.py", "_pb.js", "_pb.d.ts", "_grpc_pb.js",
+	".gen.go", "_gen.go", "_generated.go", ".generated.ts", ".generated.js",
+	".g.dart", ".freezed.dart", ".min.js",
+}
+
+// generatedMarker matches the headers generators write, e.g. Go's
+// "// Code generated by protoc-gen-go. DO NOT EDIT." or "@generated".
+var generatedMarker = regexp.MustCompile(`(?m)^\W*(Code generated .*DO NOT EDIT|@generated\b|<auto-generated)`)
+
+// generatedHeaderBytes is how much of a file is searched for a generated
+// marker; generators put it at the top.
+const generatedHeaderBytes = 1024
+
+// isGeneratedPath reports whether path is named like the output of a code
+// generator.
+func isGeneratedPath(path string) bool {
+	lower := strings.ToLower(path)
+	if strings.HasPrefix(lower, "zz_generated") || strings.Contains(lower, "/zz_generated") {
+		return true
+	}
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGeneratedContent reports whether the start of content carries a
+// generated-code marker.
+func isGeneratedContent(content string) bool {
+	if len(content) > generatedHeaderBytes {
+		content = content[:generatedHeaderBytes]
+	}
+	return generatedMarker.MatchString(content)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// GitHubGist is a gist with the content of its files.
+type GitHubGist struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	HTMLURL     string `json:"html_url"`
+	Public      bool   `json:"public"`
+	Owner       *struct {
+		Login string `json:"login"`
+	} `json:"owner"` // nil for anonymous gists
+	Files map[string]GitHubGistFile `json:"files"`
+}
+
+// GitHubGistFile is one file of a gist. Content is empty and Truncated set
+// for files over GitHub's inline limit.
+type GitHubGistFile struct {
+	Filename  string `json:"filename"`
+	Language  string `json:"language"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated"`
+	Content   string `json:"content"`
+}
+
+// OwnerLogin returns the gist owner's login, or "anonymous".
+func (g *GitHubGist) OwnerLogin() string {
+	if g.Owner == nil || g.Owner.Login == "" {
+		return "anonymous"
+	}
+	return g.Owner.Login
+}
+
+// Tree lists the gist's files as a flat tree, so they can be scored and
+// summarized like a repository's.
+func (g *GitHubGist) Tree() *GitHubTree {
+	tree := &GitHubTree{}
+	for name, f := range g.Files {
+		tree.Tree = append(tree.Tree, GitHubTreeEntry{Path: name, Type: "blob", Size: f.Size})
+	}
+	sort.Slice(tree.Tree, func(i, j int) bool {
+		return tree.Tree[i].Path < tree.Tree[j].Path
+	})
+	return tree
+}
+
+// GetGist fetches a gist with its file contents.
+func (s *GitHubService) GetGist(ctx context.Context, gistID, token string) (*GitHubGist, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/gists/%s", s.baseURL, gistID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	s.setHeaders(req, token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch gist: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := s.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var gist GitHubGist
+	if err := json.NewDecoder(resp.Body).Decode(&gist); err != nil {
+		return nil, fmt.Errorf("failed to decode gist: %w", err)
+	}
+
+	return &gist, nil
+}
+
+// GistTopFiles scores the gist's files with the same rules as FetchTopFiles
+// and returns the contents of the top maxFiles, with the files that were
+// skipped. Truncated files are skipped as too large.
+func (s *GitHubService) GistTopFiles(g *GitHubGist, maxFiles int, scoring *models.ScoringConfig) ([]models.FileContent, []models.SkippedFile) {
+	files, skipped, _ := s.selectTopFiles(g.Tree(), maxFiles, scoring, func(p string) (string, error) {
+		f := g.Files[p]
+		if f.Truncated {
+			return "", ErrFileTooLarge
+		}
+		return f.Content, nil
+	})
+	return files, skipped
+}
+
+// GistREADME returns the gist's README file, if it has one, truncated like
+// GetREADME does, with its original size. With several, README.md is
+// preferred, then the first by name, so every run picks the same one.
+func (s *GitHubService) GistREADME(g *GitHubGist) (readme string, originalSize int) {
+	var names []string
+	for name := range g.Files {
+		lower := strings.ToLower(name)
+		if lower == "readme" || strings.HasPrefix(lower, "readme.") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", 0
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		iMD, jMD := strings.EqualFold(names[i], "readme.md"), strings.EqualFold(names[j], "readme.md")
+		if iMD != jMD {
+			return iMD
+		}
+		return names[i] < names[j]
+	})
+
+	f := g.Files[names[0]]
+	return truncateREADME(f.Content, len(f.Content), s.maxREADMEBytes), len(f.Content)
+}
@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestGistREADME(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string // content of the chosen file, which is its name
+	}{
+		{name: "none", files: []string{"main.go", "notes.txt"}},
+		{name: "only one", files: []string{"main.go", "readme.txt"}, want: "readme.txt"},
+		{name: "README.md preferred", files: []string{"README", "README.rst", "README.md", "readme.txt"}, want: "README.md"},
+		{name: "README.md in any case", files: []string{"README.adoc", "Readme.MD"}, want: "Readme.MD"},
+		{name: "else first by name", files: []string{"readme.txt", "README.rst", "README"}, want: "README"},
+		{name: "prefix alone isn't a README", files: []string{"readme_old.md", "README.txt"}, want: "README.txt"},
+	}
+
+	s := NewGitHubService(GitHubServiceConfig{MaxREADMEBytes: 1 << 10})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gist := &GitHubGist{Files: map[string]GitHubGistFile{}}
+			for _, name := range tt.files {
+				gist.Files[name] = GitHubGistFile{Filename: name, Content: name}
+			}
+
+			// Map order varies between runs; the choice mustn't
+			for i := 0; i < 20; i++ {
+				got, size := s.GistREADME(gist)
+				if got != tt.want || size != len(tt.want) {
+					t.Fatalf("GistREADME = %q (%d bytes), want %q", got, size, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -1,32 +1,139 @@
 package services
 
 import (
+	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rahul4469/github-analyzer/internal/models"
 )
 
+// maxFileBytes is the largest single file fetched for analysis.
+const maxFileBytes = 100000
+
+const (
+	// defaultMaxIdleConnsPerHost keeps enough connections to the API open
+	// for concurrent file fetches; Go's default keeps only 2.
+	defaultMaxIdleConnsPerHost = 16
+	// defaultIdleConnTimeout closes pooled connections unused this long.
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
 type GitHubService struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL        string
+	httpClient     *http.Client
+	timeouts       GitHubTimeouts
+	maxREADMEBytes int
+	maxPerLanguage int
+	excluded       []string
 }
 
-func NewGitHubService(baseURL string) *GitHubService {
+// GitHubServiceConfig holds settings for the GitHub API client.
+type GitHubServiceConfig struct {
+	BaseURL string
+
+	// HTTPTimeout is the transport-level cap on any single request.
+	HTTPTimeout time.Duration
+
+	// MaxIdleConnsPerHost and IdleConnTimeout size the keep-alive pool of
+	// connections to the API. Zero uses defaultMaxIdleConnsPerHost and
+	// defaultIdleConnTimeout.
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// Transport replaces the pooled transport built from the settings
+	// above, e.g. to route through a proxy. Nil builds the default.
+	Transport http.RoundTripper
+
+	// Timeouts are per-operation deadlines applied via the request context.
+	Timeouts GitHubTimeouts
+
+	// MaxREADMEBytes caps the README sent for analysis. Zero means no cap.
+	MaxREADMEBytes int
+
+	// MaxFilesPerLanguage caps how many files of one language are selected
+	// for analysis, so polyglot repositories get a representative spread.
+	// Zero means no cap.
+	MaxFilesPerLanguage int
+
+	// ExcludedLanguages are languages, as returned by detectLanguage, or
+	// extensions that are never selected and left out of the language
+	// breakdown, on top of those in each scoring profile.
+	ExcludedLanguages []string
+}
+
+// GitHubTimeouts holds per-operation deadlines. Zero means no extra deadline
+// beyond the HTTP client timeout.
+type GitHubTimeouts struct {
+	Metadata time.Duration
+	Tree     time.Duration
+	File     time.Duration
+	README   time.Duration
+}
+
+func DefaultGitHubServiceConfig(baseURL string) GitHubServiceConfig {
+	return GitHubServiceConfig{
+		BaseURL:             baseURL,
+		HTTPTimeout:         60 * time.Second,
+		MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     defaultIdleConnTimeout,
+		Timeouts: GitHubTimeouts{
+			Metadata: 10 * time.Second, // Small JSON payloads
+			Tree:     45 * time.Second, // Recursive trees of large repos are slow
+			File:     15 * time.Second,
+			README:   10 * time.Second,
+		},
+		MaxREADMEBytes: 2000,
+	}
+}
+
+func NewGitHubService(cfg GitHubServiceConfig) *GitHubService {
+	transport := cfg.Transport
+	if transport == nil {
+		transport = newPooledTransport(cfg.MaxIdleConnsPerHost, cfg.IdleConnTimeout)
+	}
+
 	return &GitHubService{
-		baseURL: baseURL,
+		baseURL: cfg.BaseURL,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   cfg.HTTPTimeout,
+			Transport: transport,
 		},
+		timeouts:       cfg.Timeouts,
+		maxREADMEBytes: cfg.MaxREADMEBytes,
+		maxPerLanguage: cfg.MaxFilesPerLanguage,
+		excluded:       cfg.ExcludedLanguages,
+	}
+}
+
+// newPooledTransport returns a copy of http.DefaultTransport that keeps up
+// to maxIdlePerHost connections alive per host, so concurrent requests to
+// the API reuse connections instead of dialing and handshaking each time.
+func newPooledTransport(maxIdlePerHost int, idleTimeout time.Duration) *http.Transport {
+	if maxIdlePerHost <= 0 {
+		maxIdlePerHost = defaultMaxIdleConnsPerHost
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleConnTimeout
 	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdlePerHost
+	transport.MaxIdleConns = max(transport.MaxIdleConns, maxIdlePerHost)
+	transport.IdleConnTimeout = idleTimeout
+	return transport
 }
 
 type GitHubRepository struct {
@@ -39,6 +146,10 @@ type GitHubRepository struct {
 	DefaultBranch   string `json:"default_branch"`
 	HTMLURL         string `json:"html_url"`
 	Private         bool   `json:"private"`
+	Size            int    `json:"size"` // in KB
+	// Open issues and pull requests together; GitHub doesn't tell them
+	// apart here, see GetOpenPullRequestCount
+	OpenIssuesCount int `json:"open_issues_count"`
 }
 
 type GitHubTreeEntry struct {
@@ -56,19 +167,22 @@ type GitHubTree struct {
 	URL       string            `json:"url"`
 	Tree      []GitHubTreeEntry `json:"tree"`
 	Truncated bool              `json:"truncated"`
+
+	// CommitSHA is the commit the tree was read at, set by GetRepositoryTree
+	CommitSHA string `json:"-"`
 }
 
-// GitHubContent represents file content from GitHub API.
-type GitHubContent struct {
-	Name        string `json:"name"`
-	Path        string `json:"path"`
-	SHA         string `json:"sha"`
-	Size        int    `json:"size"`
-	Type        string `json:"type"`
-	Content     string `json:"content"` // Base64 encoded
-	Encoding    string `json:"encoding"`
-	HTMLURL     string `json:"html_url"`
-	DownloadURL string `json:"download_url"`
+// GitHubLicense is the license GitHub detected for a repository.
+type GitHubLicense struct {
+	Key    string `json:"key"`
+	Name   string `json:"name"`
+	SPDXID string `json:"spdx_id"` // "NOASSERTION" when GitHub can't identify it
+}
+
+// gitHubLicenseFile is the response of GET /repos/{owner}/{repo}/license.
+type gitHubLicenseFile struct {
+	Path    string        `json:"path"`
+	License GitHubLicense `json:"license"`
 }
 
 type GitHubError struct {
@@ -77,6 +191,9 @@ type GitHubError struct {
 }
 
 func (s *GitHubService) GetRepository(ctx context.Context, owner, repo, token string) (*GitHubRepository, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
 	url := fmt.Sprintf("%s/repos/%s/%s", s.baseURL, owner, repo)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -104,15 +221,75 @@ func (s *GitHubService) GetRepository(ctx context.Context, owner, repo, token st
 	return &repository, nil
 }
 
+// GetRepositoryIfChanged fetches repository metadata with a conditional
+// request. If etag still matches, GitHub answers 304 (which doesn't count
+// against the rate limit) and notModified is true. newETag is the ETag to
+// send next time.
+func (s *GitHubService) GetRepositoryIfChanged(ctx context.Context, owner, repo, token, etag string) (repository *GitHubRepository, newETag string, notModified bool, err error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/repos/%s/%s", s.baseURL, owner, repo)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	s.setHeaders(req, token)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to fetch repository: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, true, nil
+	}
+
+	if err := s.checkResponse(resp); err != nil {
+		return nil, "", false, err
+	}
+
+	var result GitHubRepository
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, "", false, fmt.Errorf("failed to decode repository: %w", err)
+	}
+
+	return &result, resp.Header.Get("ETag"), false, nil
+}
+
+// GetRepositoryTree returns the tree of the default branch's latest commit.
 func (s *GitHubService) GetRepositoryTree(ctx context.Context, owner, repo, token string) (*GitHubTree, error) {
-	// First get the default branch
-	repoInfo, err := s.GetRepository(ctx, owner, repo, token)
+	return s.GetRepositoryTreeAt(ctx, owner, repo, "", token)
+}
+
+// GetRepositoryTreeAt returns the tree at ref, a branch, tag or commit SHA.
+// An empty ref uses the default branch.
+func (s *GitHubService) GetRepositoryTreeAt(ctx context.Context, owner, repo, ref, token string) (*GitHubTree, error) {
+	if ref == "" {
+		repoInfo, err := s.GetRepository(ctx, owner, repo, token)
+		if err != nil {
+			return nil, err
+		}
+		ref = repoInfo.DefaultBranch
+	}
+
+	// Pin the ref to a commit, so the tree can be traced back to it
+	commitSHA, err := s.GetCommitSHA(ctx, owner, repo, ref, token)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, cancel := withTimeout(ctx, s.timeouts.Tree)
+	defer cancel()
+
 	// Fetch the tree recursively
-	url := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1", s.baseURL, owner, repo, repoInfo.DefaultBranch)
+	url := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1", s.baseURL, owner, repo, commitSHA)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -135,45 +312,111 @@ func (s *GitHubService) GetRepositoryTree(ctx context.Context, owner, repo, toke
 	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
 		return nil, fmt.Errorf("failed to decode tree: %w", err)
 	}
+	tree.CommitSHA = commitSHA
 
 	return &tree, nil
 }
 
-// GetFileContent fetches the content of a single file.
-func (s *GitHubService) GetFileContent(ctx context.Context, owner, repo, path, token string) (*GitHubContent, error) {
+// GetCommitSHA resolves a branch, tag or commit reference to its commit SHA.
+func (s *GitHubService) GetCommitSHA(ctx context.Context, owner, repo, ref, token string) (string, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/repos/%s/%s/commits/%s", s.baseURL, owner, repo, ref)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	s.setHeaders(req, token)
+	// Answer with the bare SHA instead of the full commit
+	req.Header.Set("Accept", "application/vnd.github.sha")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch commit: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := s.checkResponse(resp); err != nil {
+		return "", err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 128))
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit SHA: %w", err)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// StreamFileContent fetches a single file as raw bytes, reading at most
+// maxBytes. It never holds the base64 JSON envelope of the contents API in
+// memory, so peak memory per file stays bounded by maxBytes. Larger files
+// return ErrFileTooLarge. An empty ref reads the default branch.
+func (s *GitHubService) StreamFileContent(ctx context.Context, owner, repo, path, ref, token string, maxBytes int) (string, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.File)
+	defer cancel()
+
 	url := fmt.Sprintf("%s/repos/%s/%s/contents/%s", s.baseURL, owner, repo, path)
+	if ref != "" {
+		url += "?ref=" + ref
+	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	s.setHeaders(req, token)
+	req.Header.Set("Accept", "application/vnd.github.raw")
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch file: %w", err)
+		return "", fmt.Errorf("failed to fetch file: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if err := s.checkResponse(resp); err != nil {
-		return nil, err
+		return "", err
 	}
 
-	var content GitHubContent
-	if err := json.NewDecoder(resp.Body).Decode(&content); err != nil {
-		return nil, fmt.Errorf("failed to decode content: %w", err)
+	// Reject early when GitHub tells us the size up front
+	if resp.ContentLength > int64(maxBytes) {
+		return "", ErrFileTooLarge
 	}
 
-	return &content, nil
+	var buf bytes.Buffer
+	if resp.ContentLength > 0 {
+		buf.Grow(int(resp.ContentLength))
+	}
+
+	// Read one byte past the cap to detect oversized bodies without a length
+	n, err := io.Copy(&buf, io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if n > int64(maxBytes) {
+		return "", ErrFileTooLarge
+	}
+
+	return buf.String(), nil
 }
 
-func (s *GitHubService) GetREADME(ctx context.Context, owner, repo, token string) (string, error) {
+// GetREADME returns the repository README, truncated to the configured cap.
+// originalSize is the README's full length in bytes, so callers can tell
+// whether (and by how much) it was cut. Only the cap and one more byte are
+// read, so when GitHub doesn't send a Content-Length, originalSize of a
+// truncated README is that many bytes.
+func (s *GitHubService) GetREADME(ctx context.Context, owner, repo, token string) (readme string, originalSize int, err error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.README)
+	defer cancel()
+
 	url := fmt.Sprintf("%s/repos/%s/%s/readme", s.baseURL, owner, repo)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	s.setHeaders(req, token)
@@ -181,25 +424,193 @@ func (s *GitHubService) GetREADME(ctx context.Context, owner, repo, token string
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch README: %w", err)
+		return "", 0, fmt.Errorf("failed to fetch README: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// README might not exist, that's okay
 	if resp.StatusCode == http.StatusNotFound {
-		return "", nil
+		return "", 0, nil
 	}
 
 	if err := s.checkResponse(resp); err != nil {
-		return "", err
+		return "", 0, err
+	}
+
+	// Read one byte past the cap, so a huge README is never held in memory
+	body := io.Reader(resp.Body)
+	if s.maxREADMEBytes > 0 {
+		body = io.LimitReader(resp.Body, int64(s.maxREADMEBytes)+1)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read README: %w", err)
+	}
+
+	// Past the cap, only the Content-Length tells the full size
+	size := len(content)
+	if resp.ContentLength > int64(size) {
+		size = int(resp.ContentLength)
+	}
+
+	return truncateREADME(string(content), size, s.maxREADMEBytes), size, nil
+}
+
+// GetLicense returns the repository's detected license, or nil if it has
+// no license file.
+func (s *GitHubService) GetLicense(ctx context.Context, owner, repo, token string) (*GitHubLicense, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/repos/%s/%s/license", s.baseURL, owner, repo)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	content, err := io.ReadAll(resp.Body)
+	s.setHeaders(req, token)
+
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to read README: %w", err)
+		return nil, fmt.Errorf("failed to fetch license: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// No license file is a normal answer, not an error
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if err := s.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var file gitHubLicenseFile
+	if err := json.NewDecoder(resp.Body).Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode license: %w", err)
+	}
+
+	return &file.License, nil
+}
+
+// GetOpenPullRequestCount returns how many pull requests are open, using
+// the search API. Search has its own, much lower rate limit, so callers
+// should treat a failure as a missing count rather than an error.
+func (s *GitHubService) GetOpenPullRequestCount(ctx context.Context, owner, repo, token string) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("q", fmt.Sprintf("repo:%s/%s is:pr is:open", owner, repo))
+	query.Set("per_page", "1")
+	reqURL := fmt.Sprintf("%s/search/issues?%s", s.baseURL, query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	s.setHeaders(req, token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search pull requests: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := s.checkResponse(resp); err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		TotalCount int `json:"total_count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode pull request search: %w", err)
 	}
 
-	return string(content), nil
+	return result.TotalCount, nil
+}
+
+// NewGitHubIssue is an issue to open in a repository.
+type NewGitHubIssue struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// CreatedGitHubIssue identifies an issue opened by CreateIssue.
+type CreatedGitHubIssue struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+// CreateIssue opens an issue in owner/repo as the token's user, which needs
+// write access to the repository's issues. Repositories with issues
+// disabled answer 410, returned as a *GitHubAPIError.
+func (s *GitHubService) CreateIssue(ctx context.Context, owner, repo, token string, issue NewGitHubIssue) (*CreatedGitHubIssue, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
+	body, err := json.Marshal(issue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode issue: %w", err)
+	}
+
+	reqURL := fmt.Sprintf("%s/repos/%s/%s/issues", s.baseURL, owner, repo)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	s.setHeaders(req, token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create issue: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := s.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var created CreatedGitHubIssue
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return nil, fmt.Errorf("failed to decode created issue: %w", err)
+	}
+
+	return &created, nil
+}
+
+// truncateREADME cuts a README to at most maxBytes (plus a short note),
+// keeping the top of the document. It prefers to cut at a section heading,
+// then a paragraph break, so the kept part reads cleanly. size is the full
+// README's length in bytes, which readme may already be cut short of.
+func truncateREADME(readme string, size, maxBytes int) string {
+	if maxBytes <= 0 || len(readme) <= maxBytes {
+		return readme
+	}
+
+	// Don't split a multi-byte character
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(readme[cut]) {
+		cut--
+	}
+	kept := readme[:cut]
+
+	// Only back off to a boundary if it keeps at least half the budget
+	for _, sep := range []string{"\n#", "\n\n", "\n"} {
+		if i := strings.LastIndex(kept, sep); i >= cut/2 {
+			kept = kept[:i]
+			break
+		}
+	}
+
+	kept = strings.TrimRight(kept, " \t\n")
+
+	return fmt.Sprintf("%s\n\n... (README truncated: showing %d of %d bytes)", kept, len(kept), max(size, len(readme)))
 }
 
 // FileImportance determines how important a file is for analysis.
@@ -208,6 +619,10 @@ type FileImportance struct {
 	Score    int
 	Language string
 	Category string // "entry", "config", "source", "test", "docs"
+	// Generated is set for files named like code generator output. They
+	// score lowest; a marker found in the content also sets it on the
+	// fetched models.FileContent.
+	Generated bool
 }
 
 // GetRepositoryFiles fetches actual source code from important files.
@@ -218,39 +633,128 @@ type FileImportance struct {
 // 2. Score files by importance
 // 3. Fetch top N files (respecting size/token limits)
 // 4. Return file contents for AI analysis
-func (s *GitHubService) GetRepositoryFiles(ctx context.Context, owner, repo, token string, maxFiles int) ([]models.FileContent, *models.CodeStructure, error) {
-	if maxFiles <= 0 {
-		maxFiles = 15
-	}
-
+//
+// A nil scoring profile uses models.DefaultScoringConfig.
+func (s *GitHubService) GetRepositoryFiles(ctx context.Context, owner, repo, token string, maxFiles int, scoring *models.ScoringConfig) ([]models.FileContent, []models.SkippedFile, *models.CodeStructure, error) {
 	// Get the complete tree
 	tree, err := s.GetRepositoryTree(ctx, owner, repo, token)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get repository tree: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to get repository tree: %w", err)
 	}
 
-	// Build code structure
-	codeStructure := s.buildCodeStructure(tree)
+	files, skipped := s.FetchTopFiles(ctx, owner, repo, token, tree, maxFiles, scoring)
+	return files, skipped, s.BuildCodeStructure(tree, scoring), nil
+}
+
+// FetchTopFiles scores the files in an already fetched tree and returns the
+// contents of the top maxFiles, read at the tree's commit. Files that are
+// too large, binary or can't be fetched are skipped and returned with the
+// reason.
+// A nil scoring profile uses models.DefaultScoringConfig.
+func (s *GitHubService) FetchTopFiles(ctx context.Context, owner, repo, token string, tree *GitHubTree, maxFiles int, scoring *models.ScoringConfig) ([]models.FileContent, []models.SkippedFile) {
+	// Stream the raw file content, never more than maxFileBytes
+	files, skipped, _ := s.selectTopFiles(tree, maxFiles, scoring, func(path string) (string, error) {
+		return s.StreamFileContent(ctx, owner, repo, path, tree.CommitSHA, token, maxFileBytes)
+	})
+	return files, skipped
+}
+
+// FileDecision records whether a scored file was selected for analysis and,
+// if not, why. Reason is one of the models.Skip* constants.
+type FileDecision struct {
+	Path      string `json:"path"`
+	Score     int    `json:"score"`
+	Language  string `json:"language,omitempty"`
+	Category  string `json:"category"`
+	Generated bool   `json:"generated,omitempty"`
+	Selected  bool   `json:"selected"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// SelectionParameters returns the analysis parameters files are selected
+// with for maxFiles and scoring, including the service's own limits. A nil
+// scoring profile is recorded as models.DefaultScoringConfig.
+func (s *GitHubService) SelectionParameters(maxFiles int, scoring *models.ScoringConfig) *models.AnalysisParameters {
+	if scoring == nil {
+		scoring = models.DefaultScoringConfig()
+	}
+	return &models.AnalysisParameters{
+		Scoring:             scoring,
+		MaxFiles:            maxFiles,
+		MaxFilesPerLanguage: s.maxPerLanguage,
+		MaxFileBytes:        maxFileBytes,
+		MaxREADMEBytes:      s.maxREADMEBytes,
+		ExcludedLanguages:   s.excluded,
+	}
+}
+
+// PreviewFileSelection scores the tree's files as FetchTopFiles would and
+// returns every scored file, in ranking order, with whether it would be
+// selected. No content is fetched: the size budget is estimated from the
+// tree, so files that would turn out binary or fail to fetch show as
+// selected.
+func (s *GitHubService) PreviewFileSelection(tree *GitHubTree, maxFiles int, scoring *models.ScoringConfig) []FileDecision {
+	_, _, decisions := s.selectTopFiles(tree, maxFiles, scoring, nil)
+	return decisions
+}
+
+// selectTopFiles scores the tree's files and loads the best ones with fetch
+// until maxFiles or the total size budget is reached. Once a language has
+// reached the per-language cap, its remaining files are passed over for the
+// next best of other languages. fetch may return ErrFileTooLarge or
+// errBinaryFile to have the file reported as such; a nil fetch is a dry run
+// that only returns the decisions.
+func (s *GitHubService) selectTopFiles(tree *GitHubTree, maxFiles int, scoring *models.ScoringConfig, fetch func(path string) (string, error)) ([]models.FileContent, []models.SkippedFile, []FileDecision) {
+	if maxFiles <= 0 {
+		maxFiles = models.DefaultMaxFiles
+	}
+	if scoring == nil {
+		scoring = models.DefaultScoringConfig()
+	}
 
 	// Score and prioritize files
-	scoredFiles := s.scoreFiles(tree.Tree)
+	scoredFiles := s.scoreFiles(tree.Tree, scoring)
 
-	// Sort by score (highest first)
-	sort.Slice(scoredFiles, func(i, j int) bool {
+	// Sort by score (highest first), keeping tree order for ties
+	sort.SliceStable(scoredFiles, func(i, j int) bool {
 		return scoredFiles[i].Score > scoredFiles[j].Score
 	})
 
 	// Fetch top files (respect size limits)
 	var files []models.FileContent
+	var skipped []models.SkippedFile
+	decisions := make([]FileDecision, 0, len(scoredFiles))
+	selected := 0
 	totalSize := 0
 	maxTotalSize := 500000 // ~500KB total to stay within token limits
+	perLanguage := make(map[string]int)
+
+	decide := func(sf FileImportance, reason string) {
+		decisions = append(decisions, FileDecision{
+			Path:      sf.Path,
+			Score:     sf.Score,
+			Language:  sf.Language,
+			Category:  sf.Category,
+			Generated: sf.Generated,
+			Selected:  reason == "",
+			Reason:    reason,
+		})
+	}
 
 	for _, sf := range scoredFiles {
-		if len(files) >= maxFiles {
-			break
+		if selected >= maxFiles {
+			decide(sf, models.SkipMaxFiles)
+			continue
 		}
 		if totalSize >= maxTotalSize {
-			break
+			decide(sf, models.SkipSizeBudget)
+			continue
+		}
+
+		// Files with no detected language are never capped
+		if s.maxPerLanguage > 0 && sf.Language != "" && perLanguage[sf.Language] >= s.maxPerLanguage {
+			decide(sf, models.SkipLanguageQuota)
+			continue
 		}
 
 		// Find the tree entry to get size
@@ -263,43 +767,59 @@ func (s *GitHubService) GetRepositoryFiles(ctx context.Context, owner, repo, tok
 		}
 
 		// Skip files that are too large individually
-		if fileSize > 100000 { // 100KB per file max
+		if fileSize > maxFileBytes {
+			skipped = append(skipped, models.SkippedFile{Path: sf.Path, Reason: models.SkipTooLarge})
+			decide(sf, models.SkipTooLarge)
 			continue
 		}
 
-		// Fetch the file content
-		content, err := s.GetFileContent(ctx, owner, repo, sf.Path, token)
-		if err != nil {
-			// Skip files we can't fetch, continue with others
-			continue
-		}
+		size := fileSize
+		if fetch != nil {
+			decoded, err := fetch(sf.Path)
+			if err != nil {
+				// Skip files we can't fetch, continue with others
+				reason := models.SkipFetchError
+				switch {
+				case errors.Is(err, ErrFileTooLarge):
+					reason = models.SkipTooLarge
+				case errors.Is(err, errBinaryFile):
+					reason = models.SkipBinary
+				}
+				skipped = append(skipped, models.SkippedFile{Path: sf.Path, Reason: reason})
+				decide(sf, reason)
+				continue
+			}
 
-		// Decode base64 content
-		decoded, err := s.decodeContent(content)
-		if err != nil {
-			continue
-		}
+			// Skip binary files
+			if isBinaryContent(decoded) {
+				skipped = append(skipped, models.SkippedFile{Path: sf.Path, Reason: models.SkipBinary})
+				decide(sf, models.SkipBinary)
+				continue
+			}
 
-		// Skip binary files
-		if isBinaryContent(decoded) {
-			continue
+			files = append(files, models.FileContent{
+				Path:      sf.Path,
+				Content:   decoded,
+				Language:  sf.Language,
+				Size:      len(decoded),
+				Generated: sf.Generated || isGeneratedContent(decoded),
+			})
+			size = len(decoded)
 		}
 
-		files = append(files, models.FileContent{
-			Path:     sf.Path,
-			Content:  decoded,
-			Language: sf.Language,
-			Size:     len(decoded),
-		})
-
-		totalSize += len(decoded)
+		decide(sf, "")
+		selected++
+		totalSize += size
+		perLanguage[sf.Language]++
 	}
 
-	return files, codeStructure, nil
+	return files, skipped, decisions
 }
 
-// buildCodeStructure creates a CodeStructure from the tree.
-func (s *GitHubService) buildCodeStructure(tree *GitHubTree) *models.CodeStructure {
+// BuildCodeStructure summarizes a repository tree. Excluded languages are
+// listed as files but not counted in the language breakdown or as tests or
+// sources. A nil scoring profile only applies the service's exclusions.
+func (s *GitHubService) BuildCodeStructure(tree *GitHubTree, scoring *models.ScoringConfig) *models.CodeStructure {
 	structure := &models.CodeStructure{
 		Directories:       []string{},
 		Files:             []string{},
@@ -314,18 +834,31 @@ func (s *GitHubService) buildCodeStructure(tree *GitHubTree) *models.CodeStructu
 			structure.TotalFiles++
 			structure.TotalSize += entry.Size
 
+			if s.isExcluded(entry.Path, scoring) {
+				continue
+			}
+
 			// Count by language
 			lang := detectLanguage(entry.Path)
 			if lang != "" {
 				structure.LanguageBreakdown[lang]++
 			}
+
+			// Split code into tests and sources for the testing signal
+			if lang != "" && !dataLanguages[lang] {
+				if models.IsTestPath(entry.Path) {
+					structure.TestFiles++
+				} else {
+					structure.SourceFiles++
+				}
+			}
 		}
 	}
 
 	return structure
 }
 
-func (s *GitHubService) scoreFiles(entries []GitHubTreeEntry) []FileImportance {
+func (s *GitHubService) scoreFiles(entries []GitHubTreeEntry, scoring *models.ScoringConfig) []FileImportance {
 	var scored []FileImportance
 
 	for _, entry := range entries {
@@ -334,18 +867,32 @@ func (s *GitHubService) scoreFiles(entries []GitHubTreeEntry) []FileImportance {
 			continue
 		}
 
+		// Never fetch media/binary blobs, whatever else matches them
+		if isBinaryExtension(entry.Path) {
+			continue
+		}
+
 		// Skip non-code files
 		if !isCodeFile(entry.Path) {
 			continue
 		}
 
-		score, category := calculateFileScore(entry.Path)
+		if s.isExcluded(entry.Path, scoring) {
+			continue
+		}
+
+		score, category := calculateFileScore(entry.Path, scoring)
 		if score > 0 {
+			generated := isGeneratedPath(entry.Path)
+			if generated {
+				score = min(score, generatedFileScore)
+			}
 			scored = append(scored, FileImportance{
-				Path:     entry.Path,
-				Score:    score,
-				Language: detectLanguage(entry.Path),
-				Category: category,
+				Path:      entry.Path,
+				Score:     score,
+				Language:  detectLanguage(entry.Path),
+				Category:  category,
+				Generated: generated,
 			})
 		}
 	}
@@ -353,7 +900,7 @@ func (s *GitHubService) scoreFiles(entries []GitHubTreeEntry) []FileImportance {
 	return scored
 }
 
-func calculateFileScore(path string) (int, string) {
+func calculateFileScore(path string, scoring *models.ScoringConfig) (int, string) {
 	name := filepath.Base(path)
 	dir := filepath.Dir(path)
 	ext := strings.ToLower(filepath.Ext(path))
@@ -362,77 +909,42 @@ func calculateFileScore(path string) (int, string) {
 	score := 0
 	category := "source"
 
+	// Lockfiles and the like are never worth the budget
+	for _, ignored := range scoring.IgnoredFiles {
+		if nameLower == ignored {
+			return 0, ""
+		}
+	}
+
 	// Entry point files (highest priority)
-	entryPoints := []string{"main.go", "main.py", "main.rs", "main.ts", "main.js",
-		"app.go", "app.py", "app.ts", "app.js", "index.ts", "index.js",
-		"server.go", "server.ts", "server.js", "cmd.go"}
-	for _, ep := range entryPoints {
+	for _, ep := range scoring.EntryPoints {
 		if nameLower == ep {
 			return 100, "entry"
 		}
 	}
 
 	// Config files (high priority - reveal project structure)
-	configFiles := []string{"go.mod", "go.sum", "package.json", "cargo.toml",
-		"requirements.txt", "pyproject.toml", "dockerfile", "docker-compose.yml",
-		"makefile", ".env.example", "config.yaml", "config.json", "tsconfig.json"}
-	for _, cf := range configFiles {
+	for _, cf := range scoring.ConfigFiles {
 		if nameLower == cf {
 			return 90, "config"
 		}
 	}
 
-	// Important directories
-	importantDirs := map[string]int{
-		"cmd":         85,
-		"internal":    80,
-		"pkg":         75,
-		"src":         75,
-		"lib":         70,
-		"api":         80,
-		"handlers":    85,
-		"controllers": 85,
-		"services":    80,
-		"models":      80,
-		"routes":      75,
-		"middleware":  75,
-		"utils":       60,
-		"helpers":     60,
-		"core":        80,
-	}
-
-	for importantDir, dirScore := range importantDirs {
-		if strings.Contains(strings.ToLower(dir), importantDir) {
+	// Important directories, matched by whole path segment so short names
+	// like "app" don't hit "mapper" (best match wins)
+	for _, segment := range strings.Split(strings.ToLower(dir), "/") {
+		if dirScore, ok := scoring.ImportantDirs[segment]; ok && dirScore > score {
 			score = dirScore
-			break
 		}
 	}
 
 	// Test files (lower priority but still useful)
-	if strings.Contains(nameLower, "_test.") || strings.Contains(nameLower, ".test.") ||
-		strings.Contains(nameLower, ".spec.") || strings.HasPrefix(nameLower, "test_") {
+	if models.IsTestPath(path) {
 		return max(score, 40), "test"
 	}
 
 	// Boost by file extension (code files)
-	extBoost := map[string]int{
-		".go":   20,
-		".py":   20,
-		".rs":   20,
-		".ts":   18,
-		".js":   15,
-		".tsx":  18,
-		".jsx":  15,
-		".java": 18,
-		".c":    15,
-		".cpp":  15,
-		".h":    10,
-		".rb":   15,
-		".php":  15,
-		".sql":  12,
-	}
-
-	if boost, ok := extBoost[ext]; ok {
+	if boost, ok := scoring.ExtensionBoost[ext]; ok {
 		score += boost
 	}
 
@@ -463,6 +975,7 @@ func isCodeFile(path string) bool {
 		".rb": true, ".php": true, ".swift": true, ".kt": true, ".scala": true,
 		".cs": true, ".vb": true, ".fs": true, ".clj": true, ".ex": true, ".exs": true,
 		".hs": true, ".ml": true, ".sql": true, ".sh": true, ".bash": true,
+		".vue": true, ".svelte": true, ".mjs": true, ".cjs": true,
 		".yaml": true, ".yml": true, ".json": true, ".toml": true, ".xml": true,
 	}
 
@@ -470,29 +983,63 @@ func isCodeFile(path string) bool {
 	return codeExtensions[ext]
 }
 
+// binaryExtensions lists media, archive and other binary formats that are
+// never worth a fetch. isBinaryContent remains the content-level backstop.
+var binaryExtensions = map[string]bool{
+	// Images
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true, ".ico": true,
+	".webp": true, ".tiff": true, ".psd": true, ".svgz": true,
+	// Fonts
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".eot": true,
+	// Audio/video
+	".mp3": true, ".mp4": true, ".wav": true, ".ogg": true, ".webm": true, ".mov": true,
+	".avi": true, ".flac": true,
+	// Archives
+	".zip": true, ".tar": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true,
+	".7z": true, ".rar": true, ".jar": true, ".war": true,
+	// Documents
+	".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
+	// Compiled/binary artifacts
+	".exe": true, ".dll": true, ".so": true, ".dylib": true, ".a": true, ".o": true,
+	".class": true, ".pyc": true, ".wasm": true, ".bin": true, ".dat": true, ".db": true,
+	".sqlite": true,
+}
+
+// isBinaryExtension checks if a file's extension marks it as a binary/media blob.
+func isBinaryExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return binaryExtensions[ext]
+}
+
 // detectLanguage returns the programming language based on file extension.
+// dataLanguages are detected languages that hold data rather than code, and
+// so count as neither tests nor sources.
+var dataLanguages = map[string]bool{"YAML": true, "JSON": true}
+
 func detectLanguage(path string) string {
 	ext := strings.ToLower(filepath.Ext(path))
 	languages := map[string]string{
-		".go":    "Go",
-		".py":    "Python",
-		".js":    "JavaScript",
-		".ts":    "TypeScript",
-		".jsx":   "React",
-		".tsx":   "React TypeScript",
-		".rs":    "Rust",
-		".java":  "Java",
-		".c":     "C",
-		".cpp":   "C++",
-		".h":     "C/C++ Header",
-		".rb":    "Ruby",
-		".php":   "PHP",
-		".swift": "Swift",
-		".kt":    "Kotlin",
-		".sql":   "SQL",
-		".sh":    "Shell",
-		".yaml":  "YAML",
-		".json":  "JSON",
+		".go":     "Go",
+		".py":     "Python",
+		".js":     "JavaScript",
+		".ts":     "TypeScript",
+		".jsx":    "React",
+		".tsx":    "React TypeScript",
+		".vue":    "Vue",
+		".svelte": "Svelte",
+		".rs":     "Rust",
+		".java":   "Java",
+		".c":      "C",
+		".cpp":    "C++",
+		".h":      "C/C++ Header",
+		".rb":     "Ruby",
+		".php":    "PHP",
+		".swift":  "Swift",
+		".kt":     "Kotlin",
+		".sql":    "SQL",
+		".sh":     "Shell",
+		".yaml":   "YAML",
+		".json":   "JSON",
 	}
 
 	if lang, ok := languages[ext]; ok {
@@ -501,20 +1048,22 @@ func detectLanguage(path string) string {
 	return ""
 }
 
-// decodeContent decodes base64 content from GitHub API.
-func (s *GitHubService) decodeContent(content *GitHubContent) (string, error) {
-	if content.Encoding != "base64" {
-		return content.Content, nil
+// isExcluded reports whether path's language or extension is excluded by
+// the service or the scoring profile, which may be nil.
+func (s *GitHubService) isExcluded(path string, scoring *models.ScoringConfig) bool {
+	excluded := s.excluded
+	if scoring != nil {
+		excluded = append(excluded[:len(excluded):len(excluded)], scoring.ExcludedLanguages...)
 	}
 
-	// GitHub returns base64 with newlines, need to remove them
-	cleaned := strings.ReplaceAll(content.Content, "\n", "")
-	decoded, err := base64.StdEncoding.DecodeString(cleaned)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode base64: %w", err)
+	lang := detectLanguage(path)
+	ext := filepath.Ext(path)
+	for _, e := range excluded {
+		if (lang != "" && strings.EqualFold(e, lang)) || (ext != "" && strings.EqualFold(e, ext)) {
+			return true
+		}
 	}
-
-	return string(decoded), nil
+	return false
 }
 
 // isBinaryContent checks if content appears to be binary.
@@ -540,6 +1089,14 @@ func isBinaryContent(content string) bool {
 	return false
 }
 
+// withTimeout bounds ctx by d. A zero d leaves ctx unchanged.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
 func (s *GitHubService) setHeaders(req *http.Request, token string) {
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("User-Agent", "GitHub-Analyzer/1.0")
@@ -550,6 +1107,7 @@ func (s *GitHubService) setHeaders(req *http.Request, token string) {
 }
 
 // checkResponse checks for API errors in the response.
+// Non-2xx responses are returned as *GitHubAPIError.
 func (s *GitHubService) checkResponse(resp *http.Response) error {
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return nil
@@ -557,24 +1115,78 @@ func (s *GitHubService) checkResponse(resp *http.Response) error {
 
 	body, _ := io.ReadAll(resp.Body)
 
+	apiErr := &GitHubAPIError{StatusCode: resp.StatusCode}
+
 	var ghErr GitHubError
 	if err := json.Unmarshal(body, &ghErr); err == nil && ghErr.Message != "" {
-		return fmt.Errorf("GitHub API error (%d): %s", resp.StatusCode, ghErr.Message)
+		// Repos with no commits have no tree to fetch
+		if isEmptyRepositoryResponse(resp.StatusCode, ghErr.Message) {
+			return ErrEmptyRepository
+		}
+		apiErr.Message = ghErr.Message
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	switch {
+	case isRateLimited(resp, apiErr.Message):
+		apiErr.kind = ErrGitHubRateLimited
+		apiErr.ResetAt = rateLimitReset(resp)
+	case resp.StatusCode == http.StatusUnauthorized:
+		apiErr.kind = ErrGitHubUnauthorized
+	case resp.StatusCode == http.StatusForbidden:
+		apiErr.kind = ErrGitHubForbidden
+	case resp.StatusCode == http.StatusNotFound:
+		apiErr.kind = ErrGitHubNotFound
 	}
 
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		return fmt.Errorf("GitHub authentication failed: invalid or expired token")
-	case http.StatusForbidden:
-		return fmt.Errorf("GitHub API rate limit exceeded or access forbidden")
-	case http.StatusNotFound:
-		return fmt.Errorf("repository not found or not accessible")
-	default:
-		return fmt.Errorf("GitHub API error: %d - %s", resp.StatusCode, string(body))
+	return apiErr
+}
+
+// isRateLimited reports whether a 403/429 response is GitHub's rate limiter
+// rather than a permissions problem.
+func isRateLimited(resp *http.Response, message string) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		return true
 	}
+	return strings.Contains(strings.ToLower(message), "rate limit")
+}
+
+// rateLimitReset reads the reset time from the rate limit headers.
+// Returns the zero time if GitHub didn't send one.
+func rateLimitReset(resp *http.Response) time.Time {
+	if reset := resp.Header.Get("X-RateLimit-Reset"); reset != "" {
+		if unix, err := strconv.ParseInt(reset, 10, 64); err == nil {
+			return time.Unix(unix, 0)
+		}
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Now().Add(time.Duration(secs) * time.Second)
+		}
+	}
+	return time.Time{}
+}
+
+// isEmptyRepositoryResponse reports whether GitHub rejected the request
+// because the repository has no commits yet ("Git Repository is empty").
+func isEmptyRepositoryResponse(statusCode int, message string) bool {
+	if statusCode != http.StatusUnprocessableEntity && statusCode != http.StatusConflict {
+		return false
+	}
+	return strings.Contains(strings.ToLower(message), "repository is empty")
 }
 
 func (s *GitHubService) GetRateLimit(ctx context.Context, token string) (remaining, limit int, resetTime time.Time, err error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
 	url := fmt.Sprintf("%s/rate_limit", s.baseURL)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -590,6 +1202,10 @@ func (s *GitHubService) GetRateLimit(ctx context.Context, token string) (remaini
 	}
 	defer resp.Body.Close()
 
+	if err := s.checkResponse(resp); err != nil {
+		return 0, 0, time.Time{}, err
+	}
+
 	var result struct {
 		Resources struct {
 			Core struct {
@@ -610,6 +1226,47 @@ func (s *GitHubService) GetRateLimit(ctx context.Context, token string) (remaini
 		nil
 }
 
+// WaitForRateLimit checks that token has at least need core API requests
+// left. If it doesn't and the limit resets within maxWait, it waits for the
+// reset, unless ctx would be done first; otherwise it returns a
+// *GitHubAPIError matching ErrGitHubRateLimited with the reset time. When
+// the rate limit can't be read it returns nil and lets the requests decide.
+func (s *GitHubService) WaitForRateLimit(ctx context.Context, token string, need int, maxWait time.Duration) error {
+	remaining, _, resetAt, err := s.GetRateLimit(ctx, token)
+	if err != nil {
+		log.Printf("Failed to check GitHub rate limit: %v", err)
+		return nil
+	}
+	if remaining >= need {
+		return nil
+	}
+
+	// The reset time has second precision; wait a moment past it
+	wait := time.Until(resetAt) + time.Second
+	if wait <= 0 {
+		return nil
+	}
+
+	limited := &GitHubAPIError{ResetAt: resetAt, kind: ErrGitHubRateLimited}
+	if wait > maxWait {
+		return limited
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		return limited
+	}
+
+	log.Printf("GitHub rate limit low (%d left, %d needed), waiting %s for the reset", remaining, need, wait.Round(time.Second))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // max returns the larger of two integers.
 func max(a, b int) int {
 	if a > b {
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// appJWTLifetime is how long an App JWT is valid; GitHub allows at most
+	// 10 minutes.
+	appJWTLifetime = 9 * time.Minute
+	// appJWTClockSkew backdates the JWT issue time in case our clock is ahead
+	// of GitHub's.
+	appJWTClockSkew = 60 * time.Second
+	// installationTokenRefresh is how long before expiry a cached
+	// installation token is replaced, so requests in flight don't fail.
+	installationTokenRefresh = 5 * time.Minute
+)
+
+// GitHubAppConfig identifies a GitHub App and where it is installed.
+type GitHubAppConfig struct {
+	AppID         int64
+	PrivateKeyPEM []byte
+	// Installations maps repository owners (users or organizations) to the
+	// App's installation id on them. Owners are matched case-insensitively.
+	Installations map[string]int64
+}
+
+// GitHubAppAuth mints installation access tokens for a GitHub App, signing
+// the App's JWT with its private key. Tokens last an hour and are cached per
+// installation until shortly before they expire. It is safe for concurrent
+// use.
+type GitHubAppAuth struct {
+	github        *GitHubService
+	appID         int64
+	key           *rsa.PrivateKey
+	installations map[string]int64
+
+	mu     sync.Mutex // guards tokens
+	tokens map[int64]*cachedInstallationToken
+}
+
+// cachedInstallationToken is an installation's latest token. Its own lock
+// is held while minting, so concurrent requests for one installation share
+// the new token without waiting on other installations.
+type cachedInstallationToken struct {
+	mu    sync.Mutex
+	token installationToken
+}
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewGitHubAppAuth returns a GitHubAppAuth that requests tokens through
+// github. The private key may be PKCS#1, as GitHub issues it, or PKCS#8.
+func NewGitHubAppAuth(github *GitHubService, cfg GitHubAppConfig) (*GitHubAppAuth, error) {
+	if cfg.AppID <= 0 {
+		return nil, errors.New("GitHub App id is required")
+	}
+
+	key, err := parseRSAPrivateKey(cfg.PrivateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %w", err)
+	}
+
+	installations := make(map[string]int64, len(cfg.Installations))
+	for owner, id := range cfg.Installations {
+		installations[strings.ToLower(owner)] = id
+	}
+
+	return &GitHubAppAuth{
+		github:        github,
+		appID:         cfg.AppID,
+		key:           key,
+		installations: installations,
+		tokens:        make(map[int64]*cachedInstallationToken),
+	}, nil
+}
+
+// Installed reports whether the App has an installation for owner.
+func (a *GitHubAppAuth) Installed(owner string) bool {
+	_, ok := a.installations[strings.ToLower(owner)]
+	return ok
+}
+
+// Token returns an installation token for owner's repositories, minting a
+// new one when there is no cached token or it is about to expire.
+func (a *GitHubAppAuth) Token(ctx context.Context, owner string) (string, error) {
+	installationID, ok := a.installations[strings.ToLower(owner)]
+	if !ok {
+		return "", fmt.Errorf("GitHub App is not installed for %s", owner)
+	}
+
+	a.mu.Lock()
+	cached, ok := a.tokens[installationID]
+	if !ok {
+		cached = &cachedInstallationToken{}
+		a.tokens[installationID] = cached
+	}
+	a.mu.Unlock()
+
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if cached.token.Token != "" && time.Now().Before(cached.token.ExpiresAt.Add(-installationTokenRefresh)) {
+		return cached.token.Token, nil
+	}
+
+	jwt, err := a.signJWT()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := a.github.createInstallationToken(ctx, installationID, jwt)
+	if err != nil {
+		return "", err
+	}
+	cached.token = *token
+
+	return token.Token, nil
+}
+
+// signJWT returns the RS256 JWT that authenticates as the App itself.
+func (a *GitHubAppAuth) signJWT() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(a.appID, 10),
+	})
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
+
+// createInstallationToken exchanges an App JWT for an installation token.
+func (s *GitHubService) createInstallationToken(ctx context.Context, installationID int64, jwt string) (*installationToken, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Metadata)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", s.baseURL, installationID)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	s.setHeaders(req, jwt)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := s.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var token installationToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode installation token: %w", err)
+	}
+	if token.Token == "" {
+		return nil, errors.New("GitHub returned an empty installation token")
+	}
+
+	return &token, nil
+}
+
+// parseRSAPrivateKey decodes a PEM encoded RSA private key.
+func parseRSAPrivateKey(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return key, nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return key, pemBytes
+}
+
+// newTestApp returns a GitHubAppAuth installed for "acme" as installation
+// 42, minting tokens from a test server that answers with expiresIn left on
+// each token, and a count of the tokens minted.
+func newTestApp(t *testing.T, expiresIn time.Duration) (*GitHubAppAuth, *rsa.PrivateKey, *atomic.Int32) {
+	t.Helper()
+	key, pemBytes := newTestAppKey(t)
+
+	var minted atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/app/installations/42/access_tokens" {
+			http.NotFound(w, r)
+			return
+		}
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if err := verifyTestJWT(&key.PublicKey, jwt); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		n := minted.Add(1)
+		json.NewEncoder(w).Encode(installationToken{
+			Token:     fmt.Sprintf("token-%d", n),
+			ExpiresAt: time.Now().Add(expiresIn),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	app, err := NewGitHubAppAuth(NewGitHubService(DefaultGitHubServiceConfig(server.URL)), GitHubAppConfig{
+		AppID:         7,
+		PrivateKeyPEM: pemBytes,
+		Installations: map[string]int64{"Acme": 42},
+	})
+	if err != nil {
+		t.Fatalf("NewGitHubAppAuth: %v", err)
+	}
+	return app, key, &minted
+}
+
+// verifyTestJWT checks jwt is an RS256 JWT signed by pub for App 7 and
+// currently valid.
+func verifyTestJWT(pub *rsa.PublicKey, jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("JWT has %d parts, want 3", len(parts))
+	}
+
+	enc := base64.RawURLEncoding
+	signature, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+
+	var header map[string]string
+	if raw, err := enc.DecodeString(parts[0]); err != nil || json.Unmarshal(raw, &header) != nil {
+		return fmt.Errorf("malformed header")
+	}
+	if header["alg"] != "RS256" {
+		return fmt.Errorf("alg = %q, want RS256", header["alg"])
+	}
+
+	var claims struct {
+		IAT int64  `json:"iat"`
+		EXP int64  `json:"exp"`
+		ISS string `json:"iss"`
+	}
+	if raw, err := enc.DecodeString(parts[1]); err != nil || json.Unmarshal(raw, &claims) != nil {
+		return fmt.Errorf("malformed claims")
+	}
+	now := time.Now().Unix()
+	switch {
+	case claims.ISS != "7":
+		return fmt.Errorf("iss = %q, want 7", claims.ISS)
+	case claims.IAT > now:
+		return fmt.Errorf("iat is in the future")
+	case claims.EXP <= now || claims.EXP-claims.IAT > int64((10*time.Minute).Seconds()):
+		return fmt.Errorf("exp %d outside GitHub's 10 minute window", claims.EXP)
+	}
+	return nil
+}
+
+func TestGitHubAppSignJWT(t *testing.T) {
+	app, key, _ := newTestApp(t, time.Hour)
+
+	jwt, err := app.signJWT()
+	if err != nil {
+		t.Fatalf("signJWT: %v", err)
+	}
+	if err := verifyTestJWT(&key.PublicKey, jwt); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := newTestAppKey(t)
+	if err := verifyTestJWT(&other.PublicKey, jwt); err == nil {
+		t.Fatal("JWT verified with another key")
+	}
+}
+
+func TestGitHubAppToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		expiresIn  time.Duration
+		calls      int
+		wantToken  string
+		wantMinted int32
+	}{
+		{"mints on first use", time.Hour, 1, "token-1", 1},
+		{"reuses a fresh token", time.Hour, 3, "token-1", 1},
+		{"refreshes a token about to expire", installationTokenRefresh - time.Minute, 3, "token-3", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _, minted := newTestApp(t, tt.expiresIn)
+
+			var token string
+			for i := 0; i < tt.calls; i++ {
+				var err error
+				// Owners match case-insensitively
+				token, err = app.Token(context.Background(), "acme")
+				if err != nil {
+					t.Fatalf("Token: %v", err)
+				}
+			}
+			if token != tt.wantToken {
+				t.Errorf("token = %q, want %q", token, tt.wantToken)
+			}
+			if got := minted.Load(); got != tt.wantMinted {
+				t.Errorf("minted %d tokens, want %d", got, tt.wantMinted)
+			}
+		})
+	}
+}
+
+func TestGitHubAppTokenNotInstalled(t *testing.T) {
+	app, _, minted := newTestApp(t, time.Hour)
+
+	if app.Installed("other") {
+		t.Error("Installed(other) = true")
+	}
+	if _, err := app.Token(context.Background(), "other"); err == nil {
+		t.Error("Token for an owner without an installation succeeded")
+	}
+	if minted.Load() != 0 {
+		t.Error("minted a token for an owner without an installation")
+	}
+}
+
+func TestGitHubAppTokenConcurrent(t *testing.T) {
+	app, _, minted := newTestApp(t, time.Hour)
+
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			_, err := app.Token(context.Background(), "acme")
+			done <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+	}
+	if got := minted.Load(); got != 1 {
+		t.Errorf("concurrent requests minted %d tokens, want 1", got)
+	}
+}
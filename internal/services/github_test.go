@@ -0,0 +1,485 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestGitHubService returns a GitHubService whose API is handler.
+func newTestGitHubService(t *testing.T, handler http.HandlerFunc) *GitHubService {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewGitHubService(GitHubServiceConfig{BaseURL: server.URL})
+}
+
+func TestGetRepositoryOpenIssuesCount(t *testing.T) {
+	s := newTestGitHubService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/app" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name": "app", "full_name": "acme/app", "open_issues_count": 17}`))
+	})
+
+	repo, err := s.GetRepository(context.Background(), "acme", "app", "token")
+	if err != nil {
+		t.Fatalf("GetRepository: %v", err)
+	}
+	if repo.OpenIssuesCount != 17 {
+		t.Errorf("OpenIssuesCount = %d, want 17", repo.OpenIssuesCount)
+	}
+}
+
+func TestGetOpenPullRequestCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    int
+		wantErr bool
+	}{
+		{name: "counted", status: http.StatusOK, body: `{"total_count": 4, "items": [{}]}`, want: 4},
+		{name: "none open", status: http.StatusOK, body: `{"total_count": 0, "items": []}`},
+		{name: "search rate limited", status: http.StatusForbidden, body: `{"message": "API rate limit exceeded"}`, wantErr: true},
+		{name: "malformed", status: http.StatusOK, body: `{"total_count": "many"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			s := newTestGitHubService(t, func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query().Get("q")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			got, err := s.GetOpenPullRequestCount(context.Background(), "acme", "app", "token")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("count = %d, want %d", got, tt.want)
+			}
+			if query != "repo:acme/app is:pr is:open" {
+				t.Errorf("search query = %q", query)
+			}
+		})
+	}
+}
+
+func TestCreateIssue(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		wantNumber int
+		wantStatus int // of the *GitHubAPIError, when one is expected
+	}{
+		{name: "created", status: http.StatusCreated, response: `{"number": 31, "html_url": "https://github.com/acme/app/issues/31"}`, wantNumber: 31},
+		{name: "issues disabled", status: http.StatusGone, response: `{"message": "Issues are disabled for this repo"}`, wantStatus: http.StatusGone},
+		{name: "no write access", status: http.StatusForbidden, response: `{"message": "Resource not accessible by integration"}`, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got NewGitHubIssue
+			s := newTestGitHubService(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/repos/acme/app/issues" {
+					http.NotFound(w, r)
+					return
+				}
+				if r.Header.Get("Authorization") == "" {
+					t.Error("request has no Authorization header")
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decode request: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			})
+
+			created, err := s.CreateIssue(context.Background(), "acme", "app", "token", NewGitHubIssue{Title: "Bug", Body: "Details"})
+			if got.Title != "Bug" || got.Body != "Details" {
+				t.Errorf("sent issue %+v", got)
+			}
+			if tt.wantStatus != 0 {
+				var apiErr *GitHubAPIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+					t.Fatalf("error = %v, want a GitHubAPIError with status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateIssue: %v", err)
+			}
+			if created.Number != tt.wantNumber || created.HTMLURL == "" {
+				t.Errorf("created %+v, want number %d with a URL", created, tt.wantNumber)
+			}
+		})
+	}
+}
+
+func TestGetREADME(t *testing.T) {
+	big := "# Project\n\nIntro paragraph.\n\n## Usage\n\n" + strings.Repeat("x", 10000)
+
+	tests := []struct {
+		name          string
+		readme        string
+		status        int
+		contentLength bool // send a Content-Length; without one the body is chunked
+		maxBytes      int
+		wantSize      int
+		wantTruncated bool
+	}{
+		{name: "under the cap", readme: "# Small\n", status: http.StatusOK, maxBytes: 100, wantSize: 8},
+		{name: "no cap", readme: big, status: http.StatusOK, wantSize: len(big)},
+		{name: "over the cap with a length", readme: big, status: http.StatusOK, contentLength: true, maxBytes: 100, wantSize: len(big), wantTruncated: true},
+		{name: "over the cap without a length", readme: big, status: http.StatusOK, maxBytes: 100, wantSize: 101, wantTruncated: true},
+		{name: "no README", status: http.StatusNotFound, maxBytes: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestGitHubService(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(tt.readme)))
+				}
+				w.WriteHeader(tt.status)
+				// Flush before writing so a body without a length is chunked
+				w.(http.Flusher).Flush()
+				io.WriteString(w, tt.readme)
+			})
+			s.maxREADMEBytes = tt.maxBytes
+
+			readme, size, err := s.GetREADME(context.Background(), "acme", "app", "")
+			if err != nil {
+				t.Fatalf("GetREADME: %v", err)
+			}
+			if size != tt.wantSize {
+				t.Errorf("size = %d, want %d", size, tt.wantSize)
+			}
+			truncated := strings.Contains(readme, "README truncated")
+			if truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v: %q", truncated, tt.wantTruncated, readme)
+			}
+			if tt.wantTruncated {
+				if !strings.HasPrefix(readme, "# Project") || !strings.Contains(readme, fmt.Sprintf("of %d bytes", tt.wantSize)) {
+					t.Errorf("truncated README = %q", readme)
+				}
+			} else if readme != tt.readme {
+				t.Errorf("README = %q, want it unchanged", readme)
+			}
+		})
+	}
+}
+
+func TestTruncateREADME(t *testing.T) {
+	tests := []struct {
+		name     string
+		readme   string
+		size     int
+		maxBytes int
+		want     string
+	}{
+		{"fits", "# A\n\ntext", 9, 100, "# A\n\ntext"},
+		{"no cap", "# A\n\ntext", 9, 0, "# A\n\ntext"},
+		{"cut at a heading", "# A\n\nintro text\n# B\n\nmore text", 30, 20, "# A\n\nintro text\n\n... (README truncated: showing 15 of 30 bytes)"},
+		{"full size beyond what was read", "# A\n\nintro text\n# B\n\nmore", 5000, 20, "# A\n\nintro text\n\n... (README truncated: showing 15 of 5000 bytes)"},
+		{"no boundary in the second half", "abcdefghijklmnopqrstuvwxyz", 26, 10, "abcdefghij\n\n... (README truncated: showing 10 of 26 bytes)"},
+		{"multi-byte character kept whole", "ééééé", 10, 5, "éé\n\n... (README truncated: showing 4 of 10 bytes)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateREADME(tt.readme, tt.size, tt.maxBytes); got != tt.want {
+				t.Errorf("truncateREADME = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRepositoryTreeEmptyRepository(t *testing.T) {
+	tests := []struct {
+		name       string
+		commit     int // status of the commit lookup
+		tree       int // status of the tree fetch
+		message    string
+		wantEmpty  bool
+		wantStatus int
+	}{
+		{name: "tree 422", commit: http.StatusOK, tree: http.StatusUnprocessableEntity, message: "Git Repository is empty.", wantEmpty: true},
+		{name: "commit 409", commit: http.StatusConflict, message: "Git Repository is empty.", wantEmpty: true},
+		{name: "other 422", commit: http.StatusOK, tree: http.StatusUnprocessableEntity, message: "Validation Failed", wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestGitHubService(t, func(w http.ResponseWriter, r *http.Request) {
+				status := tt.tree
+				if strings.Contains(r.URL.Path, "/commits/") {
+					status = tt.commit
+				}
+				if status == http.StatusOK {
+					w.Write([]byte("0123456789abcdef0123456789abcdef01234567"))
+					return
+				}
+				w.WriteHeader(status)
+				fmt.Fprintf(w, `{"message": %q, "documentation_url": "https://docs.github.com/rest"}`, tt.message)
+			})
+
+			_, err := s.GetRepositoryTreeAt(context.Background(), "acme", "app", "main", "token")
+			if got := errors.Is(err, ErrEmptyRepository); got != tt.wantEmpty {
+				t.Fatalf("errors.Is(%v, ErrEmptyRepository) = %v, want %v", err, got, tt.wantEmpty)
+			}
+			var apiErr *GitHubAPIError
+			if tt.wantStatus != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus) {
+				t.Errorf("error = %v, want a GitHubAPIError with status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCheckResponseTypedErrors(t *testing.T) {
+	reset := time.Now().Add(20 * time.Minute).Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		status    int
+		headers   map[string]string
+		message   string
+		want      error
+		wantReset time.Time
+	}{
+		{name: "not found", status: http.StatusNotFound, message: "Not Found", want: ErrGitHubNotFound},
+		{name: "unauthorized", status: http.StatusUnauthorized, message: "Bad credentials", want: ErrGitHubUnauthorized},
+		{name: "forbidden", status: http.StatusForbidden, message: "Resource not accessible by integration", want: ErrGitHubForbidden},
+		{
+			name:   "primary rate limit",
+			status: http.StatusForbidden, message: "API rate limit exceeded for user ID 1.",
+			headers: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(reset.Unix(), 10)},
+			want:    ErrGitHubRateLimited, wantReset: reset,
+		},
+		{
+			name:   "secondary rate limit",
+			status: http.StatusTooManyRequests, message: "You have exceeded a secondary rate limit.",
+			headers: map[string]string{"X-RateLimit-Reset": strconv.FormatInt(reset.Unix(), 10)},
+			want:    ErrGitHubRateLimited, wantReset: reset,
+		},
+		{name: "server error", status: http.StatusBadGateway, message: "Server Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestGitHubService(t, func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprintf(w, `{"message": %q}`, tt.message)
+			})
+
+			_, err := s.GetRepository(context.Background(), "acme", "app", "token")
+
+			var apiErr *GitHubAPIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want a *GitHubAPIError", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.status)
+			}
+			for _, kind := range []error{ErrGitHubNotFound, ErrGitHubUnauthorized, ErrGitHubForbidden, ErrGitHubRateLimited} {
+				if got := errors.Is(err, kind); got != (kind == tt.want) {
+					t.Errorf("errors.Is(err, %v) = %v", kind, got)
+				}
+			}
+			if !apiErr.ResetAt.Equal(tt.wantReset) {
+				t.Errorf("ResetAt = %v, want %v", apiErr.ResetAt, tt.wantReset)
+			}
+		})
+	}
+}
+
+// countingReader is an endless file body that records how much was read.
+type countingReader struct {
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestStreamFileContentStopsAtLimit(t *testing.T) {
+	const limit = 1024
+
+	tests := []struct {
+		name          string
+		contentLength int64 // -1 when GitHub doesn't say
+		wantRead      int64 // most bytes the body may be read for
+	}{
+		{"no content length", -1, limit + 1},
+		{"content length over the limit", 10 << 20, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &countingReader{}
+			s := NewGitHubService(GitHubServiceConfig{BaseURL: "http://github.test"})
+			s.httpClient = &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode:    http.StatusOK,
+					Header:        http.Header{},
+					Body:          io.NopCloser(body),
+					ContentLength: tt.contentLength,
+					Request:       r,
+				}, nil
+			})}
+
+			_, err := s.StreamFileContent(context.Background(), "acme", "app", "big.bin", "", "", limit)
+			if !errors.Is(err, ErrFileTooLarge) {
+				t.Fatalf("StreamFileContent = %v, want ErrFileTooLarge", err)
+			}
+			if body.read > tt.wantRead {
+				t.Errorf("read %d bytes of the body, want at most %d", body.read, tt.wantRead)
+			}
+		})
+	}
+}
+
+func TestPerOperationTimeouts(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Resolving the ref is quick; the tree and file are slow
+		if strings.Contains(r.URL.Path, "/commits/") {
+			fmt.Fprint(w, "abc")
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		if strings.Contains(r.URL.Path, "/git/trees/") {
+			fmt.Fprint(w, `{"sha": "abc", "tree": []}`)
+			return
+		}
+		fmt.Fprint(w, "package main")
+	}))
+	defer server.Close()
+
+	s := NewGitHubService(GitHubServiceConfig{
+		BaseURL:  server.URL,
+		Timeouts: GitHubTimeouts{Tree: 50 * time.Millisecond, File: 5 * time.Second},
+	})
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := s.GetRepositoryTreeAt(ctx, "acme", "app", "main", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetRepositoryTreeAt = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("tree fetch gave up after %s, want its own 50ms deadline", elapsed)
+	}
+
+	content, err := s.StreamFileContent(ctx, "acme", "app", "main.go", "main", "", 1024)
+	if err != nil {
+		t.Fatalf("StreamFileContent with a longer deadline: %v", err)
+	}
+	if content != "package main" {
+		t.Errorf("content = %q, want %q", content, "package main")
+	}
+}
+
+func TestWaitForRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining int
+		resetIn   time.Duration
+		maxWait   time.Duration
+		wantErr   error
+		minWait   time.Duration // how long the call must block
+	}{
+		{name: "enough left", remaining: 100, resetIn: time.Hour, maxWait: time.Minute},
+		{name: "waits for a near reset", remaining: 2, resetIn: time.Second, maxWait: 5 * time.Second, minWait: time.Second},
+		{name: "reset beyond the threshold", remaining: 2, resetIn: time.Hour, maxWait: time.Minute, wantErr: ErrGitHubRateLimited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset := time.Now().Add(tt.resetIn).Truncate(time.Second)
+			s := newTestGitHubService(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/rate_limit" {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprintf(w, `{"resources": {"core": {"limit": 5000, "remaining": %d, "reset": %d}}}`, tt.remaining, reset.Unix())
+			})
+
+			start := time.Now()
+			err := s.WaitForRateLimit(context.Background(), "token", 10, tt.maxWait)
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WaitForRateLimit = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed < tt.minWait {
+				t.Errorf("returned after %s, want at least %s", elapsed, tt.minWait)
+			}
+			if tt.wantErr != nil {
+				var apiErr *GitHubAPIError
+				if !errors.As(err, &apiErr) || !apiErr.ResetAt.Equal(reset) {
+					t.Errorf("error = %v, want a *GitHubAPIError resetting at %s", err, reset)
+				}
+				// Failing fast means not waiting for a reset an hour away
+				if elapsed > time.Second {
+					t.Errorf("failed after %s, want straight away", elapsed)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRepositoryTreeAtCapturesCommitSHA(t *testing.T) {
+	var paths []string
+	s := newTestGitHubService(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/repos/acme/app/commits/main":
+			fmt.Fprint(w, "abc123")
+		case "/repos/acme/app/git/trees/abc123":
+			fmt.Fprint(w, `{"sha": "def456", "tree": [{"path": "main.go", "type": "blob"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	tree, err := s.GetRepositoryTreeAt(context.Background(), "acme", "app", "main", "")
+	if err != nil {
+		t.Fatalf("GetRepositoryTreeAt: %v", err)
+	}
+	if tree.CommitSHA != "abc123" {
+		t.Errorf("CommitSHA = %q, want abc123", tree.CommitSHA)
+	}
+	// A known ref needs no repository lookup for the default branch
+	want := []string{"/repos/acme/app/commits/main", "/repos/acme/app/git/trees/abc123"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("requested %v, want %v", paths, want)
+	}
+}
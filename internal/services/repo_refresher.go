@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rahul4469/github-analyzer/internal/crypto"
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// refreshBatchSize caps how many repositories one refresh pass checks, so a
+// pass can't burn through a user's GitHub rate limit.
+const refreshBatchSize = 100
+
+// RepositoryRefresher periodically updates stored stars, forks and other
+// metadata of recently analyzed repositories.
+type RepositoryRefresher struct {
+	repositories *models.RepositoryService
+	github       *GitHubService
+	encryptor    *crypto.Encryptor
+	lookback     time.Duration // only refresh repositories analyzed this recently
+	interval     time.Duration
+}
+
+func NewRepositoryRefresher(repositories *models.RepositoryService, github *GitHubService, encryptor *crypto.Encryptor, interval, lookback time.Duration) *RepositoryRefresher {
+	return &RepositoryRefresher{
+		repositories: repositories,
+		github:       github,
+		encryptor:    encryptor,
+		lookback:     lookback,
+		interval:     interval,
+	}
+}
+
+// Refresh updates metadata for repositories analyzed within the lookback
+// window and not refreshed during the last interval. Conditional requests
+// keep unchanged repositories cheap; the pass stops at the first rate limit
+// error. Returns the number of repositories whose metadata changed.
+func (r *RepositoryRefresher) Refresh(ctx context.Context) (int, error) {
+	candidates, err := r.repositories.RefreshCandidates(ctx, time.Now().Add(-r.lookback), r.interval, refreshBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, c := range candidates {
+		token, err := r.encryptor.Decrypt(c.EncryptedToken)
+		if err != nil {
+			log.Printf("Repository refresh: failed to decrypt token for %s/%s: %v", c.Owner, c.Name, err)
+			continue
+		}
+
+		var etag string
+		if c.ETag != nil {
+			etag = *c.ETag
+		}
+
+		repoInfo, newETag, notModified, err := r.github.GetRepositoryIfChanged(ctx, c.Owner, c.Name, token, etag)
+		if err != nil {
+			if errors.Is(err, ErrGitHubRateLimited) {
+				return updated, err
+			}
+			log.Printf("Repository refresh: failed to fetch %s/%s: %v", c.Owner, c.Name, err)
+			continue
+		}
+
+		if notModified {
+			if err := r.repositories.MarkRefreshed(ctx, c.RepositoryID); err != nil {
+				return updated, err
+			}
+			continue
+		}
+
+		if err := r.repositories.UpdateMetadata(ctx, c.RepositoryID, &repoInfo.Description, &repoInfo.Language,
+			repoInfo.StargazersCount, repoInfo.ForksCount, repoInfo.Private, newETag); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, nil
+}
+
+// Start runs Refresh every interval in a background goroutine.
+// Returns a channel that can be closed to stop it.
+func (r *RepositoryRefresher) Start() chan struct{} {
+	stop := make(chan struct{})
+
+	refresh := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		count, err := r.Refresh(ctx)
+		cancel()
+
+		if err != nil {
+			log.Printf("Repository refresh error: %v", err)
+		} else if count > 0 {
+			log.Printf("Refreshed metadata for %d repositories", count)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				refresh()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+// secretPattern detects one kind of secret. When the pattern has a "value"
+// group only that part is masked, so the surrounding key name stays readable.
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// secretPatterns are matched in order; earlier, more specific patterns
+// redact first so generic ones don't mask the same text twice.
+var secretPatterns = []secretPattern{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"stripe_key", regexp.MustCompile(`\b[sr]k_live_[0-9a-zA-Z]{24,}\b`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"credential", regexp.MustCompile(`(?i)(?:api[_-]?key|secret|password|passwd|token|access[_-]?key)["']?\s*[:=]\s*["'](?P<value>[^"'\s]{8,})["']`)},
+}
+
+// RedactSecrets masks likely secrets (keys, tokens, passwords) in the file
+// contents and returns the redacted copies with the number of secrets masked.
+// The input slice is not modified.
+func RedactSecrets(files []models.FileContent) ([]models.FileContent, int) {
+	redacted := make([]models.FileContent, len(files))
+	total := 0
+	for i, file := range files {
+		content, n := redactContent(file.Content)
+		file.Content = content
+		redacted[i] = file
+		total += n
+	}
+	return redacted, total
+}
+
+// RedactText masks likely secrets in text, such as a README, and returns it
+// with the number of secrets masked.
+func RedactText(text string) (string, int) {
+	return redactContent(text)
+}
+
+// redactContent masks every secret in content.
+func redactContent(content string) (string, int) {
+	count := 0
+	for _, p := range secretPatterns {
+		mask := "[REDACTED:" + p.kind + "]"
+		valueIdx := p.re.SubexpIndex("value")
+
+		src := content
+		content = replaceAllSubmatchFunc(p.re, src, func(m []int) string {
+			count++
+			if valueIdx < 0 {
+				return mask
+			}
+			// Keep the text around the value, e.g. `api_key = "`
+			start, end := m[2*valueIdx], m[2*valueIdx+1]
+			if strings.HasPrefix(src[start:end], "[REDACTED:") {
+				count--
+				return src[m[0]:m[1]]
+			}
+			return src[m[0]:start] + mask + src[end:m[1]]
+		})
+	}
+	return content, count
+}
+
+// replaceAllSubmatchFunc is regexp.ReplaceAllStringFunc with access to the
+// submatch indexes of each match.
+func replaceAllSubmatchFunc(re *regexp.Regexp, s string, repl func(m []int) string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+
+	var out []byte
+	last := 0
+	for _, m := range matches {
+		out = append(out, s[last:m[0]]...)
+		out = append(out, repl(m)...)
+		last = m[1]
+	}
+	out = append(out, s[last:]...)
+	return string(out)
+}
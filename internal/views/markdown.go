@@ -0,0 +1,117 @@
+package views
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletItemPattern  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedItemPattern = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	boldPattern        = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+)
+
+// markdownToHTML renders the subset of Markdown AI responses use: headings,
+// paragraphs, bullet and numbered lists, fenced code blocks, inline code and
+// bold text. All text is HTML-escaped before any markup is added, so the
+// result is safe to embed even when s contains HTML of its own. Links and
+// images are left as plain text rather than risking javascript: URLs.
+func markdownToHTML(s string) template.HTML {
+	var out strings.Builder
+	var paragraph []string
+	list := "" // "ul" or "ol" while inside a list
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		flushParagraph()
+		if list != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			flushParagraph()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, template.HTMLEscapeString(lines[i]))
+			}
+			out.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>\n")
+			continue
+		}
+
+		if m := headingPattern.FindStringSubmatch(trimmed); m != nil {
+			flushParagraph()
+			closeList()
+			tag := "h" + string(rune('0'+len(m[1])))
+			out.WriteString("<" + tag + ">" + renderInline(m[2]) + "</" + tag + ">\n")
+			continue
+		}
+
+		if m := bulletItemPattern.FindStringSubmatch(line); m != nil {
+			openList("ul")
+			out.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+			continue
+		}
+		if m := orderedItemPattern.FindStringSubmatch(line); m != nil {
+			openList("ol")
+			out.WriteString("<li>" + renderInline(m[1]) + "</li>\n")
+			continue
+		}
+
+		if trimmed == "" {
+			flushParagraph()
+			closeList()
+			continue
+		}
+
+		closeList()
+		paragraph = append(paragraph, renderInline(trimmed))
+	}
+	flushParagraph()
+	closeList()
+
+	return template.HTML(out.String())
+}
+
+// renderInline escapes s and renders inline code spans and bold text.
+// Nothing inside a code span is formatted.
+func renderInline(s string) string {
+	parts := strings.Split(s, "`")
+	// An unmatched backtick is kept as text
+	if len(parts)%2 == 0 {
+		parts[len(parts)-2] += "`" + parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+	}
+
+	var out strings.Builder
+	for i, part := range parts {
+		escaped := template.HTMLEscapeString(part)
+		if i%2 == 1 {
+			out.WriteString("<code>" + escaped + "</code>")
+			continue
+		}
+		out.WriteString(boldPattern.ReplaceAllString(escaped, "<strong>$1</strong>"))
+	}
+	return out.String()
+}
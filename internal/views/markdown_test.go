@@ -0,0 +1,96 @@
+package views
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string // substrings of the output
+		notWant []string
+	}{
+		{
+			name:    "script tag is escaped",
+			in:      "<script>alert(1)</script>",
+			want:    []string{"&lt;script&gt;alert(1)&lt;/script&gt;"},
+			notWant: []string{"<script"},
+		},
+		{
+			name:    "script in a heading",
+			in:      "## Fix <script>alert(1)</script>",
+			want:    []string{"<h2>Fix &lt;script&gt;"},
+			notWant: []string{"<script"},
+		},
+		{
+			name:    "script in a list item",
+			in:      "- <img src=x onerror=alert(1)>",
+			want:    []string{"<li>&lt;img src=x onerror=alert(1)&gt;</li>"},
+			notWant: []string{"<img"},
+		},
+		{
+			name:    "script in a code block",
+			in:      "```html\n<script>alert(1)</script>\n```",
+			want:    []string{"<pre><code>&lt;script&gt;"},
+			notWant: []string{"<script"},
+		},
+		{
+			name:    "script in inline code",
+			in:      "Use `<script>` carefully",
+			want:    []string{"<code>&lt;script&gt;</code>"},
+			notWant: []string{"<script"},
+		},
+		{
+			name:    "script inside bold",
+			in:      "**<script>alert(1)</script>**",
+			want:    []string{"<strong>&lt;script&gt;"},
+			notWant: []string{"<script"},
+		},
+		{
+			name:    "attribute breakout in text",
+			in:      `"><svg onload=alert(1)>`,
+			want:    []string{"&#34;&gt;&lt;svg onload=alert(1)&gt;"},
+			notWant: []string{"<svg"},
+		},
+		{
+			name:    "javascript link stays text",
+			in:      "[click](javascript:alert(1))",
+			want:    []string{"[click](javascript:alert(1))"},
+			notWant: []string{"<a", "href"},
+		},
+		{
+			name: "supported markup",
+			in:   "# Title\n\nSome **bold** text\n\n1. one\n2. two",
+			want: []string{"<h1>Title</h1>", "<p>Some <strong>bold</strong> text</p>", "<ol>\n<li>one</li>\n<li>two</li>\n</ol>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(markdownToHTML(tt.in))
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output %q doesn't contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("output %q contains %q", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestUnsafeFuncsOptIn(t *testing.T) {
+	for name := range UnsafeFuncMap() {
+		if _, ok := DefaultFuncMap()[name]; ok {
+			t.Errorf("%s is in DefaultFuncMap", name)
+		}
+	}
+	if err := EnableUnsafeFuncs("notAFunc"); err == nil {
+		t.Error("EnableUnsafeFuncs accepted an unknown function")
+	}
+}
@@ -10,20 +10,35 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/rahul4469/github-analyzer/internal/context"
+	"github.com/rahul4469/github-analyzer/internal/models"
 )
 
 var TemplateFS fs.FS
 
+// csrfFieldName is the form field gorilla/csrf checks by default.
+const csrfFieldName = "gorilla.csrf.Token"
+
+// AutoReload re-parses templates from TemplateFS on every render, so edits
+// show up without a restart. Only enable it in development.
+var AutoReload bool
+
+// SignupsEnabled controls whether templates link to the signup page.
+var SignupsEnabled = true
+
 // Template wraps a parsed template with helper methods for rendering.
 type Template struct {
-	tmpl *template.Template
+	tmpl     *template.Template
+	patterns []string // page templates, kept for AutoReload
 }
 
 // TemplateData is the standard data structure passed to all templates.
 // It contains common fields that every page might need.
 type TemplateData struct {
 	// Current authenticated user (nil if not logged in)
-	CurrentUser interface{}
+	CurrentUser *models.User
 
 	// CSRF token for forms
 	CSRFToken string
@@ -48,7 +63,40 @@ type TemplateData struct {
 	IsDevelopment bool
 }
 
-// DefaultFuncMap returns the default template functions available in all templates.
+// unsafeFuncs are enabled with EnableUnsafeFuncs.
+var unsafeFuncs = template.FuncMap{}
+
+// UnsafeFuncMap returns the functions that mark a string as trusted HTML,
+// URL, CSS or JavaScript, bypassing html/template's escaping. Passing them
+// user or AI content is an XSS hole, so none are available unless enabled.
+func UnsafeFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"safeHTML": func(s string) template.HTML { return template.HTML(s) },
+		"safeURL":  func(s string) template.URL { return template.URL(s) },
+		"safeCSS":  func(s string) template.CSS { return template.CSS(s) },
+		"safeJS":   func(s string) template.JS { return template.JS(s) },
+	}
+}
+
+// EnableUnsafeFuncs makes the named functions from UnsafeFuncMap available
+// to templates parsed afterwards. Only use them on content the application
+// wrote itself, never on user or AI output; render AI output with markdown.
+func EnableUnsafeFuncs(names ...string) error {
+	available := UnsafeFuncMap()
+	for _, name := range names {
+		fn, ok := available[name]
+		if !ok {
+			return fmt.Errorf("unknown template function %q", name)
+		}
+		unsafeFuncs[name] = fn
+	}
+	return nil
+}
+
+// DefaultFuncMap returns the template functions available in all templates.
+// None of them can turn a string into trusted HTML: everything goes through
+// html/template's escaping, except csrfField, which escapes its token, and
+// markdown, which escapes its input before adding markup.
 func DefaultFuncMap() template.FuncMap {
 	return template.FuncMap{
 		// String manipulation
@@ -82,18 +130,15 @@ func DefaultFuncMap() template.FuncMap {
 		"contains": strings.Contains,
 		"join":     strings.Join,
 
-		// HTML helpers
-		"safeHTML": func(s string) template.HTML { return template.HTML(s) },
-		"safeURL":  func(s string) template.URL { return template.URL(s) },
-		"safeCSS":  func(s string) template.CSS { return template.CSS(s) },
-		"safeJS":   func(s string) template.JS { return template.JS(s) },
+		// CSRF: every POST form includes {{csrfField .CSRFToken}}
+		"csrfField": csrfField,
 
 		// Status/severity styling
 		"statusClass":   statusClass,
 		"severityClass": severityClass,
 		"severityIcon":  severityIcon,
 
-		// Markdown rendering (basic)
+		// Markdown rendering, sanitized; use it for AI output
 		"markdown": markdownToHTML,
 
 		// Default value
@@ -101,6 +146,9 @@ func DefaultFuncMap() template.FuncMap {
 
 		// Iteration helpers
 		"seq": seq,
+
+		// Feature flags
+		"signupsEnabled": func() bool { return SignupsEnabled },
 	}
 }
 
@@ -116,7 +164,7 @@ func DefaultFuncMap() template.FuncMap {
 //	// - templates/pages/home.gohtml
 func ParseFS(patterns ...string) (*Template, error) {
 	// Start with function map
-	tmpl := template.New("").Funcs(DefaultFuncMap())
+	tmpl := template.New("").Funcs(DefaultFuncMap()).Funcs(unsafeFuncs)
 
 	// Parse base layout first
 	basePath := "templates/layouts/base.gohtml"
@@ -165,7 +213,7 @@ func ParseFS(patterns ...string) (*Template, error) {
 		}
 	}
 
-	return &Template{tmpl: tmpl}, nil
+	return &Template{tmpl: tmpl, patterns: patterns}, nil
 }
 
 // MustParseFS is like ParseFS but panics on error.
@@ -180,15 +228,29 @@ func MustParseFS(patterns ...string) *Template {
 
 // Execute renders the template to the given writer with the provided data.
 func (t *Template) Execute(w io.Writer, data *TemplateData) error {
-	return t.tmpl.ExecuteTemplate(w, "base", data)
+	tmpl := t.tmpl
+	if AutoReload {
+		fresh, err := ParseFS(t.patterns...)
+		if err != nil {
+			return err
+		}
+		tmpl = fresh.tmpl
+	}
+	return tmpl.ExecuteTemplate(w, "base", data)
 }
 
 // ExecuteHTTP renders the template as an HTTP response.
 // It handles errors gracefully and sets appropriate headers.
 func (t *Template) ExecuteHTTP(w http.ResponseWriter, r *http.Request, data *TemplateData) {
-	// Set current path for nav highlighting
+	// Set current path for nav highlighting, and the user if the handler didn't
 	if data != nil {
 		data.CurrentPath = r.URL.Path
+		if data.CurrentUser == nil {
+			data.CurrentUser = context.GetUser(r.Context())
+		}
+		if data.CSRFToken == "" {
+			data.CSRFToken = csrf.Token(r)
+		}
 	}
 
 	// Render to buffer first to catch errors
@@ -210,6 +272,12 @@ func (t *Template) ExecuteHTTP(w http.ResponseWriter, r *http.Request, data *Tem
 func (t *Template) ExecuteHTTPWithStatus(w http.ResponseWriter, r *http.Request, status int, data *TemplateData) {
 	if data != nil {
 		data.CurrentPath = r.URL.Path
+		if data.CurrentUser == nil {
+			data.CurrentUser = context.GetUser(r.Context())
+		}
+		if data.CSRFToken == "" {
+			data.CSRFToken = csrf.Token(r)
+		}
 	}
 
 	buf := &bytes.Buffer{}
@@ -227,6 +295,12 @@ func (t *Template) ExecuteHTTPWithStatus(w http.ResponseWriter, r *http.Request,
 
 // Template function implementations
 
+// csrfField renders the hidden input gorilla/csrf reads the token from.
+func csrfField(token string) template.HTML {
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		csrfFieldName, template.HTMLEscapeString(token)))
+}
+
 func truncate(s string, length int) string {
 	if len(s) <= length {
 		return s
@@ -338,43 +412,42 @@ func statusClass(status string) string {
 	}
 }
 
-func severityClass(severity string) string {
-	switch strings.ToUpper(severity) {
-	case "HIGH":
+func severityClass(severity models.Severity) string {
+	sev, _ := models.ParseSeverity(string(severity))
+	switch sev {
+	case models.SeverityCritical:
+		return "bg-purple-100 text-purple-800 border-purple-200"
+	case models.SeverityHigh:
 		return "bg-red-100 text-red-800 border-red-200"
-	case "MEDIUM":
+	case models.SeverityMedium:
 		return "bg-orange-100 text-orange-800 border-orange-200"
-	case "LOW":
+	case models.SeverityLow:
 		return "bg-yellow-100 text-yellow-800 border-yellow-200"
-	case "INFO":
+	case models.SeverityInfo:
 		return "bg-blue-100 text-blue-800 border-blue-200"
 	default:
 		return "bg-gray-100 text-gray-800 border-gray-200"
 	}
 }
 
-func severityIcon(severity string) string {
-	switch strings.ToUpper(severity) {
-	case "HIGH":
+func severityIcon(severity models.Severity) string {
+	sev, _ := models.ParseSeverity(string(severity))
+	switch sev {
+	case models.SeverityCritical:
+		return "🟣"
+	case models.SeverityHigh:
 		return "🔴"
-	case "MEDIUM":
+	case models.SeverityMedium:
 		return "🟠"
-	case "LOW":
+	case models.SeverityLow:
 		return "🟡"
-	case "INFO":
+	case models.SeverityInfo:
 		return "🔵"
 	default:
 		return "⚪"
 	}
 }
 
-func markdownToHTML(s string) template.HTML {
-	// Basic markdown conversion - in production, use a proper markdown library
-	// This is a placeholder that just preserves newlines
-	s = strings.ReplaceAll(s, "\n", "<br>")
-	return template.HTML(s)
-}
-
 func defaultValue(value, defaultVal interface{}) interface{} {
 	if value == nil || value == "" || value == 0 {
 		return defaultVal
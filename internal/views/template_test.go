@@ -0,0 +1,34 @@
+package views
+
+import (
+	"testing"
+
+	"github.com/rahul4469/github-analyzer/internal/models"
+)
+
+func TestSeverityHelpers(t *testing.T) {
+	const fallbackClass, fallbackIcon = "bg-gray-100 text-gray-800 border-gray-200", "⚪"
+
+	seen := make(map[string]models.Severity)
+	for _, sev := range models.Severities {
+		class := severityClass(sev)
+		if class == fallbackClass {
+			t.Errorf("severityClass(%s) = the fallback class", sev)
+		}
+		if other, ok := seen[class]; ok {
+			t.Errorf("severityClass(%s) = severityClass(%s) = %q", sev, other, class)
+		}
+		seen[class] = sev
+
+		if icon := severityIcon(sev); icon == fallbackIcon {
+			t.Errorf("severityIcon(%s) = the fallback icon", sev)
+		}
+	}
+
+	if got, want := severityClass("critical"), severityClass(models.SeverityCritical); got != want {
+		t.Errorf("severityClass(critical) = %q, want %q", got, want)
+	}
+	if got := severityClass("URGENT"); got != fallbackClass {
+		t.Errorf("severityClass(URGENT) = %q, want the fallback", got)
+	}
+}
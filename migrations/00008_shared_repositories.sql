@@ -0,0 +1,79 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Repositories are stored once per GitHub URL; users are linked through user_repositories.
+CREATE TABLE user_repositories (
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    repository_id BIGINT NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    created_at    TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, repository_id)
+);
+
+CREATE INDEX idx_user_repositories_repository_id ON user_repositories(repository_id);
+
+-- GitHub owner and repository names are case-insensitive, so URLs that
+-- differ only in case are keyed as the same repository
+CREATE TEMP TABLE repository_keys ON COMMIT DROP AS
+SELECT id,
+       CASE WHEN github_url LIKE 'https://github.com/%' THEN LOWER(github_url) ELSE github_url END AS github_key
+FROM repositories;
+
+-- The oldest row for each key becomes the canonical record
+CREATE TEMP TABLE canonical_repositories ON COMMIT DROP AS
+SELECT github_key, MIN(id) AS id FROM repository_keys GROUP BY github_key;
+
+INSERT INTO user_repositories (user_id, repository_id, created_at)
+SELECT r.user_id, c.id, r.created_at
+FROM repositories r
+JOIN repository_keys k ON k.id = r.id
+JOIN canonical_repositories c ON c.github_key = k.github_key
+ON CONFLICT DO NOTHING;
+
+UPDATE analyses a
+SET repository_id = c.id
+FROM repository_keys k
+JOIN canonical_repositories c ON c.github_key = k.github_key
+WHERE a.repository_id = k.id AND k.id <> c.id;
+
+UPDATE code_structures cs
+SET repository_id = c.id
+FROM repository_keys k
+JOIN canonical_repositories c ON c.github_key = k.github_key
+WHERE cs.repository_id = k.id AND k.id <> c.id;
+
+DELETE FROM repositories r
+USING repository_keys k
+JOIN canonical_repositories c ON c.github_key = k.github_key
+WHERE r.id = k.id AND r.id <> c.id;
+
+UPDATE repositories r
+SET github_url = k.github_key
+FROM repository_keys k
+WHERE r.id = k.id AND r.github_url <> k.github_key;
+
+ALTER TABLE repositories DROP CONSTRAINT IF EXISTS repositories_user_id_github_url_key;
+ALTER TABLE repositories DROP COLUMN user_id;
+ALTER TABLE repositories ADD CONSTRAINT repositories_github_url_key UNIQUE (github_url);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Shared rows are reassigned to their earliest associated user
+ALTER TABLE repositories ADD COLUMN user_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+
+UPDATE repositories r
+SET user_id = ur.user_id
+FROM (
+    SELECT DISTINCT ON (repository_id) repository_id, user_id
+    FROM user_repositories
+    ORDER BY repository_id, created_at
+) ur
+WHERE ur.repository_id = r.id;
+
+DELETE FROM repositories WHERE user_id IS NULL;
+ALTER TABLE repositories ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE repositories DROP CONSTRAINT IF EXISTS repositories_github_url_key;
+ALTER TABLE repositories ADD CONSTRAINT repositories_user_id_github_url_key UNIQUE (user_id, github_url);
+CREATE INDEX idx_repositories_user_id ON repositories(user_id);
+
+DROP TABLE IF EXISTS user_repositories;
+-- +goose StatementEnd
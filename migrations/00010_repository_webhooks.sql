@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Each user who links a repository can register their own push webhook.
+-- The secret is encrypted with the same key as GitHub tokens.
+ALTER TABLE user_repositories ADD COLUMN webhook_secret TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_repositories DROP COLUMN IF EXISTS webhook_secret;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- deep fetches and analyzes source files, metadata only sends metadata + README + structure
+ALTER TABLE analyses ADD COLUMN mode VARCHAR(20) NOT NULL DEFAULT 'deep';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS mode;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Duration of each pipeline step, e.g. [{"step": "tree", "duration_ms": 420}, ...]
+ALTER TABLE analyses ADD COLUMN step_timings JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS step_timings;
+-- +goose StatementEnd
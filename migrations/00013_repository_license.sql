@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- SPDX id of the detected license; NULL when the repository has no license file
+ALTER TABLE repositories ADD COLUMN license TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE repositories DROP COLUMN IF EXISTS license;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- ETag of the last GitHub metadata response, sent back as If-None-Match
+ALTER TABLE repositories ADD COLUMN metadata_etag TEXT;
+ALTER TABLE repositories ADD COLUMN metadata_refreshed_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE repositories DROP COLUMN IF EXISTS metadata_refreshed_at;
+ALTER TABLE repositories DROP COLUMN IF EXISTS metadata_etag;
+-- +goose StatementEnd
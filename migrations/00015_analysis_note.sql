@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Free-form label the user gives an analysis, e.g. "pre-refactor baseline"
+ALTER TABLE analyses ADD COLUMN note TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS note;
+-- +goose StatementEnd
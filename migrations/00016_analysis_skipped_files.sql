@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Files selected for analysis that couldn't be included: [{path, reason}]
+ALTER TABLE analyses ADD COLUMN skipped_files JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS skipped_files;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE invite_codes (
+    id          BIGSERIAL PRIMARY KEY,
+    code        VARCHAR(32) UNIQUE NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    used_at     TIMESTAMP WITH TIME ZONE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE invite_codes;
+-- +goose StatementEnd
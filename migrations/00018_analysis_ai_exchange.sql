@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Raw AI request and response, kept only when ANALYSIS_CAPTURE_AI_EXCHANGE is on
+ALTER TABLE analyses ADD COLUMN ai_debug_request TEXT;
+ALTER TABLE analyses ADD COLUMN ai_debug_response TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS ai_debug_response;
+ALTER TABLE analyses DROP COLUMN IF EXISTS ai_debug_request;
+-- +goose StatementEnd
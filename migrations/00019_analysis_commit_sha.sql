@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Commit of the default branch the analysis read its files from
+ALTER TABLE analyses ADD COLUMN commit_sha VARCHAR(40);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS commit_sha;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Inputs an analysis ran with (repository, commit, mode, file budget and
+-- scoring profile), so it can be reproduced
+ALTER TABLE analyses ADD COLUMN parameters JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS parameters;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Why the AI stopped generating, e.g. "stop" or "length" when the response
+-- was cut off by the token limit
+ALTER TABLE analyses ADD COLUMN finish_reason TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS finish_reason;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Whether GitHub reported the repository as private when it was last fetched
+ALTER TABLE repositories ADD COLUMN private BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE repositories DROP COLUMN IF EXISTS private;
+-- +goose StatementEnd
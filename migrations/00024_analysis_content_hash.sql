@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- SHA-256 of each analyzed file and of the whole set, kept even when the
+-- file contents aren't stored so later analyses can detect drift
+ALTER TABLE analyses ADD COLUMN content_hash TEXT;
+ALTER TABLE analyses ADD COLUMN file_hashes JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS file_hashes;
+ALTER TABLE analyses DROP COLUMN IF EXISTS content_hash;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Hash of the AI input, so an analysis of identical input can reuse the
+-- result, and the analysis a reused result was copied from
+ALTER TABLE analyses ADD COLUMN cache_key TEXT;
+ALTER TABLE analyses ADD COLUMN cached_from BIGINT REFERENCES analyses(id) ON DELETE SET NULL;
+CREATE INDEX idx_analyses_cache_key ON analyses(user_id, cache_key) WHERE cache_key IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_analyses_cache_key;
+ALTER TABLE analyses DROP COLUMN IF EXISTS cached_from;
+ALTER TABLE analyses DROP COLUMN IF EXISTS cache_key;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The ref an analysis was requested at, and for the head of a before/after
+-- comparison, the analysis of the base ref it is compared with
+ALTER TABLE analyses ADD COLUMN requested_ref TEXT;
+ALTER TABLE analyses ADD COLUMN compare_base_id BIGINT REFERENCES analyses(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS compare_base_id;
+ALTER TABLE analyses DROP COLUMN IF EXISTS requested_ref;
+-- +goose StatementEnd
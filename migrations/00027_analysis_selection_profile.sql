@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The scoring profile and limits the analysis selected its files with, as
+-- in effect when it ran
+ALTER TABLE analyses ADD COLUMN selection_profile JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS selection_profile;
+-- +goose StatementEnd
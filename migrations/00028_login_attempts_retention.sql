@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Supports pruning attempts older than the lockout window
+CREATE INDEX idx_login_attempts_created_at ON login_attempts(created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_login_attempts_created_at;
+-- +goose StatementEnd
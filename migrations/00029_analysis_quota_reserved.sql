@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- API quota set aside while the analysis is pending or processing, so
+-- concurrent requests can't start more than the user's quota covers
+ALTER TABLE analyses ADD COLUMN quota_reserved INT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS quota_reserved;
+-- +goose StatementEnd
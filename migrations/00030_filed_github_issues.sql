@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- GitHub issues filed from an analysis's issues, numbered from 1 in the order
+-- they are stored. A row without a GitHub number is being filed.
+CREATE TABLE filed_github_issues (
+    analysis_id    INTEGER NOT NULL REFERENCES analyses(id) ON DELETE CASCADE,
+    issue_number   INTEGER NOT NULL,
+    github_number  INTEGER,
+    github_url     TEXT,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (analysis_id, issue_number)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS filed_github_issues;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The selection limits are part of the analysis parameters; the scoring
+-- profile already recorded there wins over the copy in selection_profile
+UPDATE analyses
+SET parameters = (selection_profile - 'scoring')
+    || COALESCE(parameters, jsonb_build_object('scoring', selection_profile -> 'scoring'))
+WHERE selection_profile IS NOT NULL;
+
+ALTER TABLE analyses DROP COLUMN selection_profile;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses ADD COLUMN selection_profile JSONB;
+
+UPDATE analyses
+SET selection_profile = parameters - 'repo_url' - 'ref' - 'mode'
+WHERE parameters ? 'max_file_bytes';
+-- +goose StatementEnd